@@ -1,10 +1,18 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"log/slog"
 
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/auth/jwt"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
 	httpHandler "github.com/domenicoop/go-clean-architecture-blueprint/internal/handler/http"
+	inmemoryPublisher "github.com/domenicoop/go-clean-architecture-blueprint/internal/publisher/inmemory"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/publisher/webhook"
 	"github.com/domenicoop/go-clean-architecture-blueprint/internal/repository/inmemory"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/repository/postgres"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/repository/sqlite"
 	"github.com/domenicoop/go-clean-architecture-blueprint/internal/service"
 )
 
@@ -14,19 +22,185 @@ type application struct {
 	config config
 	logger *slog.Logger
 
+	// db is the database connection pool, nil for the in-memory backend.
+	db *sql.DB
+
+	// services
+	entityService  service.EntityService
+	webhookService service.WebhookService
+	apiKeyService  service.APIKeyService
+	eventRelay     service.EventRelay
+
 	// handlers
-	entityHandler *httpHandler.EntityHandler
+	entityHandler  *httpHandler.EntityHandler
+	webhookHandler *httpHandler.WebhookHandler
+	apiKeyHandler  *httpHandler.APIKeyHandler
+	entityStream   *httpHandler.EntityStream
+
+	// middlewares
+	idempotency *httpHandler.Idempotency
+	tenants     *httpHandler.TenantResolver
+
+	// authenticator is nil when authentication is disabled.
+	authenticator *httpHandler.Authenticator
+
+	// rateLimiter is nil when rate limiting by client is disabled, and
+	// ipRateLimiter when rate limiting by IP address is.
+	rateLimiter   *httpHandler.RateLimiter
+	ipRateLimiter *httpHandler.RateLimiter
 }
 
-func newApplication(cfg config, logger *slog.Logger) *application {
+func newApplication(cfg config, logger *slog.Logger) (*application, error) {
+	app := &application{
+		config: cfg,
+		logger: logger,
+	}
+
+	// Select the repository backend from the configuration.
+	var (
+		entityRepo   service.EntityRepository
+		outboxRepo   service.OutboxRepository
+		auditRepo    service.AuditRepository
+		webhookRepo  service.WebhookRepository
+		deliveryRepo service.DeliveryRepository
+		apiKeyRepo   service.APIKeyRepository
+		uow          service.UnitOfWork
+	)
+	switch cfg.db.driver {
+	case "postgres":
+		db, err := openPostgres(cfg.db)
+		if err != nil {
+			return nil, err
+		}
+		app.db = db
+		entityRepo = postgres.NewEntityRepository(db)
+		outboxRepo = postgres.NewOutboxRepository(db)
+		auditRepo = postgres.NewAuditRepository(db)
+		webhookRepo, deliveryRepo = postgres.NewWebhookRepository(db), postgres.NewDeliveryRepository(db)
+		apiKeyRepo = postgres.NewAPIKeyRepository(db)
+		uow = postgres.NewUnitOfWork(db)
+	case "sqlite":
+		db, err := openSQLite(cfg.db)
+		if err != nil {
+			return nil, err
+		}
+		app.db = db
+		entityRepo = sqlite.NewEntityRepository(db)
+		outboxRepo = sqlite.NewOutboxRepository(db)
+		auditRepo = sqlite.NewAuditRepository(db)
+		webhookRepo, deliveryRepo = sqlite.NewWebhookRepository(db), sqlite.NewDeliveryRepository(db)
+		apiKeyRepo = sqlite.NewAPIKeyRepository(db)
+		uow = sqlite.NewUnitOfWork(db)
+	default:
+		entities, outbox, audit := inmemory.NewEntityRepository(), inmemory.NewOutboxRepository(), inmemory.NewAuditRepository()
+		entityRepo, outboxRepo, auditRepo = entities, outbox, audit
+		uow = inmemory.NewUnitOfWork(entities, outbox, audit)
+		webhookRepo, deliveryRepo = inmemory.NewWebhookRepository(), inmemory.NewDeliveryRepository()
+		apiKeyRepo = inmemory.NewAPIKeyRepository()
+	}
+
+	authz := service.NewRoleAuthorizer()
+	app.webhookService = service.NewWebhookService(
+		webhookRepo,
+		deliveryRepo,
+		webhook.NewSender(nil),
+		service.WebhookRetryPolicy{
+			MaxAttempts: cfg.webhooks.maxAttempts,
+			BaseDelay:   cfg.webhooks.retryBaseDelay,
+			MaxDelay:    cfg.webhooks.retryMaxDelay,
+		},
+		authz,
+	)
+
+	app.entityStream = httpHandler.NewEntityStream(authz, logger, cfg.stream.logSize, cfg.stream.clientBuffer)
+
+	// The domain events of the outbox are scheduled for delivery to the
+	// registered webhooks, pushed to the entity stream, then published with
+	// the configured publisher. The first two are idempotent, so events
+	// published again after a failure of the publisher are not sent twice.
+	publisher := inmemoryPublisher.NewPublisher()
+	publisher.Subscribe(app.webhookService.Publish)
+	publisher.Subscribe(app.entityStream.Publish)
+	switch cfg.events.publisher {
+	case "webhook":
+		publisher.Subscribe(webhook.NewPublisher(cfg.events.webhookURL, nil).Publish)
+	default:
+		publisher.Subscribe(func(ctx context.Context, message *domain.EventMessage) error {
+			logger.Debug("event published", "id", message.ID, "type", message.Type, "entity_id", message.EntityID)
+			return nil
+		})
+	}
+
 	// Wire up dependencies: repository -> service -> handler
-	entityRepo := inmemory.NewEntityRepository()
-	entityService := service.NewEntityService(entityRepo)
-	entityHandler := httpHandler.NewEntityHandler(entityService, logger)
-
-	return &application{
-		config:        cfg,
-		logger:        logger,
-		entityHandler: entityHandler,
+	app.entityService = service.NewEntityService(entityRepo, uow, auditRepo, authz)
+	app.eventRelay = service.NewEventRelay(outboxRepo, publisher)
+	app.entityHandler = httpHandler.NewEntityHandler(app.entityService, logger, cfg.maxBodyBytes)
+	app.webhookHandler = httpHandler.NewWebhookHandler(app.webhookService, logger, cfg.maxBodyBytes)
+
+	app.apiKeyService = service.NewAPIKeyService(apiKeyRepo)
+	app.apiKeyHandler = httpHandler.NewAPIKeyHandler(app.apiKeyService, logger, cfg.maxBodyBytes)
+	app.idempotency = httpHandler.NewIdempotency(httpHandler.NewMemoryIdempotencyStore(), logger, cfg.idempotencyTTL, cfg.maxBodyBytes)
+	app.tenants = httpHandler.NewTenantResolver(cfg.tenancy.baseDomain, logger)
+
+	// Clients authenticate with bearer tokens, or with API keys minted by
+	// principals authenticated with bearer tokens.
+	if cfg.auth.enabled() {
+		verifier, err := newTokenVerifier(cfg.auth)
+		if err != nil {
+			app.close()
+			return nil, err
+		}
+		app.authenticator = httpHandler.NewAuthenticator([]httpHandler.AuthScheme{
+			{Name: "Bearer", Verifier: verifier},
+			{Name: "ApiKey", Verifier: app.apiKeyService},
+		}, logger)
+	} else {
+		logger.Warn("authentication is disabled: configure auth.hmacSecret or auth.jwksFile to enable it")
+	}
+
+	// Rate limits are kept in memory, so each instance allows the full rate.
+	if cfg.rateLimit.enabled() {
+		app.rateLimiter = httpHandler.NewRateLimiter(
+			httpHandler.NewMemoryRateLimitStore(),
+			httpHandler.RateLimit{Requests: cfg.rateLimit.requests, Period: cfg.rateLimit.period},
+			cfg.rateLimit.routes,
+			logger,
+		)
+	}
+	if cfg.rateLimit.ip.Requests > 0 {
+		app.ipRateLimiter = httpHandler.NewIPRateLimiter(httpHandler.NewMemoryRateLimitStore(), cfg.rateLimit.ip, logger)
+	}
+	if err := app.checkRateLimitRoutes(cfg.rateLimit.routes); err != nil {
+		app.close()
+		return nil, err
+	}
+
+	return app, nil
+}
+
+// newTokenVerifier creates the verifier of the JWT bearer tokens described by cfg.
+func newTokenVerifier(cfg authConfig) (*jwt.Verifier, error) {
+	jwtConfig := jwt.Config{
+		Secret:   []byte(cfg.hmacSecret),
+		Issuer:   cfg.issuer,
+		Audience: cfg.audience,
+		Leeway:   cfg.leeway,
+	}
+	if cfg.jwksFile != "" {
+		keys, err := jwt.LoadJWKS(cfg.jwksFile)
+		if err != nil {
+			return nil, err
+		}
+		jwtConfig.Keys = keys
+	}
+	return jwt.NewVerifier(jwtConfig)
+}
+
+// close releases the resources held by the application.
+func (app *application) close() {
+	if app.db != nil {
+		if err := app.db.Close(); err != nil {
+			app.logger.Error("failed to close database", "error", err)
+		}
 	}
 }
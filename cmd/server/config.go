@@ -1,29 +1,581 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/auth/jwt"
+	httpHandler "github.com/domenicoop/go-clean-architecture-blueprint/internal/handler/http"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/service"
+
+	"gopkg.in/yaml.v3"
 )
 
+// defaultConfigFile is read when CONFIG_FILE is not set.
+const defaultConfigFile = "configs/config.yaml"
+
 // config holds all the configuration for the application.
-// Values are read from environment variables.
+// Values are read from the config file, then overridden by environment variables.
 type config struct {
-	port string // Network port to listen on
-	env  string // Current operating environment (e.g., development, production)
+	port           string          // Network port to listen on
+	env            string          // Current operating environment (e.g., development, production)
+	maxBodyBytes   int64           // Largest accepted request body
+	idempotencyTTL time.Duration   // How long responses to idempotent requests are replayed
+	db             dbConfig        // Persistence backend settings
+	trash          trashConfig     // Retention of deleted entities
+	events         eventsConfig    // Publishing of domain events
+	webhooks       webhooksConfig  // Delivery of domain events to webhook subscriptions
+	stream         streamConfig    // Server-Sent Events stream of entity changes
+	auth           authConfig      // Authentication of API requests
+	tenancy        tenancyConfig   // Resolution of the tenant of API requests
+	rateLimit      rateLimitConfig // Limits on the rate of API requests of each client
+}
+
+// rateLimitConfig holds the limits on the rate of requests of each client.
+// Rate limiting by client is disabled when neither a default limit nor a route
+// limit is set; rate limiting by IP address, when its limit is not set.
+type rateLimitConfig struct {
+	requests int                              // Requests allowed per period to each client; zero means no default limit
+	period   time.Duration                    // Period in which the requests are allowed
+	routes   map[string]httpHandler.RateLimit // Limits of single routes, e.g. "POST /entities:batch"
+	ip       httpHandler.RateLimit            // Limit of each IP address, checked before authentication; zero requests mean no limit
+}
+
+// enabled reports whether the rate of requests of each client is limited.
+func (c rateLimitConfig) enabled() bool {
+	return c.requests > 0 || len(c.routes) > 0
+}
+
+// tenancyConfig holds the settings for resolving the tenant of requests that
+// are not authenticated as a principal of a tenant.
+type tenancyConfig struct {
+	baseDomain string // Domain whose subdomains name tenants, e.g. example.com; empty disables subdomains
+}
+
+// authConfig holds the settings for authenticating requests with JWT bearer
+// tokens. Authentication is disabled when neither a secret nor a key set is set.
+type authConfig struct {
+	hmacSecret string        // Verifies HS256 tokens
+	jwksFile   string        // JSON Web Key Set that verifies RS256 and ES256 tokens
+	issuer     string        // Expected iss claim, if set
+	audience   string        // Expected aud claim, if set
+	leeway     time.Duration // Tolerated clock skew
+}
+
+// enabled reports whether requests must be authenticated.
+func (c authConfig) enabled() bool {
+	return c.hmacSecret != "" || c.jwksFile != ""
+}
+
+// streamConfig holds the settings for the stream of entity changes.
+type streamConfig struct {
+	logSize      int // Events kept for clients that reconnect
+	clientBuffer int // Events buffered per client before a slow client is disconnected
 }
 
-// loadConfig loads configuration from environment variables.
-func loadConfig() config {
-	var cfg config
+// webhooksConfig holds the settings for delivering events to the registered webhooks.
+type webhooksConfig struct {
+	pollInterval   time.Duration // How often due deliveries are attempted
+	batchSize      int           // Largest number of deliveries attempted at once
+	maxAttempts    int           // Attempts after which a failing delivery is dead-lettered
+	retryBaseDelay time.Duration // Delay after the first failed attempt, doubled after each other one
+	retryMaxDelay  time.Duration // Longest delay between attempts
+}
+
+// eventsConfig holds the settings for publishing the domain events of the outbox.
+type eventsConfig struct {
+	publisher    string        // Event publisher: "inmemory" or "webhook"
+	webhookURL   string        // Receiver of the events, used by the webhook publisher
+	pollInterval time.Duration // How often the outbox is checked for new events
+	batchSize    int           // Largest number of events read from the outbox at once
+}
+
+// trashConfig holds the settings for purging deleted entities.
+type trashConfig struct {
+	retention     time.Duration // How long deleted entities can be restored
+	purgeInterval time.Duration // How often entities past the retention are purged
+}
+
+// dbConfig holds the settings for the persistence backend.
+type dbConfig struct {
+	driver   string // Repository backend: "inmemory", "postgres" or "sqlite"
+	path     string // Database file, used by the sqlite driver
+	host     string
+	port     int
+	user     string
+	password string
+	name     string
+	sslMode  string
+}
 
-	cfg.port = os.Getenv("PORT")
-	if cfg.port == "" {
-		cfg.port = "8080" // Default port
+// dsn returns the PostgreSQL connection string for the configured database.
+func (c dbConfig) dsn() string {
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(c.user, c.password),
+		Host:     fmt.Sprintf("%s:%d", c.host, c.port),
+		Path:     c.name,
+		RawQuery: url.Values{"sslmode": {c.sslMode}}.Encode(),
+	}
+	return u.String()
+}
+
+// fileConfig mirrors the layout of the YAML config file.
+type fileConfig struct {
+	Database struct {
+		Driver   string `yaml:"driver"`
+		Path     string `yaml:"path"`
+		Host     string `yaml:"host"`
+		Port     int    `yaml:"port"`
+		User     string `yaml:"user"`
+		Password string `yaml:"password"`
+		DBName   string `yaml:"dbname"`
+		SSLMode  string `yaml:"sslmode"`
+	} `yaml:"database"`
+	Server struct {
+		Port           int    `yaml:"port"`
+		MaxBodyBytes   int64  `yaml:"maxBodyBytes"`
+		IdempotencyTTL string `yaml:"idempotencyTTL"`
+	} `yaml:"server"`
+	Trash struct {
+		Retention     string `yaml:"retention"`
+		PurgeInterval string `yaml:"purgeInterval"`
+	} `yaml:"trash"`
+	Events struct {
+		Publisher    string `yaml:"publisher"`
+		WebhookURL   string `yaml:"webhookURL"`
+		PollInterval string `yaml:"pollInterval"`
+		BatchSize    int    `yaml:"batchSize"`
+	} `yaml:"events"`
+	Webhooks struct {
+		PollInterval   string `yaml:"pollInterval"`
+		BatchSize      int    `yaml:"batchSize"`
+		MaxAttempts    int    `yaml:"maxAttempts"`
+		RetryBaseDelay string `yaml:"retryBaseDelay"`
+		RetryMaxDelay  string `yaml:"retryMaxDelay"`
+	} `yaml:"webhooks"`
+	Stream struct {
+		LogSize      int `yaml:"logSize"`
+		ClientBuffer int `yaml:"clientBuffer"`
+	} `yaml:"stream"`
+	Auth struct {
+		HMACSecret string `yaml:"hmacSecret"`
+		JWKSFile   string `yaml:"jwksFile"`
+		Issuer     string `yaml:"issuer"`
+		Audience   string `yaml:"audience"`
+		Leeway     string `yaml:"leeway"`
+	} `yaml:"auth"`
+	Tenancy struct {
+		BaseDomain string `yaml:"baseDomain"`
+	} `yaml:"tenancy"`
+	RateLimit struct {
+		Requests int    `yaml:"requests"`
+		Period   string `yaml:"period"`
+		Routes   map[string]struct {
+			Requests int    `yaml:"requests"`
+			Period   string `yaml:"period"`
+		} `yaml:"routes"`
+		IP struct {
+			Requests int    `yaml:"requests"`
+			Period   string `yaml:"period"`
+		} `yaml:"ip"`
+	} `yaml:"rateLimit"`
+}
+
+// loadConfig loads configuration from the config file and environment variables.
+// A missing config file is not an error; built-in defaults are used instead.
+func loadConfig() (config, error) {
+	cfg := config{
+		port:           "8080",
+		env:            "development",
+		maxBodyBytes:   httpHandler.DefaultMaxBodyBytes,
+		idempotencyTTL: httpHandler.DefaultIdempotencyTTL,
+		db: dbConfig{
+			driver:  "inmemory",
+			path:    "data.db",
+			host:    "localhost",
+			port:    5432,
+			sslMode: "disable",
+		},
+		trash: trashConfig{
+			retention:     30 * 24 * time.Hour,
+			purgeInterval: time.Hour,
+		},
+		events: eventsConfig{
+			publisher:    "inmemory",
+			pollInterval: time.Second,
+			batchSize:    100,
+		},
+		webhooks: webhooksConfig{
+			pollInterval:   time.Second,
+			batchSize:      100,
+			maxAttempts:    service.DefaultWebhookRetryPolicy.MaxAttempts,
+			retryBaseDelay: service.DefaultWebhookRetryPolicy.BaseDelay,
+			retryMaxDelay:  service.DefaultWebhookRetryPolicy.MaxDelay,
+		},
+		stream: streamConfig{
+			logSize:      httpHandler.DefaultStreamLogSize,
+			clientBuffer: httpHandler.DefaultStreamClientBuffer,
+		},
+		auth: authConfig{
+			leeway: jwt.DefaultLeeway,
+		},
+		rateLimit: rateLimitConfig{
+			period: time.Minute,
+		},
+	}
+
+	path := os.Getenv("CONFIG_FILE")
+	if path == "" {
+		path = defaultConfigFile
+	}
+	if err := cfg.loadFile(path); err != nil {
+		return config{}, err
 	}
 
-	cfg.env = os.Getenv("ENV")
-	if cfg.env == "" {
-		cfg.env = "development"
+	if err := cfg.loadEnv(); err != nil {
+		return config{}, err
 	}
 
-	return cfg
+	// Route limits and the limit of IP addresses use the default period unless
+	// they have their own, whichever source set it.
+	for route, limit := range cfg.rateLimit.routes {
+		if limit.Period == 0 {
+			limit.Period = cfg.rateLimit.period
+			cfg.rateLimit.routes[route] = limit
+		}
+	}
+	if cfg.rateLimit.ip.Period == 0 {
+		cfg.rateLimit.ip.Period = cfg.rateLimit.period
+	}
+
+	switch cfg.db.driver {
+	case "inmemory", "postgres", "sqlite":
+	default:
+		return config{}, fmt.Errorf("config: unknown database driver %q", cfg.db.driver)
+	}
+
+	if cfg.maxBodyBytes <= 0 {
+		return config{}, fmt.Errorf("config: max body bytes must be positive, got %d", cfg.maxBodyBytes)
+	}
+	if cfg.idempotencyTTL <= 0 {
+		return config{}, fmt.Errorf("config: idempotency TTL must be positive, got %s", cfg.idempotencyTTL)
+	}
+	if cfg.trash.retention < 0 {
+		return config{}, fmt.Errorf("config: trash retention must not be negative, got %s", cfg.trash.retention)
+	}
+	if cfg.trash.purgeInterval <= 0 {
+		return config{}, fmt.Errorf("config: trash purge interval must be positive, got %s", cfg.trash.purgeInterval)
+	}
+
+	switch cfg.events.publisher {
+	case "inmemory":
+	case "webhook":
+		if cfg.events.webhookURL == "" {
+			return config{}, errors.New("config: the webhook event publisher needs a webhook URL")
+		}
+	default:
+		return config{}, fmt.Errorf("config: unknown event publisher %q", cfg.events.publisher)
+	}
+	if cfg.events.pollInterval <= 0 {
+		return config{}, fmt.Errorf("config: events poll interval must be positive, got %s", cfg.events.pollInterval)
+	}
+	if cfg.events.batchSize <= 0 {
+		return config{}, fmt.Errorf("config: events batch size must be positive, got %d", cfg.events.batchSize)
+	}
+	if cfg.webhooks.pollInterval <= 0 {
+		return config{}, fmt.Errorf("config: webhooks poll interval must be positive, got %s", cfg.webhooks.pollInterval)
+	}
+	if cfg.webhooks.batchSize <= 0 {
+		return config{}, fmt.Errorf("config: webhooks batch size must be positive, got %d", cfg.webhooks.batchSize)
+	}
+	if cfg.webhooks.maxAttempts <= 0 {
+		return config{}, fmt.Errorf("config: webhooks max attempts must be positive, got %d", cfg.webhooks.maxAttempts)
+	}
+	if cfg.webhooks.retryBaseDelay <= 0 || cfg.webhooks.retryMaxDelay < cfg.webhooks.retryBaseDelay {
+		return config{}, fmt.Errorf("config: webhooks retry delays must be positive and ordered, got %s and %s",
+			cfg.webhooks.retryBaseDelay, cfg.webhooks.retryMaxDelay)
+	}
+	if cfg.stream.logSize <= 0 {
+		return config{}, fmt.Errorf("config: stream log size must be positive, got %d", cfg.stream.logSize)
+	}
+	if cfg.stream.clientBuffer <= 0 {
+		return config{}, fmt.Errorf("config: stream client buffer must be positive, got %d", cfg.stream.clientBuffer)
+	}
+	if cfg.auth.leeway < 0 {
+		return config{}, fmt.Errorf("config: auth leeway must not be negative, got %s", cfg.auth.leeway)
+	}
+	if cfg.auth.hmacSecret != "" && len(cfg.auth.hmacSecret) < jwt.MinSecretLength {
+		return config{}, fmt.Errorf("config: auth HMAC secret must be at least %d bytes long, got %d", jwt.MinSecretLength, len(cfg.auth.hmacSecret))
+	}
+	if cfg.env == "production" && !cfg.auth.enabled() {
+		return config{}, errors.New("config: authentication must be configured in production")
+	}
+	if cfg.rateLimit.requests < 0 {
+		return config{}, fmt.Errorf("config: rate limit requests must not be negative, got %d", cfg.rateLimit.requests)
+	}
+	if cfg.rateLimit.period <= 0 {
+		return config{}, fmt.Errorf("config: rate limit period must be positive, got %s", cfg.rateLimit.period)
+	}
+	for route, limit := range cfg.rateLimit.routes {
+		method, pattern, ok := strings.Cut(route, " ")
+		if !ok || method == "" || !strings.HasPrefix(pattern, "/") {
+			return config{}, fmt.Errorf("config: rate limit route %q must be a method and a pattern, e.g. \"POST /entities:batch\"", route)
+		}
+		if limit.Requests < 0 || limit.Period <= 0 {
+			return config{}, fmt.Errorf("config: rate limit of %s must have non-negative requests and a positive period, got %d and %s",
+				route, limit.Requests, limit.Period)
+		}
+	}
+	if cfg.rateLimit.ip.Requests < 0 || cfg.rateLimit.ip.Period <= 0 {
+		return config{}, fmt.Errorf("config: rate limit of IP addresses must have non-negative requests and a positive period, got %d and %s",
+			cfg.rateLimit.ip.Requests, cfg.rateLimit.ip.Period)
+	}
+
+	return cfg, nil
+}
+
+// loadFile applies the values set in the YAML file at path.
+func (cfg *config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("config: failed to read %s: %w", path, err)
+	}
+
+	var fc fileConfig
+	if err := yaml.Unmarshal(data, &fc); err != nil {
+		return fmt.Errorf("config: failed to parse %s: %w", path, err)
+	}
+
+	if fc.Server.Port != 0 {
+		cfg.port = strconv.Itoa(fc.Server.Port)
+	}
+	if fc.Server.MaxBodyBytes != 0 {
+		cfg.maxBodyBytes = fc.Server.MaxBodyBytes
+	}
+	if err := setDuration(&cfg.idempotencyTTL, fc.Server.IdempotencyTTL); err != nil {
+		return fmt.Errorf("config: invalid server.idempotencyTTL in %s: %w", path, err)
+	}
+	if err := setDuration(&cfg.trash.retention, fc.Trash.Retention); err != nil {
+		return fmt.Errorf("config: invalid trash.retention in %s: %w", path, err)
+	}
+	if err := setDuration(&cfg.trash.purgeInterval, fc.Trash.PurgeInterval); err != nil {
+		return fmt.Errorf("config: invalid trash.purgeInterval in %s: %w", path, err)
+	}
+	setString(&cfg.events.publisher, fc.Events.Publisher)
+	setString(&cfg.events.webhookURL, fc.Events.WebhookURL)
+	if err := setDuration(&cfg.events.pollInterval, fc.Events.PollInterval); err != nil {
+		return fmt.Errorf("config: invalid events.pollInterval in %s: %w", path, err)
+	}
+	if fc.Events.BatchSize != 0 {
+		cfg.events.batchSize = fc.Events.BatchSize
+	}
+	if err := setDuration(&cfg.webhooks.pollInterval, fc.Webhooks.PollInterval); err != nil {
+		return fmt.Errorf("config: invalid webhooks.pollInterval in %s: %w", path, err)
+	}
+	if fc.Webhooks.BatchSize != 0 {
+		cfg.webhooks.batchSize = fc.Webhooks.BatchSize
+	}
+	if fc.Webhooks.MaxAttempts != 0 {
+		cfg.webhooks.maxAttempts = fc.Webhooks.MaxAttempts
+	}
+	if err := setDuration(&cfg.webhooks.retryBaseDelay, fc.Webhooks.RetryBaseDelay); err != nil {
+		return fmt.Errorf("config: invalid webhooks.retryBaseDelay in %s: %w", path, err)
+	}
+	if err := setDuration(&cfg.webhooks.retryMaxDelay, fc.Webhooks.RetryMaxDelay); err != nil {
+		return fmt.Errorf("config: invalid webhooks.retryMaxDelay in %s: %w", path, err)
+	}
+	if fc.Stream.LogSize != 0 {
+		cfg.stream.logSize = fc.Stream.LogSize
+	}
+	if fc.Stream.ClientBuffer != 0 {
+		cfg.stream.clientBuffer = fc.Stream.ClientBuffer
+	}
+	setString(&cfg.auth.hmacSecret, fc.Auth.HMACSecret)
+	setString(&cfg.auth.jwksFile, fc.Auth.JWKSFile)
+	setString(&cfg.auth.issuer, fc.Auth.Issuer)
+	setString(&cfg.auth.audience, fc.Auth.Audience)
+	if err := setDuration(&cfg.auth.leeway, fc.Auth.Leeway); err != nil {
+		return fmt.Errorf("config: invalid auth.leeway in %s: %w", path, err)
+	}
+	setString(&cfg.tenancy.baseDomain, fc.Tenancy.BaseDomain)
+	if fc.RateLimit.Requests != 0 {
+		cfg.rateLimit.requests = fc.RateLimit.Requests
+	}
+	if err := setDuration(&cfg.rateLimit.period, fc.RateLimit.Period); err != nil {
+		return fmt.Errorf("config: invalid rateLimit.period in %s: %w", path, err)
+	}
+	if len(fc.RateLimit.Routes) > 0 {
+		cfg.rateLimit.routes = make(map[string]httpHandler.RateLimit, len(fc.RateLimit.Routes))
+	}
+	for route, limit := range fc.RateLimit.Routes {
+		var period time.Duration
+		if err := setDuration(&period, limit.Period); err != nil {
+			return fmt.Errorf("config: invalid rateLimit.routes period of %s in %s: %w", route, path, err)
+		}
+		cfg.rateLimit.routes[route] = httpHandler.RateLimit{Requests: limit.Requests, Period: period}
+	}
+	if fc.RateLimit.IP.Requests != 0 {
+		cfg.rateLimit.ip.Requests = fc.RateLimit.IP.Requests
+	}
+	if err := setDuration(&cfg.rateLimit.ip.Period, fc.RateLimit.IP.Period); err != nil {
+		return fmt.Errorf("config: invalid rateLimit.ip.period in %s: %w", path, err)
+	}
+	setString(&cfg.db.driver, fc.Database.Driver)
+	setString(&cfg.db.path, fc.Database.Path)
+	setString(&cfg.db.host, fc.Database.Host)
+	if fc.Database.Port != 0 {
+		cfg.db.port = fc.Database.Port
+	}
+	setString(&cfg.db.user, fc.Database.User)
+	setString(&cfg.db.password, fc.Database.Password)
+	setString(&cfg.db.name, fc.Database.DBName)
+	setString(&cfg.db.sslMode, fc.Database.SSLMode)
+
+	return nil
+}
+
+// loadEnv applies the values set in environment variables.
+func (cfg *config) loadEnv() error {
+	setString(&cfg.port, os.Getenv("PORT"))
+	setString(&cfg.env, os.Getenv("ENV"))
+	if v := os.Getenv("MAX_BODY_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("config: invalid MAX_BODY_BYTES %q: %w", v, err)
+		}
+		cfg.maxBodyBytes = n
+	}
+	if err := setDuration(&cfg.idempotencyTTL, os.Getenv("IDEMPOTENCY_TTL")); err != nil {
+		return fmt.Errorf("config: invalid IDEMPOTENCY_TTL: %w", err)
+	}
+	if err := setDuration(&cfg.trash.retention, os.Getenv("TRASH_RETENTION")); err != nil {
+		return fmt.Errorf("config: invalid TRASH_RETENTION: %w", err)
+	}
+	if err := setDuration(&cfg.trash.purgeInterval, os.Getenv("TRASH_PURGE_INTERVAL")); err != nil {
+		return fmt.Errorf("config: invalid TRASH_PURGE_INTERVAL: %w", err)
+	}
+	setString(&cfg.events.publisher, os.Getenv("EVENTS_PUBLISHER"))
+	setString(&cfg.events.webhookURL, os.Getenv("EVENTS_WEBHOOK_URL"))
+	if err := setDuration(&cfg.events.pollInterval, os.Getenv("EVENTS_POLL_INTERVAL")); err != nil {
+		return fmt.Errorf("config: invalid EVENTS_POLL_INTERVAL: %w", err)
+	}
+	if v := os.Getenv("EVENTS_BATCH_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("config: invalid EVENTS_BATCH_SIZE %q: %w", v, err)
+		}
+		cfg.events.batchSize = n
+	}
+	if err := setDuration(&cfg.webhooks.pollInterval, os.Getenv("WEBHOOKS_POLL_INTERVAL")); err != nil {
+		return fmt.Errorf("config: invalid WEBHOOKS_POLL_INTERVAL: %w", err)
+	}
+	if v := os.Getenv("WEBHOOKS_BATCH_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("config: invalid WEBHOOKS_BATCH_SIZE %q: %w", v, err)
+		}
+		cfg.webhooks.batchSize = n
+	}
+	if v := os.Getenv("WEBHOOKS_MAX_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("config: invalid WEBHOOKS_MAX_ATTEMPTS %q: %w", v, err)
+		}
+		cfg.webhooks.maxAttempts = n
+	}
+	if err := setDuration(&cfg.webhooks.retryBaseDelay, os.Getenv("WEBHOOKS_RETRY_BASE_DELAY")); err != nil {
+		return fmt.Errorf("config: invalid WEBHOOKS_RETRY_BASE_DELAY: %w", err)
+	}
+	if err := setDuration(&cfg.webhooks.retryMaxDelay, os.Getenv("WEBHOOKS_RETRY_MAX_DELAY")); err != nil {
+		return fmt.Errorf("config: invalid WEBHOOKS_RETRY_MAX_DELAY: %w", err)
+	}
+	if v := os.Getenv("STREAM_LOG_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("config: invalid STREAM_LOG_SIZE %q: %w", v, err)
+		}
+		cfg.stream.logSize = n
+	}
+	if v := os.Getenv("STREAM_CLIENT_BUFFER"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("config: invalid STREAM_CLIENT_BUFFER %q: %w", v, err)
+		}
+		cfg.stream.clientBuffer = n
+	}
+	setString(&cfg.auth.hmacSecret, os.Getenv("AUTH_HMAC_SECRET"))
+	setString(&cfg.auth.jwksFile, os.Getenv("AUTH_JWKS_FILE"))
+	setString(&cfg.auth.issuer, os.Getenv("AUTH_ISSUER"))
+	setString(&cfg.auth.audience, os.Getenv("AUTH_AUDIENCE"))
+	if err := setDuration(&cfg.auth.leeway, os.Getenv("AUTH_LEEWAY")); err != nil {
+		return fmt.Errorf("config: invalid AUTH_LEEWAY: %w", err)
+	}
+	setString(&cfg.tenancy.baseDomain, os.Getenv("TENANCY_BASE_DOMAIN"))
+	if v := os.Getenv("RATE_LIMIT_REQUESTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("config: invalid RATE_LIMIT_REQUESTS %q: %w", v, err)
+		}
+		cfg.rateLimit.requests = n
+	}
+	if err := setDuration(&cfg.rateLimit.period, os.Getenv("RATE_LIMIT_PERIOD")); err != nil {
+		return fmt.Errorf("config: invalid RATE_LIMIT_PERIOD: %w", err)
+	}
+	if v := os.Getenv("RATE_LIMIT_IP_REQUESTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("config: invalid RATE_LIMIT_IP_REQUESTS %q: %w", v, err)
+		}
+		cfg.rateLimit.ip.Requests = n
+	}
+	if err := setDuration(&cfg.rateLimit.ip.Period, os.Getenv("RATE_LIMIT_IP_PERIOD")); err != nil {
+		return fmt.Errorf("config: invalid RATE_LIMIT_IP_PERIOD: %w", err)
+	}
+
+	setString(&cfg.db.driver, os.Getenv("DB_DRIVER"))
+	setString(&cfg.db.path, os.Getenv("DB_PATH"))
+	setString(&cfg.db.host, os.Getenv("DB_HOST"))
+	if v := os.Getenv("DB_PORT"); v != "" {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("config: invalid DB_PORT %q: %w", v, err)
+		}
+		cfg.db.port = port
+	}
+	setString(&cfg.db.user, os.Getenv("DB_USER"))
+	setString(&cfg.db.password, os.Getenv("DB_PASSWORD"))
+	setString(&cfg.db.name, os.Getenv("DB_NAME"))
+	setString(&cfg.db.sslMode, os.Getenv("DB_SSLMODE"))
+
+	return nil
+}
+
+// setString overwrites dst with v, unless v is empty.
+func setString(dst *string, v string) {
+	if v != "" {
+		*dst = v
+	}
+}
+
+// setDuration overwrites dst with v parsed as a time.Duration, unless v is empty.
+func setDuration(dst *time.Duration, v string) error {
+	if v == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return err
+	}
+	*dst = d
+	return nil
 }
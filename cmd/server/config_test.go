@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigRateLimitPeriod(t *testing.T) {
+	// writeConfig points CONFIG_FILE at a file with the given content.
+	writeConfig := func(t *testing.T, content string) {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("failed to write config file: %v", err)
+		}
+		t.Setenv("CONFIG_FILE", path)
+	}
+
+	t.Run("Environment period applies to routes and IP addresses", func(t *testing.T) {
+		writeConfig(t, `
+rateLimit:
+  period: "1m"
+  routes:
+    "POST /entities:batch":
+      requests: 10
+  ip:
+    requests: 100
+`)
+		t.Setenv("RATE_LIMIT_PERIOD", "10s")
+
+		cfg, err := loadConfig()
+		if err != nil {
+			t.Fatalf("failed to load config: %v", err)
+		}
+		if cfg.rateLimit.period != 10*time.Second {
+			t.Errorf("expected period %s, got %s", 10*time.Second, cfg.rateLimit.period)
+		}
+		if got := cfg.rateLimit.routes["POST /entities:batch"].Period; got != 10*time.Second {
+			t.Errorf("expected route period %s, got %s", 10*time.Second, got)
+		}
+		if got := cfg.rateLimit.ip.Period; got != 10*time.Second {
+			t.Errorf("expected IP period %s, got %s", 10*time.Second, got)
+		}
+	})
+
+	t.Run("Own periods are kept", func(t *testing.T) {
+		writeConfig(t, `
+rateLimit:
+  routes:
+    "POST /entities:batch":
+      requests: 10
+      period: "1h"
+  ip:
+    requests: 100
+`)
+		t.Setenv("RATE_LIMIT_PERIOD", "10s")
+		t.Setenv("RATE_LIMIT_IP_PERIOD", "30s")
+
+		cfg, err := loadConfig()
+		if err != nil {
+			t.Fatalf("failed to load config: %v", err)
+		}
+		if got := cfg.rateLimit.routes["POST /entities:batch"].Period; got != time.Hour {
+			t.Errorf("expected route period %s, got %s", time.Hour, got)
+		}
+		if got := cfg.rateLimit.ip.Period; got != 30*time.Second {
+			t.Errorf("expected IP period %s, got %s", 30*time.Second, got)
+		}
+	})
+}
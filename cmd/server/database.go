@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/repository/postgres"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/repository/sqlite"
+
+	_ "github.com/jackc/pgx/v5/stdlib" // Registers the "pgx" database/sql driver.
+	_ "modernc.org/sqlite"             // Registers the "sqlite" database/sql driver.
+)
+
+// openPostgres opens a PostgreSQL connection pool, verifies it is reachable
+// and brings the schema up to date.
+func openPostgres(cfg dbConfig) (*sql.DB, error) {
+	db, err := sql.Open("pgx", cfg.dsn())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	// Keep the pool bounded so a traffic spike cannot exhaust the server's connections.
+	db.SetMaxOpenConns(25)
+	db.SetMaxIdleConns(25)
+	db.SetConnMaxIdleTime(15 * time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	if err := postgres.Migrate(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// openSQLite opens the SQLite database file, creating it if needed,
+// and brings the schema up to date.
+func openSQLite(cfg dbConfig) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", sqliteDSN(cfg.path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := sqlite.Migrate(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// sqliteDSN returns the URI filename that opens the database file at path.
+// The path is escaped, so that a "?" or "#" in it cannot change the options.
+func sqliteDSN(path string) string {
+	u := url.URL{
+		Scheme: "file",
+		Opaque: (&url.URL{Path: path}).EscapedPath(),
+		// WAL journaling lets readers proceed while a write is in progress, the busy
+		// timeout makes concurrent writers wait for the lock instead of failing, and
+		// immediate transactions take the write lock up front to avoid upgrade deadlocks.
+		RawQuery: "_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)&_txlock=immediate",
+	}
+	return u.String()
+}
@@ -11,14 +11,24 @@ func main() {
 	// JSON format is great for log aggregators like Datadog or Splunk.
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
 
-	// 2. Load configuration from the environment.
-	cfg := loadConfig()
+	// 2. Load configuration from the config file and the environment.
+	cfg, err := loadConfig()
+	if err != nil {
+		logger.Error("failed to load configuration", "error", err)
+		os.Exit(1)
+	}
 
 	// 3. Set up the application struct, which holds all our dependencies.
-	app := newApplication(cfg, logger)
+	app, err := newApplication(cfg, logger)
+	if err != nil {
+		logger.Error("failed to initialize application", "error", err)
+		os.Exit(1)
+	}
 
 	// 4. Run the server, with graceful shutdown.
-	if err := app.serve(); err != nil {
+	err = app.serve()
+	app.close()
+	if err != nil {
 		logger.Error("server failed", "error", err)
 		os.Exit(1)
 	}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// purgeDeleted permanently removes the entities that have been in the trash
+// for longer than the configured retention, once per purge interval, until
+// ctx is canceled.
+func (app *application) purgeDeleted(ctx context.Context) {
+	ticker := time.NewTicker(app.config.trash.purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		n, err := app.entityService.PurgeDeleted(ctx, app.config.trash.retention)
+		if err != nil {
+			if ctx.Err() == nil {
+				app.logger.Error("failed to purge deleted entities", "error", err)
+			}
+			continue
+		}
+		if n > 0 {
+			app.logger.Info("purged deleted entities", "count", n, "retention", app.config.trash.retention.String())
+		}
+	}
+}
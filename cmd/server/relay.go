@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// relayEvents publishes the domain events of the outbox, once per poll
+// interval, until ctx is canceled. Each time, it reads batches until the
+// outbox is empty or an event fails to publish; failed events are retried on
+// the next poll.
+func (app *application) relayEvents(ctx context.Context) {
+	ticker := time.NewTicker(app.config.events.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for {
+			n, err := app.eventRelay.Relay(ctx, app.config.events.batchSize)
+			if err != nil {
+				if ctx.Err() == nil {
+					app.logger.Error("failed to relay events", "error", err, "published", n)
+				}
+				break
+			}
+			if n < app.config.events.batchSize {
+				break
+			}
+		}
+	}
+}
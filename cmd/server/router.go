@@ -1,8 +1,10 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
 
+	httpHandler "github.com/domenicoop/go-clean-architecture-blueprint/internal/handler/http"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
@@ -12,23 +14,88 @@ func (app *application) newRouter() http.Handler {
 	return app.httpRestRouter()
 }
 
-func (app *application) httpRestRouter() http.Handler {
+func (app *application) httpRestRouter() *chi.Mux {
 	router := chi.NewRouter()
 
 	// Add common middleware.
 	router.Use(middleware.RequestID)
+	router.Use(httpHandler.RequestContext)
 	router.Use(middleware.RealIP)
 	router.Use(middleware.Logger)
 	router.Use(middleware.Recoverer)
 
 	// Define routes
+	router.Group(func(router chi.Router) {
+		// Every request counts against the limit of its IP address, even if
+		// its credentials are rejected.
+		if app.ipRateLimiter != nil {
+			router.Use(app.ipRateLimiter.Middleware)
+		}
+		if app.authenticator != nil {
+			router.Use(app.authenticator.Middleware)
+		}
+		// The tenant of authenticated requests is the one of their principal.
+		router.Use(app.tenants.Middleware)
+		// Authenticated clients are identified by their credentials, the others
+		// by their IP address.
+		if app.rateLimiter != nil {
+			router.Use(app.rateLimiter.Middleware)
+		}
+		app.apiRoutes(router)
+	})
+
+	return router
+}
+
+// checkRateLimitRoutes fails if a route of routes, as "METHOD /pattern", is
+// not a route of the router, so that a mistyped limit does not go unnoticed.
+func (app *application) checkRateLimitRoutes(routes map[string]httpHandler.RateLimit) error {
+	if len(routes) == 0 {
+		return nil
+	}
+	known := make(map[string]bool)
+	err := chi.Walk(app.httpRestRouter(), func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		known[method+" "+route] = true
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("config: failed to list the routes of the router: %w", err)
+	}
+	for route := range routes {
+		if !known[route] {
+			return fmt.Errorf("config: rate limit route %q is not a route of the router", route)
+		}
+	}
+	return nil
+}
+
+// apiRoutes registers the routes of the API, which require authentication.
+func (app *application) apiRoutes(router chi.Router) {
 	router.Route("/entities", func(r chi.Router) {
-		r.Post("/", app.entityHandler.CreateEntity)
+		r.With(app.idempotency.Middleware).Post("/", app.entityHandler.CreateEntity)
 		r.Get("/", app.entityHandler.ListEntities)
+		r.Get("/stream", app.entityStream.StreamEntities)
 		r.Get("/{id}", app.entityHandler.GetEntity)
 		r.Put("/{id}", app.entityHandler.UpdateEntity)
+		r.Patch("/{id}", app.entityHandler.PatchEntity)
 		r.Delete("/{id}", app.entityHandler.DeleteEntity)
+		r.Post("/{id}/restore", app.entityHandler.RestoreEntity)
+		r.Get("/{id}/history", app.entityHandler.GetEntityHistory)
+	})
+	router.Post("/entities:batch", app.entityHandler.BatchEntities)
+	router.Route("/webhooks", func(r chi.Router) {
+		r.Post("/", app.webhookHandler.CreateWebhook)
+		r.Get("/", app.webhookHandler.ListWebhooks)
+		r.Get("/dead-letters", app.webhookHandler.ListDeadLetters)
+		r.Post("/dead-letters/{id}/retry", app.webhookHandler.RetryDeadLetter)
+		r.Get("/{id}", app.webhookHandler.GetWebhook)
+		r.Delete("/{id}", app.webhookHandler.DeleteWebhook)
+		r.Get("/{id}/deliveries", app.webhookHandler.ListDeliveries)
+	})
+	router.Route("/api-keys", func(r chi.Router) {
+		r.Post("/", app.apiKeyHandler.CreateAPIKey)
+		r.Get("/", app.apiKeyHandler.ListAPIKeys)
+		r.Get("/{id}", app.apiKeyHandler.GetAPIKey)
+		r.Post("/{id}/revoke", app.apiKeyHandler.RevokeAPIKey)
 	})
-
-	return router
 }
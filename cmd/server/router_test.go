@@ -0,0 +1,110 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/auth/jwt"
+	httpHandler "github.com/domenicoop/go-clean-architecture-blueprint/internal/handler/http"
+)
+
+func TestRouterRateLimit(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// newRouter builds the router of an application with authentication, and
+	// with the given limit of each IP address.
+	newRouter := func(t *testing.T, ip httpHandler.RateLimit) http.Handler {
+		t.Helper()
+
+		app, err := newApplication(config{
+			maxBodyBytes:   1 << 20,
+			idempotencyTTL: time.Hour,
+			auth:           authConfig{hmacSecret: "a-secret-of-at-least-32-characters", leeway: jwt.DefaultLeeway},
+			rateLimit:      rateLimitConfig{requests: 100, period: time.Minute, ip: ip},
+		}, logger)
+		if err != nil {
+			t.Fatalf("failed to create application: %v", err)
+		}
+		t.Cleanup(app.close)
+		return app.httpRestRouter()
+	}
+	send := func(handler http.Handler, remoteAddr, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/entities/", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("Authorization", authorization)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Bad credentials are limited by IP address", func(t *testing.T) {
+		handler := newRouter(t, httpHandler.RateLimit{Requests: 3, Period: time.Minute})
+
+		for i := range 3 {
+			if rr := send(handler, "192.0.2.1:1234", "Bearer not-a-token"); rr.Code != http.StatusUnauthorized {
+				t.Fatalf("request %d: expected status %d, got %d", i+1, http.StatusUnauthorized, rr.Code)
+			}
+		}
+		rr := send(handler, "192.0.2.1:1234", "ApiKey ak_guessed")
+		if rr.Code != http.StatusTooManyRequests {
+			t.Fatalf("expected status %d, got %d", http.StatusTooManyRequests, rr.Code)
+		}
+		if rr.Header().Get("Retry-After") == "" {
+			t.Error("expected a Retry-After header")
+		}
+
+		// Other addresses are not limited.
+		if rr := send(handler, "192.0.2.2:1234", "Bearer not-a-token"); rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status %d for another address, got %d", http.StatusUnauthorized, rr.Code)
+		}
+	})
+
+	t.Run("Without a limit of IP addresses", func(t *testing.T) {
+		handler := newRouter(t, httpHandler.RateLimit{Period: time.Minute})
+
+		for i := range 5 {
+			if rr := send(handler, "192.0.2.1:1234", "Bearer not-a-token"); rr.Code != http.StatusUnauthorized {
+				t.Fatalf("request %d: expected status %d, got %d", i+1, http.StatusUnauthorized, rr.Code)
+			}
+		}
+	})
+}
+
+func TestRouterRateLimitRoutes(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	newApp := func(routes map[string]httpHandler.RateLimit) error {
+		app, err := newApplication(config{
+			maxBodyBytes:   1 << 20,
+			idempotencyTTL: time.Hour,
+			rateLimit:      rateLimitConfig{requests: 100, period: time.Minute, routes: routes},
+		}, logger)
+		if err == nil {
+			app.close()
+		}
+		return err
+	}
+
+	t.Run("Known routes", func(t *testing.T) {
+		err := newApp(map[string]httpHandler.RateLimit{
+			"POST /entities:batch": {Requests: 10, Period: time.Minute},
+			"GET /entities/{id}":   {Requests: 10, Period: time.Minute},
+			"POST /entities/":      {Requests: 10, Period: time.Minute},
+		})
+		if err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	})
+
+	for _, route := range []string{"POST /entities/batch", "GET /entities/{entityID}", "DELETE /entities/"} {
+		t.Run("Unknown route "+route, func(t *testing.T) {
+			if err := newApp(map[string]httpHandler.RateLimit{route: {Requests: 10, Period: time.Minute}}); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 )
@@ -25,6 +26,27 @@ func (app *application) serve() error {
 		ErrorLog:     slog.NewLogLogger(app.logger.Handler(), slog.LevelError),
 	}
 
+	// Purge the trash, relay the outbox and deliver webhooks in the background
+	// until the server stops. Wait for the workers to return, so that they are done with the
+	// database before it closes.
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	for _, worker := range []func(context.Context){app.purgeDeleted, app.relayEvents, app.deliverWebhooks} {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			worker(workersCtx)
+		}()
+	}
+	defer func() {
+		stopWorkers()
+		workers.Wait()
+	}()
+
+	// Streams never become idle, so Shutdown would wait for them until its
+	// deadline: end them as soon as it starts.
+	srv.RegisterOnShutdown(app.entityStream.Close)
+
 	// shutdownError channel will receive any errors from the graceful shutdown.
 	shutdownError := make(chan error)
 
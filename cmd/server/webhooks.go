@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// deliverWebhooks attempts the due deliveries of events to the registered
+// webhooks, once per poll interval, until ctx is canceled. Each time, it
+// attempts batches until no delivery is due; failed deliveries are scheduled
+// again by the webhook service.
+func (app *application) deliverWebhooks(ctx context.Context) {
+	ticker := time.NewTicker(app.config.webhooks.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for {
+			n, err := app.webhookService.Deliver(ctx, app.config.webhooks.batchSize)
+			if err != nil {
+				if ctx.Err() == nil {
+					app.logger.Error("failed to deliver webhooks", "error", err, "attempted", n)
+				}
+				break
+			}
+			if n < app.config.webhooks.batchSize {
+				break
+			}
+		}
+	}
+}
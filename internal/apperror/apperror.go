@@ -13,6 +13,78 @@ var (
 	// ErrConflict indicates a resource conflict, like a duplicate key.
 	ErrConflict = errors.New("resource conflict")
 
+	// ErrPreconditionFailed indicates a conditional request whose precondition
+	// did not hold, like an update against a stale version.
+	ErrPreconditionFailed = errors.New("precondition failed")
+
+	// ErrAborted indicates an operation that was not applied because another
+	// operation it depends on failed, like the rest of a failed atomic batch.
+	ErrAborted = errors.New("aborted")
+
+	// ErrUnauthenticated indicates a request without valid credentials.
+	ErrUnauthenticated = errors.New("unauthenticated")
+
+	// ErrForbidden indicates an authenticated caller that may not perform the operation.
+	ErrForbidden = errors.New("forbidden")
+
 	// ErrInternal is a generic fallback for server-side errors.
 	ErrInternal = errors.New("internal error")
 )
+
+// Error is an application error that carries more than its kind: a
+// machine-readable code, a message that is safe to show to clients, and
+// optional details about the offending fields or the failure itself.
+//
+// Error unwraps to its Kind, so errors.Is(err, ErrInvalidInput) keeps working
+// for callers that only care about the category.
+type Error struct {
+	Kind    error          // Usually one of the standard errors above.
+	Code    string         // Machine-readable code, e.g. "invalid_query".
+	Message string         // Human-readable explanation, safe to show to clients.
+	Fields  []FieldError   // Per-field problems, for invalid input.
+	Meta    map[string]any // Additional details, safe to show to clients.
+}
+
+// FieldError describes why a single input field was rejected.
+type FieldError struct {
+	Field   string // Name of the field, e.g. "name".
+	Code    string // Machine-readable rule, e.g. "required".
+	Message string // Human-readable explanation, e.g. "must not be empty".
+}
+
+// New creates an Error of the given kind.
+func New(kind error, code, message string) *Error {
+	return &Error{
+		Kind:    kind,
+		Code:    code,
+		Message: message,
+	}
+}
+
+// WithFields appends field errors to e and returns it.
+func (e *Error) WithFields(fields ...FieldError) *Error {
+	e.Fields = append(e.Fields, fields...)
+	return e
+}
+
+// WithMeta records an additional detail on e and returns it.
+func (e *Error) WithMeta(key string, value any) *Error {
+	if e.Meta == nil {
+		e.Meta = make(map[string]any)
+	}
+	e.Meta[key] = value
+	return e
+}
+
+// Error returns the message, or the kind's message if there is none.
+func (e *Error) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	return e.Kind.Error()
+}
+
+// Unwrap returns the kind of the error.
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
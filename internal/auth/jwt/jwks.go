@@ -0,0 +1,153 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// Key is a public key of a key set.
+type Key struct {
+	ID  string
+	Alg string // RS256 or ES256.
+	Key crypto.PublicKey
+}
+
+// KeySet is a set of public keys that verify tokens.
+type KeySet []Key
+
+// lookup returns the key with the given ID for alg. Without an ID, it returns
+// the only key for alg, if there is exactly one.
+func (ks KeySet) lookup(kid, alg string) crypto.PublicKey {
+	var found crypto.PublicKey
+	n := 0
+	for _, k := range ks {
+		if k.Alg != alg || (kid != "" && k.ID != kid) {
+			continue
+		}
+		found = k.Key
+		n++
+	}
+	if n != 1 {
+		return nil
+	}
+	return found
+}
+
+// jwk is a JSON Web Key (RFC 7517), with the members of RSA and EC public keys.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+
+	// RSA.
+	N string `json:"n"`
+	E string `json:"e"`
+
+	// EC.
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// LoadJWKS reads a JSON Web Key Set file. RSA keys verify RS256 tokens and
+// P-256 keys verify ES256 tokens; keys for other uses or algorithms are skipped.
+func LoadJWKS(path string) (KeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("jwt: failed to read key set: %w", err)
+	}
+	return ParseJWKS(data)
+}
+
+// ParseJWKS parses a JSON Web Key Set, as LoadJWKS does.
+func ParseJWKS(data []byte) (KeySet, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("jwt: failed to decode key set: %w", err)
+	}
+
+	var keys KeySet
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		var key Key
+		var err error
+		switch {
+		case k.Kty == "RSA" && (k.Alg == "" || k.Alg == RS256):
+			key.Alg = RS256
+			key.Key, err = k.rsaKey()
+		case k.Kty == "EC" && k.Crv == "P-256" && (k.Alg == "" || k.Alg == ES256):
+			key.Alg = ES256
+			key.Key, err = k.ecKey()
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("jwt: invalid key %d (%q): %w", i, k.Kid, err)
+		}
+		key.ID = k.Kid
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("jwt: the key set has no RS256 or ES256 key")
+	}
+	return keys, nil
+}
+
+// rsaKey decodes an RSA public key.
+func (k *jwk) rsaKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil || len(n) == 0 {
+		return nil, fmt.Errorf("invalid modulus")
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil || len(e) == 0 || len(e) > 4 {
+		return nil, fmt.Errorf("invalid exponent")
+	}
+	exponent := new(big.Int).SetBytes(e)
+	if exponent.Int64() < 3 || exponent.Bit(0) == 0 {
+		return nil, fmt.Errorf("invalid exponent")
+	}
+
+	key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}
+	if key.N.BitLen() < 2048 {
+		return nil, fmt.Errorf("modulus shorter than 2048 bits")
+	}
+	return key, nil
+}
+
+// ecKey decodes a P-256 public key, and checks that it is on the curve.
+func (k *jwk) ecKey() (*ecdsa.PublicKey, error) {
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil || len(x) != 32 {
+		return nil, fmt.Errorf("invalid x coordinate")
+	}
+	y, err := base64.RawURLEncoding.DecodeString(k.Y)
+	if err != nil || len(y) != 32 {
+		return nil, fmt.Errorf("invalid y coordinate")
+	}
+
+	// crypto/ecdh validates the point of an uncompressed encoding.
+	point := append(append([]byte{4}, x...), y...)
+	if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+		return nil, fmt.Errorf("point not on the curve")
+	}
+	return &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}, nil
+}
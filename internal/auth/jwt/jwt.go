@@ -0,0 +1,268 @@
+// Package jwt verifies JSON Web Tokens (RFC 7519) signed with HS256, RS256 or
+// ES256, and provides an implementation of the http.TokenVerifier interface.
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+)
+
+// Signing algorithms.
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	ES256 = "ES256"
+)
+
+// DefaultLeeway is the clock skew tolerated when checking the time claims.
+const DefaultLeeway = 30 * time.Second
+
+// MinSecretLength is the length in bytes of the shortest accepted HS256
+// secret: the size of the SHA-256 output, as RFC 7518 requires.
+const MinSecretLength = 32
+
+// Errors returned by Verifier.Parse. Their messages are safe to show to clients.
+var (
+	ErrMalformed        = errors.New("jwt: malformed token")
+	ErrUnsupportedAlg   = errors.New("jwt: unsupported signing algorithm")
+	ErrUnknownKey       = errors.New("jwt: unknown signing key")
+	ErrInvalidSignature = errors.New("jwt: invalid signature")
+	ErrExpired          = errors.New("jwt: token expired")
+	ErrNotYetValid      = errors.New("jwt: token not valid yet")
+	ErrInvalidClaims    = errors.New("jwt: invalid claims")
+)
+
+// Claims are the registered claims of a token, and the roles of its subject.
+type Claims struct {
+	Subject   string      `json:"sub"`
+	Issuer    string      `json:"iss"`
+	Audience  Audience    `json:"aud"`
+	ExpiresAt NumericDate `json:"exp"`
+	NotBefore NumericDate `json:"nbf"`
+	IssuedAt  NumericDate `json:"iat"`
+
+	// Roles is the private roles claim: reader, editor or admin.
+	Roles []string `json:"roles"`
+
+	// Tenant is the private tenant claim: the tenant of the subject, or empty
+	// for the default tenant.
+	Tenant string `json:"tenant"`
+}
+
+// Audience is the aud claim, which is either a string or an array of strings.
+type Audience []string
+
+// UnmarshalJSON accepts both forms of the claim.
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+// NumericDate is a time claim, encoded as seconds since the Unix epoch.
+// The zero value means that the claim is absent.
+type NumericDate struct {
+	time.Time
+}
+
+// UnmarshalJSON decodes a number of seconds, which may have a fraction.
+func (d *NumericDate) UnmarshalJSON(data []byte) error {
+	var seconds float64
+	if err := json.Unmarshal(data, &seconds); err != nil {
+		return err
+	}
+	whole, frac := math.Modf(seconds)
+	d.Time = time.Unix(int64(whole), int64(frac*1e9)).UTC()
+	return nil
+}
+
+// Config defines the keys and the expected claims of the tokens.
+type Config struct {
+	// Secret verifies HS256 tokens. Empty means that HS256 is not accepted.
+	// It must be at least MinSecretLength bytes long.
+	Secret []byte
+
+	// Keys verifies RS256 and ES256 tokens, usually loaded with LoadJWKS.
+	Keys KeySet
+
+	// Issuer and Audience, if set, must match the iss claim and be one of the
+	// aud claim of every token.
+	Issuer   string
+	Audience string
+
+	// Leeway is the tolerated clock skew. Zero means DefaultLeeway.
+	Leeway time.Duration
+}
+
+// Verifier checks the signature and the claims of tokens.
+// It is safe for concurrent use.
+type Verifier struct {
+	config Config
+	now    func() time.Time
+}
+
+// NewVerifier creates a Verifier for the tokens described by config.
+func NewVerifier(config Config) (*Verifier, error) {
+	if len(config.Secret) == 0 && len(config.Keys) == 0 {
+		return nil, errors.New("jwt: a secret or a key set is required")
+	}
+	if len(config.Secret) > 0 && len(config.Secret) < MinSecretLength {
+		return nil, fmt.Errorf("jwt: the secret must be at least %d bytes long, got %d", MinSecretLength, len(config.Secret))
+	}
+	if config.Leeway == 0 {
+		config.Leeway = DefaultLeeway
+	}
+	return &Verifier{config: config, now: time.Now}, nil
+}
+
+// header is the JOSE header of a token.
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Parse verifies token and returns its claims. Tokens must have an exp and a
+// sub claim; the nbf claim is honored when present.
+func (v *Verifier) Parse(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	if err := v.verifySignature(h, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if err := v.validate(&claims); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// Verify verifies token and returns the principal it authenticates: its
+// subject, with its roles and tenant.
+func (v *Verifier) Verify(ctx context.Context, token string) (domain.Principal, error) {
+	claims, err := v.Parse(token)
+	if err != nil {
+		return domain.Principal{}, err
+	}
+	principal := domain.Principal{ID: claims.Subject, TenantID: claims.Tenant}
+	for _, role := range claims.Roles {
+		principal.Roles = append(principal.Roles, domain.Role(role))
+	}
+	return principal, nil
+}
+
+// decodeSegment decodes a base64url-encoded JSON segment of a token into dst.
+func decodeSegment(segment string, dst any) error {
+	js, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return ErrMalformed
+	}
+	if err := json.Unmarshal(js, dst); err != nil {
+		return ErrMalformed
+	}
+	return nil
+}
+
+// verifySignature checks the signature of the signing input of a token.
+// The algorithm of the header must match the type of the key, so that a
+// public key can never be used as an HMAC secret.
+func (v *Verifier) verifySignature(h header, input string, signature []byte) error {
+	digest := sha256.Sum256([]byte(input))
+
+	switch h.Alg {
+	case HS256:
+		if len(v.config.Secret) == 0 {
+			return ErrUnsupportedAlg
+		}
+		mac := hmac.New(sha256.New, v.config.Secret)
+		mac.Write([]byte(input))
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return ErrInvalidSignature
+		}
+	case RS256:
+		key, ok := v.config.Keys.lookup(h.Kid, RS256).(*rsa.PublicKey)
+		if !ok {
+			return ErrUnknownKey
+		}
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return ErrInvalidSignature
+		}
+	case ES256:
+		key, ok := v.config.Keys.lookup(h.Kid, ES256).(*ecdsa.PublicKey)
+		if !ok {
+			return ErrUnknownKey
+		}
+		// The signature is r and s, each as 32 big-endian bytes (RFC 7518, section 3.4).
+		if len(signature) != 64 {
+			return ErrInvalidSignature
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(key, digest[:], r, s) {
+			return ErrInvalidSignature
+		}
+	default:
+		return ErrUnsupportedAlg
+	}
+	return nil
+}
+
+// validate checks the claims of a token whose signature is valid.
+func (v *Verifier) validate(claims *Claims) error {
+	now := v.now()
+
+	switch {
+	case claims.Subject == "":
+		return fmt.Errorf("%w: missing sub", ErrInvalidClaims)
+	case claims.ExpiresAt.IsZero():
+		return fmt.Errorf("%w: missing exp", ErrInvalidClaims)
+	case !now.Before(claims.ExpiresAt.Add(v.config.Leeway)):
+		return ErrExpired
+	case !claims.NotBefore.IsZero() && now.Before(claims.NotBefore.Add(-v.config.Leeway)):
+		return ErrNotYetValid
+	case v.config.Issuer != "" && claims.Issuer != v.config.Issuer:
+		return fmt.Errorf("%w: unexpected iss", ErrInvalidClaims)
+	case v.config.Audience != "" && !slices.Contains(claims.Audience, v.config.Audience):
+		return fmt.Errorf("%w: unexpected aud", ErrInvalidClaims)
+	case !domain.ValidTenantID(claims.Tenant):
+		return fmt.Errorf("%w: invalid tenant", ErrInvalidClaims)
+	}
+	return nil
+}
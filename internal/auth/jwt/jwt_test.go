@@ -0,0 +1,229 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+)
+
+// sign returns a token with the given header and claims, signed with key: a
+// []byte secret, an *rsa.PrivateKey or an *ecdsa.PrivateKey.
+func sign(t *testing.T, header, claims map[string]any, key any) string {
+	t.Helper()
+
+	encode := func(v any) string {
+		js, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("failed to encode token segment: %v", err)
+		}
+		return base64.RawURLEncoding.EncodeToString(js)
+	}
+	input := encode(header) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(input))
+
+	var signature []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(input))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// jwksJSON returns a key set with the public keys of rsaKey and ecKey.
+func jwksJSON(rsaKey *rsa.PrivateKey, ecKey *ecdsa.PrivateKey) []byte {
+	b64 := base64.RawURLEncoding.EncodeToString
+	js, _ := json.Marshal(map[string]any{"keys": []map[string]any{
+		{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+		{"kty": "oct", "kid": "ignored", "k": "c2VjcmV0"},
+	}})
+	return js
+}
+
+func TestVerifier(t *testing.T) {
+	secret := []byte("test-secret-of-at-least-32-bytes")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate EC key: %v", err)
+	}
+	keys, err := ParseJWKS(jwksJSON(rsaKey, ecKey))
+	if err != nil {
+		t.Fatalf("failed to parse key set: %v", err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("expected the RSA and EC keys, got %d keys", len(keys))
+	}
+
+	verifier, err := NewVerifier(Config{Secret: secret, Keys: keys, Issuer: "issuer", Audience: "api"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	verifier.now = func() time.Time { return now }
+
+	// claims returns valid claims, with overrides.
+	claims := func(overrides map[string]any) map[string]any {
+		c := map[string]any{"sub": "alice", "iss": "issuer", "aud": "api", "exp": now.Add(time.Hour).Unix()}
+		for k, v := range overrides {
+			if v == nil {
+				delete(c, k)
+				continue
+			}
+			c[k] = v
+		}
+		return c
+	}
+
+	t.Run("valid tokens", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			token string
+		}{
+			{"HS256", sign(t, map[string]any{"alg": "HS256"}, claims(nil), secret)},
+			{"RS256", sign(t, map[string]any{"alg": "RS256", "kid": "rsa-1"}, claims(nil), rsaKey)},
+			{"ES256", sign(t, map[string]any{"alg": "ES256", "kid": "ec-1"}, claims(nil), ecKey)},
+			{"ES256 without kid", sign(t, map[string]any{"alg": "ES256"}, claims(nil), ecKey)},
+			{"audience array", sign(t, map[string]any{"alg": "HS256"}, claims(map[string]any{"aud": []string{"other", "api"}}), secret)},
+			{"expired within leeway", sign(t, map[string]any{"alg": "HS256"}, claims(map[string]any{"exp": now.Add(-10 * time.Second).Unix()}), secret)},
+		}
+		for _, tt := range tests {
+			principal, err := verifier.Verify(context.Background(), tt.token)
+			if err != nil {
+				t.Errorf("%s: expected no error, got %v", tt.name, err)
+				continue
+			}
+			if principal.ID != "alice" {
+				t.Errorf("%s: expected principal alice, got %q", tt.name, principal.ID)
+			}
+		}
+	})
+
+	t.Run("invalid tokens", func(t *testing.T) {
+		valid := sign(t, map[string]any{"alg": "HS256"}, claims(nil), secret)
+		otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+		tests := []struct {
+			name  string
+			token string
+			want  error
+		}{
+			{"not a token", "abc", ErrMalformed},
+			{"bad encoding", "a.b.c", ErrMalformed},
+			{"tampered signature", valid[:len(valid)-2] + "AA", ErrInvalidSignature},
+			{"wrong secret", sign(t, map[string]any{"alg": "HS256"}, claims(nil), []byte("other")), ErrInvalidSignature},
+			{"wrong key", sign(t, map[string]any{"alg": "ES256", "kid": "ec-1"}, claims(nil), otherKey), ErrInvalidSignature},
+			{"none", sign(t, map[string]any{"alg": "none"}, claims(nil), []byte{}), ErrUnsupportedAlg},
+			{"unknown kid", sign(t, map[string]any{"alg": "RS256", "kid": "rsa-2"}, claims(nil), rsaKey), ErrUnknownKey},
+			{"alg of another key type", sign(t, map[string]any{"alg": "ES256", "kid": "rsa-1"}, claims(nil), ecKey), ErrUnknownKey},
+			{"expired", sign(t, map[string]any{"alg": "HS256"}, claims(map[string]any{"exp": now.Add(-time.Minute).Unix()}), secret), ErrExpired},
+			{"not yet valid", sign(t, map[string]any{"alg": "HS256"}, claims(map[string]any{"nbf": now.Add(time.Minute).Unix()}), secret), ErrNotYetValid},
+			{"no expiry", sign(t, map[string]any{"alg": "HS256"}, claims(map[string]any{"exp": nil}), secret), ErrInvalidClaims},
+			{"no subject", sign(t, map[string]any{"alg": "HS256"}, claims(map[string]any{"sub": nil}), secret), ErrInvalidClaims},
+			{"wrong issuer", sign(t, map[string]any{"alg": "HS256"}, claims(map[string]any{"iss": "other"}), secret), ErrInvalidClaims},
+			{"wrong audience", sign(t, map[string]any{"alg": "HS256"}, claims(map[string]any{"aud": "other"}), secret), ErrInvalidClaims},
+			{"malformed claims", sign(t, map[string]any{"alg": "HS256"}, claims(map[string]any{"exp": "tomorrow"}), secret), ErrMalformed},
+			{"invalid tenant", sign(t, map[string]any{"alg": "HS256"}, claims(map[string]any{"tenant": "Acme Inc"}), secret), ErrInvalidClaims},
+		}
+		for _, tt := range tests {
+			if _, err := verifier.Verify(context.Background(), tt.token); !errors.Is(err, tt.want) {
+				t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+			}
+		}
+	})
+
+	t.Run("roles", func(t *testing.T) {
+		token := sign(t, map[string]any{"alg": "HS256"}, claims(map[string]any{"roles": []string{"reader", "editor"}}), secret)
+		principal, err := verifier.Verify(context.Background(), token)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !principal.HasRole(domain.RoleReader) || !principal.HasRole(domain.RoleEditor) || principal.HasRole(domain.RoleAdmin) {
+			t.Errorf("expected roles reader and editor, got %v", principal.Roles)
+		}
+	})
+
+	t.Run("tenant", func(t *testing.T) {
+		token := sign(t, map[string]any{"alg": "HS256"}, claims(map[string]any{"tenant": "acme"}), secret)
+		principal, err := verifier.Verify(context.Background(), token)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if principal.TenantID != "acme" {
+			t.Errorf("expected tenant acme, got %q", principal.TenantID)
+		}
+	})
+
+	t.Run("HS256 disabled without a secret", func(t *testing.T) {
+		verifier, err := NewVerifier(Config{Keys: keys})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		token := sign(t, map[string]any{"alg": "HS256"}, map[string]any{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()}, []byte{})
+		if _, err := verifier.Parse(token); !errors.Is(err, ErrUnsupportedAlg) {
+			t.Errorf("expected ErrUnsupportedAlg, got %v", err)
+		}
+	})
+
+	t.Run("NewVerifier without keys", func(t *testing.T) {
+		if _, err := NewVerifier(Config{}); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("NewVerifier with a short secret", func(t *testing.T) {
+		if _, err := NewVerifier(Config{Secret: make([]byte, MinSecretLength-1)}); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func TestParseJWKS(t *testing.T) {
+	b64 := base64.RawURLEncoding.EncodeToString
+	tests := []struct {
+		name string
+		keys string
+	}{
+		{"not JSON", `keys`},
+		{"no usable key", `{"keys": [{"kty": "oct", "k": "c2VjcmV0"}]}`},
+		{"short RSA modulus", fmt.Sprintf(`{"keys": [{"kty": "RSA", "n": %q, "e": "AQAB"}]}`, b64(make([]byte, 128)))},
+		{"EC point off the curve", fmt.Sprintf(`{"keys": [{"kty": "EC", "crv": "P-256", "x": %q, "y": %q}]}`, b64(make([]byte, 32)), b64(make([]byte, 32)))},
+	}
+	for _, tt := range tests {
+		if _, err := ParseJWKS([]byte(tt.keys)); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package domain
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// APIKey authenticates the requests of a client that cannot obtain bearer
+// tokens, on behalf of the principal who created it. Only a hash of the key is
+// stored: the key itself is shown once, when it is created.
+type APIKey struct {
+	ID string
+
+	// Name tells what the key is for, e.g. "billing sync".
+	Name string
+
+	// Prefix is the start of the key, kept in clear so that keys can be told apart.
+	Prefix string
+
+	// Hash is the hex-encoded SHA-256 hash of the key.
+	Hash string
+
+	// Scopes are the roles of the requests authenticated with the key.
+	Scopes []Role
+
+	// OwnerID is the ID of the principal who created the key, and on whose
+	// behalf its requests run.
+	OwnerID string
+
+	// TenantID is the tenant the key was created in, and the only one its
+	// requests can reach.
+	TenantID string
+
+	CreatedAt time.Time
+
+	// LastUsedAt is when the key last authenticated a request, to the minute,
+	// and zero if it never did.
+	LastUsedAt time.Time
+
+	// RevokedAt is set when the key is revoked, and zero otherwise. Revoked
+	// keys authenticate nothing.
+	RevokedAt time.Time
+}
+
+// IsRevoked reports whether the key was revoked.
+func (k *APIKey) IsRevoked() bool {
+	return !k.RevokedAt.IsZero()
+}
+
+// APIKeyNameMaxLength is the longest accepted API key name.
+const APIKeyNameMaxLength = 100
+
+// Normalize trims the leading and trailing whitespace of the key's fields,
+// and drops duplicate scopes.
+func (k *APIKey) Normalize() {
+	k.Name = strings.TrimSpace(k.Name)
+
+	scopes := make([]Role, 0, len(k.Scopes))
+	for _, s := range k.Scopes {
+		s = Role(strings.TrimSpace(string(s)))
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	k.Scopes = scopes
+}
+
+// Validate checks the key against the domain rules and returns a
+// *ValidationError listing every violation, or nil if the key is valid.
+// It expects a normalized key; see Normalize.
+func (k *APIKey) Validate() error {
+	var verr ValidationError
+
+	switch {
+	case k.Name == "":
+		verr.add("name", "required", "must not be empty")
+	case utf8.RuneCountInString(k.Name) > APIKeyNameMaxLength:
+		verr.add("name", "too_long", fmt.Sprintf("must be at most %d characters", APIKeyNameMaxLength))
+	}
+
+	if len(k.Scopes) == 0 {
+		verr.add("scopes", "required", "must not be empty")
+	}
+	for _, s := range k.Scopes {
+		if !slices.Contains(Roles, s) {
+			verr.add("scopes", "unknown_scope", fmt.Sprintf("%q is not a role", s))
+		}
+	}
+
+	return verr.errOrNil()
+}
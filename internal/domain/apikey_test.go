@@ -0,0 +1,55 @@
+package domain
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestAPIKeyValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		key       APIKey
+		wantRules []string
+	}{
+		{"valid", APIKey{Name: "billing sync", Scopes: []Role{RoleReader, RoleEditor}}, nil},
+		{"empty name", APIKey{Scopes: []Role{RoleReader}}, []string{"required"}},
+		{"too long", APIKey{Name: strings.Repeat("a", APIKeyNameMaxLength+1), Scopes: []Role{RoleReader}}, []string{"too_long"}},
+		{"no scope", APIKey{Name: "billing sync"}, []string{"required"}},
+		{"unknown scope", APIKey{Name: "billing sync", Scopes: []Role{RoleReader, "owner"}}, []string{"unknown_scope"}},
+	}
+	for _, tt := range tests {
+		err := tt.key.Validate()
+		if tt.wantRules == nil {
+			if err != nil {
+				t.Errorf("%s: expected no error, got %v", tt.name, err)
+			}
+			continue
+		}
+
+		var verr *ValidationError
+		if !errors.As(err, &verr) {
+			t.Fatalf("%s: expected a ValidationError, got %v", tt.name, err)
+		}
+		rules := make([]string, len(verr.Violations))
+		for i, v := range verr.Violations {
+			rules[i] = v.Rule
+		}
+		if !slices.Equal(rules, tt.wantRules) {
+			t.Errorf("%s: expected rules %v, got %v", tt.name, tt.wantRules, rules)
+		}
+	}
+}
+
+func TestAPIKeyNormalize(t *testing.T) {
+	key := APIKey{Name: " billing sync\n", Scopes: []Role{"reader ", RoleReader, RoleEditor}}
+	key.Normalize()
+
+	if key.Name != "billing sync" {
+		t.Errorf("expected trimmed name, got %q", key.Name)
+	}
+	if want := []Role{RoleReader, RoleEditor}; !slices.Equal(key.Scopes, want) {
+		t.Errorf("expected scopes %v, got %v", want, key.Scopes)
+	}
+}
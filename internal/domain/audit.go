@@ -0,0 +1,147 @@
+package domain
+
+import (
+	"slices"
+	"time"
+)
+
+// Principal is the authenticated caller on whose behalf an operation runs.
+type Principal struct {
+	ID    string
+	Roles []Role
+
+	// TenantID is the tenant the principal belongs to, and the only one whose
+	// data it can reach. Empty means the default tenant.
+	TenantID string
+
+	// APIKeyID is the ID of the API key that authenticated the principal, or
+	// empty if it was authenticated otherwise.
+	APIKeyID string
+}
+
+// HasRole reports whether the principal was granted role.
+func (p Principal) HasRole(role Role) bool {
+	return slices.Contains(p.Roles, role)
+}
+
+// Role is a set of permissions granted to principals.
+type Role string
+
+// Roles known to the service.
+const (
+	// RoleReader may read every entity.
+	RoleReader Role = "reader"
+
+	// RoleEditor may create entities, and read and change the ones it owns.
+	RoleEditor Role = "editor"
+
+	// RoleAdmin may do anything to every entity.
+	RoleAdmin Role = "admin"
+)
+
+// Roles lists every role.
+var Roles = []Role{RoleReader, RoleEditor, RoleAdmin}
+
+// AuditAction names a kind of audited change.
+type AuditAction string
+
+// Audited entity changes.
+const (
+	AuditActionCreate  AuditAction = "create"
+	AuditActionUpdate  AuditAction = "update"
+	AuditActionDelete  AuditAction = "delete"
+	AuditActionRestore AuditAction = "restore"
+)
+
+// AuditEntry records a change of an entity: who made it, when, in which
+// request, and what it changed.
+type AuditEntry struct {
+	ID       string
+	EntityID string
+	Action   AuditAction
+
+	// Principal is the ID of the caller who made the change.
+	Principal string
+
+	// RequestID identifies the request that made the change, if any.
+	RequestID string
+
+	OccurredAt time.Time
+
+	// Before is the entity before the change, or nil if it was not visible:
+	// created or restored from the trash.
+	// After is the entity after the change, or nil if it was moved to the trash.
+	Before *Entity
+	After  *Entity
+
+	// Changes lists the fields that differ between Before and After.
+	Changes []FieldChange
+}
+
+// FieldChange is the change of a field of an entity. A nil value means that
+// the field had no value, because the entity was not visible or the field was
+// not set.
+type FieldChange struct {
+	Field  string
+	Before any
+	After  any
+}
+
+// DiffEntities returns the fields that differ between before and after,
+// either of which may be nil.
+func DiffEntities(before, after *Entity) []FieldChange {
+	var changes []FieldChange
+	diff := func(field string, value func(e *Entity) any) {
+		var b, a any
+		if before != nil {
+			b = value(before)
+		}
+		if after != nil {
+			a = value(after)
+		}
+		if b != a {
+			changes = append(changes, FieldChange{Field: field, Before: b, After: a})
+		}
+	}
+
+	diff("name", func(e *Entity) any { return e.Name })
+	diff("ownerId", func(e *Entity) any { return stringValue(e.OwnerID) })
+	diff("version", func(e *Entity) any { return e.Version })
+	diff("createdAt", func(e *Entity) any { return timeValue(e.CreatedAt) })
+	diff("updatedAt", func(e *Entity) any { return timeValue(e.UpdatedAt) })
+	diff("deletedAt", func(e *Entity) any { return timeValue(e.DeletedAt) })
+	return changes
+}
+
+// stringValue returns s, or nil if it is empty.
+func stringValue(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// timeValue returns t in UTC, so that equal times compare equal, or nil if t is zero.
+func timeValue(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC()
+}
+
+// AuditListOptions filters and paginates the audit entries of an entity.
+type AuditListOptions struct {
+	EntityID string
+	Limit    int
+
+	// Cursor is the opaque position returned as AuditPage.NextCursor.
+	Cursor string
+}
+
+// AuditPage is a page of audit entries, oldest first.
+type AuditPage struct {
+	Entries []*AuditEntry
+
+	// NextCursor continues the listing after this page; empty on the last page.
+	NextCursor string
+}
@@ -0,0 +1,43 @@
+package domain
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDiffEntities(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	entity := &Entity{ID: "1", Name: "Test", Version: 1, CreatedAt: at, UpdatedAt: at}
+	renamed := &Entity{ID: "1", Name: "Renamed", Version: 2, CreatedAt: at, UpdatedAt: at.Add(time.Second)}
+	deleted := &Entity{ID: "1", Name: "Test", Version: 2, CreatedAt: at, UpdatedAt: at, DeletedAt: at.Add(time.Minute)}
+
+	tests := []struct {
+		name          string
+		before, after *Entity
+		want          []FieldChange
+	}{
+		{"unchanged", entity, entity, nil},
+		{"same instant in another zone", entity, &Entity{ID: "1", Name: "Test", Version: 1, CreatedAt: at.In(time.FixedZone("CET", 3600)), UpdatedAt: at}, nil},
+		{"update", entity, renamed, []FieldChange{
+			{Field: "name", Before: "Test", After: "Renamed"},
+			{Field: "version", Before: int64(1), After: int64(2)},
+			{Field: "updatedAt", Before: at, After: at.Add(time.Second)},
+		}},
+		{"soft delete", entity, deleted, []FieldChange{
+			{Field: "version", Before: int64(1), After: int64(2)},
+			{Field: "deletedAt", Before: nil, After: at.Add(time.Minute)},
+		}},
+		{"create", nil, entity, []FieldChange{
+			{Field: "name", Before: nil, After: "Test"},
+			{Field: "version", Before: nil, After: int64(1)},
+			{Field: "createdAt", Before: nil, After: at},
+			{Field: "updatedAt", Before: nil, After: at},
+		}},
+	}
+	for _, tt := range tests {
+		if got := DiffEntities(tt.before, tt.after); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
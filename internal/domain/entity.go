@@ -1,11 +1,174 @@
 package domain
 
-import "time"
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
 
 // Entity represents a generic domain entity.
 type Entity struct {
+	ID   string
+	Name string
+
+	// TenantID is the tenant the entity belongs to, set by the repository from
+	// the context of its creation. Empty means the default tenant.
+	TenantID string
+
+	// OwnerID is the ID of the principal who created the entity, or empty if
+	// it was created without one. It never changes.
+	OwnerID string
+
+	// Version starts at 1 and is incremented by every update. When set on an
+	// update or delete, the operation only succeeds if it matches the stored one.
+	Version int64
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	// DeletedAt is set when the entity is moved to the trash, and zero otherwise.
+	DeletedAt time.Time
+}
+
+// IsDeleted reports whether the entity is in the trash.
+func (e *Entity) IsDeleted() bool {
+	return !e.DeletedAt.IsZero()
+}
+
+// Constraints on entity names.
+const (
+	EntityNameMaxLength = 100
+
+	// entityNamePunctuation lists the characters allowed in names besides
+	// letters, digits and spaces.
+	entityNamePunctuation = "-_.,'&()/:"
+)
+
+// reservedEntityNames cannot be used as names, whatever their case.
+var reservedEntityNames = []string{"new", "null", "undefined", "system"}
+
+// Normalize trims the leading and trailing whitespace of the entity's fields.
+func (e *Entity) Normalize() {
+	e.Name = strings.TrimSpace(e.Name)
+}
+
+// Validate checks the entity against the domain rules and returns a
+// *ValidationError listing every violation, or nil if the entity is valid.
+// It expects a normalized entity; see Normalize.
+func (e *Entity) Validate() error {
+	var verr ValidationError
+
+	switch {
+	case e.Name == "":
+		verr.add("name", "required", "must not be empty")
+	case utf8.RuneCountInString(e.Name) > EntityNameMaxLength:
+		verr.add("name", "too_long", fmt.Sprintf("must be at most %d characters", EntityNameMaxLength))
+	}
+	if strings.ContainsFunc(e.Name, func(r rune) bool { return !isEntityNameRune(r) }) {
+		verr.add("name", "invalid_characters", "may only contain letters, digits, spaces and "+entityNamePunctuation)
+	}
+	for _, reserved := range reservedEntityNames {
+		if strings.EqualFold(e.Name, reserved) {
+			verr.add("name", "reserved", fmt.Sprintf("%q is a reserved name", e.Name))
+		}
+	}
+
+	if e.Version < 0 {
+		verr.add("version", "out_of_range", "must not be negative")
+	}
+
+	return verr.errOrNil()
+}
+
+// isEntityNameRune reports whether r may appear in an entity name.
+func isEntityNameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsDigit(r) || r == ' ' ||
+		strings.ContainsRune(entityNamePunctuation, r)
+}
+
+// EntitySortField names a field that entities can be ordered by.
+type EntitySortField string
+
+// Supported sort fields. Ties are always broken by ID.
+const (
+	EntitySortByCreatedAt EntitySortField = "createdAt"
+	EntitySortByUpdatedAt EntitySortField = "updatedAt"
+	EntitySortByName      EntitySortField = "name"
+)
+
+// EntityDeletedFilter selects entities by whether they are in the trash.
+type EntityDeletedFilter string
+
+// Supported deleted filters.
+const (
+	EntityDeletedExcluded EntityDeletedFilter = "" // The default: only entities not in the trash.
+	EntityDeletedIncluded EntityDeletedFilter = "include"
+	EntityDeletedOnly     EntityDeletedFilter = "only"
+)
+
+// EntityListOptions controls which entities a list returns, and in which order.
+type EntityListOptions struct {
+	// Limit is the maximum number of entities to return. Zero means no limit.
+	Limit int
+
+	// Cursor is the opaque token returned as EntityPage.NextCursor by a previous
+	// call. It is decoded by the service, which then sets After.
+	Cursor string
+
+	// After is the position to resume from; only entities sorted after it are returned.
+	After *EntityCursor
+
+	SortBy     EntitySortField
+	Descending bool
+
+	// NamePrefix keeps only the entities whose name starts with it.
+	NamePrefix string
+
+	// CreatedAfter keeps only the entities created strictly after it.
+	CreatedAfter time.Time
+
+	// Deleted selects entities by whether they are in the trash.
+	Deleted EntityDeletedFilter
+
+	// OwnerID, if set, keeps only the entities of that owner.
+	OwnerID string
+}
+
+// EntityCursor identifies a position in a sorted list of entities.
+// Only ID and the field matching the sort order are meaningful.
+type EntityCursor struct {
 	ID        string
 	Name      string
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
+
+// EntityPage is a page of a sorted list of entities.
+type EntityPage struct {
+	Entities []*Entity
+
+	// NextCursor fetches the following page; it is empty on the last page.
+	NextCursor string
+}
+
+// EntityOperationKind names a write in a batch of entity operations.
+type EntityOperationKind string
+
+// Supported batch operations.
+const (
+	EntityOperationCreate EntityOperationKind = "create"
+	EntityOperationUpdate EntityOperationKind = "update"
+	EntityOperationDelete EntityOperationKind = "delete"
+)
+
+// EntityOperation is a write in a batch of entity operations.
+type EntityOperation struct {
+	Kind EntityOperationKind
+
+	// Entity is the entity to create or update, or holds the ID and version
+	// of the entity to delete. Created and updated entities hold the stored
+	// values once the operation succeeds.
+	Entity *Entity
+}
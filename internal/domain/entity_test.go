@@ -0,0 +1,55 @@
+package domain
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestEntityValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		entity    Entity
+		wantRules []string
+	}{
+		{"valid", Entity{Name: "Café No. 5 (Paris)"}, nil},
+		{"empty name", Entity{Name: ""}, []string{"required"}},
+		{"max length", Entity{Name: strings.Repeat("é", EntityNameMaxLength)}, nil},
+		{"too long", Entity{Name: strings.Repeat("a", EntityNameMaxLength+1)}, []string{"too_long"}},
+		{"invalid characters", Entity{Name: "Tab\there<script>"}, []string{"invalid_characters"}},
+		{"reserved name", Entity{Name: "NULL"}, []string{"reserved"}},
+		{"negative version", Entity{Name: "Test", Version: -1}, []string{"out_of_range"}},
+		{"every violation", Entity{Name: strings.Repeat("!", EntityNameMaxLength+1), Version: -1}, []string{"too_long", "invalid_characters", "out_of_range"}},
+	}
+	for _, tt := range tests {
+		err := tt.entity.Validate()
+		if tt.wantRules == nil {
+			if err != nil {
+				t.Errorf("%s: expected no error, got %v", tt.name, err)
+			}
+			continue
+		}
+
+		var verr *ValidationError
+		if !errors.As(err, &verr) {
+			t.Fatalf("%s: expected a ValidationError, got %v", tt.name, err)
+		}
+		rules := make([]string, len(verr.Violations))
+		for i, v := range verr.Violations {
+			rules[i] = v.Rule
+		}
+		if !slices.Equal(rules, tt.wantRules) {
+			t.Errorf("%s: expected rules %v, got %v", tt.name, tt.wantRules, rules)
+		}
+	}
+}
+
+func TestEntityNormalize(t *testing.T) {
+	entity := Entity{Name: "  Test \n"}
+	entity.Normalize()
+
+	if entity.Name != "Test" {
+		t.Errorf("expected trimmed name, got %q", entity.Name)
+	}
+}
@@ -0,0 +1,78 @@
+package domain
+
+import "time"
+
+// EventType names a kind of domain event.
+type EventType string
+
+// Entity lifecycle events.
+const (
+	EventEntityCreated  EventType = "entity.created"
+	EventEntityUpdated  EventType = "entity.updated"
+	EventEntityDeleted  EventType = "entity.deleted"
+	EventEntityRestored EventType = "entity.restored"
+)
+
+// Event is a change in the domain that other systems may react to.
+type Event interface {
+	// EventType returns the kind of the event.
+	EventType() EventType
+
+	// EntityID returns the ID of the entity the event is about.
+	EntityID() string
+}
+
+// EntityCreated is emitted when an entity is created.
+type EntityCreated struct {
+	Entity Entity // As stored.
+}
+
+func (e EntityCreated) EventType() EventType { return EventEntityCreated }
+func (e EntityCreated) EntityID() string     { return e.Entity.ID }
+
+// EntityUpdated is emitted when an entity is updated or patched.
+type EntityUpdated struct {
+	Entity Entity // As stored after the update.
+}
+
+func (e EntityUpdated) EventType() EventType { return EventEntityUpdated }
+func (e EntityUpdated) EntityID() string     { return e.Entity.ID }
+
+// EntityDeleted is emitted when an entity is moved to the trash.
+type EntityDeleted struct {
+	ID      string
+	OwnerID string // Owner of the deleted entity; not part of the payload.
+}
+
+func (e EntityDeleted) EventType() EventType { return EventEntityDeleted }
+func (e EntityDeleted) EntityID() string     { return e.ID }
+
+// EntityRestored is emitted when an entity is taken out of the trash.
+type EntityRestored struct {
+	Entity Entity // As stored after the restore.
+}
+
+func (e EntityRestored) EventType() EventType { return EventEntityRestored }
+func (e EntityRestored) EntityID() string     { return e.Entity.ID }
+
+// EventMessage is an encoded domain event, as stored in the outbox and
+// handed to publishers.
+type EventMessage struct {
+	// ID identifies the event. An event may be published more than once, and
+	// consumers can use the ID to drop the duplicates.
+	ID string
+
+	Type       EventType
+	EntityID   string
+	OccurredAt time.Time
+
+	// TenantID is the tenant of the entity, whose consumers alone may see the event.
+	TenantID string
+
+	// OwnerID is the owner of the entity, which decides which principals of
+	// the tenant may see the event.
+	OwnerID string
+
+	// Payload is the event encoded as a JSON object.
+	Payload []byte
+}
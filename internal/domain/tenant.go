@@ -0,0 +1,22 @@
+package domain
+
+// TenantIDMaxLength is the longest accepted tenant ID.
+const TenantIDMaxLength = 63
+
+// ValidTenantID reports whether id is a valid tenant ID: lowercase letters,
+// digits and hyphens, neither first nor last, so that every tenant ID is also
+// a DNS label. The empty ID, which names the default tenant, is valid.
+func ValidTenantID(id string) bool {
+	if id == "" {
+		return true
+	}
+	if len(id) > TenantIDMaxLength || id[0] == '-' || id[len(id)-1] == '-' {
+		return false
+	}
+	for _, r := range id {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+			return false
+		}
+	}
+	return true
+}
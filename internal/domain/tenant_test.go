@@ -0,0 +1,28 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidTenantID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"", true},
+		{"acme", true},
+		{"acme-42", true},
+		{"Acme", false},
+		{"-acme", false},
+		{"acme-", false},
+		{"acme.example", false},
+		{strings.Repeat("a", TenantIDMaxLength), true},
+		{strings.Repeat("a", TenantIDMaxLength+1), false},
+	}
+	for _, tt := range tests {
+		if got := ValidTenantID(tt.id); got != tt.want {
+			t.Errorf("%q: expected %v, got %v", tt.id, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package domain
+
+import "strings"
+
+// Violation describes a rule that a field does not satisfy.
+type Violation struct {
+	Field   string // Name of the field, e.g. "name".
+	Rule    string // Rule that failed, e.g. "required".
+	Message string // Human-readable explanation, e.g. "must not be empty".
+}
+
+// ValidationError lists every rule a domain object violates.
+type ValidationError struct {
+	Violations []Violation
+}
+
+// Error joins the violations into a single message.
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		parts[i] = v.Field + ": " + v.Message
+	}
+	return "validation failed: " + strings.Join(parts, "; ")
+}
+
+// add records a violation.
+func (e *ValidationError) add(field, rule, message string) {
+	e.Violations = append(e.Violations, Violation{Field: field, Rule: rule, Message: message})
+}
+
+// errOrNil returns e if it holds any violation, and nil otherwise.
+func (e *ValidationError) errOrNil() error {
+	if len(e.Violations) == 0 {
+		return nil
+	}
+	return e
+}
@@ -0,0 +1,142 @@
+package domain
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Webhook is the subscription of an HTTP endpoint to domain events.
+type Webhook struct {
+	ID  string
+	URL string
+
+	// EventTypes lists the events delivered to the webhook. Empty means every event.
+	EventTypes []EventType
+
+	// Secret is the key the deliveries are signed with, so that the receiver
+	// can check that they come from us.
+	Secret string
+
+	// TenantID is the tenant the webhook was registered in. Only the events of
+	// its entities are delivered to the webhook.
+	TenantID string
+
+	// OwnerID and OwnerRoles are the principal that registered the webhook and
+	// its roles then. Only the events of the entities that this principal may
+	// read are delivered. An empty OwnerID means that authentication was disabled.
+	OwnerID    string
+	OwnerRoles []Role
+
+	CreatedAt time.Time
+}
+
+// WebhookURLMaxLength is the longest accepted webhook URL.
+const WebhookURLMaxLength = 2048
+
+// EventTypes lists every kind of domain event.
+var EventTypes = []EventType{EventEntityCreated, EventEntityUpdated, EventEntityDeleted, EventEntityRestored}
+
+// Subscribes reports whether events of type t are delivered to the webhook.
+func (w *Webhook) Subscribes(t EventType) bool {
+	return len(w.EventTypes) == 0 || slices.Contains(w.EventTypes, t)
+}
+
+// Normalize trims the leading and trailing whitespace of the webhook's fields,
+// and drops duplicate event types.
+func (w *Webhook) Normalize() {
+	w.URL = strings.TrimSpace(w.URL)
+
+	types := make([]EventType, 0, len(w.EventTypes))
+	for _, t := range w.EventTypes {
+		t = EventType(strings.TrimSpace(string(t)))
+		if !slices.Contains(types, t) {
+			types = append(types, t)
+		}
+	}
+	w.EventTypes = types
+}
+
+// Validate checks the webhook against the domain rules and returns a
+// *ValidationError listing every violation, or nil if the webhook is valid.
+// It expects a normalized webhook; see Normalize.
+func (w *Webhook) Validate() error {
+	var verr ValidationError
+
+	switch u, err := url.Parse(w.URL); {
+	case w.URL == "":
+		verr.add("url", "required", "must not be empty")
+	case len(w.URL) > WebhookURLMaxLength:
+		verr.add("url", "too_long", fmt.Sprintf("must be at most %d characters", WebhookURLMaxLength))
+	case err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "":
+		verr.add("url", "invalid_url", "must be an absolute http or https URL")
+	case u.User != nil:
+		verr.add("url", "invalid_url", "must not contain credentials")
+	}
+
+	for _, t := range w.EventTypes {
+		if !slices.Contains(EventTypes, t) {
+			verr.add("eventTypes", "unknown_event_type", fmt.Sprintf("%q is not an event type", t))
+		}
+	}
+
+	return verr.errOrNil()
+}
+
+// DeliveryStatus is the state of a webhook delivery.
+type DeliveryStatus string
+
+// Delivery states. A pending delivery is attempted until it succeeds or runs
+// out of attempts, in which case it is dead-lettered.
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	DeliveryDead      DeliveryStatus = "dead"
+)
+
+// WebhookDelivery is the delivery of an event to a webhook.
+type WebhookDelivery struct {
+	ID        string
+	WebhookID string
+	Event     EventMessage
+	Status    DeliveryStatus
+
+	// Attempts logs every attempt to deliver the event, oldest first.
+	Attempts []DeliveryAttempt
+
+	// Failures counts the attempts that failed in a row, and sets the delay
+	// before the next one.
+	Failures int
+
+	// NextAttemptAt is when a pending delivery is attempted next.
+	NextAttemptAt time.Time
+
+	// LastError explains why the last attempt failed, or why the delivery was
+	// dead-lettered without one. It is empty once the delivery succeeds.
+	LastError string
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// DeliveryAttempt is an attempt to deliver an event to a webhook.
+type DeliveryAttempt struct {
+	At       time.Time
+	Duration time.Duration
+
+	// StatusCode is the status of the response, or zero if there was none.
+	StatusCode int
+
+	// Error is empty if the attempt succeeded.
+	Error string
+}
+
+// DeliveryListOptions filters and limits the deliveries returned by a list.
+type DeliveryListOptions struct {
+	WebhookID string         // Empty means every webhook.
+	Status    DeliveryStatus // Empty means every status.
+	TenantID  string         // The tenant of the events. Empty means the default tenant.
+	Limit     int
+}
@@ -0,0 +1,151 @@
+package http
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/service"
+	"github.com/go-chi/chi/v5"
+)
+
+// APIKeyHandler is responsible for handling HTTP requests related to API keys.
+type APIKeyHandler struct {
+	responder
+	decoder
+	service service.APIKeyService
+}
+
+// NewAPIKeyHandler creates a new APIKeyHandler.
+// Request bodies larger than maxBodyBytes are rejected; zero means DefaultMaxBodyBytes.
+func NewAPIKeyHandler(service service.APIKeyService, logger *slog.Logger, maxBodyBytes int64) *APIKeyHandler {
+	return &APIKeyHandler{
+		responder: responder{logger: logger},
+		decoder:   newDecoder(maxBodyBytes),
+		service:   service,
+	}
+}
+
+// CreateAPIKeyRequest defines the request body for creating an API key.
+type CreateAPIKeyRequest struct {
+	Name string `json:"name"`
+
+	// Scopes are the roles granted to the key, e.g. "reader".
+	Scopes []string `json:"scopes"`
+}
+
+// toDomain converts a CreateAPIKeyRequest to a domain.APIKey.
+func (r *CreateAPIKeyRequest) toDomain() *domain.APIKey {
+	key := &domain.APIKey{Name: r.Name}
+	for _, s := range r.Scopes {
+		key.Scopes = append(key.Scopes, domain.Role(s))
+	}
+	return key
+}
+
+// APIKeyResponse defines the response body for an API key.
+type APIKeyResponse struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Prefix string   `json:"prefix"`
+	Scopes []string `json:"scopes"`
+
+	// Key authenticates requests. It is only returned when the key is created.
+	Key string `json:"key,omitempty"`
+
+	OwnerID    string     `json:"ownerId"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+}
+
+// ListAPIKeysResponse defines the response body for the list of API keys.
+type ListAPIKeysResponse struct {
+	APIKeys []*APIKeyResponse `json:"apiKeys"`
+}
+
+// fromDomainAPIKey converts a domain.APIKey to an APIKeyResponse, without the key.
+func fromDomainAPIKey(key *domain.APIKey) *APIKeyResponse {
+	response := &APIKeyResponse{
+		ID:        key.ID,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		Scopes:    make([]string, len(key.Scopes)),
+		OwnerID:   key.OwnerID,
+		CreatedAt: key.CreatedAt,
+	}
+	for i, s := range key.Scopes {
+		response.Scopes[i] = string(s)
+	}
+	if !key.LastUsedAt.IsZero() {
+		response.LastUsedAt = &key.LastUsedAt
+	}
+	if key.IsRevoked() {
+		response.RevokedAt = &key.RevokedAt
+	}
+	return response
+}
+
+// CreateAPIKey handles the POST /api-keys endpoint.
+// It responds with the stored key, including the key itself, which is not
+// stored and cannot be retrieved again.
+func (h *APIKeyHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req CreateAPIKeyRequest
+	if err := h.decodeJSON(w, r, &req); err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	key := req.toDomain()
+	secret, err := h.service.Create(r.Context(), key)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response := fromDomainAPIKey(key)
+	response.Key = secret
+	w.Header().Set("Location", "/api-keys/"+url.PathEscape(key.ID))
+	w.Header().Set("Cache-Control", "no-store")
+	h.writeJSON(w, r, http.StatusCreated, response)
+}
+
+// ListAPIKeys handles the GET /api-keys endpoint.
+func (h *APIKeyHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.service.List(r.Context())
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response := &ListAPIKeysResponse{APIKeys: make([]*APIKeyResponse, len(keys))}
+	for i, key := range keys {
+		response.APIKeys[i] = fromDomainAPIKey(key)
+	}
+	h.writeJSON(w, r, http.StatusOK, response)
+}
+
+// GetAPIKey handles the GET /api-keys/{id} endpoint.
+func (h *APIKeyHandler) GetAPIKey(w http.ResponseWriter, r *http.Request) {
+	key, err := h.service.GetByID(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	h.writeJSON(w, r, http.StatusOK, fromDomainAPIKey(key))
+}
+
+// RevokeAPIKey handles the POST /api-keys/{id}/revoke endpoint.
+// It revokes the key for good and responds with it.
+func (h *APIKeyHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	key, err := h.service.Revoke(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	h.writeJSON(w, r, http.StatusOK, fromDomainAPIKey(key))
+}
@@ -0,0 +1,116 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// AuditEntryResponse defines the response body for an entry of the audit log
+// of an entity.
+type AuditEntryResponse struct {
+	ID         string    `json:"id"`
+	EntityID   string    `json:"entityId"`
+	Action     string    `json:"action"`
+	Principal  string    `json:"principal"`
+	RequestID  string    `json:"requestId,omitempty"`
+	OccurredAt time.Time `json:"occurredAt"`
+
+	// Before and After are omitted when the entity was not visible, before it
+	// was created or restored, and after it was deleted.
+	Before  *EntityResponse        `json:"before,omitempty"`
+	After   *EntityResponse        `json:"after,omitempty"`
+	Changes []*FieldChangeResponse `json:"changes"`
+}
+
+// FieldChangeResponse defines a changed field of an audit entry. A null value
+// means that the field had no value.
+type FieldChangeResponse struct {
+	Field  string `json:"field"`
+	Before any    `json:"before"`
+	After  any    `json:"after"`
+}
+
+// EntityHistoryResponse defines the response body for a page of the audit log
+// of an entity.
+type EntityHistoryResponse struct {
+	Entries    []*AuditEntryResponse `json:"entries"`
+	NextCursor string                `json:"nextCursor,omitempty"`
+}
+
+// fromDomainAuditEntry converts a domain.AuditEntry to an AuditEntryResponse.
+func fromDomainAuditEntry(entry *domain.AuditEntry) *AuditEntryResponse {
+	response := &AuditEntryResponse{
+		ID:         entry.ID,
+		EntityID:   entry.EntityID,
+		Action:     string(entry.Action),
+		Principal:  entry.Principal,
+		RequestID:  entry.RequestID,
+		OccurredAt: entry.OccurredAt,
+		Changes:    make([]*FieldChangeResponse, len(entry.Changes)),
+	}
+	if entry.Before != nil {
+		response.Before = fromDomain(entry.Before)
+	}
+	if entry.After != nil {
+		response.After = fromDomain(entry.After)
+	}
+	for i, c := range entry.Changes {
+		response.Changes[i] = &FieldChangeResponse{Field: c.Field, Before: c.Before, After: c.After}
+	}
+	return response
+}
+
+// GetEntityHistory handles the GET /entities/{id}/history endpoint.
+// It responds with the audit log of the entity, oldest first, which is kept
+// after the entity is deleted.
+//
+// Query parameters:
+//   - limit: page size
+//   - cursor: the nextCursor of the previous page
+func (h *EntityHandler) GetEntityHistory(w http.ResponseWriter, r *http.Request) {
+	opts := domain.AuditListOptions{
+		EntityID: chi.URLParam(r, "id"),
+		Cursor:   r.URL.Query().Get("cursor"),
+	}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			h.handleError(w, r, invalidQuery("limit", "must be a positive integer"))
+			return
+		}
+		opts.Limit = limit
+	}
+
+	page, err := h.service.History(r.Context(), opts)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response := &EntityHistoryResponse{
+		Entries:    make([]*AuditEntryResponse, len(page.Entries)),
+		NextCursor: page.NextCursor,
+	}
+	for i, entry := range page.Entries {
+		response.Entries[i] = fromDomainAuditEntry(entry)
+	}
+	h.writeJSON(w, r, http.StatusOK, response)
+}
+
+// RequestContext is a middleware that passes the ID set by chi's RequestID
+// middleware on to the services, which record it in the audit log. It must
+// come after RequestID.
+func RequestContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id := middleware.GetReqID(r.Context()); id != "" {
+			r = r.WithContext(service.WithRequestID(r.Context(), id))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
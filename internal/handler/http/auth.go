@@ -0,0 +1,98 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/apperror"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/service"
+)
+
+// authRealm is the protection space announced in WWW-Authenticate headers.
+const authRealm = "api"
+
+// TokenVerifier checks the credentials of an authentication scheme, like
+// bearer tokens or API keys.
+type TokenVerifier interface {
+	// Verify returns the principal authenticated by token. Errors that wrap
+	// apperror.ErrInternal are failures of the server; any other error is
+	// shown to clients as the reason why the token was rejected.
+	Verify(ctx context.Context, token string) (domain.Principal, error)
+}
+
+// AuthScheme is an HTTP authentication scheme accepted by an Authenticator.
+type AuthScheme struct {
+	// Name is the scheme of the Authorization header, e.g. "Bearer".
+	// It is matched case-insensitively.
+	Name     string
+	Verifier TokenVerifier
+}
+
+// Authenticator is a middleware that requires valid credentials on every
+// request, in the Authorization header with one of its schemes, and passes
+// the principal they authenticate on to the handlers and services through the
+// request context.
+type Authenticator struct {
+	responder
+	schemes []AuthScheme
+}
+
+// NewAuthenticator creates an Authenticator that accepts the given schemes,
+// which are announced to clients in this order.
+func NewAuthenticator(schemes []AuthScheme, logger *slog.Logger) *Authenticator {
+	return &Authenticator{
+		responder: responder{logger: logger},
+		schemes:   schemes,
+	}
+}
+
+// Middleware rejects requests without valid credentials with a 401
+// Unauthorized response.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scheme, token, ok := a.credentials(r)
+		if !ok {
+			names := make([]string, len(a.schemes))
+			for i, s := range a.schemes {
+				w.Header().Add("WWW-Authenticate", s.Name+` realm="`+authRealm+`"`)
+				names[i] = s.Name
+			}
+			a.handleError(w, r, apperror.New(apperror.ErrUnauthenticated, "missing_credentials",
+				"credentials are required, with the "+strings.Join(names, " or ")+" scheme"))
+			return
+		}
+
+		principal, err := scheme.Verifier.Verify(r.Context(), token)
+		switch {
+		case errors.Is(err, apperror.ErrInternal):
+			a.handleError(w, r, err)
+			return
+		case err != nil:
+			w.Header().Set("WWW-Authenticate", scheme.Name+` realm="`+authRealm+`", error="invalid_token"`)
+			a.handleError(w, r, apperror.New(apperror.ErrUnauthenticated, "invalid_token", err.Error()))
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(service.WithPrincipal(r.Context(), principal)))
+	})
+}
+
+// credentials returns the scheme and the token of the Authorization header,
+// if it uses one of the schemes of the Authenticator.
+func (a *Authenticator) credentials(r *http.Request) (AuthScheme, string, bool) {
+	name, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	token = strings.TrimSpace(token)
+	if !ok || token == "" {
+		return AuthScheme{}, "", false
+	}
+	for _, s := range a.schemes {
+		if strings.EqualFold(name, s.Name) {
+			return s, token, true
+		}
+	}
+	return AuthScheme{}, "", false
+}
@@ -0,0 +1,115 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/apperror"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+)
+
+// Batch modes.
+const (
+	batchModeAtomic     = "atomic"
+	batchModeBestEffort = "bestEffort"
+)
+
+// BatchEntitiesRequest defines the request body for a batch of entity operations.
+type BatchEntitiesRequest struct {
+	// Mode is "atomic" (default), to apply every operation or none, or
+	// "bestEffort", to apply every operation that succeeds.
+	Mode       string                  `json:"mode"`
+	Operations []BatchOperationRequest `json:"operations"`
+}
+
+// BatchOperationRequest defines an operation in a batch.
+// Op is "create", "update" or "delete"; ID is ignored on create. A non-zero
+// Version must match the stored one, as with If-Match.
+type BatchOperationRequest struct {
+	Op      string `json:"op"`
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Version int64  `json:"version"`
+}
+
+// toDomain converts a BatchOperationRequest to a domain.EntityOperation.
+func (r *BatchOperationRequest) toDomain() domain.EntityOperation {
+	return domain.EntityOperation{
+		Kind: domain.EntityOperationKind(r.Op),
+		Entity: &domain.Entity{
+			ID:      r.ID,
+			Name:    r.Name,
+			Version: r.Version,
+		},
+	}
+}
+
+// BatchEntitiesResponse defines the response body for a batch of entity operations.
+// Results are in the order of the operations.
+type BatchEntitiesResponse struct {
+	Results []*BatchOperationResult `json:"results"`
+}
+
+// BatchOperationResult defines the outcome of an operation in a batch. Status
+// is the status the matching single-entity endpoint would respond with.
+type BatchOperationResult struct {
+	Status int             `json:"status"`
+	Entity *EntityResponse `json:"entity,omitempty"`
+	Error  *Problem        `json:"error,omitempty"`
+}
+
+// BatchEntities handles the POST /entities:batch endpoint.
+// It responds with 200 OK and a result per operation, whether they succeeded
+// or not. In atomic mode, the operations that did not fail report 424 Failed
+// Dependency if any other did.
+func (h *EntityHandler) BatchEntities(w http.ResponseWriter, r *http.Request) {
+	var req BatchEntitiesRequest
+	if err := h.decodeJSON(w, r, &req); err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	var atomic bool
+	switch req.Mode {
+	case "", batchModeAtomic:
+		atomic = true
+	case batchModeBestEffort:
+	default:
+		h.handleError(w, r, invalidBody("request body contains an invalid field").
+			WithFields(apperror.FieldError{Field: "mode", Code: "invalid", Message: "must be atomic or bestEffort"}))
+		return
+	}
+
+	ops := make([]domain.EntityOperation, len(req.Operations))
+	for i := range req.Operations {
+		ops[i] = req.Operations[i].toDomain()
+	}
+
+	errs, err := h.service.Batch(r.Context(), ops, atomic)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response := &BatchEntitiesResponse{Results: make([]*BatchOperationResult, len(ops))}
+	for i, op := range ops {
+		response.Results[i] = h.batchResult(r, op, errs[i])
+	}
+	h.writeJSON(w, r, http.StatusOK, response)
+}
+
+// batchResult converts the outcome of a batch operation to its result.
+func (h *EntityHandler) batchResult(r *http.Request, op domain.EntityOperation, err error) *BatchOperationResult {
+	if err != nil {
+		problem := h.problemFor(r, err)
+		return &BatchOperationResult{Status: problem.Status, Error: &problem}
+	}
+
+	switch op.Kind {
+	case domain.EntityOperationCreate:
+		return &BatchOperationResult{Status: http.StatusCreated, Entity: fromDomain(op.Entity)}
+	case domain.EntityOperationDelete:
+		return &BatchOperationResult{Status: http.StatusOK}
+	default:
+		return &BatchOperationResult{Status: http.StatusOK, Entity: fromDomain(op.Entity)}
+	}
+}
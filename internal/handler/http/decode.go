@@ -0,0 +1,143 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/apperror"
+)
+
+// DefaultMaxBodyBytes is the request body limit used when none is configured.
+const DefaultMaxBodyBytes = 1 << 20 // 1 MiB
+
+// Transport-level error kinds, reported alongside the apperror ones by handleError.
+var (
+	errBodyTooLarge         = errors.New("request body too large")
+	errUnsupportedMediaType = errors.New("unsupported media type")
+)
+
+// decoder decodes request bodies for the handlers that embed it.
+type decoder struct {
+	maxBodyBytes int64
+}
+
+// newDecoder creates a decoder that rejects bodies larger than maxBodyBytes;
+// zero means DefaultMaxBodyBytes.
+func newDecoder(maxBodyBytes int64) decoder {
+	if maxBodyBytes <= 0 {
+		maxBodyBytes = DefaultMaxBodyBytes
+	}
+	return decoder{maxBodyBytes: maxBodyBytes}
+}
+
+// decodeJSON decodes the JSON request body into dst. It requires an
+// application/json Content-Type, enforces the body size limit of the decoder,
+// and rejects unknown fields and anything after the first JSON value.
+// The returned errors describe the problem precisely enough to show to clients.
+func (d decoder) decodeJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	if contentType(r) != "application/json" {
+		return apperror.New(errUnsupportedMediaType, "unsupported_media_type", "Content-Type must be application/json")
+	}
+	return d.decodeBody(w, r, dst)
+}
+
+// contentType returns the media type of the request body, without parameters.
+func contentType(r *http.Request) string {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
+
+// decodeBody is decodeJSON without the Content-Type check, for handlers that
+// accept other JSON-based media types.
+func (d decoder) decodeBody(w http.ResponseWriter, r *http.Request, dst any) error {
+	r.Body = http.MaxBytesReader(w, r.Body, d.maxBodyBytes)
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(dst); err != nil {
+		return decodeError(err)
+	}
+
+	// Decode reads a single value; anything but the end of the body is garbage.
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return decodeError(err)
+		}
+		return invalidBody("request body must contain a single JSON value")
+	}
+	return nil
+}
+
+// decodeError converts an error returned by json.Decoder.Decode to a client-facing error.
+func decodeError(err error) error {
+	var (
+		syntaxErr   *json.SyntaxError
+		typeErr     *json.UnmarshalTypeError
+		maxBytesErr *http.MaxBytesError
+	)
+	field, isUnknownField := unknownField(err)
+
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return apperror.New(errBodyTooLarge, "body_too_large", fmt.Sprintf("request body must not exceed %d bytes", maxBytesErr.Limit)).
+			WithMeta("maxBytes", maxBytesErr.Limit)
+	case errors.As(err, &syntaxErr):
+		return invalidBody(fmt.Sprintf("request body contains malformed JSON at offset %d", syntaxErr.Offset)).
+			WithMeta("offset", syntaxErr.Offset)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return invalidBody("request body contains malformed JSON")
+	case errors.Is(err, io.EOF):
+		return invalidBody("request body must not be empty")
+	case errors.As(err, &typeErr):
+		if typeErr.Field == "" {
+			return invalidBody(fmt.Sprintf("request body must be a JSON object, not %s", typeErr.Value)).
+				WithMeta("offset", typeErr.Offset)
+		}
+		return invalidBody("request body contains a field of the wrong type").
+			WithFields(apperror.FieldError{Field: typeErr.Field, Code: "wrong_type", Message: fmt.Sprintf("must be a %s, not %s", jsonType(typeErr.Type.Kind()), typeErr.Value)}).
+			WithMeta("offset", typeErr.Offset)
+	case isUnknownField:
+		return invalidBody("request body contains an unknown field").
+			WithFields(apperror.FieldError{Field: field, Code: "unknown", Message: "is not a known field"})
+	default:
+		return invalidBody("request body could not be read")
+	}
+}
+
+// unknownField returns the name of the field that a json.Decoder with
+// DisallowUnknownFields rejected, if err is such an error.
+func unknownField(err error) (string, bool) {
+	field, ok := strings.CutPrefix(err.Error(), "json: unknown field ")
+	return strings.Trim(field, `"`), ok
+}
+
+// invalidBody returns an apperror.ErrInvalidInput error about the request body.
+func invalidBody(message string) *apperror.Error {
+	return apperror.New(apperror.ErrInvalidInput, "malformed_body", message)
+}
+
+// jsonType names the JSON type that a Go kind is decoded from.
+func jsonType(kind reflect.Kind) string {
+	switch kind {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	default:
+		return "number"
+	}
+}
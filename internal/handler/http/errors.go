@@ -4,33 +4,162 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 
 	"github.com/domenicoop/go-clean-architecture-blueprint/internal/apperror"
+	"github.com/go-chi/chi/v5/middleware"
 )
 
+// Problem is an RFC 7807 problem details object, sent as application/problem+json.
+type Problem struct {
+	Type     string         `json:"type"`
+	Title    string         `json:"title"`
+	Status   int            `json:"status"`
+	Detail   string         `json:"detail,omitempty"`
+	Instance string         `json:"instance,omitempty"`
+	Code     string         `json:"code,omitempty"`
+	Errors   []FieldProblem `json:"errors,omitempty"`
+
+	// Extensions are additional members, written next to the standard ones.
+	Extensions map[string]any `json:"-"`
+}
+
+// FieldProblem describes why a single input field was rejected.
+type FieldProblem struct {
+	Field  string `json:"field"`
+	Code   string `json:"code"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// MarshalJSON writes the extension members at the top level of the object,
+// as RFC 7807 requires. Extensions cannot override the standard members.
+func (p Problem) MarshalJSON() ([]byte, error) {
+	type members Problem // Drops the MarshalJSON method to avoid recursion.
+	js, err := json.Marshal(members(p))
+	if err != nil {
+		return nil, err
+	}
+
+	var standard map[string]json.RawMessage
+	if err := json.Unmarshal(js, &standard); err != nil {
+		return nil, err
+	}
+	all := make(map[string]any, len(standard)+len(p.Extensions))
+	for k, v := range p.Extensions {
+		all[k] = v
+	}
+	for k, v := range standard {
+		all[k] = v
+	}
+	return json.Marshal(all)
+}
+
+// problemKind describes how an application error kind is reported.
+type problemKind struct {
+	kind   error
+	status int
+	slug   string
+}
+
+// problemKinds lists the known error kinds, in the order they are checked.
+var problemKinds = []problemKind{
+	{apperror.ErrInvalidInput, http.StatusBadRequest, "invalid-input"},
+	{apperror.ErrUnauthenticated, http.StatusUnauthorized, "unauthenticated"},
+	{apperror.ErrForbidden, http.StatusForbidden, "forbidden"},
+	{apperror.ErrNotFound, http.StatusNotFound, "not-found"},
+	{apperror.ErrConflict, http.StatusConflict, "conflict"},
+	{apperror.ErrPreconditionFailed, http.StatusPreconditionFailed, "precondition-failed"},
+	{apperror.ErrAborted, http.StatusFailedDependency, "aborted"},
+	{errBodyTooLarge, http.StatusRequestEntityTooLarge, "body-too-large"},
+	{errUnsupportedMediaType, http.StatusUnsupportedMediaType, "unsupported-media-type"},
+	{errIdempotencyKeyReused, http.StatusUnprocessableEntity, "idempotency-key-reused"},
+	{errRateLimited, http.StatusTooManyRequests, "rate-limited"},
+	{errStreamClosed, http.StatusServiceUnavailable, "unavailable"},
+}
+
+// problemTypePrefix prefixes the slug of a problem kind to form its type URI.
+const problemTypePrefix = "urn:problem-type:"
+
+// responder writes the responses of the handlers and middlewares in this
+// package, and logs the errors that cannot be shown to clients.
+type responder struct {
+	logger *slog.Logger
+}
+
 // handleError is a centralized error handler for the HTTP layer.
-// It maps application-specific errors to HTTP status codes and logs unknown errors.
-func (h *EntityHandler) handleError(w http.ResponseWriter, r *http.Request, err error) {
+// It maps application-specific errors to problem details and logs unknown errors.
+func (rs responder) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	rs.writeProblem(w, r, rs.problemFor(r, err))
+}
+
+// problemFor maps an error to its problem details, and logs it if it is unknown.
+func (rs responder) problemFor(r *http.Request, err error) Problem {
+	problem := Problem{
+		Type:     problemTypePrefix + "internal",
+		Title:    http.StatusText(http.StatusInternalServerError),
+		Status:   http.StatusInternalServerError,
+		Instance: middleware.GetReqID(r.Context()),
+	}
+
 	// Use errors.Is to check for known error types.
-	switch {
-	case errors.Is(err, apperror.ErrInvalidInput):
-		http.Error(w, err.Error(), http.StatusBadRequest)
-	case errors.Is(err, apperror.ErrNotFound):
-		http.Error(w, err.Error(), http.StatusNotFound)
-	case errors.Is(err, apperror.ErrConflict):
-		http.Error(w, err.Error(), http.StatusConflict)
-	default:
+	known := false
+	for _, pk := range problemKinds {
+		if errors.Is(err, pk.kind) {
+			problem.Type = problemTypePrefix + pk.slug
+			problem.Title = http.StatusText(pk.status)
+			problem.Status = pk.status
+			problem.Detail = pk.kind.Error()
+			known = true
+			break
+		}
+	}
+
+	if !known {
 		// For unknown errors, log the full error and return a generic
 		// 500 Internal Server Error to the client.
-		h.logger.Error("internal server error", "error", err.Error(), "method", r.Method, "url", r.URL.String())
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		rs.logger.Error("internal server error", "error", err.Error(), "method", r.Method, "url", r.URL.String(), "request_id", problem.Instance)
+		return problem
+	}
+
+	// Richer application errors carry a client-safe message and details.
+	var appErr *apperror.Error
+	if errors.As(err, &appErr) {
+		problem.Code = appErr.Code
+		if appErr.Message != "" {
+			problem.Detail = appErr.Message
+		}
+		for _, f := range appErr.Fields {
+			problem.Errors = append(problem.Errors, FieldProblem{Field: f.Field, Code: f.Code, Detail: f.Message})
+		}
+		problem.Extensions = appErr.Meta
+	}
+
+	return problem
+}
+
+// writeProblem writes an application/problem+json response.
+func (rs responder) writeProblem(w http.ResponseWriter, r *http.Request, problem Problem) {
+	js, err := json.Marshal(problem)
+	if err != nil {
+		// Only the extensions can fail to marshal; drop them and try again.
+		rs.logger.Error("failed to marshal problem extensions", "error", err.Error(), "method", r.Method, "url", r.URL.String())
+		problem.Extensions = nil
+		js, _ = json.Marshal(problem)
+	}
+	js = append(js, '\n')
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	if _, err := w.Write(js); err != nil {
+		rs.logger.Error("failed to write response", "error", err.Error(), "method", r.Method, "url", r.URL.String())
 	}
 }
 
 // writeJSON is a helper for writing JSON responses.
 // It marshals the data to JSON first, handling potential errors before writing to the response.
-func (h *EntityHandler) writeJSON(w http.ResponseWriter, r *http.Request, status int, data any) {
+func (rs responder) writeJSON(w http.ResponseWriter, r *http.Request, status int, data any) {
 	// If there's no data to send, just write the status code.
 	if data == nil {
 		w.WriteHeader(status)
@@ -42,7 +171,7 @@ func (h *EntityHandler) writeJSON(w http.ResponseWriter, r *http.Request, status
 	if err != nil {
 		// Log the underlying error and send a generic 500 response.
 		err = fmt.Errorf("failed to marshal JSON response: %w", err)
-		h.handleError(w, r, err)
+		rs.handleError(w, r, err)
 		return
 	}
 
@@ -55,6 +184,6 @@ func (h *EntityHandler) writeJSON(w http.ResponseWriter, r *http.Request, status
 	if _, err := w.Write(js); err != nil {
 		// If writing fails, the response has already started, so we can't send
 		// a new error. We just log it.
-		h.logger.Error("failed to write response", "error", err.Error(), "method", r.Method, "url", r.URL.String())
+		rs.logger.Error("failed to write response", "error", err.Error(), "method", r.Method, "url", r.URL.String())
 	}
 }
@@ -0,0 +1,105 @@
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/apperror"
+)
+
+// formatETag returns the strong entity tag of an entity version.
+func formatETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// parseIfMatch returns the entity version required by the If-Match header,
+// or zero if the request is unconditional.
+// Only a single entity tag, or "*", is supported.
+func parseIfMatch(r *http.Request) (int64, error) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	if value == "" || value == "*" {
+		return 0, nil
+	}
+	if strings.Contains(value, ",") {
+		return 0, apperror.New(apperror.ErrInvalidInput, "unsupported_if_match", "If-Match supports a single entity tag")
+	}
+
+	// Weak tags never match under the strong comparison If-Match requires,
+	// and tags we did not issue cannot match any version either.
+	mismatch := apperror.New(apperror.ErrPreconditionFailed, "etag_mismatch", "the entity tag does not match the current version")
+	unquoted, ok := strings.CutPrefix(value, `"`)
+	if !ok {
+		return 0, mismatch
+	}
+	unquoted, ok = strings.CutSuffix(unquoted, `"`)
+	if !ok {
+		return 0, mismatch
+	}
+	version, err := strconv.ParseInt(unquoted, 10, 64)
+	if err != nil || version < 1 {
+		return 0, mismatch
+	}
+	return version, nil
+}
+
+// contentETag returns a weak entity tag derived from the JSON encoding of data,
+// for responses that have no version of their own.
+func contentETag(data any) (string, error) {
+	js, err := json.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal JSON for ETag: %w", err)
+	}
+	sum := sha256.Sum256(js)
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
+
+// checkNotModified sets the ETag and, when known, the Last-Modified headers of
+// the response. If the conditional headers of the request show that the client
+// already has this representation, it writes a 304 Not Modified response and
+// returns true.
+func checkNotModified(w http.ResponseWriter, r *http.Request, etag string, lastModified time.Time) bool {
+	w.Header().Set("ETag", etag)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if !isFresh(r, etag, lastModified) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// isFresh evaluates If-None-Match, or If-Modified-Since when the former is absent (RFC 9110, section 13.2.2).
+func isFresh(r *http.Request, etag string, lastModified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for tag := range strings.SplitSeq(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || weakMatch(tag, etag) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+		t, err := http.ParseTime(ims)
+		if err != nil {
+			return false
+		}
+		// HTTP dates have a one-second resolution.
+		return !lastModified.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+// weakMatch compares two entity tags, ignoring their weakness indicators.
+func weakMatch(a, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
@@ -1,9 +1,10 @@
 package http
 
 import (
-	"encoding/json"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/domenicoop/go-clean-architecture-blueprint/internal/apperror"
@@ -14,15 +15,18 @@ import (
 
 // EntityHandler is responsible for handling HTTP requests related to entities.
 type EntityHandler struct {
+	responder
+	decoder
 	service service.EntityService
-	logger  *slog.Logger
 }
 
 // NewEntityHandler creates a new EntityHandler.
-func NewEntityHandler(service service.EntityService, logger *slog.Logger) *EntityHandler {
+// Request bodies larger than maxBodyBytes are rejected; zero means DefaultMaxBodyBytes.
+func NewEntityHandler(service service.EntityService, logger *slog.Logger, maxBodyBytes int64) *EntityHandler {
 	return &EntityHandler{
-		service: service,
-		logger:  logger,
+		responder: responder{logger: logger},
+		decoder:   newDecoder(maxBodyBytes),
+		service:   service,
 	}
 }
 
@@ -53,27 +57,45 @@ func (r *UpdateEntityRequest) toDomain(id string) *domain.Entity {
 
 // EntityResponse defines the response body for an entity.
 type EntityResponse struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	TenantID  string     `json:"tenantId,omitempty"`
+	OwnerID   string     `json:"ownerId,omitempty"`
+	Version   int64      `json:"version"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+}
+
+// ListEntitiesResponse defines the response body for a page of entities.
+type ListEntitiesResponse struct {
+	Entities   []*EntityResponse `json:"entities"`
+	NextCursor string            `json:"nextCursor,omitempty"`
 }
 
 // fromDomain converts a domain.Entity to an EntityResponse.
 func fromDomain(entity *domain.Entity) *EntityResponse {
-	return &EntityResponse{
+	response := &EntityResponse{
 		ID:        entity.ID,
 		Name:      entity.Name,
+		TenantID:  entity.TenantID,
+		OwnerID:   entity.OwnerID,
+		Version:   entity.Version,
 		CreatedAt: entity.CreatedAt,
 		UpdatedAt: entity.UpdatedAt,
 	}
+	if entity.IsDeleted() {
+		response.DeletedAt = &entity.DeletedAt
+	}
+	return response
 }
 
 // CreateEntity handles the POST /entities endpoint.
+// It responds with the stored entity and its location.
 func (h *EntityHandler) CreateEntity(w http.ResponseWriter, r *http.Request) {
 	var req CreateEntityRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.handleError(w, r, apperror.ErrInvalidInput)
+	if err := h.decodeJSON(w, r, &req); err != nil {
+		h.handleError(w, r, err)
 		return
 	}
 
@@ -83,10 +105,13 @@ func (h *EntityHandler) CreateEntity(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.writeJSON(w, r, http.StatusCreated, nil)
+	w.Header().Set("Location", "/entities/"+url.PathEscape(entity.ID))
+	w.Header().Set("ETag", formatETag(entity.Version))
+	h.writeJSON(w, r, http.StatusCreated, fromDomain(entity))
 }
 
 // GetEntity handles the GET /entities/{id} endpoint.
+// It honors If-None-Match and If-Modified-Since with a 304 Not Modified response.
 func (h *EntityHandler) GetEntity(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 
@@ -96,33 +121,83 @@ func (h *EntityHandler) GetEntity(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if checkNotModified(w, r, formatETag(entity.Version), entity.UpdatedAt) {
+		return
+	}
 	h.writeJSON(w, r, http.StatusOK, fromDomain(entity))
 }
 
 // UpdateEntity handles the PUT /entities/{id} endpoint.
+// It responds with the stored entity.
+// With an If-Match header, the update only succeeds if the entity is unchanged.
 func (h *EntityHandler) UpdateEntity(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 
+	version, err := parseIfMatch(r)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
 	var req UpdateEntityRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.handleError(w, r, apperror.ErrInvalidInput)
+	if err := h.decodeJSON(w, r, &req); err != nil {
+		h.handleError(w, r, err)
 		return
 	}
 
 	entity := req.toDomain(id)
+	entity.Version = version
 	if err := h.service.Update(r.Context(), entity); err != nil {
 		h.handleError(w, r, err)
 		return
 	}
 
-	h.writeJSON(w, r, http.StatusOK, nil)
+	w.Header().Set("ETag", formatETag(entity.Version))
+	h.writeJSON(w, r, http.StatusOK, fromDomain(entity))
+}
+
+// PatchEntity handles the PATCH /entities/{id} endpoint.
+// It accepts a JSON Merge Patch (RFC 7396) or a JSON Patch (RFC 6902) of the
+// fields UpdateEntityRequest replaces, and responds with the stored entity.
+// With an If-Match header, the patch only applies if the entity is unchanged.
+func (h *EntityHandler) PatchEntity(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	version, err := parseIfMatch(r)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	patch, err := h.parsePatch(w, r)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	entity, err := h.service.Patch(r.Context(), id, version, patch)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", formatETag(entity.Version))
+	h.writeJSON(w, r, http.StatusOK, fromDomain(entity))
 }
 
 // DeleteEntity handles the DELETE /entities/{id} endpoint.
+// The entity is moved to the trash, from which RestoreEntity can take it back.
+// With an If-Match header, the delete only succeeds if the entity is unchanged.
 func (h *EntityHandler) DeleteEntity(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 
-	if err := h.service.Delete(r.Context(), id); err != nil {
+	version, err := parseIfMatch(r)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	if err := h.service.Delete(r.Context(), id, version); err != nil {
 		h.handleError(w, r, err)
 		return
 	}
@@ -130,18 +205,141 @@ func (h *EntityHandler) DeleteEntity(w http.ResponseWriter, r *http.Request) {
 	h.writeJSON(w, r, http.StatusOK, nil)
 }
 
+// RestoreEntity handles the POST /entities/{id}/restore endpoint.
+// It takes a deleted entity out of the trash and responds with the stored entity.
+// With an If-Match header, the restore only succeeds if the entity is unchanged.
+func (h *EntityHandler) RestoreEntity(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	version, err := parseIfMatch(r)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	entity, err := h.service.Restore(r.Context(), id, version)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", formatETag(entity.Version))
+	h.writeJSON(w, r, http.StatusOK, fromDomain(entity))
+}
+
 // ListEntities handles the GET /entities endpoint.
+//
+// Query parameters:
+//   - limit: page size
+//   - cursor: the nextCursor of the previous page, with the same sort, order and filters
+//   - sort: "createdAt" (default), "updatedAt" or "name"
+//   - order: "asc" (default) or "desc"
+//   - namePrefix: only entities whose name starts with it
+//   - createdAfter: only entities created after it (RFC 3339)
+//   - deleted: "exclude" (default), "include" or "only" the entities in the trash
+//
+// It honors If-None-Match with a 304 Not Modified response.
 func (h *EntityHandler) ListEntities(w http.ResponseWriter, r *http.Request) {
-	entities, err := h.service.List(r.Context())
+	opts, err := parseListOptions(r.URL.Query())
 	if err != nil {
 		h.handleError(w, r, err)
 		return
 	}
 
-	response := make([]*EntityResponse, len(entities))
-	for i, entity := range entities {
-		response[i] = fromDomain(entity)
+	page, err := h.service.List(r.Context(), opts)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response := &ListEntitiesResponse{
+		Entities:   make([]*EntityResponse, len(page.Entities)),
+		NextCursor: page.NextCursor,
+	}
+	for i, entity := range page.Entities {
+		response.Entities[i] = fromDomain(entity)
 	}
 
+	// A page has no version of its own, so its ETag is derived from its content.
+	// There is no Last-Modified either: deleting an entity changes the page
+	// without leaving a newer timestamp behind.
+	etag, err := contentETag(response)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+	if checkNotModified(w, r, etag, time.Time{}) {
+		return
+	}
 	h.writeJSON(w, r, http.StatusOK, response)
 }
+
+// sortFields maps the values of the sort query parameter to domain sort fields.
+var sortFields = map[string]domain.EntitySortField{
+	"createdAt": domain.EntitySortByCreatedAt,
+	"updatedAt": domain.EntitySortByUpdatedAt,
+	"name":      domain.EntitySortByName,
+}
+
+// deletedFilters maps the values of the deleted query parameter to domain filters.
+var deletedFilters = map[string]domain.EntityDeletedFilter{
+	"exclude": domain.EntityDeletedExcluded,
+	"include": domain.EntityDeletedIncluded,
+	"only":    domain.EntityDeletedOnly,
+}
+
+// invalidQuery returns the error for a query parameter that cannot be parsed.
+func invalidQuery(param, message string) error {
+	return apperror.New(apperror.ErrInvalidInput, "invalid_query", "invalid query parameter").
+		WithFields(apperror.FieldError{Field: param, Code: "invalid", Message: message})
+}
+
+// parseListOptions converts the query parameters of GET /entities to list options.
+func parseListOptions(query url.Values) (domain.EntityListOptions, error) {
+	opts := domain.EntityListOptions{
+		Cursor:     query.Get("cursor"),
+		NamePrefix: query.Get("namePrefix"),
+	}
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return opts, invalidQuery("limit", "must be a positive integer")
+		}
+		opts.Limit = limit
+	}
+
+	if v := query.Get("sort"); v != "" {
+		field, ok := sortFields[v]
+		if !ok {
+			return opts, invalidQuery("sort", "must be one of createdAt, updatedAt or name")
+		}
+		opts.SortBy = field
+	}
+
+	switch v := query.Get("order"); v {
+	case "", "asc":
+	case "desc":
+		opts.Descending = true
+	default:
+		return opts, invalidQuery("order", "must be asc or desc")
+	}
+
+	if v := query.Get("createdAfter"); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return opts, invalidQuery("createdAfter", "must be an RFC 3339 timestamp")
+		}
+		opts.CreatedAfter = t
+	}
+
+	if v := query.Get("deleted"); v != "" {
+		filter, ok := deletedFilters[v]
+		if !ok {
+			return opts, invalidQuery("deleted", "must be one of exclude, include or only")
+		}
+		opts.Deleted = filter
+	}
+
+	return opts, nil
+}
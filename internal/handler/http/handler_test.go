@@ -1,17 +1,28 @@
 package http
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/apperror"
 	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/repository/inmemory"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/service"
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 )
 
 // mockEntityService is a mock implementation of the EntityService interface.
@@ -19,8 +30,13 @@ type mockEntityService struct {
 	CreateFunc  func(ctx context.Context, entity *domain.Entity) error
 	GetByIDFunc func(ctx context.Context, id string) (*domain.Entity, error)
 	UpdateFunc  func(ctx context.Context, entity *domain.Entity) error
-	DeleteFunc  func(ctx context.Context, id string) error
-	ListFunc    func(ctx context.Context) ([]*domain.Entity, error)
+	PatchFunc   func(ctx context.Context, id string, version int64, patch service.EntityPatch) (*domain.Entity, error)
+	DeleteFunc  func(ctx context.Context, id string, version int64) error
+	BatchFunc   func(ctx context.Context, ops []domain.EntityOperation, atomic bool) ([]error, error)
+	RestoreFunc func(ctx context.Context, id string, version int64) (*domain.Entity, error)
+	PurgeFunc   func(ctx context.Context, retention time.Duration) (int64, error)
+	ListFunc    func(ctx context.Context, opts domain.EntityListOptions) (*domain.EntityPage, error)
+	HistoryFunc func(ctx context.Context, opts domain.AuditListOptions) (*domain.AuditPage, error)
 }
 
 func (m *mockEntityService) Create(ctx context.Context, entity *domain.Entity) error {
@@ -35,26 +51,52 @@ func (m *mockEntityService) Update(ctx context.Context, entity *domain.Entity) e
 	return m.UpdateFunc(ctx, entity)
 }
 
-func (m *mockEntityService) Delete(ctx context.Context, id string) error {
-	return m.DeleteFunc(ctx, id)
+func (m *mockEntityService) Patch(ctx context.Context, id string, version int64, patch service.EntityPatch) (*domain.Entity, error) {
+	return m.PatchFunc(ctx, id, version, patch)
 }
 
-func (m *mockEntityService) List(ctx context.Context) ([]*domain.Entity, error) {
-	return m.ListFunc(ctx)
+func (m *mockEntityService) Delete(ctx context.Context, id string, version int64) error {
+	return m.DeleteFunc(ctx, id, version)
+}
+
+func (m *mockEntityService) Batch(ctx context.Context, ops []domain.EntityOperation, atomic bool) ([]error, error) {
+	return m.BatchFunc(ctx, ops, atomic)
+}
+
+func (m *mockEntityService) Restore(ctx context.Context, id string, version int64) (*domain.Entity, error) {
+	return m.RestoreFunc(ctx, id, version)
+}
+
+func (m *mockEntityService) PurgeDeleted(ctx context.Context, retention time.Duration) (int64, error) {
+	return m.PurgeFunc(ctx, retention)
+}
+
+func (m *mockEntityService) List(ctx context.Context, opts domain.EntityListOptions) (*domain.EntityPage, error) {
+	return m.ListFunc(ctx, opts)
+}
+
+func (m *mockEntityService) History(ctx context.Context, opts domain.AuditListOptions) (*domain.AuditPage, error) {
+	return m.HistoryFunc(ctx, opts)
 }
 
 func TestEntityHandler(t *testing.T) {
 	mockService := &mockEntityService{}
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
-	handler := NewEntityHandler(mockService, logger)
+	handler := NewEntityHandler(mockService, logger, 0)
 
 	t.Run("CreateEntity", func(t *testing.T) {
+		createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
 		mockService.CreateFunc = func(ctx context.Context, entity *domain.Entity) error {
+			entity.ID = "abc"
+			entity.Version = 1
+			entity.CreatedAt = createdAt
+			entity.UpdatedAt = createdAt
 			return nil
 		}
 
 		body, _ := json.Marshal(CreateEntityRequest{Name: "Test"})
 		req := httptest.NewRequest("POST", "/entities", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
 		rr := httptest.NewRecorder()
 
 		handler.CreateEntity(rr, req)
@@ -62,10 +104,21 @@ func TestEntityHandler(t *testing.T) {
 		if rr.Code != http.StatusCreated {
 			t.Errorf("expected status %d, got %d", http.StatusCreated, rr.Code)
 		}
+		if location := rr.Header().Get("Location"); location != "/entities/abc" {
+			t.Errorf("expected Location /entities/abc, got %q", location)
+		}
+
+		var response EntityResponse
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatalf("could not decode response: %v", err)
+		}
+		if response.ID != "abc" || response.Name != "Test" || response.Version != 1 || !response.CreatedAt.Equal(createdAt) {
+			t.Errorf("expected the created entity, got %+v", response)
+		}
 	})
 
 	t.Run("GetEntity", func(t *testing.T) {
-		expectedEntity := &domain.Entity{ID: "1", Name: "Test"}
+		expectedEntity := &domain.Entity{ID: "1", Name: "Test", Version: 3}
 		mockService.GetByIDFunc = func(ctx context.Context, id string) (*domain.Entity, error) {
 			return expectedEntity, nil
 		}
@@ -92,5 +145,1839 @@ func TestEntityHandler(t *testing.T) {
 		if response.ID != "1" {
 			t.Errorf("expected entity with ID 1, got %s", response.ID)
 		}
+		if etag := rr.Header().Get("ETag"); etag != `"3"` {
+			t.Errorf("expected ETag %q, got %q", `"3"`, etag)
+		}
+	})
+
+	t.Run("GetEntity conditional", func(t *testing.T) {
+		updatedAt := time.Date(2024, 1, 2, 3, 4, 5, 600, time.UTC)
+		mockService.GetByIDFunc = func(ctx context.Context, id string) (*domain.Entity, error) {
+			return &domain.Entity{ID: "1", Name: "Test", Version: 3, UpdatedAt: updatedAt}, nil
+		}
+
+		tests := []struct {
+			name       string
+			header     string
+			value      string
+			wantStatus int
+		}{
+			{"matching tag", "If-None-Match", `"3"`, http.StatusNotModified},
+			{"matching weak tag in list", "If-None-Match", `"1", W/"3"`, http.StatusNotModified},
+			{"stale tag", "If-None-Match", `"2"`, http.StatusOK},
+			{"not modified since", "If-Modified-Since", "Tue, 02 Jan 2024 03:04:05 GMT", http.StatusNotModified},
+			{"modified since", "If-Modified-Since", "Tue, 02 Jan 2024 03:04:04 GMT", http.StatusOK},
+		}
+		for _, tt := range tests {
+			req := httptest.NewRequest("GET", "/entities/1", nil)
+			req.Header.Set(tt.header, tt.value)
+			rr := httptest.NewRecorder()
+
+			handler.GetEntity(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("%s: expected status %d, got %d", tt.name, tt.wantStatus, rr.Code)
+			}
+			if tt.wantStatus == http.StatusNotModified && rr.Body.Len() != 0 {
+				t.Errorf("%s: expected empty body, got %q", tt.name, rr.Body.String())
+			}
+			if lm := rr.Header().Get("Last-Modified"); lm != "Tue, 02 Jan 2024 03:04:05 GMT" {
+				t.Errorf("%s: unexpected Last-Modified %q", tt.name, lm)
+			}
+		}
+	})
+
+	t.Run("ListEntities If-None-Match", func(t *testing.T) {
+		mockService.ListFunc = func(ctx context.Context, opts domain.EntityListOptions) (*domain.EntityPage, error) {
+			return &domain.EntityPage{Entities: []*domain.Entity{{ID: "1", Name: "Test"}}}, nil
+		}
+
+		rr := httptest.NewRecorder()
+		handler.ListEntities(rr, httptest.NewRequest("GET", "/entities", nil))
+		etag := rr.Header().Get("ETag")
+		if rr.Code != http.StatusOK || etag == "" {
+			t.Fatalf("expected status %d with an ETag, got %d and %q", http.StatusOK, rr.Code, etag)
+		}
+
+		req := httptest.NewRequest("GET", "/entities", nil)
+		req.Header.Set("If-None-Match", etag)
+		rr = httptest.NewRecorder()
+		handler.ListEntities(rr, req)
+		if rr.Code != http.StatusNotModified {
+			t.Errorf("expected status %d, got %d", http.StatusNotModified, rr.Code)
+		}
+	})
+
+	t.Run("UpdateEntity If-Match", func(t *testing.T) {
+		mockService.UpdateFunc = func(ctx context.Context, entity *domain.Entity) error {
+			if entity.Version != 3 {
+				return apperror.ErrPreconditionFailed
+			}
+			entity.Version++
+			return nil
+		}
+
+		tests := []struct {
+			ifMatch    string
+			wantStatus int
+			wantETag   string
+		}{
+			{`"3"`, http.StatusOK, `"4"`},
+			{`"2"`, http.StatusPreconditionFailed, ""},
+			{`W/"3"`, http.StatusPreconditionFailed, ""},
+			{`"2", "3"`, http.StatusBadRequest, ""},
+		}
+		for _, tt := range tests {
+			body, _ := json.Marshal(UpdateEntityRequest{Name: "Test"})
+			req := httptest.NewRequest("PUT", "/entities/1", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("If-Match", tt.ifMatch)
+			rr := httptest.NewRecorder()
+
+			handler.UpdateEntity(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("If-Match %s: expected status %d, got %d", tt.ifMatch, tt.wantStatus, rr.Code)
+			}
+			if etag := rr.Header().Get("ETag"); etag != tt.wantETag {
+				t.Errorf("If-Match %s: expected ETag %q, got %q", tt.ifMatch, tt.wantETag, etag)
+			}
+		}
+	})
+
+	t.Run("PatchEntity", func(t *testing.T) {
+		mockService.PatchFunc = func(ctx context.Context, id string, version int64, patch service.EntityPatch) (*domain.Entity, error) {
+			entity := &domain.Entity{ID: id, Name: "Old", Version: 2}
+			if err := patch(entity); err != nil {
+				return nil, err
+			}
+			entity.Version++
+			return entity, nil
+		}
+
+		tests := []struct {
+			name        string
+			contentType string
+			body        string
+			wantStatus  int
+			wantName    string
+		}{
+			{"merge patch", mergePatchType, `{"name": "Renamed"}`, http.StatusOK, "Renamed"},
+			{"empty merge patch", mergePatchType, `{}`, http.StatusOK, "Old"},
+			{"merge patch of a read-only field", mergePatchType, `{"version": 9}`, http.StatusBadRequest, ""},
+			{"merge patch of the wrong type", mergePatchType, `{"name": 42}`, http.StatusBadRequest, ""},
+			{"JSON Patch", jsonPatchType, `[{"op": "test", "path": "/name", "value": "Old"}, {"op": "replace", "path": "/name", "value": "Renamed"}]`, http.StatusOK, "Renamed"},
+			{"failed JSON Patch test", jsonPatchType, `[{"op": "test", "path": "/name", "value": "Other"}]`, http.StatusConflict, ""},
+			{"malformed JSON Patch", jsonPatchType, `{"op": "replace"}`, http.StatusBadRequest, ""},
+			{"plain JSON", "application/json", `{"name": "Renamed"}`, http.StatusUnsupportedMediaType, ""},
+		}
+		for _, tt := range tests {
+			req := httptest.NewRequest("PATCH", "/entities/1", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rr := httptest.NewRecorder()
+
+			handler.PatchEntity(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("%s: expected status %d, got %d", tt.name, tt.wantStatus, rr.Code)
+				continue
+			}
+			if tt.wantStatus == http.StatusUnsupportedMediaType && rr.Header().Get("Accept-Patch") == "" {
+				t.Errorf("%s: expected an Accept-Patch header", tt.name)
+			}
+			if tt.wantStatus != http.StatusOK {
+				continue
+			}
+
+			var response EntityResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("%s: could not decode response: %v", tt.name, err)
+			}
+			if response.Name != tt.wantName || response.Version != 3 {
+				t.Errorf("%s: expected name %q at version 3, got %+v", tt.name, tt.wantName, response)
+			}
+			if etag := rr.Header().Get("ETag"); etag != `"3"` {
+				t.Errorf("%s: expected ETag \"3\", got %q", tt.name, etag)
+			}
+		}
+	})
+
+	t.Run("DeleteEntity If-Match", func(t *testing.T) {
+		var gotVersion int64 = -1
+		mockService.DeleteFunc = func(ctx context.Context, id string, version int64) error {
+			gotVersion = version
+			return nil
+		}
+
+		req := httptest.NewRequest("DELETE", "/entities/1", nil)
+		req.Header.Set("If-Match", `"7"`)
+		rr := httptest.NewRecorder()
+
+		handler.DeleteEntity(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+		if gotVersion != 7 {
+			t.Errorf("expected version 7, got %d", gotVersion)
+		}
+	})
+	t.Run("RestoreEntity", func(t *testing.T) {
+		mockService.RestoreFunc = func(ctx context.Context, id string, version int64) (*domain.Entity, error) {
+			if version != 4 {
+				return nil, apperror.ErrPreconditionFailed
+			}
+			return &domain.Entity{ID: id, Name: "Test", Version: 5}, nil
+		}
+
+		router := chi.NewRouter()
+		router.Post("/entities/{id}/restore", handler.RestoreEntity)
+		req := httptest.NewRequest("POST", "/entities/1/restore", nil)
+		req.Header.Set("If-Match", `"4"`)
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+		if etag := rr.Header().Get("ETag"); etag != `"5"` {
+			t.Errorf("expected ETag \"5\", got %q", etag)
+		}
+		var response map[string]any
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatalf("could not decode response: %v", err)
+		}
+		if response["id"] != "1" {
+			t.Errorf("expected entity 1, got %v", response["id"])
+		}
+		if _, ok := response["deletedAt"]; ok {
+			t.Errorf("expected no deletedAt on a restored entity, got %v", response["deletedAt"])
+		}
+	})
+
+	t.Run("BatchEntities", func(t *testing.T) {
+		mockService.BatchFunc = func(ctx context.Context, ops []domain.EntityOperation, atomic bool) ([]error, error) {
+			if len(ops) != 3 || atomic {
+				t.Errorf("expected 3 operations in best-effort mode, got %d, atomic %v", len(ops), atomic)
+			}
+			if ops[1].Kind != domain.EntityOperationUpdate || ops[1].Entity.ID != "1" || ops[1].Entity.Version != 2 {
+				t.Errorf("unexpected operation %+v", ops[1].Entity)
+			}
+			ops[0].Entity.ID = "abc"
+			ops[0].Entity.Version = 1
+			return []error{nil, apperror.ErrPreconditionFailed, nil}, nil
+		}
+
+		body := `{"mode":"bestEffort","operations":[
+			{"op":"create","name":"Test"},
+			{"op":"update","id":"1","name":"Test","version":2},
+			{"op":"delete","id":"2"}]}`
+		req := httptest.NewRequest("POST", "/entities:batch", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+
+		handler.BatchEntities(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+		var response struct {
+			Results []struct {
+				Status int             `json:"status"`
+				Entity *EntityResponse `json:"entity"`
+				Error  map[string]any  `json:"error"`
+			} `json:"results"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatalf("could not decode response: %v", err)
+		}
+		results := response.Results
+		if len(results) != 3 {
+			t.Fatalf("expected 3 results, got %d", len(results))
+		}
+		if results[0].Status != http.StatusCreated || results[0].Entity == nil || results[0].Entity.ID != "abc" {
+			t.Errorf("expected the created entity, got %+v", results[0])
+		}
+		if results[1].Status != http.StatusPreconditionFailed || results[1].Error["status"] != float64(http.StatusPreconditionFailed) {
+			t.Errorf("expected a 412 problem, got %+v", results[1])
+		}
+		if results[2].Status != http.StatusOK || results[2].Entity != nil || results[2].Error != nil {
+			t.Errorf("expected a bare 200 for the delete, got %+v", results[2])
+		}
+	})
+
+	t.Run("BatchEntities invalid mode", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/entities:batch", strings.NewReader(`{"mode":"some","operations":[]}`))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+
+		handler.BatchEntities(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("ListEntities", func(t *testing.T) {
+		mockService.ListFunc = func(ctx context.Context, opts domain.EntityListOptions) (*domain.EntityPage, error) {
+			if opts.Limit != 1 || opts.Cursor != "abc" || opts.SortBy != domain.EntitySortByName || !opts.Descending {
+				t.Errorf("unexpected list options %+v", opts)
+			}
+			if opts.NamePrefix != "Te" || !opts.CreatedAfter.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) || opts.Deleted != domain.EntityDeletedOnly {
+				t.Errorf("unexpected list filters %+v", opts)
+			}
+			return &domain.EntityPage{Entities: []*domain.Entity{{ID: "1", Name: "Test"}}, NextCursor: "def"}, nil
+		}
+
+		req := httptest.NewRequest("GET", "/entities?limit=1&cursor=abc&sort=name&order=desc&namePrefix=Te&createdAfter=2024-01-02T03:04:05Z&deleted=only", nil)
+		rr := httptest.NewRecorder()
+
+		handler.ListEntities(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		var response ListEntitiesResponse
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatalf("could not decode response: %v", err)
+		}
+		if len(response.Entities) != 1 || response.Entities[0].ID != "1" || response.NextCursor != "def" {
+			t.Errorf("unexpected response %+v", response)
+		}
+	})
+
+	t.Run("ListEntities invalid query", func(t *testing.T) {
+		for _, query := range []string{"limit=abc", "limit=0", "sort=color", "order=up", "createdAfter=yesterday", "deleted=maybe"} {
+			req := httptest.NewRequest("GET", "/entities?"+query, nil)
+			rr := httptest.NewRecorder()
+
+			handler.ListEntities(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected status %d, got %d", query, http.StatusBadRequest, rr.Code)
+			}
+		}
+	})
+
+	t.Run("GetEntityHistory", func(t *testing.T) {
+		occurredAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		mockService.HistoryFunc = func(ctx context.Context, opts domain.AuditListOptions) (*domain.AuditPage, error) {
+			if opts.EntityID != "1" || opts.Limit != 1 || opts.Cursor != "abc" {
+				t.Errorf("unexpected list options %+v", opts)
+			}
+			before := &domain.Entity{ID: "1", Name: "Old", Version: 1}
+			after := &domain.Entity{ID: "1", Name: "Test", Version: 2}
+			return &domain.AuditPage{
+				Entries: []*domain.AuditEntry{{
+					ID:         "a1",
+					EntityID:   "1",
+					Action:     domain.AuditActionUpdate,
+					Principal:  "alice",
+					RequestID:  "req-1",
+					OccurredAt: occurredAt,
+					Before:     before,
+					After:      after,
+					Changes:    domain.DiffEntities(before, after),
+				}},
+				NextCursor: "a1",
+			}, nil
+		}
+
+		router := chi.NewRouter()
+		router.Get("/entities/{id}/history", handler.GetEntityHistory)
+		req := httptest.NewRequest("GET", "/entities/1/history?limit=1&cursor=abc", nil)
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+		var response struct {
+			Entries []struct {
+				Action    string                `json:"action"`
+				Principal string                `json:"principal"`
+				RequestID string                `json:"requestId"`
+				Before    *EntityResponse       `json:"before"`
+				After     *EntityResponse       `json:"after"`
+				Changes   []FieldChangeResponse `json:"changes"`
+			} `json:"entries"`
+			NextCursor string `json:"nextCursor"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatalf("could not decode response: %v", err)
+		}
+		if len(response.Entries) != 1 || response.NextCursor != "a1" {
+			t.Fatalf("expected 1 entry and a next cursor, got %+v", response)
+		}
+		entry := response.Entries[0]
+		if entry.Action != "update" || entry.Principal != "alice" || entry.RequestID != "req-1" ||
+			entry.Before == nil || entry.Before.Name != "Old" || entry.After == nil || entry.After.Name != "Test" {
+			t.Errorf("unexpected entry %+v", entry)
+		}
+		want := []FieldChangeResponse{{Field: "name", Before: "Old", After: "Test"}, {Field: "version", Before: 1.0, After: 2.0}}
+		if fmt.Sprint(entry.Changes) != fmt.Sprint(want) {
+			t.Errorf("expected changes %v, got %v", want, entry.Changes)
+		}
+	})
+
+	t.Run("GetEntityHistory unknown entity", func(t *testing.T) {
+		mockService.HistoryFunc = func(ctx context.Context, opts domain.AuditListOptions) (*domain.AuditPage, error) {
+			return nil, apperror.ErrNotFound
+		}
+
+		router := chi.NewRouter()
+		router.Get("/entities/{id}/history", handler.GetEntityHistory)
+		for path, status := range map[string]int{
+			"/entities/missing/history":         http.StatusNotFound,
+			"/entities/missing/history?limit=0": http.StatusBadRequest,
+		} {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+
+			if rr.Code != status {
+				t.Errorf("%s: expected status %d, got %d", path, status, rr.Code)
+			}
+		}
+	})
+}
+
+func TestRequestContext(t *testing.T) {
+	var got string
+	handler := middleware.RequestID(RequestContext(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = service.RequestIDFrom(r.Context())
+	})))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(middleware.RequestIDHeader, "req-1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got != "req-1" {
+		t.Errorf("expected request ID req-1 in the service context, got %q", got)
+	}
+}
+
+func TestHandleError(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handler := NewEntityHandler(&mockEntityService{}, logger, 0)
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantType   string
+		wantDetail string
+	}{
+		{"not found", fmt.Errorf("service: failed: %w", apperror.ErrNotFound), http.StatusNotFound, "urn:problem-type:not-found", "not found"},
+		{"conflict", apperror.ErrConflict, http.StatusConflict, "urn:problem-type:conflict", "resource conflict"},
+		{"precondition failed", apperror.ErrPreconditionFailed, http.StatusPreconditionFailed, "urn:problem-type:precondition-failed", "precondition failed"},
+		{"forbidden", apperror.New(apperror.ErrForbidden, "forbidden", "you do not have permission to delete"), http.StatusForbidden, "urn:problem-type:forbidden", "you do not have permission to delete"},
+		{"internal", errors.New("connection refused"), http.StatusInternalServerError, "urn:problem-type:internal", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/entities/1", nil)
+		req = req.WithContext(context.WithValue(req.Context(), middleware.RequestIDKey, "req-1"))
+		rr := httptest.NewRecorder()
+
+		handler.handleError(rr, req, tt.err)
+
+		if rr.Code != tt.wantStatus {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.wantStatus, rr.Code)
+		}
+		if ct := rr.Header().Get("Content-Type"); ct != "application/problem+json" {
+			t.Errorf("%s: expected problem+json content type, got %q", tt.name, ct)
+		}
+
+		var problem Problem
+		if err := json.NewDecoder(rr.Body).Decode(&problem); err != nil {
+			t.Fatalf("%s: could not decode problem: %v", tt.name, err)
+		}
+		if problem.Type != tt.wantType || problem.Status != tt.wantStatus || problem.Detail != tt.wantDetail || problem.Instance != "req-1" {
+			t.Errorf("%s: unexpected problem %+v", tt.name, problem)
+		}
+	}
+
+	t.Run("field errors and metadata", func(t *testing.T) {
+		err := apperror.New(apperror.ErrInvalidInput, "invalid_entity", "the request contains invalid fields").
+			WithFields(apperror.FieldError{Field: "name", Code: "required", Message: "must not be empty"}).
+			WithMeta("maxLength", 100).
+			WithMeta("status", "ignored")
+		rr := httptest.NewRecorder()
+
+		handler.handleError(rr, httptest.NewRequest("POST", "/entities", nil), fmt.Errorf("service: %w", err))
+
+		var body map[string]any
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatalf("could not decode problem: %v", err)
+		}
+		if body["status"] != float64(http.StatusBadRequest) || body["code"] != "invalid_entity" || body["maxLength"] != float64(100) {
+			t.Errorf("unexpected problem %v", body)
+		}
+		fields, _ := body["errors"].([]any)
+		if len(fields) != 1 {
+			t.Fatalf("expected 1 field error, got %v", body["errors"])
+		}
+		if field := fields[0].(map[string]any); field["field"] != "name" || field["code"] != "required" {
+			t.Errorf("unexpected field error %v", field)
+		}
+	})
+}
+
+func TestDecodeJSON(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handler := NewEntityHandler(&mockEntityService{}, logger, 32)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantDetail  string
+		wantField   string
+	}{
+		{"valid", "application/json; charset=utf-8", `{"name": "Test"}`, http.StatusOK, "", ""},
+		{"missing content type", "", `{"name": "Test"}`, http.StatusUnsupportedMediaType, "Content-Type must be application/json", ""},
+		{"wrong content type", "text/plain", `{"name": "Test"}`, http.StatusUnsupportedMediaType, "Content-Type must be application/json", ""},
+		{"empty", "application/json", ``, http.StatusBadRequest, "request body must not be empty", ""},
+		{"syntax error", "application/json", `{"name": Test}`, http.StatusBadRequest, "request body contains malformed JSON at offset 10", ""},
+		{"truncated", "application/json", `{"name": "Test"`, http.StatusBadRequest, "request body contains malformed JSON", ""},
+		{"wrong type", "application/json", `{"name": 42}`, http.StatusBadRequest, "request body contains a field of the wrong type", "name"},
+		{"not an object", "application/json", `["Test"]`, http.StatusBadRequest, "request body must be a JSON object, not array", ""},
+		{"unknown field", "application/json", `{"nmae": "Test"}`, http.StatusBadRequest, "request body contains an unknown field", "nmae"},
+		{"multiple values", "application/json", `{"name": "A"} {"name": "B"}`, http.StatusBadRequest, "request body must contain a single JSON value", ""},
+		{"too large", "application/json", `{"name": "` + strings.Repeat("a", 64) + `"}`, http.StatusRequestEntityTooLarge, "request body must not exceed 32 bytes", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/entities", strings.NewReader(tt.body))
+		if tt.contentType != "" {
+			req.Header.Set("Content-Type", tt.contentType)
+		}
+		rr := httptest.NewRecorder()
+
+		var dst CreateEntityRequest
+		if err := handler.decodeJSON(rr, req, &dst); err != nil {
+			handler.handleError(rr, req, err)
+		} else {
+			rr.WriteHeader(http.StatusOK)
+		}
+
+		if rr.Code != tt.wantStatus {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.wantStatus, rr.Code)
+			continue
+		}
+		if tt.wantStatus == http.StatusOK {
+			continue
+		}
+
+		var problem Problem
+		if err := json.NewDecoder(rr.Body).Decode(&problem); err != nil {
+			t.Fatalf("%s: could not decode problem: %v", tt.name, err)
+		}
+		if problem.Detail != tt.wantDetail {
+			t.Errorf("%s: expected detail %q, got %q", tt.name, tt.wantDetail, problem.Detail)
+		}
+		if tt.wantField != "" && (len(problem.Errors) != 1 || problem.Errors[0].Field != tt.wantField) {
+			t.Errorf("%s: expected a field error for %s, got %+v", tt.name, tt.wantField, problem.Errors)
+		}
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	const doc = `{"a": {"b": [1, 2]}, "c": "d", "e/f": 1, "g~h": 2}`
+
+	tests := []struct {
+		name    string
+		patch   string
+		want    string
+		wantErr error
+	}{
+		{"add member", `[{"op": "add", "path": "/x", "value": 1}]`, `{"a": {"b": [1, 2]}, "c": "d", "e/f": 1, "g~h": 2, "x": 1}`, nil},
+		{"add array element", `[{"op": "add", "path": "/a/b/1", "value": 3}]`, `{"a": {"b": [1, 3, 2]}, "c": "d", "e/f": 1, "g~h": 2}`, nil},
+		{"append array element", `[{"op": "add", "path": "/a/b/-", "value": 3}]`, `{"a": {"b": [1, 2, 3]}, "c": "d", "e/f": 1, "g~h": 2}`, nil},
+		{"remove escaped members", `[{"op": "remove", "path": "/e~1f"}, {"op": "remove", "path": "/g~0h"}]`, `{"a": {"b": [1, 2]}, "c": "d"}`, nil},
+		{"replace", `[{"op": "replace", "path": "/a/b/0", "value": {"z": null}}]`, `{"a": {"b": [{"z": null}, 2]}, "c": "d", "e/f": 1, "g~h": 2}`, nil},
+		{"move", `[{"op": "move", "from": "/c", "path": "/a/c"}]`, `{"a": {"b": [1, 2], "c": "d"}, "e/f": 1, "g~h": 2}`, nil},
+		{"copy", `[{"op": "copy", "from": "/a/b", "path": "/b"}]`, `{"a": {"b": [1, 2]}, "b": [1, 2], "c": "d", "e/f": 1, "g~h": 2}`, nil},
+		{"test", `[{"op": "test", "path": "/a", "value": {"b": [1, 2]}}]`, doc, nil},
+		{"failed test", `[{"op": "test", "path": "/c", "value": "x"}]`, "", apperror.ErrConflict},
+		{"missing path", `[{"op": "remove", "path": "/a/x"}]`, "", apperror.ErrConflict},
+		{"array index out of range", `[{"op": "add", "path": "/a/b/3", "value": 1}]`, "", apperror.ErrConflict},
+		{"leading zero index", `[{"op": "replace", "path": "/a/b/01", "value": 1}]`, "", apperror.ErrConflict},
+		{"unknown operation", `[{"op": "merge", "path": "/a"}]`, "", apperror.ErrInvalidInput},
+		{"missing value", `[{"op": "add", "path": "/a"}]`, "", apperror.ErrInvalidInput},
+		{"invalid pointer", `[{"op": "remove", "path": "a"}]`, "", apperror.ErrInvalidInput},
+		{"move into a child", `[{"op": "move", "from": "/a", "path": "/a/x"}]`, "", apperror.ErrInvalidInput},
+	}
+	for _, tt := range tests {
+		var target any
+		if err := json.Unmarshal([]byte(doc), &target); err != nil {
+			t.Fatal(err)
+		}
+
+		ops, err := parseJSONPatch(json.RawMessage(tt.patch))
+		var got any
+		if err == nil {
+			got, err = applyJSONPatch(target, ops)
+		}
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("%s: expected %v, got %v", tt.name, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: expected no error, got %v", tt.name, err)
+			continue
+		}
+
+		var want any
+		if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+			t.Fatal(err)
+		}
+		if gotJSON, wantJSON := fmt.Sprint(got), fmt.Sprint(want); gotJSON != wantJSON {
+			t.Errorf("%s: expected %s, got %s", tt.name, wantJSON, gotJSON)
+		}
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	// Examples from RFC 7396, Appendix A.
+	tests := []struct {
+		target, patch, want string
+	}{
+		{`{"a": "b"}`, `{"a": "c"}`, `{"a": "c"}`},
+		{`{"a": "b"}`, `{"b": "c"}`, `{"a": "b", "b": "c"}`},
+		{`{"a": "b"}`, `{"a": null}`, `{}`},
+		{`{"a": [{"b": "c"}]}`, `{"a": [1]}`, `{"a": [1]}`},
+		{`["a", "b"]`, `["c", "d"]`, `["c", "d"]`},
+		{`{"a": "foo"}`, `null`, `null`},
+		{`{"a": "foo"}`, `"bar"`, `"bar"`},
+		{`{"e": null}`, `{"a": 1}`, `{"e": null, "a": 1}`},
+		{`[1, 2]`, `{"a": "b", "c": null}`, `{"a": "b"}`},
+		{`{}`, `{"a": {"bb": {"ccc": null}}}`, `{"a": {"bb": {}}}`},
+	}
+	for _, tt := range tests {
+		var target, patch, want any
+		for _, v := range []struct {
+			js  string
+			dst *any
+		}{{tt.target, &target}, {tt.patch, &patch}, {tt.want, &want}} {
+			if err := json.Unmarshal([]byte(v.js), v.dst); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if got := mergePatch(target, patch); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("merge %s into %s: expected %v, got %v", tt.patch, tt.target, want, got)
+		}
+	}
+}
+
+func TestIdempotency(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ctx := context.Background()
+
+	calls := 0
+	status := http.StatusCreated
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Location", "/entities/"+strconv.Itoa(calls))
+		w.WriteHeader(status)
+		_, _ = w.Write(body)
+	})
+
+	post := func(handler http.Handler, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/entities", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("replays the first response", func(t *testing.T) {
+		calls = 0
+		handler := NewIdempotency(NewMemoryIdempotencyStore(), logger, 0, 0).Middleware(next)
+
+		first := post(handler, "key", `{"name": "Test"}`)
+		retry := post(handler, "key", `{"name": "Test"}`)
+
+		if calls != 1 {
+			t.Errorf("expected the request to be handled once, got %d", calls)
+		}
+		if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() {
+			t.Errorf("expected the replayed response to match, got %d %q", retry.Code, retry.Body.String())
+		}
+		if location := retry.Header().Get("Location"); location != "/entities/1" {
+			t.Errorf("expected Location /entities/1, got %q", location)
+		}
+		if retry.Header().Get(idempotentReplayedHeader) != "true" {
+			t.Errorf("expected the %s header on the replay", idempotentReplayedHeader)
+		}
+	})
+
+	t.Run("replays are rate limited afresh", func(t *testing.T) {
+		calls = 0
+		limiter := NewRateLimiter(NewMemoryRateLimitStore(), RateLimit{Requests: 5, Period: time.Minute}, nil, logger)
+		handler := limiter.Middleware(NewIdempotency(NewMemoryIdempotencyStore(), logger, 0, 0).Middleware(next))
+
+		post(handler, "key", `{"name": "Test"}`)
+		post(handler, "other", `{"name": "Test"}`)
+		retry := post(handler, "key", `{"name": "Test"}`)
+
+		if retry.Header().Get(idempotentReplayedHeader) != "true" {
+			t.Fatalf("expected the %s header on the replay", idempotentReplayedHeader)
+		}
+		if remaining := retry.Header().Get(rateLimitRemainingHeader); remaining != "2" {
+			t.Errorf("expected %s 2 after three requests, got %q", rateLimitRemainingHeader, remaining)
+		}
+		if location := retry.Header().Get("Location"); location != "/entities/1" {
+			t.Errorf("expected Location /entities/1, got %q", location)
+		}
+	})
+
+	t.Run("without a key", func(t *testing.T) {
+		calls = 0
+		handler := NewIdempotency(NewMemoryIdempotencyStore(), logger, 0, 0).Middleware(next)
+
+		post(handler, "", `{"name": "Test"}`)
+		post(handler, "", `{"name": "Test"}`)
+
+		if calls != 2 {
+			t.Errorf("expected the request to be handled twice, got %d", calls)
+		}
+	})
+
+	t.Run("keys are scoped to the principal", func(t *testing.T) {
+		handler := NewIdempotency(NewMemoryIdempotencyStore(), logger, 0, 0).Middleware(next)
+		postAs := func(principal string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("POST", "/entities", strings.NewReader(`{"name": "Test"}`))
+			req = req.WithContext(service.WithPrincipal(req.Context(), domain.Principal{ID: principal}))
+			req.Header.Set(IdempotencyKeyHeader, "shared")
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			return rr
+		}
+
+		first := postAs("alice")
+		second := postAs("bob")
+
+		if first.Header().Get("Location") == second.Header().Get("Location") {
+			t.Errorf("expected another principal's request to be served, got the replay of %s", first.Header().Get("Location"))
+		}
+	})
+
+	t.Run("keys are scoped to the tenant", func(t *testing.T) {
+		handler := NewIdempotency(NewMemoryIdempotencyStore(), logger, 0, 0).Middleware(next)
+		postIn := func(tenantID string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest("POST", "/entities", strings.NewReader(`{"name": "Test"}`))
+			ctx := service.WithPrincipal(req.Context(), domain.Principal{ID: "alice", TenantID: tenantID})
+			req = req.WithContext(service.WithTenant(ctx, tenantID))
+			req.Header.Set(IdempotencyKeyHeader, "shared")
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			return rr
+		}
+
+		first := postIn("acme")
+		second := postIn("globex")
+
+		if first.Header().Get("Location") == second.Header().Get("Location") {
+			t.Errorf("expected another tenant's request to be served, got the replay of %s", first.Header().Get("Location"))
+		}
+	})
+
+	t.Run("key reused with a different body", func(t *testing.T) {
+		handler := NewIdempotency(NewMemoryIdempotencyStore(), logger, 0, 0).Middleware(next)
+
+		post(handler, "key", `{"name": "Test"}`)
+		rr := post(handler, "key", `{"name": "Other"}`)
+
+		if rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("expected status %d, got %d", http.StatusUnprocessableEntity, rr.Code)
+		}
+	})
+
+	t.Run("request in progress", func(t *testing.T) {
+		store := NewMemoryIdempotencyStore()
+		handler := NewIdempotency(store, logger, 0, 0).Middleware(next)
+
+		body := `{"name": "Test"}`
+		req := httptest.NewRequest("POST", "/entities", nil)
+		record := IdempotencyRecord{Fingerprint: requestFingerprint(req, []byte(body)), ExpiresAt: time.Now().Add(time.Hour)}
+		if _, err := store.Begin(ctx, "key", record); err != nil {
+			t.Fatalf("failed to reserve key: %v", err)
+		}
+
+		rr := post(handler, "key", body)
+
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status %d, got %d", http.StatusConflict, rr.Code)
+		}
+	})
+
+	t.Run("server errors are not replayed", func(t *testing.T) {
+		calls = 0
+		status = http.StatusInternalServerError
+		defer func() { status = http.StatusCreated }()
+		handler := NewIdempotency(NewMemoryIdempotencyStore(), logger, 0, 0).Middleware(next)
+
+		post(handler, "key", `{"name": "Test"}`)
+		post(handler, "key", `{"name": "Test"}`)
+
+		if calls != 2 {
+			t.Errorf("expected the request to be handled twice, got %d", calls)
+		}
+	})
+
+	t.Run("expired keys can be reused", func(t *testing.T) {
+		store := NewMemoryIdempotencyStore()
+
+		expired := IdempotencyRecord{Fingerprint: "a", ExpiresAt: time.Now().Add(-time.Second)}
+		if _, err := store.Begin(ctx, "key", expired); err != nil {
+			t.Fatalf("failed to reserve key: %v", err)
+		}
+		existing, err := store.Begin(ctx, "key", IdempotencyRecord{Fingerprint: "b", ExpiresAt: time.Now().Add(time.Hour)})
+		if err != nil || existing != nil {
+			t.Errorf("expected the expired key to be reserved again, got %+v, %v", existing, err)
+		}
+	})
+}
+
+// mockWebhookService is a mock implementation of the WebhookService interface.
+type mockWebhookService struct {
+	CreateFunc         func(ctx context.Context, webhook *domain.Webhook) error
+	GetByIDFunc        func(ctx context.Context, id string) (*domain.Webhook, error)
+	ListFunc           func(ctx context.Context) ([]*domain.Webhook, error)
+	DeleteFunc         func(ctx context.Context, id string) error
+	ListDeliveriesFunc func(ctx context.Context, opts domain.DeliveryListOptions) ([]*domain.WebhookDelivery, error)
+	RetryDeliveryFunc  func(ctx context.Context, id string) (*domain.WebhookDelivery, error)
+}
+
+func (m *mockWebhookService) Create(ctx context.Context, webhook *domain.Webhook) error {
+	return m.CreateFunc(ctx, webhook)
+}
+
+func (m *mockWebhookService) GetByID(ctx context.Context, id string) (*domain.Webhook, error) {
+	return m.GetByIDFunc(ctx, id)
+}
+
+func (m *mockWebhookService) List(ctx context.Context) ([]*domain.Webhook, error) {
+	return m.ListFunc(ctx)
+}
+
+func (m *mockWebhookService) Delete(ctx context.Context, id string) error {
+	return m.DeleteFunc(ctx, id)
+}
+
+func (m *mockWebhookService) ListDeliveries(ctx context.Context, opts domain.DeliveryListOptions) ([]*domain.WebhookDelivery, error) {
+	return m.ListDeliveriesFunc(ctx, opts)
+}
+
+func (m *mockWebhookService) RetryDelivery(ctx context.Context, id string) (*domain.WebhookDelivery, error) {
+	return m.RetryDeliveryFunc(ctx, id)
+}
+
+func (m *mockWebhookService) Publish(ctx context.Context, message *domain.EventMessage) error {
+	return nil
+}
+
+func (m *mockWebhookService) Deliver(ctx context.Context, limit int) (int, error) {
+	return 0, nil
+}
+
+func TestWebhookHandler(t *testing.T) {
+	mockService := &mockWebhookService{}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handler := NewWebhookHandler(mockService, logger, 0)
+
+	router := chi.NewRouter()
+	router.Route("/webhooks", func(r chi.Router) {
+		r.Post("/", handler.CreateWebhook)
+		r.Get("/", handler.ListWebhooks)
+		r.Get("/dead-letters", handler.ListDeadLetters)
+		r.Post("/dead-letters/{id}/retry", handler.RetryDeadLetter)
+		r.Get("/{id}", handler.GetWebhook)
+		r.Delete("/{id}", handler.DeleteWebhook)
+		r.Get("/{id}/deliveries", handler.ListDeliveries)
+	})
+
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	webhook := &domain.Webhook{
+		ID:         "w1",
+		URL:        "https://example.com/hooks",
+		EventTypes: []domain.EventType{domain.EventEntityCreated},
+		Secret:     "whsec_test",
+		CreatedAt:  createdAt,
+	}
+	mockService.GetByIDFunc = func(ctx context.Context, id string) (*domain.Webhook, error) {
+		if id != "w1" {
+			return nil, apperror.ErrNotFound
+		}
+		return webhook, nil
+	}
+	dead := &domain.WebhookDelivery{
+		ID:        "d1",
+		WebhookID: "w1",
+		Event:     domain.EventMessage{ID: "e1", Type: domain.EventEntityCreated, EntityID: "1"},
+		Status:    domain.DeliveryDead,
+		Attempts: []domain.DeliveryAttempt{
+			{At: createdAt, Duration: 1500 * time.Millisecond, StatusCode: 500, Error: "status 500"},
+		},
+		LastError: "status 500",
+		CreatedAt: createdAt,
+	}
+
+	t.Run("CreateWebhook", func(t *testing.T) {
+		mockService.CreateFunc = func(ctx context.Context, w *domain.Webhook) error {
+			if w.URL != webhook.URL || len(w.EventTypes) != 1 || w.EventTypes[0] != domain.EventEntityCreated {
+				t.Errorf("expected the requested webhook, got %+v", w)
+			}
+			*w = *webhook
+			return nil
+		}
+
+		body := `{"url":"https://example.com/hooks","eventTypes":["entity.created"]}`
+		req := httptest.NewRequest("POST", "/webhooks", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d", http.StatusCreated, rr.Code)
+		}
+		if location := rr.Header().Get("Location"); location != "/webhooks/w1" {
+			t.Errorf("expected Location /webhooks/w1, got %q", location)
+		}
+		var response WebhookResponse
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatalf("could not decode response: %v", err)
+		}
+		if response.ID != "w1" || response.Secret != "whsec_test" || !response.CreatedAt.Equal(createdAt) {
+			t.Errorf("expected the created webhook with its secret, got %+v", response)
+		}
+	})
+
+	t.Run("GetWebhook", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/webhooks/w1", nil))
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+		var response map[string]any
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatalf("could not decode response: %v", err)
+		}
+		if response["id"] != "w1" {
+			t.Errorf("expected webhook w1, got %v", response)
+		}
+		if _, ok := response["secret"]; ok {
+			t.Error("expected the secret not to be returned")
+		}
+
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/webhooks/unknown", nil))
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+
+	t.Run("ListWebhooks", func(t *testing.T) {
+		mockService.ListFunc = func(ctx context.Context) ([]*domain.Webhook, error) {
+			return []*domain.Webhook{webhook, {ID: "w2", URL: "https://example.org"}}, nil
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/webhooks", nil))
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+		var response ListWebhooksResponse
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatalf("could not decode response: %v", err)
+		}
+		if len(response.Webhooks) != 2 || response.Webhooks[0].Secret != "" || response.Webhooks[1].EventTypes == nil {
+			t.Errorf("expected 2 webhooks without secrets, got %+v", response.Webhooks)
+		}
+	})
+
+	t.Run("DeleteWebhook", func(t *testing.T) {
+		var deleted string
+		mockService.DeleteFunc = func(ctx context.Context, id string) error {
+			deleted = id
+			return nil
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("DELETE", "/webhooks/w1", nil))
+
+		if rr.Code != http.StatusOK || deleted != "w1" {
+			t.Errorf("expected w1 to be deleted with status %d, got %q with %d", http.StatusOK, deleted, rr.Code)
+		}
+	})
+
+	t.Run("ListDeliveries", func(t *testing.T) {
+		mockService.ListDeliveriesFunc = func(ctx context.Context, opts domain.DeliveryListOptions) ([]*domain.WebhookDelivery, error) {
+			if opts.WebhookID != "w1" || opts.Status != domain.DeliveryDead || opts.Limit != 5 {
+				t.Errorf("unexpected options %+v", opts)
+			}
+			return []*domain.WebhookDelivery{dead}, nil
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/webhooks/w1/deliveries?status=dead&limit=5", nil))
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+		var response ListDeliveriesResponse
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatalf("could not decode response: %v", err)
+		}
+		if len(response.Deliveries) != 1 {
+			t.Fatalf("expected 1 delivery, got %d", len(response.Deliveries))
+		}
+		delivery := response.Deliveries[0]
+		if delivery.ID != "d1" || delivery.EventID != "e1" || delivery.Status != "dead" || delivery.NextAttemptAt != nil {
+			t.Errorf("unexpected delivery %+v", delivery)
+		}
+		if len(delivery.Attempts) != 1 || delivery.Attempts[0].StatusCode != 500 || delivery.Attempts[0].DurationMS != 1500 {
+			t.Errorf("expected the attempt log, got %+v", delivery.Attempts)
+		}
+
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/webhooks/w1/deliveries?limit=0", nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status %d for an invalid limit, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("ListDeadLetters", func(t *testing.T) {
+		mockService.ListDeliveriesFunc = func(ctx context.Context, opts domain.DeliveryListOptions) ([]*domain.WebhookDelivery, error) {
+			if opts.WebhookID != "" || opts.Status != domain.DeliveryDead {
+				t.Errorf("expected the dead deliveries of every webhook, got %+v", opts)
+			}
+			return []*domain.WebhookDelivery{dead}, nil
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/webhooks/dead-letters?status=succeeded", nil))
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+	})
+
+	t.Run("RetryDeadLetter", func(t *testing.T) {
+		mockService.RetryDeliveryFunc = func(ctx context.Context, id string) (*domain.WebhookDelivery, error) {
+			if id != "d1" {
+				return nil, apperror.New(apperror.ErrConflict, "delivery_not_dead", "only dead-lettered deliveries can be retried")
+			}
+			retried := *dead
+			retried.Status = domain.DeliveryPending
+			retried.NextAttemptAt = createdAt
+			return &retried, nil
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("POST", "/webhooks/dead-letters/d1/retry", nil))
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+		var response DeliveryResponse
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatalf("could not decode response: %v", err)
+		}
+		if response.Status != "pending" || response.NextAttemptAt == nil || !response.NextAttemptAt.Equal(createdAt) {
+			t.Errorf("expected the delivery to be pending again, got %+v", response)
+		}
+
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("POST", "/webhooks/dead-letters/d2/retry", nil))
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status %d, got %d", http.StatusConflict, rr.Code)
+		}
+	})
+}
+
+// mockAPIKeyService is a mock implementation of the APIKeyService interface.
+type mockAPIKeyService struct {
+	CreateFunc  func(ctx context.Context, key *domain.APIKey) (string, error)
+	GetByIDFunc func(ctx context.Context, id string) (*domain.APIKey, error)
+	ListFunc    func(ctx context.Context) ([]*domain.APIKey, error)
+	RevokeFunc  func(ctx context.Context, id string) (*domain.APIKey, error)
+}
+
+func (m *mockAPIKeyService) Create(ctx context.Context, key *domain.APIKey) (string, error) {
+	return m.CreateFunc(ctx, key)
+}
+
+func (m *mockAPIKeyService) GetByID(ctx context.Context, id string) (*domain.APIKey, error) {
+	return m.GetByIDFunc(ctx, id)
+}
+
+func (m *mockAPIKeyService) List(ctx context.Context) ([]*domain.APIKey, error) {
+	return m.ListFunc(ctx)
+}
+
+func (m *mockAPIKeyService) Revoke(ctx context.Context, id string) (*domain.APIKey, error) {
+	return m.RevokeFunc(ctx, id)
+}
+
+func (m *mockAPIKeyService) Verify(ctx context.Context, key string) (domain.Principal, error) {
+	return domain.Principal{}, apperror.ErrUnauthenticated
+}
+
+func TestAPIKeyHandler(t *testing.T) {
+	mockService := &mockAPIKeyService{}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handler := NewAPIKeyHandler(mockService, logger, 0)
+
+	router := chi.NewRouter()
+	router.Route("/api-keys", func(r chi.Router) {
+		r.Post("/", handler.CreateAPIKey)
+		r.Get("/", handler.ListAPIKeys)
+		r.Get("/{id}", handler.GetAPIKey)
+		r.Post("/{id}/revoke", handler.RevokeAPIKey)
+	})
+
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	key := &domain.APIKey{
+		ID:        "k1",
+		Name:      "sync",
+		Prefix:    "ak_01234567",
+		Hash:      "hash",
+		Scopes:    []domain.Role{domain.RoleReader},
+		OwnerID:   "alice",
+		CreatedAt: createdAt,
+	}
+
+	t.Run("CreateAPIKey", func(t *testing.T) {
+		mockService.CreateFunc = func(ctx context.Context, k *domain.APIKey) (string, error) {
+			if k.Name != "sync" || !slices.Equal(k.Scopes, []domain.Role{domain.RoleReader}) {
+				t.Errorf("expected the requested key, got %+v", k)
+			}
+			*k = *key
+			return "ak_0123456789", nil
+		}
+
+		req := httptest.NewRequest("POST", "/api-keys", strings.NewReader(`{"name":"sync","scopes":["reader"]}`))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status %d, got %d", http.StatusCreated, rr.Code)
+		}
+		if location := rr.Header().Get("Location"); location != "/api-keys/k1" {
+			t.Errorf("expected Location /api-keys/k1, got %q", location)
+		}
+		if cache := rr.Header().Get("Cache-Control"); cache != "no-store" {
+			t.Errorf("expected the response not to be cached, got Cache-Control %q", cache)
+		}
+		var response map[string]any
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatalf("could not decode response: %v", err)
+		}
+		if response["key"] != "ak_0123456789" || response["prefix"] != "ak_01234567" {
+			t.Errorf("expected the created key with its secret, got %v", response)
+		}
+		if _, ok := response["hash"]; ok {
+			t.Error("expected the hash not to be returned")
+		}
+	})
+
+	t.Run("GetAPIKey", func(t *testing.T) {
+		mockService.GetByIDFunc = func(ctx context.Context, id string) (*domain.APIKey, error) {
+			if id != "k1" {
+				return nil, apperror.New(apperror.ErrForbidden, "forbidden", "you do not have permission to manage this API key")
+			}
+			return key, nil
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/api-keys/k1", nil))
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+		var response map[string]any
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatalf("could not decode response: %v", err)
+		}
+		if _, ok := response["key"]; ok || response["id"] != "k1" {
+			t.Errorf("expected key k1 without its secret, got %v", response)
+		}
+
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/api-keys/k2", nil))
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("ListAPIKeys", func(t *testing.T) {
+		used := *key
+		used.LastUsedAt = createdAt.Add(time.Hour)
+		mockService.ListFunc = func(ctx context.Context) ([]*domain.APIKey, error) {
+			return []*domain.APIKey{key, &used}, nil
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", "/api-keys", nil))
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+		var response ListAPIKeysResponse
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatalf("could not decode response: %v", err)
+		}
+		if len(response.APIKeys) != 2 || response.APIKeys[0].LastUsedAt != nil || response.APIKeys[1].LastUsedAt == nil {
+			t.Errorf("expected 2 keys, the second one used, got %+v", response.APIKeys)
+		}
+	})
+
+	t.Run("RevokeAPIKey", func(t *testing.T) {
+		mockService.RevokeFunc = func(ctx context.Context, id string) (*domain.APIKey, error) {
+			revoked := *key
+			revoked.RevokedAt = createdAt.Add(time.Hour)
+			return &revoked, nil
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("POST", "/api-keys/k1/revoke", nil))
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+		var response APIKeyResponse
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatalf("could not decode response: %v", err)
+		}
+		if response.RevokedAt == nil || !response.RevokedAt.Equal(createdAt.Add(time.Hour)) {
+			t.Errorf("expected the key to be revoked, got %+v", response)
+		}
+	})
+}
+
+// sseEvent is an event read from a Server-Sent Events stream.
+type sseEvent struct {
+	id, event, data string
+}
+
+// readSSEEvent reads the next event from a Server-Sent Events stream, skipping
+// comments and blocks without data.
+func readSSEEvent(t *testing.T, scanner *bufio.Scanner) sseEvent {
+	t.Helper()
+
+	var event sseEvent
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if event.data != "" {
+				return event
+			}
+			continue
+		}
+		field, value, _ := strings.Cut(line, ": ")
+		switch field {
+		case "id":
+			event.id = value
+		case "event":
+			event.event = value
+		case "data":
+			event.data = value
+		}
+	}
+	t.Fatalf("expected an event, got the end of the stream: %v", scanner.Err())
+	return event
+}
+
+func TestEntityStream(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ctx := context.Background()
+
+	message := func(id string) *domain.EventMessage {
+		return &domain.EventMessage{
+			ID:         id,
+			Type:       domain.EventEntityUpdated,
+			EntityID:   "1",
+			OccurredAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+			Payload:    []byte(`{"entity":{"id":"1"}}`),
+		}
+	}
+
+	// connect opens the stream of server, and returns a scanner of its body
+	// once the stream has registered the client.
+	connect := func(t *testing.T, stream *EntityStream, server *httptest.Server, lastEventID string) *bufio.Scanner {
+		t.Helper()
+
+		clients := func() int {
+			stream.mu.Lock()
+			defer stream.mu.Unlock()
+			return len(stream.clients)
+		}
+		before := clients()
+
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		if lastEventID != "" {
+			req.Header.Set(LastEventIDHeader, lastEventID)
+		}
+		resp, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatalf("could not connect: %v", err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("expected an event stream, got status %d and %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+		for clients() == before {
+			time.Sleep(time.Millisecond)
+		}
+		return bufio.NewScanner(resp.Body)
+	}
+
+	t.Run("pushes published events", func(t *testing.T) {
+		stream := NewEntityStream(service.NewRoleAuthorizer(), logger, 0, 0)
+		server := httptest.NewServer(http.HandlerFunc(stream.StreamEntities))
+		t.Cleanup(server.Close) // After the streams opened by connect are closed.
+		scanner := connect(t, stream, server, "")
+
+		_ = stream.Publish(ctx, message("e1"))
+		_ = stream.Publish(ctx, message("e1")) // Relayed again.
+		_ = stream.Publish(ctx, message("e2"))
+
+		event := readSSEEvent(t, scanner)
+		if event.id != "e1" || event.event != "entity.updated" {
+			t.Errorf("expected event e1, got %+v", event)
+		}
+		var data EntityChangeEvent
+		if err := json.Unmarshal([]byte(event.data), &data); err != nil {
+			t.Fatalf("could not decode data: %v", err)
+		}
+		if data.Type != "entity.updated" || data.EntityID != "1" || string(data.Data) != `{"entity":{"id":"1"}}` {
+			t.Errorf("unexpected data %+v", data)
+		}
+		if event := readSSEEvent(t, scanner); event.id != "e2" {
+			t.Errorf("expected event e2 once e1 was sent once, got %+v", event)
+		}
+	})
+
+	t.Run("pushes the changes relayed from the outbox", func(t *testing.T) {
+		stream := NewEntityStream(service.NewRoleAuthorizer(), logger, 0, 0)
+		server := httptest.NewServer(http.HandlerFunc(stream.StreamEntities))
+		t.Cleanup(server.Close)
+		scanner := connect(t, stream, server, "")
+
+		entities, outbox, audit := inmemory.NewEntityRepository(), inmemory.NewOutboxRepository(), inmemory.NewAuditRepository()
+		entityService := service.NewEntityService(entities, inmemory.NewUnitOfWork(entities, outbox, audit), audit, service.NewRoleAuthorizer())
+		relay := service.NewEventRelay(outbox, stream)
+
+		entity := &domain.Entity{Name: "Test"}
+		if err := entityService.Create(ctx, entity); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		// Nothing is pushed before the relay polls the outbox.
+		stream.mu.Lock()
+		pushed := len(stream.events)
+		stream.mu.Unlock()
+		if pushed != 0 {
+			t.Errorf("expected no event before the relay, got %d", pushed)
+		}
+		if n, err := relay.Relay(ctx, 10); err != nil || n != 1 {
+			t.Fatalf("expected 1 relayed event, got %d and %v", n, err)
+		}
+
+		event := readSSEEvent(t, scanner)
+		if event.event != string(domain.EventEntityCreated) {
+			t.Fatalf("expected an %s event, got %+v", domain.EventEntityCreated, event)
+		}
+		var data EntityChangeEvent
+		if err := json.Unmarshal([]byte(event.data), &data); err != nil {
+			t.Fatalf("could not decode data: %v", err)
+		}
+		if data.EntityID != entity.ID {
+			t.Errorf("expected the change of entity %s, got %+v", entity.ID, data)
+		}
+	})
+
+	t.Run("only sends the entities that the principal may read", func(t *testing.T) {
+		stream := NewEntityStream(service.NewRoleAuthorizer(), logger, 0, 0)
+		bobPrincipal := domain.Principal{ID: "bob", Roles: []domain.Role{domain.RoleEditor}}
+		alice := service.WithPrincipal(ctx, domain.Principal{ID: "alice", Roles: []domain.Role{domain.RoleEditor}})
+		bob := service.WithPrincipal(ctx, bobPrincipal)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			stream.StreamEntities(w, r.WithContext(service.WithPrincipal(r.Context(), bobPrincipal)))
+		}))
+		t.Cleanup(server.Close)
+		scanner := connect(t, stream, server, "")
+
+		entities, outbox, audit := inmemory.NewEntityRepository(), inmemory.NewOutboxRepository(), inmemory.NewAuditRepository()
+		entityService := service.NewEntityService(entities, inmemory.NewUnitOfWork(entities, outbox, audit), audit, service.NewRoleAuthorizer())
+		relay := service.NewEventRelay(outbox, stream)
+
+		if err := entityService.Create(alice, &domain.Entity{Name: "Alice's"}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		owned := &domain.Entity{Name: "Bob's"}
+		if err := entityService.Create(bob, owned); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if n, err := relay.Relay(ctx, 10); err != nil || n != 2 {
+			t.Fatalf("expected 2 relayed events, got %d and %v", n, err)
+		}
+
+		var data EntityChangeEvent
+		if err := json.Unmarshal([]byte(readSSEEvent(t, scanner).data), &data); err != nil {
+			t.Fatalf("could not decode data: %v", err)
+		}
+		if data.EntityID != owned.ID {
+			t.Errorf("expected only the change of entity %s of bob, got %+v", owned.ID, data)
+		}
+	})
+
+	t.Run("rejects principals that may not list entities", func(t *testing.T) {
+		stream := NewEntityStream(service.NewRoleAuthorizer(), logger, 0, 0)
+		nobody := service.WithPrincipal(ctx, domain.Principal{ID: "nobody"})
+		req := httptest.NewRequest("GET", "/entities/stream", nil).WithContext(nobody)
+		rr := httptest.NewRecorder()
+		stream.StreamEntities(rr, req)
+
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("resumes after Last-Event-ID", func(t *testing.T) {
+		stream := NewEntityStream(service.NewRoleAuthorizer(), logger, 2, 0)
+		server := httptest.NewServer(http.HandlerFunc(stream.StreamEntities))
+		t.Cleanup(server.Close)
+		for _, id := range []string{"e1", "e2", "e3"} {
+			_ = stream.Publish(ctx, message(id))
+		}
+
+		scanner := connect(t, stream, server, "e2")
+		if event := readSSEEvent(t, scanner); event.id != "e3" {
+			t.Errorf("expected the missed event e3, got %+v", event)
+		}
+
+		// e1 is out of the log of 2 events.
+		scanner = connect(t, stream, server, "e1")
+		if event := readSSEEvent(t, scanner); event.event != "reset" {
+			t.Errorf("expected a reset event, got %+v", event)
+		}
+	})
+
+	t.Run("only sends the events of the tenant", func(t *testing.T) {
+		stream := NewEntityStream(service.NewRoleAuthorizer(), logger, 0, 1)
+		acme := message("e1")
+		acme.TenantID = "acme"
+		_ = stream.Publish(ctx, message("e0"))
+		_ = stream.Publish(ctx, acme)
+		_ = stream.Publish(ctx, message("e2"))
+
+		client, replay, resumed, err := stream.connect(service.WithTenant(ctx, "acme"), "e0")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if resumed {
+			t.Error("expected the event of another tenant not to resume the stream")
+		}
+		_, replay, _, _ = stream.connect(ctx, "e0")
+		if len(replay) != 1 || replay[0].ID != "e2" {
+			t.Errorf("expected to replay e2 only, got %v", replay)
+		}
+
+		// The events of other tenants do not fill the buffer of the client.
+		_ = stream.Publish(ctx, message("e3"))
+		_ = stream.Publish(ctx, message("e4"))
+		acme = message("e5")
+		acme.TenantID = "acme"
+		_ = stream.Publish(ctx, acme)
+		if m := <-client.events; m.ID != "e5" {
+			t.Errorf("expected the event of acme e5, got %s", m.ID)
+		}
+	})
+
+	t.Run("disconnects slow clients", func(t *testing.T) {
+		stream := NewEntityStream(service.NewRoleAuthorizer(), logger, 0, 1)
+		client, _, _, err := stream.connect(ctx, "")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		_ = stream.Publish(ctx, message("e1"))
+		_ = stream.Publish(ctx, message("e2"))
+
+		if m := <-client.events; m.ID != "e1" {
+			t.Errorf("expected the buffered event e1, got %s", m.ID)
+		}
+		if _, ok := <-client.events; ok {
+			t.Error("expected the client to be disconnected once its buffer is full")
+		}
+	})
+
+	t.Run("ends streams on Close", func(t *testing.T) {
+		stream := NewEntityStream(service.NewRoleAuthorizer(), logger, 0, 0)
+		server := httptest.NewServer(http.HandlerFunc(stream.StreamEntities))
+		t.Cleanup(server.Close)
+		scanner := connect(t, stream, server, "")
+
+		stream.Close()
+
+		for scanner.Scan() {
+		}
+		if err := scanner.Err(); err != nil {
+			t.Errorf("expected the stream to end cleanly, got %v", err)
+		}
+
+		resp, err := server.Client().Get(server.URL)
+		if err != nil {
+			t.Fatalf("could not connect: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("expected status %d after Close, got %d", http.StatusServiceUnavailable, resp.StatusCode)
+		}
+	})
+}
+
+// mockTokenVerifier is a mock implementation of the TokenVerifier interface.
+type mockTokenVerifier struct {
+	VerifyFunc func(ctx context.Context, token string) (domain.Principal, error)
+}
+
+func (m *mockTokenVerifier) Verify(ctx context.Context, token string) (domain.Principal, error) {
+	return m.VerifyFunc(ctx, token)
+}
+
+func TestAuthenticator(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	bearer := &mockTokenVerifier{VerifyFunc: func(ctx context.Context, token string) (domain.Principal, error) {
+		if token != "good" {
+			return domain.Principal{}, errors.New("jwt: token expired")
+		}
+		return domain.Principal{ID: "alice"}, nil
+	}}
+	apiKeys := &mockTokenVerifier{VerifyFunc: func(ctx context.Context, token string) (domain.Principal, error) {
+		switch token {
+		case "ak_good":
+			return domain.Principal{ID: "alice", APIKeyID: "k1"}, nil
+		case "ak_down":
+			return domain.Principal{}, fmt.Errorf("service: failed to find API key: %w", apperror.ErrInternal)
+		}
+		return domain.Principal{}, apperror.New(apperror.ErrUnauthenticated, "invalid_api_key", "the API key is invalid")
+	}}
+
+	var principal domain.Principal
+	schemes := []AuthScheme{{Name: "Bearer", Verifier: bearer}, {Name: "ApiKey", Verifier: apiKeys}}
+	handler := NewAuthenticator(schemes, logger).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ = service.PrincipalFrom(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	challenges := []string{`Bearer realm="api"`, `ApiKey realm="api"`}
+	tests := []struct {
+		name           string
+		authorization  string
+		wantStatus     int
+		wantChallenges []string
+	}{
+		{"valid token", "Bearer good", http.StatusNoContent, nil},
+		{"scheme is case-insensitive", "bearer good", http.StatusNoContent, nil},
+		{"valid API key", "ApiKey ak_good", http.StatusNoContent, nil},
+		{"missing header", "", http.StatusUnauthorized, challenges},
+		{"other scheme", "Basic YWxpY2U6c2VjcmV0", http.StatusUnauthorized, challenges},
+		{"empty token", "Bearer ", http.StatusUnauthorized, challenges},
+		{"invalid token", "Bearer bad", http.StatusUnauthorized, []string{`Bearer realm="api", error="invalid_token"`}},
+		{"invalid API key", "ApiKey ak_bad", http.StatusUnauthorized, []string{`ApiKey realm="api", error="invalid_token"`}},
+		{"verifier failure", "ApiKey ak_down", http.StatusInternalServerError, nil},
+	}
+	for _, tt := range tests {
+		principal = domain.Principal{}
+		req := httptest.NewRequest("GET", "/entities", nil)
+		if tt.authorization != "" {
+			req.Header.Set("Authorization", tt.authorization)
+		}
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != tt.wantStatus {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.wantStatus, rr.Code)
+		}
+		if got := rr.Header().Values("WWW-Authenticate"); !slices.Equal(got, tt.wantChallenges) {
+			t.Errorf("%s: expected WWW-Authenticate %q, got %q", tt.name, tt.wantChallenges, got)
+		}
+		if tt.wantStatus == http.StatusNoContent && principal.ID != "alice" {
+			t.Errorf("%s: expected principal alice in the context, got %+v", tt.name, principal)
+		}
+	}
+
+	t.Run("problem details", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/entities", nil)
+		req.Header.Set("Authorization", "Bearer bad")
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		var problem Problem
+		if err := json.NewDecoder(rr.Body).Decode(&problem); err != nil {
+			t.Fatalf("could not decode response: %v", err)
+		}
+		if problem.Type != problemTypePrefix+"unauthenticated" || problem.Code != "invalid_token" || problem.Detail != "jwt: token expired" {
+			t.Errorf("unexpected problem %+v", problem)
+		}
+	})
+}
+
+func TestTenantResolver(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	var tenantID string
+	handler := NewTenantResolver("example.com", logger).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenantID = service.TenantFrom(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name       string
+		host       string
+		header     string
+		principal  *domain.Principal
+		wantStatus int
+		wantTenant string
+	}{
+		{"default tenant", "example.com", "", nil, http.StatusNoContent, ""},
+		{"header", "example.com", "acme", nil, http.StatusNoContent, "acme"},
+		{"subdomain", "acme.example.com:8080", "", nil, http.StatusNoContent, "acme"},
+		{"subdomain is case-insensitive", "ACME.Example.com", "", nil, http.StatusNoContent, "acme"},
+		{"header and subdomain", "acme.example.com", "acme", nil, http.StatusNoContent, "acme"},
+		{"other domain", "acme.example.org", "", nil, http.StatusNoContent, ""},
+		{"conflicting header and subdomain", "acme.example.com", "globex", nil, http.StatusBadRequest, ""},
+		{"invalid header", "example.com", "Acme Inc", nil, http.StatusBadRequest, ""},
+		{"nested subdomain", "eu.acme.example.com", "", nil, http.StatusBadRequest, ""},
+		{"principal", "example.com", "", &domain.Principal{ID: "alice", TenantID: "acme"}, http.StatusNoContent, "acme"},
+		{"principal naming its tenant", "acme.example.com", "acme", &domain.Principal{ID: "alice", TenantID: "acme"}, http.StatusNoContent, "acme"},
+		{"principal naming another tenant", "example.com", "globex", &domain.Principal{ID: "alice", TenantID: "acme"}, http.StatusForbidden, ""},
+		{"principal of the default tenant", "acme.example.com", "", &domain.Principal{ID: "alice"}, http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		tenantID = "unset"
+		req := httptest.NewRequest("GET", "/entities", nil)
+		req.Host = tt.host
+		if tt.header != "" {
+			req.Header.Set(TenantIDHeader, tt.header)
+		}
+		if tt.principal != nil {
+			req = req.WithContext(service.WithPrincipal(req.Context(), *tt.principal))
+		}
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != tt.wantStatus {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.wantStatus, rr.Code)
+		}
+		if tt.wantStatus == http.StatusNoContent && tenantID != tt.wantTenant {
+			t.Errorf("%s: expected tenant %q in the context, got %q", tt.name, tt.wantTenant, tenantID)
+		}
+	}
+
+	t.Run("problem details", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/entities", nil)
+		req.Header.Set(TenantIDHeader, "globex")
+		req = req.WithContext(service.WithPrincipal(req.Context(), domain.Principal{ID: "alice", TenantID: "acme"}))
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		var problem Problem
+		if err := json.NewDecoder(rr.Body).Decode(&problem); err != nil {
+			t.Fatalf("could not decode response: %v", err)
+		}
+		if problem.Type != problemTypePrefix+"forbidden" || problem.Code != "tenant_mismatch" {
+			t.Errorf("unexpected problem %+v", problem)
+		}
+	})
+}
+
+// failingRateLimitStore is a RateLimitStore that always fails.
+type failingRateLimitStore struct{}
+
+func (failingRateLimitStore) Take(ctx context.Context, key string, limit RateLimit, now time.Time) (RateLimitStatus, error) {
+	return RateLimitStatus{}, errors.New("store unavailable")
+}
+
+func TestRateLimiter(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// newRouter routes requests through a RateLimiter with a fake clock.
+	newRouter := func(store RateLimitStore, limit RateLimit, routes map[string]RateLimit) (http.Handler, *time.Time) {
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		limiter := NewRateLimiter(store, limit, routes, logger)
+		limiter.now = func() time.Time { return now }
+
+		router := chi.NewRouter()
+		router.Use(limiter.Middleware)
+		ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
+		router.Route("/entities", func(r chi.Router) {
+			r.Get("/", ok)
+			r.Get("/{id}", ok)
+		})
+		router.Post("/entities:batch", ok)
+		return router, &now
+	}
+	send := func(handler http.Handler, method, target, remoteAddr string, principal *domain.Principal) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.RemoteAddr = remoteAddr
+		if principal != nil {
+			req = req.WithContext(service.WithPrincipal(req.Context(), *principal))
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Headers and limit", func(t *testing.T) {
+		handler, now := newRouter(NewMemoryRateLimitStore(), RateLimit{Requests: 2, Period: 10 * time.Second}, nil)
+
+		rr := send(handler, "GET", "/entities/1", "192.0.2.1:1234", nil)
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("expected status %d, got %d", http.StatusNoContent, rr.Code)
+		}
+		for header, want := range map[string]string{
+			"RateLimit-Limit":     "2",
+			"RateLimit-Remaining": "1",
+			"RateLimit-Reset":     "5",
+			"RateLimit-Policy":    "2;w=10",
+		} {
+			if got := rr.Header().Get(header); got != want {
+				t.Errorf("expected %s %q, got %q", header, want, got)
+			}
+		}
+
+		send(handler, "GET", "/entities/2", "192.0.2.1:1234", nil)
+		rr = send(handler, "GET", "/entities/", "192.0.2.1:1234", nil)
+		if rr.Code != http.StatusTooManyRequests {
+			t.Fatalf("expected status %d, got %d", http.StatusTooManyRequests, rr.Code)
+		}
+		if got := rr.Header().Get("Retry-After"); got != "5" {
+			t.Errorf("expected Retry-After %q, got %q", "5", got)
+		}
+		if got := rr.Header().Get("RateLimit-Remaining"); got != "0" {
+			t.Errorf("expected RateLimit-Remaining %q, got %q", "0", got)
+		}
+		var problem Problem
+		if err := json.NewDecoder(rr.Body).Decode(&problem); err != nil {
+			t.Fatalf("could not decode response: %v", err)
+		}
+		if problem.Type != problemTypePrefix+"rate-limited" || problem.Code != "rate_limited" {
+			t.Errorf("unexpected problem %+v", problem)
+		}
+
+		// A token is earned back every 5 seconds.
+		*now = now.Add(5 * time.Second)
+		if rr := send(handler, "GET", "/entities/1", "192.0.2.1:1234", nil); rr.Code != http.StatusNoContent {
+			t.Errorf("expected status %d after the refill, got %d", http.StatusNoContent, rr.Code)
+		}
+		if rr := send(handler, "GET", "/entities/1", "192.0.2.1:1234", nil); rr.Code != http.StatusTooManyRequests {
+			t.Errorf("expected status %d once the refill is spent, got %d", http.StatusTooManyRequests, rr.Code)
+		}
+	})
+
+	t.Run("Clients", func(t *testing.T) {
+		handler, _ := newRouter(NewMemoryRateLimitStore(), RateLimit{Requests: 1, Period: time.Minute}, nil)
+
+		clients := []struct {
+			name       string
+			remoteAddr string
+			principal  *domain.Principal
+		}{
+			{"IP address", "192.0.2.1:1234", nil},
+			{"IP address without a port", "192.0.2.2", nil},
+			{"principal", "192.0.2.1:1234", &domain.Principal{ID: "alice"}},
+			{"principal of another tenant", "192.0.2.1:1234", &domain.Principal{ID: "alice", TenantID: "acme"}},
+			{"API key", "192.0.2.1:1234", &domain.Principal{ID: "alice", APIKeyID: "key-1"}},
+			{"other API key", "192.0.2.1:1234", &domain.Principal{ID: "alice", APIKeyID: "key-2"}},
+		}
+		for _, c := range clients {
+			if rr := send(handler, "GET", "/entities/1", c.remoteAddr, c.principal); rr.Code != http.StatusNoContent {
+				t.Errorf("%s: expected status %d for the first request, got %d", c.name, http.StatusNoContent, rr.Code)
+			}
+		}
+		for _, c := range clients {
+			if rr := send(handler, "GET", "/entities/1", c.remoteAddr, c.principal); rr.Code != http.StatusTooManyRequests {
+				t.Errorf("%s: expected status %d for the second request, got %d", c.name, http.StatusTooManyRequests, rr.Code)
+			}
+		}
+	})
+
+	t.Run("Routes", func(t *testing.T) {
+		handler, _ := newRouter(NewMemoryRateLimitStore(), RateLimit{Requests: 2, Period: time.Minute}, map[string]RateLimit{
+			"POST /entities:batch": {Requests: 1, Period: time.Minute},
+			"GET /entities/":       {},
+		})
+
+		rr := send(handler, "POST", "/entities:batch", "192.0.2.1:1234", nil)
+		if rr.Code != http.StatusNoContent || rr.Header().Get("RateLimit-Limit") != "1" {
+			t.Errorf("expected the route limit, got status %d and limit %q", rr.Code, rr.Header().Get("RateLimit-Limit"))
+		}
+		if rr := send(handler, "POST", "/entities:batch", "192.0.2.1:1234", nil); rr.Code != http.StatusTooManyRequests {
+			t.Errorf("expected status %d, got %d", http.StatusTooManyRequests, rr.Code)
+		}
+
+		// The other routes share the default limit, untouched by the route above.
+		for i := range 2 {
+			if rr := send(handler, "GET", fmt.Sprintf("/entities/%d", i), "192.0.2.1:1234", nil); rr.Code != http.StatusNoContent {
+				t.Errorf("expected status %d, got %d", http.StatusNoContent, rr.Code)
+			}
+		}
+		if rr := send(handler, "GET", "/entities/3", "192.0.2.1:1234", nil); rr.Code != http.StatusTooManyRequests {
+			t.Errorf("expected status %d, got %d", http.StatusTooManyRequests, rr.Code)
+		}
+
+		// A zero route limit means no limit.
+		for range 3 {
+			rr := send(handler, "GET", "/entities/", "192.0.2.1:1234", nil)
+			if rr.Code != http.StatusNoContent || rr.Header().Get("RateLimit-Limit") != "" {
+				t.Errorf("expected an unlimited route, got status %d and limit %q", rr.Code, rr.Header().Get("RateLimit-Limit"))
+			}
+		}
+	})
+
+	t.Run("IP address alone", func(t *testing.T) {
+		limiter := NewIPRateLimiter(NewMemoryRateLimitStore(), RateLimit{Requests: 2, Period: time.Minute}, logger)
+		handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+
+		// Every request of an address counts, whatever its credentials.
+		send(handler, "GET", "/entities/1", "192.0.2.1:1234", &domain.Principal{ID: "alice"})
+		send(handler, "GET", "/entities/1", "192.0.2.1:1234", &domain.Principal{ID: "bob", APIKeyID: "key-1"})
+		if rr := send(handler, "GET", "/entities/1", "192.0.2.1:1234", nil); rr.Code != http.StatusTooManyRequests {
+			t.Errorf("expected status %d, got %d", http.StatusTooManyRequests, rr.Code)
+		}
+		if rr := send(handler, "GET", "/entities/1", "192.0.2.2:1234", &domain.Principal{ID: "alice"}); rr.Code != http.StatusNoContent {
+			t.Errorf("expected another address not to be limited, got status %d", rr.Code)
+		}
+	})
+
+	t.Run("Store failure", func(t *testing.T) {
+		handler, _ := newRouter(failingRateLimitStore{}, RateLimit{Requests: 1, Period: time.Minute}, nil)
+
+		if rr := send(handler, "GET", "/entities/1", "192.0.2.1:1234", nil); rr.Code != http.StatusNoContent {
+			t.Errorf("expected the request to be served, got status %d", rr.Code)
+		}
 	})
 }
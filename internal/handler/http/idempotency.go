@@ -0,0 +1,313 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/apperror"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/service"
+)
+
+// IdempotencyKeyHeader is the request header that carries the idempotency key.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// DefaultIdempotencyTTL is how long responses are replayed when no TTL is configured.
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+const (
+	// idempotentReplayedHeader marks replayed responses.
+	idempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+
+	// idempotencySweepInterval is the number of Begin calls between sweeps of
+	// expired records from the in-memory store.
+	idempotencySweepInterval = 1024
+)
+
+// replayedHeaders are the headers of a response that are stored for replay:
+// those that the handlers set. The others, such as the RateLimit-* headers of
+// the middleware in front of Idempotency, describe the request they were sent
+// with, and are set afresh for the replays.
+var replayedHeaders = []string{
+	"Cache-Control",
+	"Content-Type",
+	"ETag",
+	"Last-Modified",
+	"Location",
+	"X-Content-Type-Options",
+}
+
+// errIdempotencyKeyReused is reported when an idempotency key is sent with a
+// different request than the one it was first used for.
+var errIdempotencyKeyReused = errors.New("idempotency key reused")
+
+// IdempotencyRecord is what an IdempotencyStore keeps for an idempotency key.
+type IdempotencyRecord struct {
+	Fingerprint string              // Identifies the request the key was first used for.
+	ExpiresAt   time.Time           // After this, the key can be used again.
+	Response    *IdempotentResponse // Nil while the first request is in progress.
+}
+
+// IdempotentResponse is a response recorded for replay.
+type IdempotentResponse struct {
+	Status int
+	Header http.Header // Only the replayedHeaders.
+	Body   []byte
+}
+
+// IdempotencyStore stores the responses replayed by the Idempotency middleware.
+// Implementations must be safe for concurrent use.
+type IdempotencyStore interface {
+	// Begin reserves key for the request described by record, whose Response
+	// is nil. If key is already reserved and has not expired, Begin reserves
+	// nothing and returns the existing record instead.
+	Begin(ctx context.Context, key string, record IdempotencyRecord) (*IdempotencyRecord, error)
+
+	// Complete records the response to the request that reserved key.
+	Complete(ctx context.Context, key string, response *IdempotentResponse) error
+
+	// Release removes the reservation of key, so that the request can be retried.
+	Release(ctx context.Context, key string) error
+}
+
+// Idempotency is a middleware that makes retries of a request safe. The first
+// response to each Idempotency-Key header is stored, and replayed to later
+// requests with the same key and body instead of handling them again.
+//
+// Responses with a 5xx status are not stored, so that the request can be
+// retried. Requests without the header are handled as usual.
+type Idempotency struct {
+	responder
+	store        IdempotencyStore
+	ttl          time.Duration
+	maxBodyBytes int64
+}
+
+// NewIdempotency creates an Idempotency middleware that keeps responses in
+// store for ttl. Zero values for ttl and maxBodyBytes mean DefaultIdempotencyTTL
+// and DefaultMaxBodyBytes.
+func NewIdempotency(store IdempotencyStore, logger *slog.Logger, ttl time.Duration, maxBodyBytes int64) *Idempotency {
+	if ttl <= 0 {
+		ttl = DefaultIdempotencyTTL
+	}
+	if maxBodyBytes <= 0 {
+		maxBodyBytes = DefaultMaxBodyBytes
+	}
+	return &Idempotency{
+		responder:    responder{logger: logger},
+		store:        store,
+		ttl:          ttl,
+		maxBodyBytes: maxBodyBytes,
+	}
+}
+
+// Middleware wraps next with the idempotency handling.
+func (m *Idempotency) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			m.handleError(w, r, apperror.New(apperror.ErrInvalidInput, "invalid_idempotency_key",
+				fmt.Sprintf("%s must be at most %d characters", IdempotencyKeyHeader, maxIdempotencyKeyLength)))
+			return
+		}
+		// Clients choose their keys, so each tenant and principal has keys of its own.
+		if principal, ok := service.PrincipalFrom(r.Context()); ok {
+			key = principal.ID + "\x00" + key
+		}
+		if tenantID := service.TenantFrom(r.Context()); tenantID != "" {
+			key = tenantID + "\x00" + key
+		}
+
+		// The body is part of the fingerprint, so read it up front and hand a
+		// copy to next.
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, m.maxBodyBytes))
+		if err != nil {
+			m.handleError(w, r, decodeError(err))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		fingerprint := requestFingerprint(r, body)
+		existing, err := m.store.Begin(r.Context(), key, IdempotencyRecord{
+			Fingerprint: fingerprint,
+			ExpiresAt:   time.Now().Add(m.ttl),
+		})
+		switch {
+		case err != nil:
+			m.handleError(w, r, fmt.Errorf("failed to reserve idempotency key: %w", err))
+		case existing == nil:
+			m.serveFirst(w, r, next, key)
+		case existing.Fingerprint != fingerprint:
+			m.handleError(w, r, apperror.New(errIdempotencyKeyReused, "idempotency_key_reused",
+				fmt.Sprintf("%s was already used for a different request", IdempotencyKeyHeader)))
+		case existing.Response == nil:
+			m.handleError(w, r, apperror.New(apperror.ErrConflict, "request_in_progress",
+				fmt.Sprintf("a request with this %s is still in progress", IdempotencyKeyHeader)))
+		default:
+			m.replay(w, r, existing.Response)
+		}
+	})
+}
+
+// serveFirst handles the first request with key and stores its response.
+func (m *Idempotency) serveFirst(w http.ResponseWriter, r *http.Request, next http.Handler, key string) {
+	// Storing must not depend on whether the client is still waiting.
+	ctx := context.WithoutCancel(r.Context())
+	rec := &responseRecorder{ResponseWriter: w}
+
+	completed := false
+	defer func() {
+		// Release the key if next failed or panicked, so that it can be retried.
+		if completed {
+			return
+		}
+		if err := m.store.Release(ctx, key); err != nil {
+			m.logger.Error("failed to release idempotency key", "error", err.Error(), "method", r.Method, "url", r.URL.String())
+		}
+	}()
+
+	next.ServeHTTP(rec, r)
+
+	if rec.status >= http.StatusInternalServerError {
+		return
+	}
+	if rec.status == 0 {
+		// next wrote nothing, which net/http sends as an empty 200 OK.
+		rec.status = http.StatusOK
+		rec.header = w.Header().Clone()
+	}
+	header := make(http.Header)
+	for _, name := range replayedHeaders {
+		if values := rec.header.Values(name); len(values) > 0 {
+			header[name] = values
+		}
+	}
+	response := &IdempotentResponse{
+		Status: rec.status,
+		Header: header,
+		Body:   rec.body.Bytes(),
+	}
+	if err := m.store.Complete(ctx, key, response); err != nil {
+		m.logger.Error("failed to store idempotent response", "error", err.Error(), "method", r.Method, "url", r.URL.String())
+		return
+	}
+	completed = true
+}
+
+// replay writes a stored response.
+func (m *Idempotency) replay(w http.ResponseWriter, r *http.Request, response *IdempotentResponse) {
+	for name, values := range response.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set(idempotentReplayedHeader, "true")
+	w.WriteHeader(response.Status)
+	if _, err := w.Write(response.Body); err != nil {
+		m.logger.Error("failed to write response", "error", err.Error(), "method", r.Method, "url", r.URL.String())
+	}
+}
+
+// requestFingerprint identifies a request by its method, path and body.
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", r.Method, r.URL.Path)
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder passes a response through while recording a copy of it.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+		rec.header = rec.ResponseWriter.Header().Clone()
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.WriteHeader(http.StatusOK)
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// MemoryIdempotencyStore is an IdempotencyStore that keeps records in memory.
+// Records are lost on restart and are not shared between instances.
+type MemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]*IdempotencyRecord
+	begins  int
+}
+
+// NewMemoryIdempotencyStore creates an empty MemoryIdempotencyStore.
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		records: make(map[string]*IdempotencyRecord),
+	}
+}
+
+// Begin implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Begin(ctx context.Context, key string, record IdempotencyRecord) (*IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.begins++
+	if s.begins%idempotencySweepInterval == 0 {
+		for k, r := range s.records {
+			if now.After(r.ExpiresAt) {
+				delete(s.records, k)
+			}
+		}
+	}
+
+	if existing, ok := s.records[key]; ok && !now.After(existing.ExpiresAt) {
+		copied := *existing
+		return &copied, nil
+	}
+	s.records[key] = &record
+	return nil, nil
+}
+
+// Complete implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Complete(ctx context.Context, key string, response *IdempotentResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.records[key]
+	if !ok {
+		return fmt.Errorf("idempotency key %q is not reserved", key)
+	}
+	record.Response = response
+	return nil
+}
+
+// Release implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+	return nil
+}
@@ -0,0 +1,427 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/apperror"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/service"
+)
+
+// Media types of the supported patch documents.
+const (
+	mergePatchType = "application/merge-patch+json" // RFC 7396
+	jsonPatchType  = "application/json-patch+json"  // RFC 6902
+)
+
+// parsePatch parses the patch document in the request body into a patch of
+// the fields an UpdateEntityRequest replaces.
+func (h *EntityHandler) parsePatch(w http.ResponseWriter, r *http.Request) (service.EntityPatch, error) {
+	mediaType := contentType(r)
+	if mediaType != mergePatchType && mediaType != jsonPatchType {
+		w.Header().Set("Accept-Patch", mergePatchType+", "+jsonPatchType)
+		return nil, apperror.New(errUnsupportedMediaType, "unsupported_media_type",
+			"Content-Type must be "+mergePatchType+" or "+jsonPatchType)
+	}
+
+	var raw json.RawMessage
+	if err := h.decodeBody(w, r, &raw); err != nil {
+		return nil, err
+	}
+
+	var apply func(doc any) (any, error)
+	if mediaType == mergePatchType {
+		var patch any
+		if err := json.Unmarshal(raw, &patch); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal merge patch: %w", err)
+		}
+		apply = func(doc any) (any, error) {
+			return mergePatch(doc, patch), nil
+		}
+	} else {
+		ops, err := parseJSONPatch(raw)
+		if err != nil {
+			return nil, err
+		}
+		apply = func(doc any) (any, error) {
+			return applyJSONPatch(doc, ops)
+		}
+	}
+
+	return func(entity *domain.Entity) error {
+		doc, err := toDocument(UpdateEntityRequest{Name: entity.Name})
+		if err != nil {
+			return err
+		}
+		patched, err := apply(doc)
+		if err != nil {
+			return err
+		}
+
+		var req UpdateEntityRequest
+		if err := fromDocument(patched, &req); err != nil {
+			return err
+		}
+		entity.Name = req.Name
+		return nil
+	}, nil
+}
+
+// toDocument converts v to its generic JSON representation.
+func toDocument(v any) (any, error) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal patch target: %w", err)
+	}
+	var doc any
+	if err := json.Unmarshal(js, &doc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal patch target: %w", err)
+	}
+	return doc, nil
+}
+
+// fromDocument decodes a patched document into dst, rejecting the fields dst
+// does not have, as decodeJSON does for request bodies.
+func fromDocument(doc any, dst any) error {
+	js, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("failed to marshal patched document: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.DisallowUnknownFields()
+
+	err = dec.Decode(dst)
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &typeErr) && typeErr.Field == "":
+		return invalidPatch(fmt.Sprintf("the patched entity must be a JSON object, not %s", typeErr.Value))
+	case errors.As(err, &typeErr):
+		return invalidPatch("the patched entity contains a field of the wrong type").
+			WithFields(apperror.FieldError{Field: typeErr.Field, Code: "wrong_type", Message: fmt.Sprintf("must be a %s, not %s", jsonType(typeErr.Type.Kind()), typeErr.Value)})
+	}
+	if field, ok := unknownField(err); ok {
+		return invalidPatch("the patch sets a field that cannot be changed").
+			WithFields(apperror.FieldError{Field: field, Code: "unknown", Message: "is not a field that can be patched"})
+	}
+	return fmt.Errorf("failed to decode patched document: %w", err)
+}
+
+// invalidPatch returns an apperror.ErrInvalidInput error about a patch whose
+// result cannot be applied to an entity.
+func invalidPatch(message string) *apperror.Error {
+	return apperror.New(apperror.ErrInvalidInput, "invalid_patch", message)
+}
+
+// mergePatch applies an RFC 7396 merge patch to target and returns the result.
+// It may modify target but never patch.
+func mergePatch(target, patch any) any {
+	members, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	result, ok := target.(map[string]any)
+	if !ok {
+		result = make(map[string]any, len(members))
+	}
+	for name, value := range members {
+		if value == nil {
+			delete(result, name)
+			continue
+		}
+		result[name] = mergePatch(result[name], value)
+	}
+	return result
+}
+
+// patchOperation is an operation of an RFC 6902 JSON Patch.
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+
+	path, from []string // Parsed JSON Pointers.
+	value      any      // Parsed Value.
+}
+
+// errPathNotFound reports a JSON Pointer that does not point to a value.
+var errPathNotFound = errors.New("path not found")
+
+// parseJSONPatch parses and checks the operations of an RFC 6902 JSON Patch.
+// As the RFC requires, members an operation does not use are ignored.
+func parseJSONPatch(raw json.RawMessage) ([]patchOperation, error) {
+	var ops []patchOperation
+	if err := json.Unmarshal(raw, &ops); err != nil {
+		return nil, apperror.New(apperror.ErrInvalidInput, "malformed_patch", "a JSON Patch must be an array of operations")
+	}
+
+	for i := range ops {
+		op := &ops[i]
+		malformed := func(message string) error {
+			return apperror.New(apperror.ErrInvalidInput, "malformed_patch", message).WithMeta("operation", i)
+		}
+
+		if !slices.Contains([]string{"add", "remove", "replace", "move", "copy", "test"}, op.Op) {
+			return nil, malformed(fmt.Sprintf("unknown operation %q", op.Op))
+		}
+		if op.Path == nil {
+			return nil, malformed(op.Op + " operation requires a path")
+		}
+		path, err := parsePointer(*op.Path)
+		if err != nil {
+			return nil, malformed(err.Error())
+		}
+		op.path = path
+
+		switch op.Op {
+		case "move", "copy":
+			if op.From == nil {
+				return nil, malformed(op.Op + " operation requires from")
+			}
+			from, err := parsePointer(*op.From)
+			if err != nil {
+				return nil, malformed(err.Error())
+			}
+			if op.Op == "move" && len(from) < len(path) && slices.Equal(from, path[:len(from)]) {
+				return nil, malformed("cannot move a value into one of its children")
+			}
+			op.from = from
+		case "add", "replace", "test":
+			if op.Value == nil {
+				return nil, malformed(op.Op + " operation requires a value")
+			}
+			if err := json.Unmarshal(op.Value, &op.value); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal patch value: %w", err)
+			}
+		}
+	}
+	return ops, nil
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into its unescaped reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("JSON Pointer %q must start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+// applyJSONPatch applies the operations of a JSON Patch to doc, in order, and
+// returns the result. It may modify doc but never the operations.
+// An operation that cannot be applied to doc is reported as a conflict.
+func applyJSONPatch(doc any, ops []patchOperation) (any, error) {
+	for i, op := range ops {
+		var (
+			value any
+			err   error
+		)
+		switch op.Op {
+		case "add":
+			doc, err = addValue(doc, op.path, deepCopy(op.value))
+		case "remove":
+			doc, _, err = removeValue(doc, op.path)
+		case "replace":
+			if doc, _, err = removeValue(doc, op.path); err == nil {
+				doc, err = addValue(doc, op.path, deepCopy(op.value))
+			}
+		case "move":
+			if doc, value, err = removeValue(doc, op.from); err == nil {
+				doc, err = addValue(doc, op.path, value)
+			}
+		case "copy":
+			if value, err = getValue(doc, op.from); err == nil {
+				doc, err = addValue(doc, op.path, deepCopy(value))
+			}
+		case "test":
+			if value, err = getValue(doc, op.path); err == nil && !reflect.DeepEqual(value, op.value) {
+				return nil, patchConflict(i, fmt.Sprintf("test failed: the value at %q differs", *op.Path))
+			}
+		}
+
+		if errors.Is(err, errPathNotFound) {
+			pointer := *op.Path
+			if op.Op == "move" || op.Op == "copy" {
+				pointer = fmt.Sprintf("%s or %s", *op.From, *op.Path)
+			}
+			return nil, patchConflict(i, fmt.Sprintf("%s failed: %s does not point to a value", op.Op, pointer))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+// patchConflict returns an apperror.ErrConflict error about a patch operation
+// that cannot be applied to the current state of the entity.
+func patchConflict(operation int, message string) error {
+	return apperror.New(apperror.ErrConflict, "patch_conflict", message).WithMeta("operation", operation)
+}
+
+// getValue returns the value that path points to in doc.
+func getValue(doc any, path []string) (any, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]any:
+			value, ok := node[token]
+			if !ok {
+				return nil, errPathNotFound
+			}
+			doc = value
+		case []any:
+			i, ok := arrayIndex(token, len(node))
+			if !ok {
+				return nil, errPathNotFound
+			}
+			doc = node[i]
+		default:
+			return nil, errPathNotFound
+		}
+	}
+	return doc, nil
+}
+
+// addValue adds value to doc at path, as the add operation does, and returns
+// the resulting document.
+func addValue(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	token, rest := path[0], path[1:]
+
+	switch node := doc.(type) {
+	case map[string]any:
+		if len(rest) == 0 {
+			node[token] = value
+			return node, nil
+		}
+		child, ok := node[token]
+		if !ok {
+			return nil, errPathNotFound
+		}
+		child, err := addValue(child, rest, value)
+		if err != nil {
+			return nil, err
+		}
+		node[token] = child
+		return node, nil
+	case []any:
+		if len(rest) == 0 {
+			i := len(node)
+			if token != "-" {
+				var ok bool
+				if i, ok = arrayIndex(token, len(node)+1); !ok {
+					return nil, errPathNotFound
+				}
+			}
+			return slices.Insert(node, i, value), nil
+		}
+		i, ok := arrayIndex(token, len(node))
+		if !ok {
+			return nil, errPathNotFound
+		}
+		child, err := addValue(node[i], rest, value)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = child
+		return node, nil
+	default:
+		return nil, errPathNotFound
+	}
+}
+
+// removeValue removes the value at path from doc and returns the resulting
+// document and the removed value.
+func removeValue(doc any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+	token, rest := path[0], path[1:]
+
+	switch node := doc.(type) {
+	case map[string]any:
+		child, ok := node[token]
+		if !ok {
+			return nil, nil, errPathNotFound
+		}
+		if len(rest) == 0 {
+			delete(node, token)
+			return node, child, nil
+		}
+		child, removed, err := removeValue(child, rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		node[token] = child
+		return node, removed, nil
+	case []any:
+		i, ok := arrayIndex(token, len(node))
+		if !ok {
+			return nil, nil, errPathNotFound
+		}
+		if len(rest) == 0 {
+			removed := node[i]
+			return slices.Delete(node, i, i+1), removed, nil
+		}
+		child, removed, err := removeValue(node[i], rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		node[i] = child
+		return node, removed, nil
+	default:
+		return nil, nil, errPathNotFound
+	}
+}
+
+// arrayIndex parses a reference token as an index below size.
+// Like RFC 6901, it rejects leading zeros and signs.
+func arrayIndex(token string, size int) (int, bool) {
+	if token == "" || (len(token) > 1 && token[0] == '0') || strings.ContainsAny(token, "+-") {
+		return 0, false
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i >= size {
+		return 0, false
+	}
+	return i, true
+}
+
+// deepCopy copies a generic JSON value, so that later operations cannot
+// modify the original.
+func deepCopy(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		c := make(map[string]any, len(v))
+		for name, member := range v {
+			c[name] = deepCopy(member)
+		}
+		return c
+	case []any:
+		c := make([]any, len(v))
+		for i, element := range v {
+			c[i] = deepCopy(element)
+		}
+		return c
+	default:
+		return v
+	}
+}
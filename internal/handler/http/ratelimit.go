@@ -0,0 +1,279 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/apperror"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/service"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// Headers describing the rate limit of a client, after the IETF draft
+	// "RateLimit header fields for HTTP".
+	rateLimitLimitHeader     = "RateLimit-Limit"
+	rateLimitRemainingHeader = "RateLimit-Remaining"
+	rateLimitResetHeader     = "RateLimit-Reset"
+	rateLimitPolicyHeader    = "RateLimit-Policy"
+
+	// rateLimitSweepInterval is the number of Take calls between sweeps of
+	// full buckets from the in-memory store.
+	rateLimitSweepInterval = 1024
+)
+
+// errRateLimited is reported when a client sends more requests than its rate
+// limit allows.
+var errRateLimited = errors.New("rate limit exceeded")
+
+// RateLimit allows bursts of up to Requests requests, refilled at Requests
+// per Period.
+type RateLimit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// enabled reports whether the limit lets any request through at all, which
+// zero limits do not.
+func (l RateLimit) enabled() bool {
+	return l.Requests > 0 && l.Period > 0
+}
+
+// RateLimitStatus is the state of a bucket after a request was counted.
+type RateLimitStatus struct {
+	Allowed    bool          // Whether the request is within the limit.
+	Remaining  int           // Requests allowed right away after this one.
+	Reset      time.Duration // Until the bucket is full again.
+	RetryAfter time.Duration // Until the next request is allowed, if this one is not.
+}
+
+// RateLimitStore keeps the token buckets of the RateLimiter middleware.
+// Implementations must be safe for concurrent use.
+type RateLimitStore interface {
+	// Take takes a token from the bucket of key, which holds limit.Requests
+	// tokens when it is first used, at time now. The request is allowed if
+	// the bucket was not empty.
+	Take(ctx context.Context, key string, limit RateLimit, now time.Time) (RateLimitStatus, error)
+}
+
+// RateLimiter is a middleware that limits the rate of requests of each client
+// with token buckets. Clients are told about their limit by the RateLimit-*
+// headers of every response, and are rejected with a 429 Too Many Requests
+// response and a Retry-After header when they exceed it.
+//
+// A client is identified by its API key, else by its principal, else by its
+// IP address, which middleware.RealIP resolves from the proxy headers. Every
+// route has the default limit, shared by all the routes of a client, unless
+// it has a limit of its own.
+type RateLimiter struct {
+	responder
+	store  RateLimitStore
+	limit  RateLimit
+	routes map[string]RateLimit
+	client func(r *http.Request) string // Identifies the client of a request.
+	now    func() time.Time
+}
+
+// NewRateLimiter creates a RateLimiter that keeps its buckets in store. The
+// routes map patterns of the router, as "METHOD /pattern", to their limits,
+// e.g. "POST /entities:batch". A zero limit means no limit.
+//
+// Clients are only told apart by their credentials once they are
+// authenticated, so the middleware goes after the authentication.
+func NewRateLimiter(store RateLimitStore, limit RateLimit, routes map[string]RateLimit, logger *slog.Logger) *RateLimiter {
+	return &RateLimiter{
+		responder: responder{logger: logger},
+		store:     store,
+		limit:     limit,
+		routes:    routes,
+		client:    rateLimitClient,
+		now:       time.Now,
+	}
+}
+
+// NewIPRateLimiter creates a RateLimiter that identifies clients by their IP
+// address alone, and allows each one limit on every route. It goes before the
+// authentication, so that requests whose credentials are rejected count too:
+// a client guessing credentials is limited like any other. The RateLimit-*
+// headers of the requests it allows are those of the limiters that run after it.
+func NewIPRateLimiter(store RateLimitStore, limit RateLimit, logger *slog.Logger) *RateLimiter {
+	return &RateLimiter{
+		responder: responder{logger: logger},
+		store:     store,
+		limit:     limit,
+		client:    rateLimitIP,
+		now:       time.Now,
+	}
+}
+
+// Middleware wraps next with the rate limiting. Requests are served when the
+// store fails, so that an outage of the store does not take the API down.
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := l.client(r)
+		limit := l.limit
+		if route, ok := l.route(r); ok {
+			key = route + "\x00" + key
+			limit = l.routes[route]
+		}
+		if !limit.enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		status, err := l.store.Take(r.Context(), key, limit, l.now())
+		if err != nil {
+			l.logger.Error("failed to check rate limit", "error", err.Error(), "method", r.Method, "url", r.URL.String())
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		header := w.Header()
+		header.Set(rateLimitLimitHeader, strconv.Itoa(limit.Requests))
+		header.Set(rateLimitRemainingHeader, strconv.Itoa(status.Remaining))
+		header.Set(rateLimitResetHeader, strconv.Itoa(ceilSeconds(status.Reset)))
+		header.Set(rateLimitPolicyHeader, fmt.Sprintf("%d;w=%d", limit.Requests, ceilSeconds(limit.Period)))
+		if !status.Allowed {
+			retryAfter := max(ceilSeconds(status.RetryAfter), 1)
+			header.Set("Retry-After", strconv.Itoa(retryAfter))
+			l.handleError(w, r, apperror.New(errRateLimited, "rate_limited",
+				fmt.Sprintf("too many requests, retry in %d seconds", retryAfter)))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// route returns the route of r, as "METHOD /pattern", if it has a limit of its own.
+func (l *RateLimiter) route(r *http.Request) (string, bool) {
+	if len(l.routes) == 0 {
+		return "", false
+	}
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil || rctx.Routes == nil {
+		return "", false
+	}
+	// The middleware runs before the routing, so find the pattern the
+	// request will be routed to.
+	pattern := rctx.Routes.Find(chi.NewRouteContext(), r.Method, r.URL.Path)
+	if pattern == "" {
+		return "", false
+	}
+	route := r.Method + " " + pattern
+	_, ok := l.routes[route]
+	return route, ok
+}
+
+// rateLimitClient identifies the client of r for rate limiting by its
+// credentials, else by its IP address.
+func rateLimitClient(r *http.Request) string {
+	if principal, ok := service.PrincipalFrom(r.Context()); ok {
+		if principal.APIKeyID != "" {
+			return "api-key:" + principal.APIKeyID
+		}
+		return "principal:" + principal.TenantID + "/" + principal.ID
+	}
+	return rateLimitIP(r)
+}
+
+// rateLimitIP identifies the client of r for rate limiting by its IP address.
+func rateLimitIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		// middleware.RealIP sets RemoteAddr without a port.
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// ceilSeconds returns d in seconds, rounded up.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// MemoryRateLimitStore is a RateLimitStore that keeps buckets in memory.
+// Buckets are lost on restart and are not shared between instances, so each
+// instance allows the full rate.
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	takes   int
+}
+
+// tokenBucket is a bucket of a MemoryRateLimitStore.
+type tokenBucket struct {
+	limit   RateLimit
+	tokens  float64
+	updated time.Time
+}
+
+// refill adds the tokens earned since the last update, up to the capacity of b.
+func (b *tokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens = min(float64(b.limit.Requests), b.tokens+elapsed.Seconds()*b.rate())
+		b.updated = now
+	}
+}
+
+// rate returns the tokens b earns per second.
+func (b *tokenBucket) rate() float64 {
+	return float64(b.limit.Requests) / b.limit.Period.Seconds()
+}
+
+// NewMemoryRateLimitStore creates an empty MemoryRateLimitStore.
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// Take implements RateLimitStore.
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, limit RateLimit, now time.Time) (RateLimitStatus, error) {
+	if !limit.enabled() {
+		return RateLimitStatus{}, fmt.Errorf("invalid rate limit of %d requests per %s", limit.Requests, limit.Period)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.takes++
+	if s.takes%rateLimitSweepInterval == 0 {
+		// Full buckets are the same as new ones.
+		for k, b := range s.buckets {
+			if b.refill(now); b.tokens >= float64(b.limit.Requests) {
+				delete(s.buckets, k)
+			}
+		}
+	}
+
+	b, ok := s.buckets[key]
+	if !ok || b.limit != limit {
+		b = &tokenBucket{limit: limit, tokens: float64(limit.Requests), updated: now}
+		s.buckets[key] = b
+	}
+	b.refill(now)
+
+	var status RateLimitStatus
+	if b.tokens >= 1 {
+		b.tokens--
+		status.Allowed = true
+	} else {
+		status.RetryAfter = seconds((1 - b.tokens) / b.rate())
+	}
+	status.Remaining = int(b.tokens)
+	status.Reset = seconds((float64(limit.Requests) - b.tokens) / b.rate())
+	return status, nil
+}
+
+// seconds converts a number of seconds to a time.Duration.
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,329 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/service"
+)
+
+// Defaults of the entity stream.
+const (
+	DefaultStreamLogSize      = 1000
+	DefaultStreamClientBuffer = 64
+)
+
+// LastEventIDHeader is sent by reconnecting Server-Sent Events clients with
+// the ID of the last event they received.
+const LastEventIDHeader = "Last-Event-ID"
+
+const (
+	// streamHeartbeat is how often a comment is sent to idle clients, so that
+	// proxies keep the connection open and dead clients are noticed.
+	streamHeartbeat = 15 * time.Second
+
+	// streamWriteTimeout bounds each write to a client.
+	streamWriteTimeout = 10 * time.Second
+
+	// streamRetry is the reconnection delay suggested to clients, in milliseconds.
+	streamRetry = 3000
+)
+
+// errStreamClosed is reported to clients that connect after the stream is closed.
+var errStreamClosed = errors.New("stream closed")
+
+// EntityChangeEvent defines the data of an entity change in the stream.
+type EntityChangeEvent struct {
+	Type       string          `json:"type"`
+	EntityID   string          `json:"entityId"`
+	OccurredAt time.Time       `json:"occurredAt"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// EntityStream pushes entity changes to clients as Server-Sent Events.
+//
+// It keeps the most recent events in a bounded log, so that reconnecting
+// clients resume after their Last-Event-ID. Each client has a bounded buffer:
+// a client that falls behind is disconnected, and resumes from the log when
+// it reconnects, instead of slowing down the others. Clients only receive the
+// events of the tenant of their request, and, if they are authenticated, of
+// the entities that their principal may list.
+//
+// Publish has the signature of an event handler, to subscribe the stream to
+// the events relayed from the outbox. It is safe for concurrent use.
+//
+// The stream is only fed by the event relay of its own instance. A change
+// therefore reaches clients once the relay polls the outbox, up to the poll
+// interval of the relay after it is committed. With several instances, the
+// relays share the outbox, and each client only receives the events relayed
+// by the instance it is connected to: fanning them out to every instance
+// takes a shared broker.
+type EntityStream struct {
+	responder
+	authz        service.Authorizer
+	logSize      int
+	clientBuffer int
+
+	mu      sync.Mutex
+	events  []*domain.EventMessage // The most recent events, oldest first.
+	clients map[*streamClient]struct{}
+	closed  bool
+}
+
+// streamClient is a client connected to the stream.
+type streamClient struct {
+	tenantID  string
+	principal *domain.Principal // Nil for unauthenticated clients.
+
+	// events is closed when the client is disconnected by the stream.
+	events chan *domain.EventMessage
+}
+
+// NewEntityStream creates an EntityStream that shows events to the principals
+// that authz lets list their entities, keeps logSize events, and buffers up to
+// clientBuffer events per client. Zero values mean DefaultStreamLogSize and
+// DefaultStreamClientBuffer.
+func NewEntityStream(authz service.Authorizer, logger *slog.Logger, logSize, clientBuffer int) *EntityStream {
+	if logSize <= 0 {
+		logSize = DefaultStreamLogSize
+	}
+	if clientBuffer <= 0 {
+		clientBuffer = DefaultStreamClientBuffer
+	}
+	return &EntityStream{
+		responder:    responder{logger: logger},
+		authz:        authz,
+		logSize:      logSize,
+		clientBuffer: clientBuffer,
+		clients:      make(map[*streamClient]struct{}),
+	}
+}
+
+// Publish adds message to the log and sends it to the connected clients.
+// A message already in the log is ignored, so that events relayed again are
+// not sent twice.
+func (s *EntityStream) Publish(ctx context.Context, message *domain.EventMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed || s.index(message.ID) >= 0 {
+		return nil
+	}
+
+	if len(s.events) == s.logSize {
+		s.events = slices.Delete(s.events, 0, 1)
+	}
+	s.events = append(s.events, message)
+
+	for client := range s.clients {
+		if !s.shows(client, message) {
+			continue
+		}
+		select {
+		case client.events <- message:
+		default:
+			// The client is too slow: drop it rather than block everyone.
+			s.disconnect(client)
+		}
+	}
+	return nil
+}
+
+// Close disconnects every client and rejects new ones. It is meant to be
+// called when the server shuts down, which waits for the streams to end.
+func (s *EntityStream) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	for client := range s.clients {
+		s.disconnect(client)
+	}
+}
+
+// connect registers a new client for the tenant and principal of ctx, and
+// returns the events it may see in the log after lastEventID. resumed is false
+// if lastEventID is set but no longer in the log, in which case the client may
+// have missed events. Principals that may not list entities are rejected.
+func (s *EntityStream) connect(ctx context.Context, lastEventID string) (client *streamClient, replay []*domain.EventMessage, resumed bool, err error) {
+	client = &streamClient{tenantID: service.TenantFrom(ctx)}
+	if principal, ok := service.PrincipalFrom(ctx); ok {
+		if _, err := s.authz.ListScope(principal); err != nil {
+			return nil, nil, false, err
+		}
+		client.principal = &principal
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, nil, false, errStreamClosed
+	}
+
+	resumed = true
+	if lastEventID != "" {
+		i := s.index(lastEventID)
+		resumed = i >= 0 && s.events[i].TenantID == client.tenantID
+		if resumed {
+			for _, message := range s.events[i+1:] {
+				if s.shows(client, message) {
+					replay = append(replay, message)
+				}
+			}
+		}
+	}
+
+	client.events = make(chan *domain.EventMessage, s.clientBuffer)
+	s.clients[client] = struct{}{}
+	return client, replay, resumed, nil
+}
+
+// shows reports whether message is shown to client: it must be of the tenant
+// of the client, and about an entity that its principal may read.
+func (s *EntityStream) shows(client *streamClient, message *domain.EventMessage) bool {
+	if message.TenantID != client.tenantID {
+		return false
+	}
+	if client.principal == nil {
+		return true
+	}
+	entity := &domain.Entity{ID: message.EntityID, TenantID: message.TenantID, OwnerID: message.OwnerID}
+	return s.authz.Authorize(*client.principal, service.ActionRead, entity) == nil
+}
+
+// disconnect removes client, if it is still connected. The lock must be held.
+func (s *EntityStream) disconnect(client *streamClient) {
+	if _, ok := s.clients[client]; ok {
+		delete(s.clients, client)
+		close(client.events)
+	}
+}
+
+// index returns the position of the event with the given ID in the log, or -1.
+// The lock must be held.
+func (s *EntityStream) index(id string) int {
+	return slices.IndexFunc(s.events, func(m *domain.EventMessage) bool { return m.ID == id })
+}
+
+// StreamEntities handles the GET /entities/stream endpoint.
+//
+// Each entity change is sent as an event named after its type, e.g.
+// "entity.created", with the event ID as its ID and an EntityChangeEvent as
+// its data. Clients that reconnect with a Last-Event-ID header first receive
+// the events they missed; if those are no longer available, they receive a
+// "reset" event instead, and should reload the entities.
+//
+// The stream ends when the client disconnects, falls behind, or the server
+// shuts down; clients are expected to reconnect.
+func (s *EntityStream) StreamEntities(w http.ResponseWriter, r *http.Request) {
+	client, replay, resumed, err := s.connect(r.Context(), r.Header.Get(LastEventIDHeader))
+	if err != nil {
+		s.handleError(w, r, err)
+		return
+	}
+	defer func() {
+		s.mu.Lock()
+		s.disconnect(client)
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Disables buffering in nginx.
+	w.WriteHeader(http.StatusOK)
+
+	sw := &streamWriter{w: w, rc: http.NewResponseController(w)}
+	sw.printf("retry: %d\n\n", streamRetry)
+	if !resumed {
+		sw.printf("event: reset\ndata: {}\n\n")
+	}
+	for _, message := range replay {
+		sw.event(message)
+	}
+	sw.flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for sw.err == nil {
+		select {
+		case <-r.Context().Done():
+			return
+		case message, ok := <-client.events:
+			if !ok {
+				return
+			}
+			sw.event(message)
+		case <-heartbeat.C:
+			sw.printf(": heartbeat\n\n")
+		}
+		sw.flush()
+	}
+}
+
+// streamWriter writes Server-Sent Events to a client. After the first error,
+// its methods do nothing, and the error is kept in err.
+type streamWriter struct {
+	w   http.ResponseWriter
+	rc  *http.ResponseController
+	err error
+}
+
+// printf writes a formatted string within the write timeout of the stream.
+// The server-wide write timeout cannot apply to streams, which never end; it
+// is replaced by a deadline for each write.
+func (sw *streamWriter) printf(format string, args ...any) {
+	if sw.err != nil {
+		return
+	}
+	sw.setWriteDeadline(time.Now().Add(streamWriteTimeout))
+	if sw.err != nil {
+		return
+	}
+	_, sw.err = fmt.Fprintf(sw.w, format, args...)
+}
+
+// setWriteDeadline sets the write deadline of the connection, if the
+// response writer supports it.
+func (sw *streamWriter) setWriteDeadline(deadline time.Time) {
+	if err := sw.rc.SetWriteDeadline(deadline); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		sw.err = err
+	}
+}
+
+// event writes message as an event.
+func (sw *streamWriter) event(message *domain.EventMessage) {
+	data, err := json.Marshal(&EntityChangeEvent{
+		Type:       string(message.Type),
+		EntityID:   message.EntityID,
+		OccurredAt: message.OccurredAt,
+		Data:       message.Payload,
+	})
+	if err != nil {
+		sw.err = fmt.Errorf("failed to encode event %s: %w", message.ID, err)
+		return
+	}
+	// JSON without indentation is a single line, as the data field requires.
+	sw.printf("id: %s\nevent: %s\ndata: %s\n\n", message.ID, message.Type, data)
+}
+
+// flush sends the buffered events to the client, and lifts the write
+// deadline while the stream waits for the next ones.
+func (sw *streamWriter) flush() {
+	if sw.err != nil {
+		return
+	}
+	if sw.err = sw.rc.Flush(); sw.err != nil {
+		return
+	}
+	sw.setWriteDeadline(time.Time{})
+}
@@ -0,0 +1,103 @@
+package http
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/apperror"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/service"
+)
+
+// TenantIDHeader names the tenant of a request.
+const TenantIDHeader = "X-Tenant-ID"
+
+// TenantResolver is a middleware that resolves the tenant of every request
+// and passes it on to the handlers and services through the request context,
+// where the repositories find it.
+//
+// The tenant is the one of the authenticated principal, if any. Otherwise it
+// is named by the X-Tenant-ID header or, if a base domain is set, by the
+// subdomain of the request, e.g. "acme" in acme.example.com for the base
+// domain example.com. Without any of them, the request is in the default
+// tenant. The header and the subdomain may be sent with a principal too, but
+// must then name its own tenant.
+type TenantResolver struct {
+	responder
+	baseDomain string
+}
+
+// NewTenantResolver creates a TenantResolver that reads tenants from the
+// subdomains of baseDomain. An empty baseDomain disables subdomains.
+func NewTenantResolver(baseDomain string, logger *slog.Logger) *TenantResolver {
+	return &TenantResolver{
+		responder:  responder{logger: logger},
+		baseDomain: strings.ToLower(strings.TrimPrefix(baseDomain, ".")),
+	}
+}
+
+// Middleware rejects requests that name an invalid tenant with a 400 Bad
+// Request response, and requests that name another tenant than the one of
+// their principal with a 403 Forbidden response.
+func (t *TenantResolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenantID, named, err := t.requested(r)
+		if err != nil {
+			t.handleError(w, r, err)
+			return
+		}
+
+		if principal, ok := service.PrincipalFrom(r.Context()); ok {
+			if named && tenantID != principal.TenantID {
+				t.handleError(w, r, apperror.New(apperror.ErrForbidden, "tenant_mismatch",
+					"the request names another tenant than the one of its credentials"))
+				return
+			}
+			tenantID = principal.TenantID
+		}
+
+		next.ServeHTTP(w, r.WithContext(service.WithTenant(r.Context(), tenantID)))
+	})
+}
+
+// requested returns the tenant named by the header or the subdomain of r, and
+// whether r names one at all.
+func (t *TenantResolver) requested(r *http.Request) (string, bool, error) {
+	header := r.Header.Get(TenantIDHeader)
+	subdomain, fromSubdomain := t.subdomain(r.Host)
+
+	switch {
+	case header != "" && fromSubdomain && header != subdomain:
+		return "", false, apperror.New(apperror.ErrInvalidInput, "invalid_tenant",
+			"the "+TenantIDHeader+" header and the host do not name the same tenant")
+	case header != "":
+		return header, true, validTenant(header, TenantIDHeader+" header")
+	case fromSubdomain:
+		return subdomain, true, validTenant(subdomain, "subdomain")
+	default:
+		return "", false, nil
+	}
+}
+
+// subdomain returns the part of host before the base domain, if any.
+func (t *TenantResolver) subdomain(host string) (string, bool) {
+	if t.baseDomain == "" {
+		return "", false
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	subdomain, ok := strings.CutSuffix(strings.ToLower(host), "."+t.baseDomain)
+	return subdomain, ok && subdomain != ""
+}
+
+// validTenant checks a tenant ID named by source.
+func validTenant(id, source string) error {
+	if !domain.ValidTenantID(id) {
+		return apperror.New(apperror.ErrInvalidInput, "invalid_tenant",
+			"the "+source+" must be a tenant ID of lowercase letters, digits and hyphens").WithMeta("tenant", id)
+	}
+	return nil
+}
@@ -0,0 +1,279 @@
+package http
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/service"
+	"github.com/go-chi/chi/v5"
+)
+
+// WebhookHandler is responsible for handling HTTP requests related to webhooks
+// and their deliveries.
+type WebhookHandler struct {
+	responder
+	decoder
+	service service.WebhookService
+}
+
+// NewWebhookHandler creates a new WebhookHandler.
+// Request bodies larger than maxBodyBytes are rejected; zero means DefaultMaxBodyBytes.
+func NewWebhookHandler(service service.WebhookService, logger *slog.Logger, maxBodyBytes int64) *WebhookHandler {
+	return &WebhookHandler{
+		responder: responder{logger: logger},
+		decoder:   newDecoder(maxBodyBytes),
+		service:   service,
+	}
+}
+
+// CreateWebhookRequest defines the request body for registering a webhook.
+type CreateWebhookRequest struct {
+	URL string `json:"url"`
+
+	// EventTypes lists the events to deliver, e.g. "entity.created".
+	// Empty means every event.
+	EventTypes []string `json:"eventTypes"`
+}
+
+// toDomain converts a CreateWebhookRequest to a domain.Webhook.
+func (r *CreateWebhookRequest) toDomain() *domain.Webhook {
+	webhook := &domain.Webhook{URL: r.URL}
+	for _, t := range r.EventTypes {
+		webhook.EventTypes = append(webhook.EventTypes, domain.EventType(t))
+	}
+	return webhook
+}
+
+// WebhookResponse defines the response body for a webhook.
+type WebhookResponse struct {
+	ID         string   `json:"id"`
+	URL        string   `json:"url"`
+	EventTypes []string `json:"eventTypes"`
+
+	// Secret signs the deliveries. It is only returned when the webhook is created.
+	Secret string `json:"secret,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ListWebhooksResponse defines the response body for the list of webhooks.
+type ListWebhooksResponse struct {
+	Webhooks []*WebhookResponse `json:"webhooks"`
+}
+
+// fromDomainWebhook converts a domain.Webhook to a WebhookResponse, without its secret.
+func fromDomainWebhook(webhook *domain.Webhook) *WebhookResponse {
+	response := &WebhookResponse{
+		ID:         webhook.ID,
+		URL:        webhook.URL,
+		EventTypes: make([]string, len(webhook.EventTypes)),
+		CreatedAt:  webhook.CreatedAt,
+	}
+	for i, t := range webhook.EventTypes {
+		response.EventTypes[i] = string(t)
+	}
+	return response
+}
+
+// DeliveryResponse defines the response body for a webhook delivery.
+type DeliveryResponse struct {
+	ID        string                     `json:"id"`
+	WebhookID string                     `json:"webhookId"`
+	EventID   string                     `json:"eventId"`
+	EventType string                     `json:"eventType"`
+	EntityID  string                     `json:"entityId"`
+	Status    string                     `json:"status"`
+	Attempts  []*DeliveryAttemptResponse `json:"attempts"`
+
+	// NextAttemptAt is only set on pending deliveries.
+	NextAttemptAt *time.Time `json:"nextAttemptAt,omitempty"`
+	LastError     string     `json:"lastError,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// DeliveryAttemptResponse defines an entry of the attempt log of a delivery.
+type DeliveryAttemptResponse struct {
+	At         time.Time `json:"at"`
+	DurationMS int64     `json:"durationMs"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// ListDeliveriesResponse defines the response body for a list of deliveries.
+type ListDeliveriesResponse struct {
+	Deliveries []*DeliveryResponse `json:"deliveries"`
+}
+
+// fromDomainDelivery converts a domain.WebhookDelivery to a DeliveryResponse.
+func fromDomainDelivery(delivery *domain.WebhookDelivery) *DeliveryResponse {
+	response := &DeliveryResponse{
+		ID:        delivery.ID,
+		WebhookID: delivery.WebhookID,
+		EventID:   delivery.Event.ID,
+		EventType: string(delivery.Event.Type),
+		EntityID:  delivery.Event.EntityID,
+		Status:    string(delivery.Status),
+		Attempts:  make([]*DeliveryAttemptResponse, len(delivery.Attempts)),
+		LastError: delivery.LastError,
+		CreatedAt: delivery.CreatedAt,
+		UpdatedAt: delivery.UpdatedAt,
+	}
+	for i, a := range delivery.Attempts {
+		response.Attempts[i] = &DeliveryAttemptResponse{
+			At:         a.At,
+			DurationMS: a.Duration.Milliseconds(),
+			StatusCode: a.StatusCode,
+			Error:      a.Error,
+		}
+	}
+	if delivery.Status == domain.DeliveryPending {
+		response.NextAttemptAt = &delivery.NextAttemptAt
+	}
+	return response
+}
+
+// CreateWebhook handles the POST /webhooks endpoint.
+// It responds with the stored webhook, including the secret that signs its
+// deliveries, which is not returned anywhere else.
+func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req CreateWebhookRequest
+	if err := h.decodeJSON(w, r, &req); err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	webhook := req.toDomain()
+	if err := h.service.Create(r.Context(), webhook); err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response := fromDomainWebhook(webhook)
+	response.Secret = webhook.Secret
+	w.Header().Set("Location", "/webhooks/"+url.PathEscape(webhook.ID))
+	h.writeJSON(w, r, http.StatusCreated, response)
+}
+
+// ListWebhooks handles the GET /webhooks endpoint.
+func (h *WebhookHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := h.service.List(r.Context())
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response := &ListWebhooksResponse{Webhooks: make([]*WebhookResponse, len(webhooks))}
+	for i, webhook := range webhooks {
+		response.Webhooks[i] = fromDomainWebhook(webhook)
+	}
+	h.writeJSON(w, r, http.StatusOK, response)
+}
+
+// GetWebhook handles the GET /webhooks/{id} endpoint.
+func (h *WebhookHandler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	webhook, err := h.service.GetByID(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	h.writeJSON(w, r, http.StatusOK, fromDomainWebhook(webhook))
+}
+
+// DeleteWebhook handles the DELETE /webhooks/{id} endpoint.
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	if err := h.service.Delete(r.Context(), chi.URLParam(r, "id")); err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	h.writeJSON(w, r, http.StatusOK, nil)
+}
+
+// ListDeliveries handles the GET /webhooks/{id}/deliveries endpoint.
+// It responds with the most recent deliveries to the webhook and their attempt logs.
+//
+// Query parameters:
+//   - limit: number of deliveries
+//   - status: only deliveries that are "pending", "succeeded" or "dead"
+func (h *WebhookHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	webhook, err := h.service.GetByID(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	opts, err := parseDeliveryListOptions(r.URL.Query())
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+	opts.WebhookID = webhook.ID
+	h.listDeliveries(w, r, opts)
+}
+
+// ListDeadLetters handles the GET /webhooks/dead-letters endpoint.
+// It responds with the most recent dead-lettered deliveries, to any webhook,
+// including the deleted ones.
+//
+// Query parameters:
+//   - limit: number of deliveries
+func (h *WebhookHandler) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseDeliveryListOptions(r.URL.Query())
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+	opts.Status = domain.DeliveryDead
+	h.listDeliveries(w, r, opts)
+}
+
+// listDeliveries responds with the deliveries matching opts.
+func (h *WebhookHandler) listDeliveries(w http.ResponseWriter, r *http.Request, opts domain.DeliveryListOptions) {
+	deliveries, err := h.service.ListDeliveries(r.Context(), opts)
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	response := &ListDeliveriesResponse{Deliveries: make([]*DeliveryResponse, len(deliveries))}
+	for i, delivery := range deliveries {
+		response.Deliveries[i] = fromDomainDelivery(delivery)
+	}
+	h.writeJSON(w, r, http.StatusOK, response)
+}
+
+// RetryDeadLetter handles the POST /webhooks/dead-letters/{id}/retry endpoint.
+// It schedules a dead-lettered delivery again and responds with it.
+func (h *WebhookHandler) RetryDeadLetter(w http.ResponseWriter, r *http.Request) {
+	delivery, err := h.service.RetryDelivery(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		h.handleError(w, r, err)
+		return
+	}
+
+	h.writeJSON(w, r, http.StatusOK, fromDomainDelivery(delivery))
+}
+
+// parseDeliveryListOptions converts the query parameters of the delivery lists
+// to list options.
+func parseDeliveryListOptions(query url.Values) (domain.DeliveryListOptions, error) {
+	opts := domain.DeliveryListOptions{
+		Status: domain.DeliveryStatus(query.Get("status")),
+	}
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return opts, invalidQuery("limit", "must be a positive integer")
+		}
+		opts.Limit = limit
+	}
+	return opts, nil
+}
@@ -0,0 +1,49 @@
+// Package inmemory provides an in-process implementation of the
+// service.EventPublisher interface.
+package inmemory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+)
+
+// Handler handles a published message. A message can be handled more than
+// once: if a handler fails, the message is published again to every handler.
+type Handler func(ctx context.Context, message *domain.EventMessage) error
+
+// Publisher hands each published message to its handlers, in the order they
+// subscribed. Without handlers, messages are dropped.
+// It is safe for concurrent use.
+type Publisher struct {
+	mu       sync.RWMutex
+	handlers []Handler
+}
+
+// NewPublisher creates a Publisher without handlers.
+func NewPublisher() *Publisher {
+	return &Publisher{}
+}
+
+// Subscribe adds a handler for the messages published from now on.
+func (p *Publisher) Subscribe(handler Handler) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.handlers = append(p.handlers, handler)
+}
+
+// Publish calls the handlers with message, and stops at the first one that fails.
+func (p *Publisher) Publish(ctx context.Context, message *domain.EventMessage) error {
+	p.mu.RLock()
+	handlers := p.handlers
+	p.mu.RUnlock()
+
+	for _, handler := range handlers {
+		if err := handler(ctx, message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
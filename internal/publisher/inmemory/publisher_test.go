@@ -0,0 +1,41 @@
+package inmemory
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+)
+
+func TestPublisher(t *testing.T) {
+	publisher := NewPublisher()
+	message := &domain.EventMessage{ID: "e1", Type: domain.EventEntityCreated}
+	ctx := context.Background()
+
+	if err := publisher.Publish(ctx, message); err != nil {
+		t.Fatalf("expected no error without handlers, got %v", err)
+	}
+
+	var calls []string
+	handlerErr := errors.New("handler failed")
+	publisher.Subscribe(func(ctx context.Context, m *domain.EventMessage) error {
+		calls = append(calls, "first "+m.ID)
+		return nil
+	})
+	publisher.Subscribe(func(ctx context.Context, m *domain.EventMessage) error {
+		calls = append(calls, "second "+m.ID)
+		return handlerErr
+	})
+	publisher.Subscribe(func(ctx context.Context, m *domain.EventMessage) error {
+		t.Error("expected the handlers after a failure not to be called")
+		return nil
+	})
+
+	if err := publisher.Publish(ctx, message); !errors.Is(err, handlerErr) {
+		t.Errorf("expected the handler error, got %v", err)
+	}
+	if len(calls) != 2 || calls[0] != "first e1" || calls[1] != "second e1" {
+		t.Errorf("expected the handlers to be called in order, got %v", calls)
+	}
+}
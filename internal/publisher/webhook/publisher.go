@@ -0,0 +1,100 @@
+// Package webhook provides implementations of the service.EventPublisher and
+// service.WebhookSender interfaces that deliver events over HTTP.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+)
+
+// IDHeader carries the ID of the delivered event, so that receivers can drop
+// duplicates without parsing the body.
+const IDHeader = "Webhook-Id"
+
+// defaultTimeout bounds a delivery when no client is given.
+const defaultTimeout = 10 * time.Second
+
+// Event is the JSON body of a delivery.
+type Event struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	EntityID   string          `json:"entityId"`
+	OccurredAt time.Time       `json:"occurredAt"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// newEvent converts a domain.EventMessage to an Event.
+func newEvent(message *domain.EventMessage) *Event {
+	return &Event{
+		ID:         message.ID,
+		Type:       string(message.Type),
+		EntityID:   message.EntityID,
+		OccurredAt: message.OccurredAt,
+		Data:       message.Payload,
+	}
+}
+
+// Publisher POSTs each event as JSON to a URL. A delivery succeeds when the
+// receiver responds with a 2xx status.
+type Publisher struct {
+	url    string
+	client *http.Client
+}
+
+// NewPublisher creates a Publisher that delivers to url with client.
+// A nil client means an http.Client with a 10 second timeout.
+func NewPublisher(url string, client *http.Client) *Publisher {
+	if client == nil {
+		client = &http.Client{Timeout: defaultTimeout}
+	}
+	return &Publisher{
+		url:    url,
+		client: client,
+	}
+}
+
+// Publish delivers message to the URL of the publisher.
+func (p *Publisher) Publish(ctx context.Context, message *domain.EventMessage) error {
+	_, err := post(ctx, p.client, p.url, message, nil)
+	return err
+}
+
+// post POSTs message as an Event to url, after setting the headers of the
+// request with sign, if any. It returns the status code of the response, or
+// zero if there was none, and an error unless the status is 2xx.
+func post(ctx context.Context, client *http.Client, url string, message *domain.EventMessage, sign func(h http.Header, body []byte)) (int, error) {
+	body, err := json.Marshal(newEvent(message))
+	if err != nil {
+		return 0, fmt.Errorf("webhook: failed to encode event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("webhook: failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(IDHeader, message.ID)
+	if sign != nil {
+		sign(req.Header, body)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("webhook: failed to deliver event: %w", err)
+	}
+	defer resp.Body.Close()
+	// Drain the body so that the connection can be reused.
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook: receiver responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,227 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+)
+
+func TestPublisher(t *testing.T) {
+	message := &domain.EventMessage{
+		ID:         "e1",
+		Type:       domain.EventEntityCreated,
+		EntityID:   "1",
+		OccurredAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Payload:    []byte(`{"entity":{"id":"1"}}`),
+	}
+	ctx := context.Background()
+
+	t.Run("Publish", func(t *testing.T) {
+		var received Event
+		var id string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+				t.Errorf("expected a JSON POST, got %s %s", r.Method, r.Header.Get("Content-Type"))
+			}
+			id = r.Header.Get(IDHeader)
+			if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+				t.Errorf("could not decode event: %v", err)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		if err := NewPublisher(server.URL, nil).Publish(ctx, message); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if id != "e1" || received.ID != "e1" || received.Type != "entity.created" || received.EntityID != "1" {
+			t.Errorf("unexpected delivery %+v with ID header %q", received, id)
+		}
+		if !received.OccurredAt.Equal(message.OccurredAt) || string(received.Data) != string(message.Payload) {
+			t.Errorf("expected the payload as data, got %+v", received)
+		}
+	})
+
+	t.Run("Publish rejected", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		if err := NewPublisher(server.URL, nil).Publish(ctx, message); err == nil {
+			t.Error("expected an error for a 503 response")
+		}
+	})
+}
+
+func TestSender(t *testing.T) {
+	webhook := &domain.Webhook{ID: "w1", Secret: "whsec_test"}
+	delivery := &domain.WebhookDelivery{
+		ID:        "d1",
+		WebhookID: "w1",
+		Event: domain.EventMessage{
+			ID:         "e1",
+			Type:       domain.EventEntityDeleted,
+			EntityID:   "1",
+			OccurredAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+			Payload:    []byte(`{"id":"1"}`),
+		},
+	}
+	ctx := context.Background()
+	// The test servers listen on the loopback, which senders refuse by default.
+	sender := NewSender(NewClient(netip.MustParsePrefix("127.0.0.0/8"), netip.MustParsePrefix("::1/128")))
+
+	t.Run("Send", func(t *testing.T) {
+		var verifyErr error
+		var received Event
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			verifyErr = Verify("whsec_test", r.Header, body, time.Minute)
+			if err := json.Unmarshal(body, &received); err != nil {
+				t.Errorf("could not decode event: %v", err)
+			}
+			w.WriteHeader(http.StatusAccepted)
+		}))
+		defer server.Close()
+		webhook.URL = server.URL
+
+		status, err := sender.Send(ctx, webhook, delivery)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if status != http.StatusAccepted {
+			t.Errorf("expected status %d, got %d", http.StatusAccepted, status)
+		}
+		if verifyErr != nil {
+			t.Errorf("expected a valid signature, got %v", verifyErr)
+		}
+		if received.ID != "e1" || received.Type != "entity.deleted" || string(received.Data) != `{"id":"1"}` {
+			t.Errorf("expected the event of the delivery, got %+v", received)
+		}
+	})
+
+	t.Run("Send rejected", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusGone)
+		}))
+		defer server.Close()
+		webhook.URL = server.URL
+
+		status, err := sender.Send(ctx, webhook, delivery)
+		if err == nil {
+			t.Error("expected an error for a 410 response")
+		}
+		if status != http.StatusGone {
+			t.Errorf("expected status %d, got %d", http.StatusGone, status)
+		}
+	})
+
+	t.Run("Send unreachable", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		webhook.URL = server.URL
+		server.Close()
+
+		status, err := sender.Send(ctx, webhook, delivery)
+		if err == nil || status != 0 {
+			t.Errorf("expected an error without status, got %d and %v", status, err)
+		}
+	})
+
+	t.Run("Send to a forbidden address", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("expected the loopback not to be reached")
+		}))
+		defer server.Close()
+		webhook.URL = server.URL
+
+		status, err := NewSender(nil).Send(ctx, webhook, delivery)
+		if !errors.Is(err, ErrForbiddenAddress) || status != 0 {
+			t.Errorf("expected ErrForbiddenAddress without status, got %d and %v", status, err)
+		}
+	})
+
+	t.Run("Send does not follow redirects", func(t *testing.T) {
+		target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("expected the redirect not to be followed")
+		}))
+		defer target.Close()
+		server := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+		defer server.Close()
+		webhook.URL = server.URL
+
+		status, err := sender.Send(ctx, webhook, delivery)
+		if err == nil {
+			t.Error("expected an error for a redirect")
+		}
+		if status != http.StatusTemporaryRedirect {
+			t.Errorf("expected status %d, got %d", http.StatusTemporaryRedirect, status)
+		}
+	})
+}
+
+func TestIsPublic(t *testing.T) {
+	tests := []struct {
+		addr   string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"100.64.0.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"224.0.0.1", false},
+		{"255.255.255.255", false},
+	}
+	for _, tt := range tests {
+		if got := isPublic(netip.MustParseAddr(tt.addr)); got != tt.public {
+			t.Errorf("expected %s to be public: %t, got %t", tt.addr, tt.public, got)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"id":"e1"}`)
+	now := time.Now().Unix()
+	header := func(timestamp int64, signature string) http.Header {
+		h := http.Header{}
+		h.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+		h.Set(SignatureHeader, signature)
+		return h
+	}
+
+	tests := []struct {
+		name   string
+		header http.Header
+		body   []byte
+		want   error
+	}{
+		{"valid", header(now, Sign("secret", now, body)), body, nil},
+		{"other secret", header(now, Sign("other", now, body)), body, ErrInvalidSignature},
+		{"tampered body", header(now, Sign("secret", now, body)), []byte(`{"id":"e2"}`), ErrInvalidSignature},
+		{"other timestamp", header(now-1, Sign("secret", now, body)), body, ErrInvalidSignature},
+		{"stale", header(now-600, Sign("secret", now-600, body)), body, ErrStaleTimestamp},
+		{"missing", http.Header{}, body, ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		if err := Verify("secret", tt.header, tt.body, 5*time.Minute); !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+)
+
+// Headers of signed deliveries.
+const (
+	// TimestampHeader carries the Unix time at which the delivery was signed.
+	TimestampHeader = "Webhook-Timestamp"
+
+	// SignatureHeader carries "v1=" followed by the hex-encoded HMAC-SHA256,
+	// keyed with the webhook secret, of the timestamp, a dot and the body.
+	// Signing the timestamp lets receivers reject replayed deliveries.
+	SignatureHeader = "Webhook-Signature"
+)
+
+// signatureVersion prefixes signatures, so that the scheme can change.
+const signatureVersion = "v1="
+
+// Sign returns the signature of body sent at timestamp with secret, as set in
+// the SignatureHeader.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signatureVersion + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Errors returned by Verify.
+var (
+	ErrInvalidSignature = errors.New("webhook: invalid signature")
+	ErrStaleTimestamp   = errors.New("webhook: timestamp outside of the tolerance")
+)
+
+// Verify checks that a delivery with header and body was signed with secret,
+// less than tolerance ago. It is meant for receivers, and for tests.
+func Verify(secret string, header http.Header, body []byte, tolerance time.Duration) error {
+	timestamp, err := strconv.ParseInt(header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if age := time.Since(time.Unix(timestamp, 0)); age > tolerance || age < -tolerance {
+		return ErrStaleTimestamp
+	}
+
+	signature := header.Get(SignatureHeader)
+	if !strings.HasPrefix(signature, signatureVersion) ||
+		!hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, body))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// Sender is an implementation of the service.WebhookSender interface. It POSTs
+// each event as JSON, like Publisher, and signs it with the secret of the
+// webhook in the TimestampHeader and SignatureHeader.
+type Sender struct {
+	client *http.Client
+}
+
+// NewSender creates a Sender that delivers with client.
+// A nil client means the client of NewClient, without any allowed network.
+func NewSender(client *http.Client) *Sender {
+	if client == nil {
+		client = NewClient()
+	}
+	return &Sender{client: client}
+}
+
+// ErrForbiddenAddress is returned when a webhook resolves to an address that
+// is not public, such as a loopback, private or link-local one.
+var ErrForbiddenAddress = errors.New("webhook: forbidden address")
+
+// NewClient returns an http.Client with a 10 second timeout for delivering
+// to the URLs registered by users. Since those could point at internal
+// services, it refuses to connect to addresses that are not public, once
+// resolved, unless they belong to one of the allowed networks, and it does
+// not follow redirects.
+func NewClient(allowed ...netip.Prefix) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: defaultTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return fmt.Errorf("%w: %s", ErrForbiddenAddress, address)
+			}
+			if addr := addrPort.Addr().Unmap(); !isPublic(addr) && !contains(allowed, addr) {
+				return fmt.Errorf("%w: %s", ErrForbiddenAddress, addr)
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// Proxies would connect on behalf of the dialer, without its checks.
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   defaultTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// reserved holds the global unicast networks that are not public either.
+var reserved = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // "This" network
+	netip.MustParsePrefix("100.64.0.0/10"),  // Carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),   // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"),  // Benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),    // Reserved
+	netip.MustParsePrefix("64:ff9b::/96"),   // IPv4/IPv6 translation
+	netip.MustParsePrefix("64:ff9b:1::/48"), // Local IPv4/IPv6 translation
+	netip.MustParsePrefix("2001:db8::/32"),  // Documentation
+}
+
+// isPublic reports whether addr may be reached on the public internet.
+func isPublic(addr netip.Addr) bool {
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !contains(reserved, addr)
+}
+
+// contains reports whether addr belongs to any of prefixes.
+func contains(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Send delivers the event of delivery to webhook.
+func (s *Sender) Send(ctx context.Context, webhook *domain.Webhook, delivery *domain.WebhookDelivery) (int, error) {
+	return post(ctx, s.client, webhook.URL, &delivery.Event, func(h http.Header, body []byte) {
+		timestamp := time.Now().Unix()
+		h.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+		h.Set(SignatureHeader, Sign(webhook.Secret, timestamp, body))
+	})
+}
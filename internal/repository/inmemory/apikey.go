@@ -0,0 +1,123 @@
+package inmemory
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/apperror"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+)
+
+// APIKeyRepository is a mock implementation of the service.APIKeyRepository interface.
+// It is safe for concurrent use.
+type APIKeyRepository struct {
+	mu     sync.RWMutex
+	keys   []*domain.APIKey // In creation order.
+	byHash map[string]*domain.APIKey
+}
+
+// NewAPIKeyRepository creates a new APIKeyRepository.
+func NewAPIKeyRepository() *APIKeyRepository {
+	return &APIKeyRepository{byHash: make(map[string]*domain.APIKey)}
+}
+
+// Create stores a new API key in the mock repository.
+func (r *APIKeyRepository) Create(ctx context.Context, key *domain.APIKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.byHash[key.Hash]; exists || r.find(key.ID) != nil {
+		return apperror.ErrConflict
+	}
+	stored := copyAPIKey(key)
+	r.keys = append(r.keys, stored)
+	r.byHash[stored.Hash] = stored
+	return nil
+}
+
+// FindByID retrieves an API key by its ID from the mock repository.
+func (r *APIKeyRepository) FindByID(ctx context.Context, id string) (*domain.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	key := r.find(id)
+	if key == nil {
+		return nil, apperror.ErrNotFound
+	}
+	return copyAPIKey(key), nil
+}
+
+// FindByHash retrieves an API key by its hash from the mock repository.
+func (r *APIKeyRepository) FindByHash(ctx context.Context, hash string) (*domain.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	key, ok := r.byHash[hash]
+	if !ok {
+		return nil, apperror.ErrNotFound
+	}
+	return copyAPIKey(key), nil
+}
+
+// List returns the API keys of an owner, or every API key, of the mock repository.
+func (r *APIKeyRepository) List(ctx context.Context, ownerID string) ([]*domain.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keys := []*domain.APIKey{}
+	for _, k := range r.keys {
+		if ownerID == "" || k.OwnerID == ownerID {
+			keys = append(keys, copyAPIKey(k))
+		}
+	}
+	return keys, nil
+}
+
+// Revoke revokes an API key of the mock repository.
+func (r *APIKeyRepository) Revoke(ctx context.Context, id string, at time.Time) (*domain.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := r.find(id)
+	if key == nil {
+		return nil, apperror.ErrNotFound
+	}
+	if !key.IsRevoked() {
+		key.RevokedAt = at
+	}
+	return copyAPIKey(key), nil
+}
+
+// Touch records the use of an API key of the mock repository.
+func (r *APIKeyRepository) Touch(ctx context.Context, id string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := r.find(id)
+	if key == nil {
+		return apperror.ErrNotFound
+	}
+	if at.After(key.LastUsedAt) {
+		key.LastUsedAt = at
+	}
+	return nil
+}
+
+// find returns the stored API key with the given ID, or nil.
+// The lock must be held.
+func (r *APIKeyRepository) find(id string) *domain.APIKey {
+	i := slices.IndexFunc(r.keys, func(k *domain.APIKey) bool { return k.ID == id })
+	if i < 0 {
+		return nil
+	}
+	return r.keys[i]
+}
+
+// copyAPIKey returns a copy of k that shares no memory with it.
+func copyAPIKey(k *domain.APIKey) *domain.APIKey {
+	c := *k
+	c.Scopes = slices.Clone(k.Scopes)
+	return &c
+}
@@ -0,0 +1,79 @@
+package inmemory
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+)
+
+// AuditRepository is a mock implementation of the service.AuditRepository interface.
+// It is safe for concurrent use.
+type AuditRepository struct {
+	mu      sync.RWMutex
+	entries map[string][]*domain.AuditEntry // By entity ID, in the order they were added.
+}
+
+// NewAuditRepository creates a new AuditRepository.
+func NewAuditRepository() *AuditRepository {
+	return &AuditRepository{entries: make(map[string][]*domain.AuditEntry)}
+}
+
+// Add appends entries to the mock audit log.
+func (r *AuditRepository) Add(ctx context.Context, entries []*domain.AuditEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.add(entries)
+	return nil
+}
+
+// add appends copies of entries to the log. The lock must be held.
+func (r *AuditRepository) add(entries []*domain.AuditEntry) {
+	for _, e := range entries {
+		r.entries[e.EntityID] = append(r.entries[e.EntityID], copyAuditEntry(e))
+	}
+}
+
+// List returns the entries of an entity from the mock audit log, after the cursor.
+func (r *AuditRepository) List(ctx context.Context, opts domain.AuditListOptions) ([]*domain.AuditEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return pageAuditEntries(r.entries[opts.EntityID], opts), nil
+}
+
+// pageAuditEntries returns copies of the entries of stored after the cursor of opts.
+func pageAuditEntries(stored []*domain.AuditEntry, opts domain.AuditListOptions) []*domain.AuditEntry {
+	start := 0
+	if opts.Cursor != "" {
+		start = slices.IndexFunc(stored, func(e *domain.AuditEntry) bool { return e.ID == opts.Cursor }) + 1
+		if start == 0 {
+			// An unknown cursor does not continue any listing.
+			return []*domain.AuditEntry{}
+		}
+	}
+
+	stored = stored[start:]
+	entries := make([]*domain.AuditEntry, min(opts.Limit, len(stored)))
+	for i := range entries {
+		entries[i] = copyAuditEntry(stored[i])
+	}
+	return entries
+}
+
+// copyAuditEntry returns a copy of e that shares no memory with it.
+func copyAuditEntry(e *domain.AuditEntry) *domain.AuditEntry {
+	c := *e
+	if e.Before != nil {
+		before := *e.Before
+		c.Before = &before
+	}
+	if e.After != nil {
+		after := *e.After
+		c.After = &after
+	}
+	c.Changes = slices.Clone(e.Changes)
+	return &c
+}
@@ -2,6 +2,11 @@ package inmemory
 
 import (
 	"context"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/domenicoop/go-clean-architecture-blueprint/internal/apperror"
@@ -13,8 +18,12 @@ import (
 type Entity struct {
 	ID        string
 	Name      string
+	TenantID  string
+	OwnerID   string
+	Version   int64
 	CreatedAt time.Time
 	UpdatedAt time.Time
+	DeletedAt time.Time
 }
 
 // toDomain converts an Entity to a domain.Entity.
@@ -22,8 +31,12 @@ func (e *Entity) toDomain() *domain.Entity {
 	return &domain.Entity{
 		ID:        e.ID,
 		Name:      e.Name,
+		TenantID:  e.TenantID,
+		OwnerID:   e.OwnerID,
+		Version:   e.Version,
 		CreatedAt: e.CreatedAt,
 		UpdatedAt: e.UpdatedAt,
+		DeletedAt: e.DeletedAt,
 	}
 }
 
@@ -32,68 +45,373 @@ func fromDomain(e *domain.Entity) *Entity {
 	return &Entity{
 		ID:        e.ID,
 		Name:      e.Name,
+		TenantID:  e.TenantID,
+		OwnerID:   e.OwnerID,
+		Version:   e.Version,
 		CreatedAt: e.CreatedAt,
 		UpdatedAt: e.UpdatedAt,
+		DeletedAt: e.DeletedAt,
 	}
 }
 
+// shardCount is the number of independently locked partitions of the repository.
+// Must be a power of two.
+const shardCount = 32
+
+// shard is a partition of the repository guarded by its own lock.
+type shard struct {
+	mu       sync.RWMutex
+	entities map[string]*Entity
+}
+
 // EntityRepository is a mock implementation of the service.EntityRepository interface.
+// It is safe for concurrent use. Entities are spread across shards by ID, so
+// writers only contend with operations on the same shard.
+//
+// Every method but Purge only reaches the entities of the tenant of its
+// context; the entities of other tenants are reported as not found.
 type EntityRepository struct {
-	entities map[string]*Entity
+	shards [shardCount]*shard
 }
 
 // NewEntityRepository creates a new EntityRepository.
-func NewEntityRepository() service.EntityRepository {
-	return &EntityRepository{
-		entities: make(map[string]*Entity),
+func NewEntityRepository() *EntityRepository {
+	r := &EntityRepository{}
+	for i := range r.shards {
+		r.shards[i] = &shard{entities: make(map[string]*Entity)}
 	}
+	return r
 }
 
-// Create creates a new entity in the mock repository.
+// shardFor returns the shard that owns the given ID.
+func (r *EntityRepository) shardFor(id string) *shard {
+	return r.shards[shardIndex(id)]
+}
+
+// shardIndex returns the index of the shard that owns the given ID.
+func shardIndex(id string) int {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return int(h.Sum32() & (shardCount - 1))
+}
+
+// lockAll locks every shard, in order.
+func (r *EntityRepository) lockAll() {
+	for _, s := range r.shards {
+		s.mu.Lock()
+	}
+}
+
+// unlockAll unlocks every shard locked by lockAll.
+func (r *EntityRepository) unlockAll() {
+	for _, s := range r.shards {
+		s.mu.Unlock()
+	}
+}
+
+// Create creates a new entity in the mock repository, in the tenant of ctx.
+// IDs are unique across tenants. On success, entity holds the stored values.
 func (r *EntityRepository) Create(ctx context.Context, entity *domain.Entity) error {
-	if _, exists := r.entities[entity.ID]; exists {
+	s := r.shardFor(entity.ID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.create(service.TenantFrom(ctx), entity)
+}
+
+// create is Create for a shard whose lock is held.
+func (s *shard) create(tenantID string, entity *domain.Entity) error {
+	if _, exists := s.entities[entity.ID]; exists {
 		return apperror.ErrConflict
 	}
 	storageEntity := fromDomain(entity)
+	storageEntity.TenantID = tenantID
+	storageEntity.Version = 1
 	storageEntity.CreatedAt = time.Now()
-	storageEntity.UpdatedAt = time.Now()
-	r.entities[entity.ID] = storageEntity
+	storageEntity.UpdatedAt = storageEntity.CreatedAt
+	s.entities[entity.ID] = storageEntity
+	*entity = *storageEntity.toDomain()
 	return nil
 }
 
 // FindByID finds an entity by its ID in the mock repository.
 func (r *EntityRepository) FindByID(ctx context.Context, id string) (*domain.Entity, error) {
-	if entity, exists := r.entities[id]; exists {
+	s := r.shardFor(id)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.find(service.TenantFrom(ctx), id)
+}
+
+// get returns the stored entity with the given ID, if it belongs to the tenant.
+func (s *shard) get(tenantID, id string) (*Entity, bool) {
+	entity, exists := s.entities[id]
+	if !exists || entity.TenantID != tenantID {
+		return nil, false
+	}
+	return entity, true
+}
+
+// find is FindByID for a shard whose lock is held.
+func (s *shard) find(tenantID, id string) (*domain.Entity, error) {
+	if entity, exists := s.get(tenantID, id); exists && entity.DeletedAt.IsZero() {
 		return entity.toDomain(), nil
 	}
 	return nil, apperror.ErrNotFound
 }
 
-// Update updates an entity in the mock repository.
+// Update updates an entity in the mock repository, if its version matches.
+// On success, entity holds the stored values, including the new version.
 func (r *EntityRepository) Update(ctx context.Context, entity *domain.Entity) error {
-	if _, exists := r.entities[entity.ID]; !exists {
+	s := r.shardFor(entity.ID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.update(service.TenantFrom(ctx), entity)
+}
+
+// update is Update for a shard whose lock is held.
+func (s *shard) update(tenantID string, entity *domain.Entity) error {
+	existing, exists := s.get(tenantID, entity.ID)
+	if !exists || !existing.DeletedAt.IsZero() {
 		return apperror.ErrNotFound
 	}
+	if entity.Version != 0 && entity.Version != existing.Version {
+		return apperror.ErrPreconditionFailed
+	}
 	storageEntity := fromDomain(entity)
+	storageEntity.TenantID = existing.TenantID
+	storageEntity.OwnerID = existing.OwnerID
+	storageEntity.Version = existing.Version + 1
+	storageEntity.CreatedAt = existing.CreatedAt
 	storageEntity.UpdatedAt = time.Now()
-	r.entities[entity.ID] = storageEntity
+	s.entities[entity.ID] = storageEntity
+	*entity = *storageEntity.toDomain()
 	return nil
 }
 
-// Delete deletes an entity from the mock repository.
-func (r *EntityRepository) Delete(ctx context.Context, id string) error {
-	if _, exists := r.entities[id]; !exists {
+// Delete moves an entity of the mock repository to the trash, if its version matches.
+func (r *EntityRepository) Delete(ctx context.Context, id string, version int64) error {
+	s := r.shardFor(id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.delete(service.TenantFrom(ctx), id, version)
+}
+
+// delete is Delete for a shard whose lock is held.
+func (s *shard) delete(tenantID, id string, version int64) error {
+	existing, exists := s.get(tenantID, id)
+	if !exists || !existing.DeletedAt.IsZero() {
 		return apperror.ErrNotFound
 	}
-	delete(r.entities, id)
+	if version != 0 && version != existing.Version {
+		return apperror.ErrPreconditionFailed
+	}
+	deleted := *existing
+	deleted.Version++
+	deleted.DeletedAt = time.Now()
+	s.entities[id] = &deleted
 	return nil
 }
 
-// List lists all entities from the mock repository.
-func (r *EntityRepository) List(ctx context.Context) ([]*domain.Entity, error) {
-	entities := make([]*domain.Entity, 0, len(r.entities))
-	for _, entity := range r.entities {
-		entities = append(entities, entity.toDomain())
+// Batch applies ops to the mock repository in order. Every shard is locked for
+// the whole batch, so that other operations never see part of it. If atomic is
+// set, the changes are undone on the first failure.
+func (r *EntityRepository) Batch(ctx context.Context, ops []domain.EntityOperation, atomic bool) ([]error, error) {
+	r.lockAll()
+	defer r.unlockAll()
+
+	var j journal
+	return r.batch(service.TenantFrom(ctx), ops, atomic, &j), nil
+}
+
+// batch is Batch with every shard lock held. The changes it keeps are recorded in j.
+func (r *EntityRepository) batch(tenantID string, ops []domain.EntityOperation, atomic bool, j *journal) []error {
+	var changes journal
+	errs := make([]error, len(ops))
+	for i, op := range ops {
+		err := r.apply(tenantID, op, &changes)
+		errs[i] = err
+		if err != nil && atomic {
+			changes.rollback()
+			for k := range errs {
+				errs[k] = apperror.ErrAborted
+			}
+			errs[i] = err
+			return errs
+		}
+	}
+	*j = append(*j, changes...)
+	return errs
+}
+
+// apply runs a batch operation with the lock of its shard held, and records
+// the change in j.
+func (r *EntityRepository) apply(tenantID string, op domain.EntityOperation, j *journal) error {
+	s := r.shardFor(op.Entity.ID)
+	previous := s.entities[op.Entity.ID]
+
+	var err error
+	switch op.Kind {
+	case domain.EntityOperationCreate:
+		err = s.create(tenantID, op.Entity)
+	case domain.EntityOperationUpdate:
+		err = s.update(tenantID, op.Entity)
+	case domain.EntityOperationDelete:
+		err = s.delete(tenantID, op.Entity.ID, op.Entity.Version)
+	default:
+		err = fmt.Errorf("inmemory: unknown operation %q", op.Kind)
+	}
+	if err == nil {
+		j.record(s, op.Entity.ID, previous)
+	}
+	return err
+}
+
+// Restore takes an entity of the mock repository out of the trash, if its version matches.
+func (r *EntityRepository) Restore(ctx context.Context, id string, version int64) (*domain.Entity, error) {
+	s := r.shardFor(id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.restore(service.TenantFrom(ctx), id, version)
+}
+
+// restore is Restore for a shard whose lock is held.
+func (s *shard) restore(tenantID, id string, version int64) (*domain.Entity, error) {
+	existing, exists := s.get(tenantID, id)
+	if !exists || existing.DeletedAt.IsZero() {
+		return nil, apperror.ErrNotFound
+	}
+	if version != 0 && version != existing.Version {
+		return nil, apperror.ErrPreconditionFailed
+	}
+	restored := *existing
+	restored.Version++
+	restored.DeletedAt = time.Time{}
+	s.entities[id] = &restored
+	return restored.toDomain(), nil
+}
+
+// Purge permanently removes the entities deleted before deletedBefore from the
+// mock repository, in every tenant.
+func (r *EntityRepository) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	var n int64
+	for _, s := range r.shards {
+		s.mu.Lock()
+		n += s.purge(deletedBefore, nil)
+		s.mu.Unlock()
+	}
+	return n, nil
+}
+
+// purge is Purge for a shard whose lock is held. If j is not nil, the removed
+// entities are recorded in it.
+func (s *shard) purge(deletedBefore time.Time, j *journal) int64 {
+	var n int64
+	for id, entity := range s.entities {
+		if !entity.DeletedAt.IsZero() && entity.DeletedAt.Before(deletedBefore) {
+			if j != nil {
+				j.record(s, id, entity)
+			}
+			delete(s.entities, id)
+			n++
+		}
+	}
+	return n
+}
+
+// List lists the entities matching opts from the mock repository.
+// Shards are read one at a time, so writers are only blocked while their own
+// shard is being copied; the result is not a point-in-time snapshot.
+func (r *EntityRepository) List(ctx context.Context, opts domain.EntityListOptions) ([]*domain.Entity, error) {
+	entities := make([]*domain.Entity, 0)
+	for _, s := range r.shards {
+		s.mu.RLock()
+		entities = s.collect(entities, service.TenantFrom(ctx), opts)
+		s.mu.RUnlock()
+	}
+	return page(entities, opts), nil
+}
+
+// Lock does nothing: outside a unit of work, every call locks the shards it
+// reaches on its own.
+func (r *EntityRepository) Lock(ctx context.Context, ids ...string) error {
+	return nil
+}
+
+// collect appends the entities of the tenant in a shard whose lock is held
+// that match opts.
+func (s *shard) collect(entities []*domain.Entity, tenantID string, opts domain.EntityListOptions) []*domain.Entity {
+	for _, entity := range s.entities {
+		if entity.TenantID == tenantID && matches(entity, opts) {
+			entities = append(entities, entity.toDomain())
+		}
+	}
+	return entities
+}
+
+// page sorts the entities matching opts and cuts them to the page size.
+func page(entities []*domain.Entity, opts domain.EntityListOptions) []*domain.Entity {
+	slices.SortFunc(entities, func(a, b *domain.Entity) int {
+		return compare(a, cursorOf(b), opts)
+	})
+
+	if opts.Limit > 0 && len(entities) > opts.Limit {
+		entities = entities[:opts.Limit]
+	}
+	return entities
+}
+
+// matches reports whether an entity passes the filters of opts and sorts after opts.After.
+func matches(e *Entity, opts domain.EntityListOptions) bool {
+	switch opts.Deleted {
+	case domain.EntityDeletedExcluded:
+		if !e.DeletedAt.IsZero() {
+			return false
+		}
+	case domain.EntityDeletedOnly:
+		if e.DeletedAt.IsZero() {
+			return false
+		}
+	}
+	if !strings.HasPrefix(e.Name, opts.NamePrefix) {
+		return false
+	}
+	if !opts.CreatedAfter.IsZero() && !e.CreatedAt.After(opts.CreatedAfter) {
+		return false
+	}
+	if opts.OwnerID != "" && e.OwnerID != opts.OwnerID {
+		return false
+	}
+	if opts.After != nil && compare(e.toDomain(), opts.After, opts) <= 0 {
+		return false
+	}
+	return true
+}
+
+// cursorOf returns the sort key of an entity.
+func cursorOf(e *domain.Entity) *domain.EntityCursor {
+	return &domain.EntityCursor{ID: e.ID, Name: e.Name, CreatedAt: e.CreatedAt, UpdatedAt: e.UpdatedAt}
+}
+
+// compare orders an entity relative to a position, following the sort order of opts.
+func compare(e *domain.Entity, c *domain.EntityCursor, opts domain.EntityListOptions) int {
+	var n int
+	switch opts.SortBy {
+	case domain.EntitySortByName:
+		n = strings.Compare(e.Name, c.Name)
+	case domain.EntitySortByUpdatedAt:
+		n = e.UpdatedAt.Compare(c.UpdatedAt)
+	default:
+		n = e.CreatedAt.Compare(c.CreatedAt)
+	}
+	if n == 0 {
+		n = strings.Compare(e.ID, c.ID)
+	}
+	if opts.Descending {
+		n = -n
 	}
-	return entities, nil
+	return n
 }
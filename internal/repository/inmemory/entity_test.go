@@ -2,66 +2,409 @@ package inmemory
 
 import (
 	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/apperror"
 	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/repository/repositorytest"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/service"
 )
 
 func TestEntityRepository(t *testing.T) {
+	repositorytest.RunEntityRepositorySuite(t, func(t *testing.T) service.EntityRepository {
+		return NewEntityRepository()
+	})
+}
+
+func TestOutboxRepository(t *testing.T) {
+	repositorytest.RunOutboxRepositorySuite(t, func(t *testing.T) service.OutboxRepository {
+		return NewOutboxRepository()
+	})
+}
+
+func TestAuditRepository(t *testing.T) {
+	repositorytest.RunAuditRepositorySuite(t, func(t *testing.T) service.AuditRepository {
+		return NewAuditRepository()
+	})
+}
+
+func TestWebhookRepository(t *testing.T) {
+	repositorytest.RunWebhookRepositorySuite(t, func(t *testing.T) service.WebhookRepository {
+		return NewWebhookRepository()
+	})
+}
+
+func TestDeliveryRepository(t *testing.T) {
+	repositorytest.RunDeliveryRepositorySuite(t, func(t *testing.T) service.DeliveryRepository {
+		return NewDeliveryRepository()
+	})
+}
+
+func TestAPIKeyRepository(t *testing.T) {
+	repositorytest.RunAPIKeyRepositorySuite(t, func(t *testing.T) service.APIKeyRepository {
+		return NewAPIKeyRepository()
+	})
+}
+
+func TestUnitOfWork(t *testing.T) {
+	repositorytest.RunUnitOfWorkSuite(t, func(t *testing.T) (service.UnitOfWork, service.Repositories) {
+		entities, outbox, audit := NewEntityRepository(), NewOutboxRepository(), NewAuditRepository()
+		return NewUnitOfWork(entities, outbox, audit), service.Repositories{Entities: entities, Outbox: outbox, Audit: audit}
+	})
+}
+
+// TestEntityRepositoryParallel hammers the repository from many goroutines.
+// Run it with -race to catch unsynchronized access.
+func TestEntityRepositoryParallel(t *testing.T) {
 	repo := NewEntityRepository()
 	ctx := context.Background()
 
-	t.Run("Create and FindByID", func(t *testing.T) {
-		entity := &domain.Entity{ID: "1", Name: "Test"}
-		err := repo.Create(ctx, entity)
-		if err != nil {
-			t.Fatalf("expected no error, got %v", err)
+	const (
+		workers = 16
+		ids     = 64
+		rounds  = 200
+	)
+
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range rounds {
+				// Workers share IDs, so conflicts and missing entities are expected.
+				id := strconv.Itoa((w*rounds + i) % ids)
+				switch i % 5 {
+				case 0:
+					_ = repo.Create(ctx, &domain.Entity{ID: id, Name: "Test"})
+				case 1:
+					_ = repo.Update(ctx, &domain.Entity{ID: id, Name: "Updated Test"})
+				case 2:
+					_, _ = repo.FindByID(ctx, id)
+				case 3:
+					if _, err := repo.List(ctx, domain.EntityListOptions{}); err != nil {
+						t.Errorf("expected no error, got %v", err)
+					}
+				case 4:
+					_ = repo.Delete(ctx, id, 0)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Every entity left behind must still be reachable through its own shard.
+	entities, err := repo.List(ctx, domain.EntityListOptions{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for _, e := range entities {
+		if _, err := repo.FindByID(ctx, e.ID); err != nil {
+			t.Errorf("expected listed entity %s to be found, got %v", e.ID, err)
+		}
+	}
+}
+
+// idInShard returns an ID owned by the shard with the given index.
+func idInShard(index int) string {
+	for i := 0; ; i++ {
+		if id := strconv.Itoa(i); shardIndex(id) == index {
+			return id
 		}
+	}
+}
+
+// TestUnitOfWorkLocking checks that a unit of work only holds the shards it
+// reaches, and cannot deadlock with another one.
+func TestUnitOfWorkLocking(t *testing.T) {
+	ctx := context.Background()
+	low, high := idInShard(1), idInShard(2)
+
+	t.Run("Other shards are not blocked", func(t *testing.T) {
+		entities := NewEntityRepository()
+		uow := NewUnitOfWork(entities, NewOutboxRepository(), NewAuditRepository())
+		mustCreate(t, entities, low)
 
-		found, err := repo.FindByID(ctx, "1")
+		err := uow.Do(ctx, func(repos service.Repositories) error {
+			if _, err := repos.Entities.FindByID(ctx, low); err != nil {
+				return err
+			}
+			done := make(chan error)
+			go func() { done <- entities.Create(ctx, &domain.Entity{ID: high, Name: "Test"}) }()
+			select {
+			case err := <-done:
+				return err
+			case <-time.After(time.Second):
+				t.Fatal("expected a write to another shard not to wait for the unit of work")
+				return nil
+			}
+		})
 		if err != nil {
 			t.Fatalf("expected no error, got %v", err)
 		}
-		if found.ID != "1" || found.Name != "Test" {
-			t.Errorf("expected entity with ID 1 and Name Test, got %+v", found)
-		}
 	})
 
-	t.Run("Update", func(t *testing.T) {
-		entity := &domain.Entity{ID: "1", Name: "Updated Test"}
-		err := repo.Update(ctx, entity)
+	t.Run("The same shard waits", func(t *testing.T) {
+		entities := NewEntityRepository()
+		uow := NewUnitOfWork(entities, NewOutboxRepository(), NewAuditRepository())
+		mustCreate(t, entities, low)
+
+		done := make(chan error, 1)
+		err := uow.Do(ctx, func(repos service.Repositories) error {
+			if err := repos.Entities.Update(ctx, &domain.Entity{ID: low, Name: "Updated Test"}); err != nil {
+				return err
+			}
+			go func() { done <- entities.Delete(ctx, low, 2) }()
+			select {
+			case err := <-done:
+				t.Fatalf("expected the delete to wait for the unit of work, got %v", err)
+			case <-time.After(50 * time.Millisecond):
+			}
+			return nil
+		})
 		if err != nil {
 			t.Fatalf("expected no error, got %v", err)
 		}
+		// The delete runs once the update it waited for is committed.
+		if err := <-done; err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	})
 
-		found, err := repo.FindByID(ctx, "1")
-		if err != nil {
-			t.Fatalf("expected no error, got %v", err)
+	t.Run("Locks out of order", func(t *testing.T) {
+		entities := NewEntityRepository()
+		uow := NewUnitOfWork(entities, NewOutboxRepository(), NewAuditRepository())
+		mustCreate(t, entities, low)
+		mustCreate(t, entities, high)
+
+		// The first unit of work holds high then wants low, while the second
+		// holds low then waits for high.
+		holdsHigh, holdsLow := make(chan struct{}), make(chan struct{})
+		second := make(chan error, 1)
+		go func() {
+			<-holdsHigh
+			second <- uow.Do(ctx, func(repos service.Repositories) error {
+				if _, err := repos.Entities.FindByID(ctx, low); err != nil {
+					return err
+				}
+				close(holdsLow)
+				_, err := repos.Entities.FindByID(ctx, high)
+				return err
+			})
+		}()
+
+		err := uow.Do(ctx, func(repos service.Repositories) error {
+			if _, err := repos.Entities.FindByID(ctx, high); err != nil {
+				return err
+			}
+			close(holdsHigh)
+			<-holdsLow
+			_, err := repos.Entities.FindByID(ctx, low)
+			return err
+		})
+		if !errors.Is(err, apperror.ErrConflict) {
+			t.Errorf("expected ErrConflict for the unit of work locking out of order, got %v", err)
 		}
-		if found.Name != "Updated Test" {
-			t.Errorf("expected updated name, got %s", found.Name)
+		if err := <-second; err != nil {
+			t.Errorf("expected the other unit of work to go on, got %v", err)
 		}
 	})
+}
+
+// TestEntityServiceParallel runs the writes of the entity service from many
+// goroutines, through units of work. Run it with -race to catch unsynchronized
+// access.
+func TestEntityServiceParallel(t *testing.T) {
+	entities, outbox, audit := NewEntityRepository(), NewOutboxRepository(), NewAuditRepository()
+	svc := service.NewEntityService(entities, NewUnitOfWork(entities, outbox, audit), audit, service.NewRoleAuthorizer())
+	ctx := context.Background()
+
+	const (
+		workers = 16
+		rounds  = 50
+	)
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range rounds {
+				entity := &domain.Entity{Name: "Test"}
+				if err := svc.Create(ctx, entity); err != nil {
+					t.Errorf("Create: expected no error, got %v", err)
+					return
+				}
+				entity.Name = "Updated Test"
+				if err := svc.Update(ctx, entity); err != nil {
+					t.Errorf("Update: expected no error, got %v", err)
+				}
+				if err := svc.Delete(ctx, entity.ID, 0); err != nil {
+					t.Errorf("Delete: expected no error, got %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
 
-	t.Run("List", func(t *testing.T) {
-		entities, err := repo.List(ctx)
+	// Every change emitted its event, in the order of the changes of its entity.
+	messages, err := outbox.Pending(ctx, workers*rounds*3+1)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(messages) != workers*rounds*3 {
+		t.Fatalf("expected %d events, got %d", workers*rounds*3, len(messages))
+	}
+	next := make(map[string]domain.EventType)
+	order := map[domain.EventType]domain.EventType{"": domain.EventEntityCreated, domain.EventEntityCreated: domain.EventEntityUpdated, domain.EventEntityUpdated: domain.EventEntityDeleted}
+	for _, m := range messages {
+		if want := order[next[m.EntityID]]; m.Type != want {
+			t.Fatalf("expected %s for entity %s, got %s", want, m.EntityID, m.Type)
+		}
+		next[m.EntityID] = m.Type
+	}
+
+	// Every change was audited with its event, in the same order.
+	for id := range next {
+		entries, err := audit.List(ctx, domain.AuditListOptions{EntityID: id, Limit: 10})
 		if err != nil {
 			t.Fatalf("expected no error, got %v", err)
 		}
-		if len(entities) != 1 {
-			t.Errorf("expected 1 entity, got %d", len(entities))
+		var actions []domain.AuditAction
+		for _, e := range entries {
+			actions = append(actions, e.Action)
 		}
-	})
+		if want := []domain.AuditAction{domain.AuditActionCreate, domain.AuditActionUpdate, domain.AuditActionDelete}; !slices.Equal(actions, want) {
+			t.Fatalf("expected audit actions %v for entity %s, got %v", want, id, actions)
+		}
+	}
+}
+
+// TestEntityServiceBatchContention runs two batches over the same entities, in
+// opposite orders, the second one starting while the first one reads its
+// entities. Their units of work lock every entity up front, so the second one
+// waits for the first one rather than conflicting with it.
+func TestEntityServiceBatchContention(t *testing.T) {
+	entities, outbox, audit := NewEntityRepository(), NewOutboxRepository(), NewAuditRepository()
+	uow := NewUnitOfWork(entities, outbox, audit)
+	ctx := context.Background()
+
+	low, high := idInShard(1), idInShard(2)
+	mustCreate(t, entities, low)
+	mustCreate(t, entities, high)
+	batch := func(ids ...string) []domain.EntityOperation {
+		ops := make([]domain.EntityOperation, len(ids))
+		for i, id := range ids {
+			ops[i] = domain.EntityOperation{Kind: domain.EntityOperationUpdate, Entity: &domain.Entity{ID: id, Name: "Updated Test"}}
+		}
+		return ops
+	}
 
-	t.Run("Delete", func(t *testing.T) {
-		err := repo.Delete(ctx, "1")
+	// The first batch waits, after its first read, for the second one to read
+	// too, which it can only do if it does not wait for the first one's locks.
+	firstReads, secondReads := make(chan struct{}), make(chan struct{})
+	var firstOnce, secondOnce sync.Once
+	first := service.NewEntityService(entities, pausingUnitOfWork{uow, func() {
+		firstOnce.Do(func() {
+			close(firstReads)
+			select {
+			case <-secondReads:
+			case <-time.After(100 * time.Millisecond):
+			}
+		})
+	}}, audit, service.NewRoleAuthorizer())
+	second := service.NewEntityService(entities, pausingUnitOfWork{uow, func() {
+		secondOnce.Do(func() { close(secondReads) })
+	}}, audit, service.NewRoleAuthorizer())
+
+	type result struct {
+		errs []error
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		<-firstReads
+		errs, err := second.Batch(ctx, batch(high, low), true)
+		done <- result{errs, err}
+	}()
+
+	errs, err := first.Batch(ctx, batch(low, high), true)
+	if err != nil || slices.ContainsFunc(errs, func(err error) bool { return err != nil }) {
+		t.Errorf("expected the first batch to succeed, got %v and %v", err, errs)
+	}
+	r := <-done
+	if r.err != nil || slices.ContainsFunc(r.errs, func(err error) bool { return err != nil }) {
+		t.Errorf("expected the second batch to succeed, got %v and %v", r.err, r.errs)
+	}
+	for _, id := range []string{low, high} {
+		entity, err := entities.FindByID(ctx, id)
 		if err != nil {
 			t.Fatalf("expected no error, got %v", err)
 		}
+		if entity.Version != 3 {
+			t.Errorf("expected version 3 for entity %s, got %d", id, entity.Version)
+		}
+	}
+}
+
+// pausingUnitOfWork runs the units of work of a UnitOfWork, calling pause
+// after each read of an entity.
+type pausingUnitOfWork struct {
+	uow   service.UnitOfWork
+	pause func()
+}
+
+func (p pausingUnitOfWork) Do(ctx context.Context, fn func(repos service.Repositories) error) error {
+	return p.uow.Do(ctx, func(repos service.Repositories) error {
+		repos.Entities = pausingEntityRepository{repos.Entities, p.pause}
+		return fn(repos)
+	})
+}
 
-		_, err = repo.FindByID(ctx, "1")
-		if err == nil {
-			t.Fatal("expected error, got nil")
+// pausingEntityRepository is an EntityRepository that calls pause after each read.
+type pausingEntityRepository struct {
+	service.EntityRepository
+	pause func()
+}
+
+func (r pausingEntityRepository) FindByID(ctx context.Context, id string) (*domain.Entity, error) {
+	entity, err := r.EntityRepository.FindByID(ctx, id)
+	r.pause()
+	return entity, err
+}
+
+// BenchmarkEntityServiceParallel measures the throughput of the writes of the
+// entity service when units of work run concurrently.
+func BenchmarkEntityServiceParallel(b *testing.B) {
+	entities, outbox, audit := NewEntityRepository(), NewOutboxRepository(), NewAuditRepository()
+	svc := service.NewEntityService(entities, NewUnitOfWork(entities, outbox, audit), audit, service.NewRoleAuthorizer())
+	ctx := context.Background()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			entity := &domain.Entity{Name: "Test"}
+			if err := svc.Create(ctx, entity); err != nil {
+				b.Error(err)
+				return
+			}
+			entity.Name = "Updated Test"
+			if err := svc.Update(ctx, entity); err != nil {
+				b.Error(err)
+				return
+			}
 		}
 	})
 }
+
+// mustCreate stores an entity with the given ID, failing the test on error.
+func mustCreate(t *testing.T, repo *EntityRepository, id string) {
+	t.Helper()
+
+	if err := repo.Create(context.Background(), &domain.Entity{ID: id, Name: "Test"}); err != nil {
+		t.Fatalf("failed to create entity %s: %v", id, err)
+	}
+}
@@ -0,0 +1,82 @@
+package inmemory
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+)
+
+// OutboxRepository is a mock implementation of the service.OutboxRepository interface.
+// It is safe for concurrent use.
+type OutboxRepository struct {
+	mu       sync.Mutex
+	messages []*domain.EventMessage // Oldest first.
+}
+
+// NewOutboxRepository creates a new OutboxRepository.
+func NewOutboxRepository() *OutboxRepository {
+	return &OutboxRepository{}
+}
+
+// Add stores messages in the mock outbox.
+func (r *OutboxRepository) Add(ctx context.Context, messages []*domain.EventMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.add(messages)
+	return nil
+}
+
+// add is Add with the lock held.
+func (r *OutboxRepository) add(messages []*domain.EventMessage) {
+	for _, m := range messages {
+		r.messages = append(r.messages, copyMessage(m))
+	}
+}
+
+// Pending returns the oldest messages of the mock outbox.
+func (r *OutboxRepository) Pending(ctx context.Context, limit int) ([]*domain.EventMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.pending(limit), nil
+}
+
+// pending is Pending with the lock held.
+func (r *OutboxRepository) pending(limit int) []*domain.EventMessage {
+	n := min(limit, len(r.messages))
+	messages := make([]*domain.EventMessage, n)
+	for i := range n {
+		messages[i] = copyMessage(r.messages[i])
+	}
+	return messages
+}
+
+// MarkPublished removes messages from the mock outbox.
+func (r *OutboxRepository) MarkPublished(ctx context.Context, ids []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.markPublished(ids)
+	return nil
+}
+
+// markPublished is MarkPublished with the lock held.
+func (r *OutboxRepository) markPublished(ids []string) {
+	remaining := make([]*domain.EventMessage, 0, len(r.messages))
+	for _, m := range r.messages {
+		if !slices.Contains(ids, m.ID) {
+			remaining = append(remaining, m)
+		}
+	}
+	r.messages = remaining
+}
+
+// copyMessage returns a copy of m that shares no memory with it.
+func copyMessage(m *domain.EventMessage) *domain.EventMessage {
+	c := *m
+	c.Payload = slices.Clone(m.Payload)
+	return &c
+}
@@ -0,0 +1,318 @@
+package inmemory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/apperror"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/service"
+)
+
+// change is a write to a shard: the stored entity it replaced, or nil if there was none.
+type change struct {
+	s        *shard
+	id       string
+	previous *Entity
+}
+
+// journal records the writes to the repository, oldest first, so that they can be undone.
+type journal []change
+
+// record adds a write of id to the journal.
+func (j *journal) record(s *shard, id string, previous *Entity) {
+	*j = append(*j, change{s, id, previous})
+}
+
+// rollback undoes the recorded writes, newest first. The locks of their shards must be held.
+func (j journal) rollback() {
+	for i := len(j) - 1; i >= 0; i-- {
+		c := j[i]
+		if c.previous == nil {
+			delete(c.s.entities, c.id)
+		} else {
+			c.s.entities[c.id] = c.previous
+		}
+	}
+}
+
+// UnitOfWork is a mock implementation of the service.UnitOfWork interface.
+//
+// A unit of work locks the shards of the entities it reaches when it first
+// reaches them, and holds them until it ends, so units of work on entities of
+// different shards run concurrently. Shards are locked in index order, so a
+// unit of work that reaches several entities locks them up front with Lock. A
+// unit of work that reaches a shard below one it holds cannot wait for it
+// without risking a deadlock: if the shard is not free, it fails with
+// apperror.ErrConflict at once, as a deadlocked SQL transaction would. List
+// and Purge reach every shard.
+//
+// Writes to the outbox and the audit log are buffered, and applied when the
+// unit of work commits.
+type UnitOfWork struct {
+	entities *EntityRepository
+	outbox   *OutboxRepository
+	audit    *AuditRepository
+}
+
+// NewUnitOfWork creates a new UnitOfWork over the given repositories.
+func NewUnitOfWork(entities *EntityRepository, outbox *OutboxRepository, audit *AuditRepository) service.UnitOfWork {
+	return &UnitOfWork{
+		entities: entities,
+		outbox:   outbox,
+		audit:    audit,
+	}
+}
+
+// Do runs fn with repositories whose writes are undone if fn fails.
+func (u *UnitOfWork) Do(ctx context.Context, fn func(repos service.Repositories) error) error {
+	entities := &txEntityRepository{r: u.entities, highest: -1}
+	outbox := &txOutboxRepository{r: u.outbox}
+	audit := &txAuditRepository{r: u.audit}
+	committed := false
+	defer func() {
+		// Undo the writes if fn failed or panicked.
+		if !committed {
+			entities.changes.rollback()
+		}
+		entities.unlock()
+	}()
+
+	err := fn(service.Repositories{
+		Entities: entities,
+		Outbox:   outbox,
+		Audit:    audit,
+	})
+	if err != nil {
+		return err
+	}
+	// The shards are still locked, so the events and audit entries of an
+	// entity are added in the order of its changes.
+	outbox.commit()
+	audit.commit()
+	committed = true
+	return nil
+}
+
+// txEntityRepository is the EntityRepository of a unit of work. It locks the
+// shards it reaches until the unit of work ends, and records the writes for
+// rollback.
+type txEntityRepository struct {
+	r       *EntityRepository
+	held    [shardCount]bool
+	highest int // Index of the highest held shard, or -1.
+	changes journal
+}
+
+// lock locks the shards of ids that the unit of work does not hold yet.
+func (t *txEntityRepository) lock(ids ...string) error {
+	indexes := make([]int, len(ids))
+	for i, id := range ids {
+		indexes[i] = shardIndex(id)
+	}
+	return t.lockShards(indexes)
+}
+
+// lockAll locks every shard that the unit of work does not hold yet.
+func (t *txEntityRepository) lockAll() error {
+	indexes := make([]int, shardCount)
+	for i := range indexes {
+		indexes[i] = i
+	}
+	return t.lockShards(indexes)
+}
+
+// lockShards locks the shards with the given indexes, in order. Waiting for a
+// shard above every held one cannot deadlock, since every unit of work waits
+// in the same order; the others are only taken if they are free.
+func (t *txEntityRepository) lockShards(indexes []int) error {
+	slices.Sort(indexes)
+	for _, i := range slices.Compact(indexes) {
+		if t.held[i] {
+			continue
+		}
+		s := t.r.shards[i]
+		if i > t.highest {
+			s.mu.Lock()
+		} else if !s.mu.TryLock() {
+			return fmt.Errorf("inmemory: a lock is held by another unit of work: %w", apperror.ErrConflict)
+		}
+		t.held[i] = true
+		t.highest = max(t.highest, i)
+	}
+	return nil
+}
+
+// unlock unlocks every shard held by the unit of work.
+func (t *txEntityRepository) unlock() {
+	for i, held := range t.held {
+		if held {
+			t.r.shards[i].mu.Unlock()
+		}
+	}
+}
+
+func (t *txEntityRepository) Lock(ctx context.Context, ids ...string) error {
+	return t.lock(ids...)
+}
+
+func (t *txEntityRepository) Create(ctx context.Context, entity *domain.Entity) error {
+	if err := t.lock(entity.ID); err != nil {
+		return err
+	}
+	return t.r.apply(service.TenantFrom(ctx), domain.EntityOperation{Kind: domain.EntityOperationCreate, Entity: entity}, &t.changes)
+}
+
+func (t *txEntityRepository) FindByID(ctx context.Context, id string) (*domain.Entity, error) {
+	if err := t.lock(id); err != nil {
+		return nil, err
+	}
+	return t.r.shardFor(id).find(service.TenantFrom(ctx), id)
+}
+
+func (t *txEntityRepository) Update(ctx context.Context, entity *domain.Entity) error {
+	if err := t.lock(entity.ID); err != nil {
+		return err
+	}
+	return t.r.apply(service.TenantFrom(ctx), domain.EntityOperation{Kind: domain.EntityOperationUpdate, Entity: entity}, &t.changes)
+}
+
+func (t *txEntityRepository) Delete(ctx context.Context, id string, version int64) error {
+	if err := t.lock(id); err != nil {
+		return err
+	}
+	return t.r.apply(service.TenantFrom(ctx), domain.EntityOperation{Kind: domain.EntityOperationDelete, Entity: &domain.Entity{ID: id, Version: version}}, &t.changes)
+}
+
+func (t *txEntityRepository) Batch(ctx context.Context, ops []domain.EntityOperation, atomic bool) ([]error, error) {
+	ids := make([]string, len(ops))
+	for i, op := range ops {
+		ids[i] = op.Entity.ID
+	}
+	if err := t.lock(ids...); err != nil {
+		return nil, err
+	}
+	return t.r.batch(service.TenantFrom(ctx), ops, atomic, &t.changes), nil
+}
+
+func (t *txEntityRepository) Restore(ctx context.Context, id string, version int64) (*domain.Entity, error) {
+	if err := t.lock(id); err != nil {
+		return nil, err
+	}
+	s := t.r.shardFor(id)
+	previous := s.entities[id]
+	entity, err := s.restore(service.TenantFrom(ctx), id, version)
+	if err == nil {
+		t.changes.record(s, id, previous)
+	}
+	return entity, err
+}
+
+func (t *txEntityRepository) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	if err := t.lockAll(); err != nil {
+		return 0, err
+	}
+	var n int64
+	for _, s := range t.r.shards {
+		n += s.purge(deletedBefore, &t.changes)
+	}
+	return n, nil
+}
+
+func (t *txEntityRepository) List(ctx context.Context, opts domain.EntityListOptions) ([]*domain.Entity, error) {
+	if err := t.lockAll(); err != nil {
+		return nil, err
+	}
+	entities := make([]*domain.Entity, 0)
+	for _, s := range t.r.shards {
+		entities = s.collect(entities, service.TenantFrom(ctx), opts)
+	}
+	return page(entities, opts), nil
+}
+
+// txOutboxRepository is the OutboxRepository of a unit of work. It buffers
+// the writes until the unit of work commits.
+type txOutboxRepository struct {
+	r         *OutboxRepository
+	added     []*domain.EventMessage
+	published []string
+}
+
+func (t *txOutboxRepository) Add(ctx context.Context, messages []*domain.EventMessage) error {
+	for _, m := range messages {
+		t.added = append(t.added, copyMessage(m))
+	}
+	return nil
+}
+
+func (t *txOutboxRepository) Pending(ctx context.Context, limit int) ([]*domain.EventMessage, error) {
+	t.r.mu.Lock()
+	defer t.r.mu.Unlock()
+
+	messages := make([]*domain.EventMessage, 0)
+	for _, m := range slices.Concat(t.r.messages, t.added) {
+		if len(messages) == limit {
+			break
+		}
+		if !slices.Contains(t.published, m.ID) {
+			messages = append(messages, copyMessage(m))
+		}
+	}
+	return messages, nil
+}
+
+func (t *txOutboxRepository) MarkPublished(ctx context.Context, ids []string) error {
+	t.published = append(t.published, ids...)
+	t.added = slices.DeleteFunc(t.added, func(m *domain.EventMessage) bool {
+		return slices.Contains(ids, m.ID)
+	})
+	return nil
+}
+
+// commit applies the buffered writes to the outbox.
+func (t *txOutboxRepository) commit() {
+	t.r.mu.Lock()
+	defer t.r.mu.Unlock()
+
+	if len(t.published) > 0 {
+		t.r.markPublished(t.published)
+	}
+	t.r.add(t.added)
+}
+
+// txAuditRepository is the AuditRepository of a unit of work. It buffers the
+// added entries until the unit of work commits.
+type txAuditRepository struct {
+	r     *AuditRepository
+	added []*domain.AuditEntry
+}
+
+func (t *txAuditRepository) Add(ctx context.Context, entries []*domain.AuditEntry) error {
+	for _, e := range entries {
+		t.added = append(t.added, copyAuditEntry(e))
+	}
+	return nil
+}
+
+func (t *txAuditRepository) List(ctx context.Context, opts domain.AuditListOptions) ([]*domain.AuditEntry, error) {
+	t.r.mu.RLock()
+	defer t.r.mu.RUnlock()
+
+	stored := slices.Clone(t.r.entries[opts.EntityID])
+	for _, e := range t.added {
+		if e.EntityID == opts.EntityID {
+			stored = append(stored, e)
+		}
+	}
+	return pageAuditEntries(stored, opts), nil
+}
+
+// commit applies the buffered entries to the audit log.
+func (t *txAuditRepository) commit() {
+	t.r.mu.Lock()
+	defer t.r.mu.Unlock()
+
+	t.r.add(t.added)
+}
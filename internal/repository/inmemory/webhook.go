@@ -0,0 +1,189 @@
+package inmemory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/apperror"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+)
+
+// WebhookRepository is a mock implementation of the service.WebhookRepository interface.
+// It is safe for concurrent use.
+type WebhookRepository struct {
+	mu       sync.RWMutex
+	webhooks []*domain.Webhook // In creation order.
+}
+
+// NewWebhookRepository creates a new WebhookRepository.
+func NewWebhookRepository() *WebhookRepository {
+	return &WebhookRepository{}
+}
+
+// Create stores a new webhook in the mock repository.
+func (r *WebhookRepository) Create(ctx context.Context, webhook *domain.Webhook) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.index(webhook.ID) >= 0 {
+		return apperror.ErrConflict
+	}
+	r.webhooks = append(r.webhooks, copyWebhook(webhook))
+	return nil
+}
+
+// FindByID retrieves a webhook by its ID from the mock repository.
+func (r *WebhookRepository) FindByID(ctx context.Context, id string) (*domain.Webhook, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i := r.index(id)
+	if i < 0 {
+		return nil, apperror.ErrNotFound
+	}
+	return copyWebhook(r.webhooks[i]), nil
+}
+
+// List returns every webhook of the mock repository.
+func (r *WebhookRepository) List(ctx context.Context) ([]*domain.Webhook, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	webhooks := make([]*domain.Webhook, len(r.webhooks))
+	for i, w := range r.webhooks {
+		webhooks[i] = copyWebhook(w)
+	}
+	return webhooks, nil
+}
+
+// Delete removes a webhook from the mock repository.
+func (r *WebhookRepository) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.index(id)
+	if i < 0 {
+		return apperror.ErrNotFound
+	}
+	r.webhooks = slices.Delete(r.webhooks, i, i+1)
+	return nil
+}
+
+// index returns the position of the webhook with the given ID, or -1.
+// The lock must be held.
+func (r *WebhookRepository) index(id string) int {
+	return slices.IndexFunc(r.webhooks, func(w *domain.Webhook) bool { return w.ID == id })
+}
+
+// copyWebhook returns a copy of w that shares no memory with it.
+func copyWebhook(w *domain.Webhook) *domain.Webhook {
+	c := *w
+	c.EventTypes = slices.Clone(w.EventTypes)
+	c.OwnerRoles = slices.Clone(w.OwnerRoles)
+	return &c
+}
+
+// DeliveryRepository is a mock implementation of the service.DeliveryRepository interface.
+// It is safe for concurrent use.
+type DeliveryRepository struct {
+	mu         sync.RWMutex
+	deliveries map[string]*domain.WebhookDelivery
+}
+
+// NewDeliveryRepository creates a new DeliveryRepository.
+func NewDeliveryRepository() *DeliveryRepository {
+	return &DeliveryRepository{deliveries: make(map[string]*domain.WebhookDelivery)}
+}
+
+// Add stores the new deliveries in the mock repository, and skips the others.
+func (r *DeliveryRepository) Add(ctx context.Context, deliveries []*domain.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, d := range deliveries {
+		if _, exists := r.deliveries[d.ID]; !exists {
+			r.deliveries[d.ID] = copyDelivery(d)
+		}
+	}
+	return nil
+}
+
+// FindByID retrieves a delivery by its ID from the mock repository.
+func (r *DeliveryRepository) FindByID(ctx context.Context, id string) (*domain.WebhookDelivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	d, ok := r.deliveries[id]
+	if !ok {
+		return nil, apperror.ErrNotFound
+	}
+	return copyDelivery(d), nil
+}
+
+// Update replaces a delivery in the mock repository.
+func (r *DeliveryRepository) Update(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.deliveries[delivery.ID]; !ok {
+		return apperror.ErrNotFound
+	}
+	r.deliveries[delivery.ID] = copyDelivery(delivery)
+	return nil
+}
+
+// Due returns the pending deliveries of the mock repository whose next attempt is due.
+func (r *DeliveryRepository) Due(ctx context.Context, now time.Time, limit int) ([]*domain.WebhookDelivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var due []*domain.WebhookDelivery
+	for _, d := range r.deliveries {
+		if d.Status == domain.DeliveryPending && !d.NextAttemptAt.After(now) {
+			due = append(due, d)
+		}
+	}
+	slices.SortFunc(due, func(a, b *domain.WebhookDelivery) int {
+		return cmp.Or(a.NextAttemptAt.Compare(b.NextAttemptAt), cmp.Compare(a.ID, b.ID))
+	})
+	return copyDeliveries(due, limit), nil
+}
+
+// List returns the deliveries of the mock repository matching opts.
+func (r *DeliveryRepository) List(ctx context.Context, opts domain.DeliveryListOptions) ([]*domain.WebhookDelivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var matches []*domain.WebhookDelivery
+	for _, d := range r.deliveries {
+		if (opts.WebhookID == "" || d.WebhookID == opts.WebhookID) && (opts.Status == "" || d.Status == opts.Status) &&
+			d.Event.TenantID == opts.TenantID {
+			matches = append(matches, d)
+		}
+	}
+	slices.SortFunc(matches, func(a, b *domain.WebhookDelivery) int {
+		return cmp.Or(b.CreatedAt.Compare(a.CreatedAt), cmp.Compare(a.ID, b.ID))
+	})
+	return copyDeliveries(matches, opts.Limit), nil
+}
+
+// copyDeliveries copies the first limit deliveries.
+func copyDeliveries(deliveries []*domain.WebhookDelivery, limit int) []*domain.WebhookDelivery {
+	n := min(limit, len(deliveries))
+	copies := make([]*domain.WebhookDelivery, n)
+	for i := range n {
+		copies[i] = copyDelivery(deliveries[i])
+	}
+	return copies
+}
+
+// copyDelivery returns a copy of d that shares no memory with it.
+func copyDelivery(d *domain.WebhookDelivery) *domain.WebhookDelivery {
+	c := *d
+	c.Event = *copyMessage(&d.Event)
+	c.Attempts = slices.Clone(d.Attempts)
+	return &c
+}
@@ -0,0 +1,149 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/apperror"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/service"
+)
+
+// apiKeyColumns lists the columns of the api_keys table read by scanAPIKey.
+const apiKeyColumns = "id, name, prefix, hash, scopes, owner_id, tenant_id, created_at, last_used_at, revoked_at"
+
+// APIKeyRepository is a PostgreSQL implementation of the service.APIKeyRepository interface.
+// Keys are read back in the order of the seq column; their scopes are stored
+// as a JSON array.
+type APIKeyRepository struct {
+	db querier
+}
+
+// NewAPIKeyRepository creates a new APIKeyRepository backed by the given database handle.
+// The schema is expected to be in place; see Migrate.
+func NewAPIKeyRepository(db *sql.DB) service.APIKeyRepository {
+	return &APIKeyRepository{
+		db: db,
+	}
+}
+
+// Create inserts a new API key. IDs and hashes are unique.
+func (r *APIKeyRepository) Create(ctx context.Context, key *domain.APIKey) error {
+	scopes, err := marshalJSON(key.Scopes, "scopes of API key "+key.ID)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx,
+		`INSERT INTO api_keys (`+apiKeyColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		key.ID, key.Name, key.Prefix, key.Hash, scopes, key.OwnerID, key.TenantID, key.CreatedAt.UTC(),
+		nullTime(key.LastUsedAt), nullTime(key.RevokedAt),
+	)
+	if err != nil {
+		return translateError(err)
+	}
+	return nil
+}
+
+// FindByID finds an API key by its ID.
+func (r *APIKeyRepository) FindByID(ctx context.Context, id string) (*domain.APIKey, error) {
+	return scanAPIKey(r.db.QueryRowContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE id = $1`, id))
+}
+
+// FindByHash finds an API key by its hash.
+func (r *APIKeyRepository) FindByHash(ctx context.Context, hash string) (*domain.APIKey, error) {
+	return scanAPIKey(r.db.QueryRowContext(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE hash = $1`, hash))
+}
+
+// List returns the API keys of an owner, or every API key.
+func (r *APIKeyRepository) List(ctx context.Context, ownerID string) ([]*domain.APIKey, error) {
+	query, args := `SELECT `+apiKeyColumns+` FROM api_keys ORDER BY seq`, []any{}
+	if ownerID != "" {
+		query, args = `SELECT `+apiKeyColumns+` FROM api_keys WHERE owner_id = $1 ORDER BY seq`, []any{ownerID}
+	}
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+
+	keys := make([]*domain.APIKey, 0)
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, translateError(err)
+	}
+	return keys, nil
+}
+
+// Revoke revokes an API key, unless it is already revoked.
+func (r *APIKeyRepository) Revoke(ctx context.Context, id string, at time.Time) (*domain.APIKey, error) {
+	return scanAPIKey(r.db.QueryRowContext(ctx,
+		`UPDATE api_keys SET revoked_at = COALESCE(revoked_at, $2) WHERE id = $1 RETURNING `+apiKeyColumns,
+		id, at.UTC(),
+	))
+}
+
+// Touch records the use of an API key, unless a later one is recorded.
+func (r *APIKeyRepository) Touch(ctx context.Context, id string, at time.Time) error {
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE api_keys SET last_used_at = $2 WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < $2)`,
+		id, at.UTC(),
+	)
+	if err != nil {
+		return translateError(err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("postgres: failed to read affected rows: %w", err)
+	}
+	if n > 0 {
+		return nil
+	}
+
+	// Tell a later use apart from a missing key.
+	var exists bool
+	if err := r.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM api_keys WHERE id = $1)`, id).Scan(&exists); err != nil {
+		return translateError(err)
+	}
+	if !exists {
+		return apperror.ErrNotFound
+	}
+	return nil
+}
+
+// scanAPIKey reads an API key from the apiKeyColumns of row.
+func scanAPIKey(row scanner) (*domain.APIKey, error) {
+	var (
+		k                     domain.APIKey
+		scopes                string
+		lastUsedAt, revokedAt sql.NullTime
+	)
+	err := row.Scan(&k.ID, &k.Name, &k.Prefix, &k.Hash, &scopes, &k.OwnerID, &k.TenantID, &k.CreatedAt, &lastUsedAt, &revokedAt)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	if err := json.Unmarshal([]byte(scopes), &k.Scopes); err != nil {
+		return nil, fmt.Errorf("postgres: failed to decode scopes of API key %s: %w", k.ID, err)
+	}
+	k.CreatedAt = k.CreatedAt.UTC()
+	if lastUsedAt.Valid {
+		k.LastUsedAt = lastUsedAt.Time.UTC()
+	}
+	if revokedAt.Valid {
+		k.RevokedAt = revokedAt.Time.UTC()
+	}
+	return &k, nil
+}
+
+// nullTime converts t to a stored timestamp, or NULL if it is zero.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t.UTC(), Valid: !t.IsZero()}
+}
@@ -0,0 +1,409 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/apperror"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/service"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// uniqueViolation is the PostgreSQL error code for a unique constraint violation.
+const uniqueViolation = "23505"
+
+// Entity is the storage model for a row of the entities table.
+type Entity struct {
+	ID        string       `db:"id"`
+	Name      string       `db:"name"`
+	TenantID  string       `db:"tenant_id"`
+	OwnerID   string       `db:"owner_id"`
+	Version   int64        `db:"version"`
+	CreatedAt time.Time    `db:"created_at"`
+	UpdatedAt time.Time    `db:"updated_at"`
+	DeletedAt sql.NullTime `db:"deleted_at"`
+}
+
+// entityColumns lists the columns of the entities table in the order of Entity.fields.
+const entityColumns = "id, name, tenant_id, owner_id, version, created_at, updated_at, deleted_at"
+
+// fields returns pointers to the fields of e, in the order of entityColumns.
+func (e *Entity) fields() []any {
+	return []any{&e.ID, &e.Name, &e.TenantID, &e.OwnerID, &e.Version, &e.CreatedAt, &e.UpdatedAt, &e.DeletedAt}
+}
+
+// toDomain converts an Entity to a domain.Entity.
+func (e *Entity) toDomain() *domain.Entity {
+	return &domain.Entity{
+		ID:        e.ID,
+		Name:      e.Name,
+		TenantID:  e.TenantID,
+		OwnerID:   e.OwnerID,
+		Version:   e.Version,
+		CreatedAt: e.CreatedAt,
+		UpdatedAt: e.UpdatedAt,
+		DeletedAt: e.DeletedAt.Time,
+	}
+}
+
+// fromDomain converts a domain.Entity to an Entity.
+func fromDomain(e *domain.Entity) *Entity {
+	return &Entity{
+		ID:        e.ID,
+		Name:      e.Name,
+		TenantID:  e.TenantID,
+		OwnerID:   e.OwnerID,
+		Version:   e.Version,
+		CreatedAt: e.CreatedAt,
+		UpdatedAt: e.UpdatedAt,
+		DeletedAt: sql.NullTime{Time: e.DeletedAt, Valid: !e.DeletedAt.IsZero()},
+	}
+}
+
+// querier runs statements; it is implemented by *sql.DB and *sql.Tx.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// EntityRepository is a PostgreSQL implementation of the service.EntityRepository interface.
+// Every method but Purge only reaches the entities of the tenant of its
+// context; the entities of other tenants are reported as not found.
+type EntityRepository struct {
+	db querier // The database, or the transaction of a unit of work.
+}
+
+// NewEntityRepository creates a new EntityRepository backed by the given database handle.
+// The schema is expected to be in place; see Migrate.
+func NewEntityRepository(db *sql.DB) service.EntityRepository {
+	return &EntityRepository{
+		db: db,
+	}
+}
+
+// Create inserts a new entity in the tenant of ctx. IDs are unique across
+// tenants. On success, entity holds the stored values.
+func (r *EntityRepository) Create(ctx context.Context, entity *domain.Entity) error {
+	return create(ctx, r.db, entity)
+}
+
+// create is Create against q, which may be a transaction.
+func create(ctx context.Context, q querier, entity *domain.Entity) error {
+	storageEntity := fromDomain(entity)
+	storageEntity.TenantID = service.TenantFrom(ctx)
+	storageEntity.CreatedAt = time.Now().UTC()
+	storageEntity.UpdatedAt = storageEntity.CreatedAt
+	storageEntity.Version = 1
+
+	err := q.QueryRowContext(ctx,
+		`INSERT INTO entities (id, name, tenant_id, owner_id, version, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+entityColumns,
+		storageEntity.ID, storageEntity.Name, storageEntity.TenantID, storageEntity.OwnerID, storageEntity.Version, storageEntity.CreatedAt, storageEntity.UpdatedAt,
+	).Scan(storageEntity.fields()...)
+	if err != nil {
+		return translateError(err)
+	}
+	*entity = *storageEntity.toDomain()
+	return nil
+}
+
+// FindByID finds an entity by its ID.
+func (r *EntityRepository) FindByID(ctx context.Context, id string) (*domain.Entity, error) {
+	var storageEntity Entity
+	err := r.db.QueryRowContext(ctx,
+		`SELECT `+entityColumns+` FROM entities WHERE id = $1 AND tenant_id = $2 AND deleted_at IS NULL`,
+		id, service.TenantFrom(ctx),
+	).Scan(storageEntity.fields()...)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return storageEntity.toDomain(), nil
+}
+
+// Update updates the name of an existing entity, if its version matches.
+// On success, entity holds the stored values, including the new version.
+func (r *EntityRepository) Update(ctx context.Context, entity *domain.Entity) error {
+	return update(ctx, r.db, entity)
+}
+
+// update is Update against q, which may be a transaction.
+func update(ctx context.Context, q querier, entity *domain.Entity) error {
+	storageEntity := fromDomain(entity)
+	storageEntity.UpdatedAt = time.Now().UTC()
+
+	err := q.QueryRowContext(ctx,
+		`UPDATE entities SET name = $2, updated_at = $3, version = version + 1
+		WHERE id = $1 AND tenant_id = $5 AND deleted_at IS NULL AND ($4::bigint = 0 OR version = $4::bigint)
+		RETURNING `+entityColumns,
+		storageEntity.ID, storageEntity.Name, storageEntity.UpdatedAt, storageEntity.Version, service.TenantFrom(ctx),
+	).Scan(storageEntity.fields()...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return missingError(ctx, q, entity.ID, false)
+	}
+	if err != nil {
+		return translateError(err)
+	}
+	*entity = *storageEntity.toDomain()
+	return nil
+}
+
+// Delete moves an entity to the trash, if its version matches.
+func (r *EntityRepository) Delete(ctx context.Context, id string, version int64) error {
+	return softDelete(ctx, r.db, id, version)
+}
+
+// softDelete is Delete against q, which may be a transaction.
+func softDelete(ctx context.Context, q querier, id string, version int64) error {
+	result, err := q.ExecContext(ctx,
+		`UPDATE entities SET deleted_at = $3, version = version + 1
+		WHERE id = $1 AND tenant_id = $4 AND deleted_at IS NULL AND ($2::bigint = 0 OR version = $2::bigint)`,
+		id, version, time.Now().UTC(), service.TenantFrom(ctx),
+	)
+	if err != nil {
+		return translateError(err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("postgres: failed to read affected rows: %w", err)
+	}
+	if n == 0 {
+		return missingError(ctx, q, id, false)
+	}
+	return nil
+}
+
+// Batch applies ops in order. If atomic is set, they run in a single
+// transaction that is rolled back on the first failure. Otherwise each one
+// runs in its own, so that a failure does not affect the others even within
+// a unit of work.
+func (r *EntityRepository) Batch(ctx context.Context, ops []domain.EntityOperation, atomic bool) ([]error, error) {
+	errs := make([]error, len(ops))
+	if !atomic {
+		for i, op := range ops {
+			errs[i] = inTransaction(ctx, r.db, func(tx querier) error {
+				return apply(ctx, tx, op)
+			})
+		}
+		return errs, nil
+	}
+
+	var failed bool
+	err := inTransaction(ctx, r.db, func(tx querier) error {
+		for i, op := range ops {
+			if err := apply(ctx, tx, op); err != nil {
+				for j := range errs {
+					errs[j] = apperror.ErrAborted
+				}
+				errs[i] = err
+				failed = true
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil && !failed {
+		return nil, fmt.Errorf("postgres: failed to apply batch: %w", err)
+	}
+	return errs, nil
+}
+
+// apply runs a batch operation against q.
+func apply(ctx context.Context, q querier, op domain.EntityOperation) error {
+	switch op.Kind {
+	case domain.EntityOperationCreate:
+		return create(ctx, q, op.Entity)
+	case domain.EntityOperationUpdate:
+		return update(ctx, q, op.Entity)
+	case domain.EntityOperationDelete:
+		return softDelete(ctx, q, op.Entity.ID, op.Entity.Version)
+	default:
+		return fmt.Errorf("postgres: unknown operation %q", op.Kind)
+	}
+}
+
+// Restore takes an entity out of the trash, if its version matches.
+func (r *EntityRepository) Restore(ctx context.Context, id string, version int64) (*domain.Entity, error) {
+	var storageEntity Entity
+	err := r.db.QueryRowContext(ctx,
+		`UPDATE entities SET deleted_at = NULL, version = version + 1
+		WHERE id = $1 AND tenant_id = $3 AND deleted_at IS NOT NULL AND ($2::bigint = 0 OR version = $2::bigint)
+		RETURNING `+entityColumns,
+		id, version, service.TenantFrom(ctx),
+	).Scan(storageEntity.fields()...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, missingError(ctx, r.db, id, true)
+	}
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return storageEntity.toDomain(), nil
+}
+
+// Purge permanently removes the entities deleted before deletedBefore, in every tenant.
+func (r *EntityRepository) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx,
+		`DELETE FROM entities WHERE deleted_at < $1`,
+		deletedBefore,
+	)
+	if err != nil {
+		return 0, translateError(err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("postgres: failed to read affected rows: %w", err)
+	}
+	return n, nil
+}
+
+// List lists the entities matching opts.
+func (r *EntityRepository) List(ctx context.Context, opts domain.EntityListOptions) ([]*domain.Entity, error) {
+	query, args := listQuery(service.TenantFrom(ctx), opts)
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+
+	entities := make([]*domain.Entity, 0)
+	for rows.Next() {
+		var storageEntity Entity
+		if err := rows.Scan(storageEntity.fields()...); err != nil {
+			return nil, translateError(err)
+		}
+		entities = append(entities, storageEntity.toDomain())
+	}
+	if err := rows.Err(); err != nil {
+		return nil, translateError(err)
+	}
+	return entities, nil
+}
+
+// Lock locks the rows of the existing entities with the given IDs, in every
+// tenant, until the transaction ends. Rows are locked in the order of their
+// IDs, so transactions that lock them up front do not deadlock each other;
+// entities that do not exist yet are guarded by the primary key.
+func (r *EntityRepository) Lock(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	placeholders := make([]string, len(ids))
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = id
+	}
+	_, err := r.db.ExecContext(ctx,
+		`SELECT id FROM entities WHERE id IN (`+strings.Join(placeholders, ", ")+`) ORDER BY id FOR UPDATE`,
+		args...,
+	)
+	if err != nil {
+		return translateError(err)
+	}
+	return nil
+}
+
+// listQuery builds the keyset-paginated SELECT statement for List, over the
+// entities of the given tenant.
+func listQuery(tenantID string, opts domain.EntityListOptions) (string, []any) {
+	var (
+		where []string
+		args  []any
+	)
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	where = append(where, "tenant_id = "+arg(tenantID))
+	if opts.NamePrefix != "" {
+		where = append(where, "starts_with(name, "+arg(opts.NamePrefix)+")")
+	}
+	if !opts.CreatedAfter.IsZero() {
+		where = append(where, "created_at > "+arg(opts.CreatedAfter))
+	}
+
+	if opts.OwnerID != "" {
+		where = append(where, "owner_id = "+arg(opts.OwnerID))
+	}
+
+	switch opts.Deleted {
+	case domain.EntityDeletedExcluded:
+		where = append(where, "deleted_at IS NULL")
+	case domain.EntityDeletedOnly:
+		where = append(where, "deleted_at IS NOT NULL")
+	}
+
+	column := "created_at"
+	switch opts.SortBy {
+	case domain.EntitySortByName:
+		column = "name"
+	case domain.EntitySortByUpdatedAt:
+		column = "updated_at"
+	}
+
+	direction, op := "ASC", ">"
+	if opts.Descending {
+		direction, op = "DESC", "<"
+	}
+
+	if c := opts.After; c != nil {
+		var value any
+		switch opts.SortBy {
+		case domain.EntitySortByName:
+			value = c.Name
+		case domain.EntitySortByUpdatedAt:
+			value = c.UpdatedAt
+		default:
+			value = c.CreatedAt
+		}
+		where = append(where, fmt.Sprintf("(%s, id) %s (%s, %s)", column, op, arg(value), arg(c.ID)))
+	}
+
+	query := "SELECT " + entityColumns + " FROM entities WHERE " + strings.Join(where, " AND ")
+	query += fmt.Sprintf(" ORDER BY %[1]s %[2]s, id %[2]s", column, direction)
+	if opts.Limit > 0 {
+		query += " LIMIT " + arg(opts.Limit)
+	}
+	return query, args
+}
+
+// missingError explains why a conditional statement on id did not touch any row:
+// apperror.ErrNotFound if no entity with id of the tenant of ctx is in the trash
+// (deleted) or out of it (!deleted), apperror.ErrPreconditionFailed otherwise.
+func missingError(ctx context.Context, q querier, id string, deleted bool) error {
+	var exists bool
+	err := q.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM entities WHERE id = $1 AND tenant_id = $3 AND (deleted_at IS NOT NULL) = $2)`,
+		id, deleted, service.TenantFrom(ctx),
+	).Scan(&exists)
+	if err != nil {
+		return translateError(err)
+	}
+	if !exists {
+		return apperror.ErrNotFound
+	}
+	return apperror.ErrPreconditionFailed
+}
+
+// translateError maps database-specific errors to application errors.
+// Errors that cannot be translated are returned wrapped, and will be treated as internal errors.
+func translateError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return apperror.ErrNotFound
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return apperror.ErrConflict
+	}
+
+	return fmt.Errorf("postgres: %w", err)
+}
@@ -0,0 +1,80 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/service"
+)
+
+// UnitOfWork is a PostgreSQL implementation of the service.UnitOfWork interface.
+// Each unit of work runs in a database transaction.
+//
+// As in any PostgreSQL transaction, a failed statement aborts the transaction:
+// fn should return the error of a failed repository call rather than carry on.
+type UnitOfWork struct {
+	db *sql.DB
+}
+
+// NewUnitOfWork creates a new UnitOfWork backed by the given database handle.
+func NewUnitOfWork(db *sql.DB) service.UnitOfWork {
+	return &UnitOfWork{
+		db: db,
+	}
+}
+
+// Do runs fn with repositories bound to a new transaction.
+func (u *UnitOfWork) Do(ctx context.Context, fn func(repos service.Repositories) error) error {
+	return inTransaction(ctx, u.db, func(tx querier) error {
+		return fn(service.Repositories{
+			Entities: &EntityRepository{db: tx},
+			Outbox:   &OutboxRepository{db: tx},
+			Audit:    &AuditRepository{db: tx},
+		})
+	})
+}
+
+// inTransaction runs fn in a transaction on q, which is committed if fn returns
+// nil and rolled back otherwise. If q is already a transaction, fn runs in a
+// savepoint of it instead, so that a failure only rolls back the writes of fn.
+func inTransaction(ctx context.Context, q querier, fn func(tx querier) error) error {
+	db, ok := q.(*sql.DB)
+	if !ok {
+		return inSavepoint(ctx, q, fn)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("postgres: failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // Rollback after Commit is a no-op.
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("postgres: failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// inSavepoint runs fn in a savepoint of the transaction tx, which is released
+// if fn returns nil and rolled back to otherwise.
+func inSavepoint(ctx context.Context, tx querier, fn func(tx querier) error) error {
+	if _, err := tx.ExecContext(ctx, `SAVEPOINT nested`); err != nil {
+		return fmt.Errorf("postgres: failed to create savepoint: %w", err)
+	}
+
+	if err := fn(tx); err != nil {
+		if _, rbErr := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT nested`); rbErr != nil {
+			return errors.Join(err, fmt.Errorf("postgres: failed to roll back to savepoint: %w", rbErr))
+		}
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `RELEASE SAVEPOINT nested`); err != nil {
+		return fmt.Errorf("postgres: failed to release savepoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/apperror"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/service"
+)
+
+// scanner reads the columns of a row; it is implemented by *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// webhookColumns lists the columns of the webhooks table read by scanWebhook.
+const webhookColumns = "id, url, event_types, secret, tenant_id, owner_id, owner_roles, created_at"
+
+// WebhookRepository is a PostgreSQL implementation of the service.WebhookRepository interface.
+// Webhooks are read back in the order of the seq column.
+type WebhookRepository struct {
+	db querier
+}
+
+// NewWebhookRepository creates a new WebhookRepository backed by the given database handle.
+// The schema is expected to be in place; see Migrate.
+func NewWebhookRepository(db *sql.DB) service.WebhookRepository {
+	return &WebhookRepository{
+		db: db,
+	}
+}
+
+// Create inserts a new webhook. The event types and owner roles are stored as
+// JSON arrays.
+func (r *WebhookRepository) Create(ctx context.Context, webhook *domain.Webhook) error {
+	eventTypes, err := marshalJSON(webhook.EventTypes, "event types of webhook "+webhook.ID)
+	if err != nil {
+		return err
+	}
+	ownerRoles, err := marshalJSON(webhook.OwnerRoles, "owner roles of webhook "+webhook.ID)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx,
+		`INSERT INTO webhooks (`+webhookColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		webhook.ID, webhook.URL, eventTypes, webhook.Secret, webhook.TenantID, webhook.OwnerID, ownerRoles, webhook.CreatedAt.UTC(),
+	)
+	if err != nil {
+		return translateError(err)
+	}
+	return nil
+}
+
+// FindByID finds a webhook by its ID.
+func (r *WebhookRepository) FindByID(ctx context.Context, id string) (*domain.Webhook, error) {
+	return scanWebhook(r.db.QueryRowContext(ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE id = $1`, id))
+}
+
+// List returns every webhook.
+func (r *WebhookRepository) List(ctx context.Context) ([]*domain.Webhook, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+webhookColumns+` FROM webhooks ORDER BY seq`)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+
+	webhooks := make([]*domain.Webhook, 0)
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, translateError(err)
+	}
+	return webhooks, nil
+}
+
+// Delete removes a webhook. Its deliveries are kept, for their logs.
+func (r *WebhookRepository) Delete(ctx context.Context, id string) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM webhooks WHERE id = $1`, id)
+	if err != nil {
+		return translateError(err)
+	}
+	return requireRow(result)
+}
+
+// scanWebhook reads a webhook from the webhookColumns of row.
+func scanWebhook(row scanner) (*domain.Webhook, error) {
+	var (
+		w          domain.Webhook
+		eventTypes string
+		ownerRoles string
+	)
+	if err := row.Scan(&w.ID, &w.URL, &eventTypes, &w.Secret, &w.TenantID, &w.OwnerID, &ownerRoles, &w.CreatedAt); err != nil {
+		return nil, translateError(err)
+	}
+	if err := json.Unmarshal([]byte(eventTypes), &w.EventTypes); err != nil {
+		return nil, fmt.Errorf("postgres: failed to decode event types of webhook %s: %w", w.ID, err)
+	}
+	if err := json.Unmarshal([]byte(ownerRoles), &w.OwnerRoles); err != nil {
+		return nil, fmt.Errorf("postgres: failed to decode owner roles of webhook %s: %w", w.ID, err)
+	}
+	w.CreatedAt = w.CreatedAt.UTC()
+	return &w, nil
+}
+
+// deliveryColumns lists the columns of the webhook_deliveries table, in the
+// order of deliveryArgs and scanDelivery.
+const deliveryColumns = `id, webhook_id, event_id, event_type, event_entity_id, event_tenant_id, event_occurred_at, event_payload,
+	status, attempts, failures, next_attempt_at, last_error, created_at, updated_at`
+
+// DeliveryRepository is a PostgreSQL implementation of the service.DeliveryRepository interface.
+// The event of a delivery is stored in columns of its own, and its attempt log
+// as a JSON array.
+type DeliveryRepository struct {
+	db querier
+}
+
+// NewDeliveryRepository creates a new DeliveryRepository backed by the given database handle.
+// The schema is expected to be in place; see Migrate.
+func NewDeliveryRepository(db *sql.DB) service.DeliveryRepository {
+	return &DeliveryRepository{
+		db: db,
+	}
+}
+
+// Add inserts the new deliveries, and skips those whose ID is already stored.
+func (r *DeliveryRepository) Add(ctx context.Context, deliveries []*domain.WebhookDelivery) error {
+	for _, d := range deliveries {
+		args, err := deliveryArgs(d)
+		if err != nil {
+			return err
+		}
+		_, err = r.db.ExecContext(ctx,
+			`INSERT INTO webhook_deliveries (`+deliveryColumns+`)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+			ON CONFLICT (id) DO NOTHING`,
+			args...,
+		)
+		if err != nil {
+			return translateError(err)
+		}
+	}
+	return nil
+}
+
+// FindByID finds a delivery by its ID.
+func (r *DeliveryRepository) FindByID(ctx context.Context, id string) (*domain.WebhookDelivery, error) {
+	return scanDelivery(r.db.QueryRowContext(ctx, `SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE id = $1`, id))
+}
+
+// Update replaces a stored delivery.
+func (r *DeliveryRepository) Update(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	args, err := deliveryArgs(delivery)
+	if err != nil {
+		return err
+	}
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE webhook_deliveries SET webhook_id = $2, event_id = $3, event_type = $4, event_entity_id = $5,
+			event_tenant_id = $6, event_occurred_at = $7, event_payload = $8, status = $9, attempts = $10,
+			failures = $11, next_attempt_at = $12, last_error = $13, created_at = $14, updated_at = $15
+		WHERE id = $1`,
+		args...,
+	)
+	if err != nil {
+		return translateError(err)
+	}
+	return requireRow(result)
+}
+
+// Due returns the pending deliveries whose next attempt is due.
+func (r *DeliveryRepository) Due(ctx context.Context, now time.Time, limit int) ([]*domain.WebhookDelivery, error) {
+	return r.query(ctx,
+		`SELECT `+deliveryColumns+` FROM webhook_deliveries
+		WHERE status = $1 AND next_attempt_at <= $2 ORDER BY next_attempt_at, id LIMIT $3`,
+		string(domain.DeliveryPending), now.UTC(), limit,
+	)
+}
+
+// List returns the deliveries matching opts.
+func (r *DeliveryRepository) List(ctx context.Context, opts domain.DeliveryListOptions) ([]*domain.WebhookDelivery, error) {
+	conditions := []string{"event_tenant_id = $1"}
+	args := []any{opts.TenantID}
+	if opts.WebhookID != "" {
+		args = append(args, opts.WebhookID)
+		conditions = append(conditions, fmt.Sprintf("webhook_id = $%d", len(args)))
+	}
+	if opts.Status != "" {
+		args = append(args, string(opts.Status))
+		conditions = append(conditions, fmt.Sprintf("status = $%d", len(args)))
+	}
+	args = append(args, opts.Limit)
+
+	return r.query(ctx,
+		`SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE `+strings.Join(conditions, " AND ")+
+			fmt.Sprintf(` ORDER BY created_at DESC, id LIMIT $%d`, len(args)),
+		args...,
+	)
+}
+
+// query returns the deliveries selected by query, which reads deliveryColumns.
+func (r *DeliveryRepository) query(ctx context.Context, query string, args ...any) ([]*domain.WebhookDelivery, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+
+	deliveries := make([]*domain.WebhookDelivery, 0)
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, translateError(err)
+	}
+	return deliveries, nil
+}
+
+// deliveryArgs returns the values of the deliveryColumns of d.
+func deliveryArgs(d *domain.WebhookDelivery) ([]any, error) {
+	attempts, err := marshalJSON(d.Attempts, "attempts of delivery "+d.ID)
+	if err != nil {
+		return nil, err
+	}
+	return []any{
+		d.ID, d.WebhookID, d.Event.ID, string(d.Event.Type), d.Event.EntityID, d.Event.TenantID, d.Event.OccurredAt.UTC(), string(d.Event.Payload),
+		string(d.Status), attempts, d.Failures, d.NextAttemptAt.UTC(), d.LastError, d.CreatedAt.UTC(), d.UpdatedAt.UTC(),
+	}, nil
+}
+
+// scanDelivery reads a delivery from the deliveryColumns of row.
+func scanDelivery(row scanner) (*domain.WebhookDelivery, error) {
+	var (
+		d                                    domain.WebhookDelivery
+		eventType, payload, status, attempts string
+	)
+	err := row.Scan(
+		&d.ID, &d.WebhookID, &d.Event.ID, &eventType, &d.Event.EntityID, &d.Event.TenantID, &d.Event.OccurredAt, &payload,
+		&status, &attempts, &d.Failures, &d.NextAttemptAt, &d.LastError, &d.CreatedAt, &d.UpdatedAt,
+	)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	if err := json.Unmarshal([]byte(attempts), &d.Attempts); err != nil {
+		return nil, fmt.Errorf("postgres: failed to decode attempts of delivery %s: %w", d.ID, err)
+	}
+	d.Event.Type = domain.EventType(eventType)
+	d.Event.OccurredAt = d.Event.OccurredAt.UTC()
+	d.Event.Payload = []byte(payload)
+	d.Status = domain.DeliveryStatus(status)
+	d.NextAttemptAt = d.NextAttemptAt.UTC()
+	d.CreatedAt = d.CreatedAt.UTC()
+	d.UpdatedAt = d.UpdatedAt.UTC()
+	return &d, nil
+}
+
+// marshalJSON encodes v, described by what in errors, as JSON text.
+func marshalJSON(v any, what string) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("postgres: failed to encode %s: %w", what, err)
+	}
+	return string(data), nil
+}
+
+// requireRow returns apperror.ErrNotFound if result did not touch any row.
+func requireRow(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("postgres: failed to read affected rows: %w", err)
+	}
+	if n == 0 {
+		return apperror.ErrNotFound
+	}
+	return nil
+}
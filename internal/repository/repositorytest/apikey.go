@@ -0,0 +1,161 @@
+package repositorytest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/apperror"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/service"
+)
+
+// APIKeyRepositoryFactory returns a new, empty API key repository.
+// It is called once per subtest, so each one starts from a clean state.
+type APIKeyRepositoryFactory func(t *testing.T) service.APIKeyRepository
+
+// RunAPIKeyRepositorySuite verifies that the repositories built by newRepo
+// honor the service.APIKeyRepository contract.
+func RunAPIKeyRepositorySuite(t *testing.T, newRepo APIKeyRepositoryFactory) {
+	ctx := context.Background()
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// newKey returns a key with the given ID and owner, and a hash derived from its ID.
+	newKey := func(id, ownerID string) *domain.APIKey {
+		return &domain.APIKey{
+			ID:        id,
+			Name:      "key " + id,
+			Prefix:    "ak_" + id,
+			Hash:      "hash-" + id,
+			Scopes:    []domain.Role{domain.RoleReader},
+			OwnerID:   ownerID,
+			CreatedAt: start,
+		}
+	}
+
+	t.Run("Create and Find", func(t *testing.T) {
+		repo := newRepo(t)
+		key := newKey("k1", "alice")
+		key.Scopes = []domain.Role{domain.RoleReader, domain.RoleEditor}
+		if err := repo.Create(ctx, key); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		byID, err := repo.FindByID(ctx, "k1")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		byHash, err := repo.FindByHash(ctx, "hash-k1")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		for _, found := range []*domain.APIKey{byID, byHash} {
+			if found.ID != "k1" || found.Name != key.Name || found.Prefix != key.Prefix || found.OwnerID != "alice" ||
+				!found.CreatedAt.Equal(start) || !slices.Equal(found.Scopes, key.Scopes) {
+				t.Errorf("expected %+v, got %+v", key, found)
+			}
+		}
+
+		if err := repo.Create(ctx, key); !errors.Is(err, apperror.ErrConflict) {
+			t.Errorf("expected ErrConflict for a duplicate ID, got %v", err)
+		}
+		duplicate := newKey("k2", "alice")
+		duplicate.Hash = key.Hash
+		if err := repo.Create(ctx, duplicate); !errors.Is(err, apperror.ErrConflict) {
+			t.Errorf("expected ErrConflict for a duplicate hash, got %v", err)
+		}
+		if _, err := repo.FindByID(ctx, "unknown"); !errors.Is(err, apperror.ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+		if _, err := repo.FindByHash(ctx, "unknown"); !errors.Is(err, apperror.ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		repo := newRepo(t)
+		for _, k := range []*domain.APIKey{newKey("c", "alice"), newKey("a", "bob"), newKey("b", "alice")} {
+			if err := repo.Create(ctx, k); err != nil {
+				t.Fatalf("failed to create API key %s: %v", k.ID, err)
+			}
+		}
+
+		tests := []struct {
+			ownerID string
+			want    []string
+		}{
+			{"", []string{"c", "a", "b"}},
+			{"alice", []string{"c", "b"}},
+			{"carol", []string{}},
+		}
+		for _, tt := range tests {
+			keys, err := repo.List(ctx, tt.ownerID)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			ids := make([]string, len(keys))
+			for i, k := range keys {
+				ids[i] = k.ID
+			}
+			if !slices.Equal(ids, tt.want) {
+				t.Errorf("owner %q: expected the keys %v in creation order, got %v", tt.ownerID, tt.want, ids)
+			}
+		}
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		repo := newRepo(t)
+		if err := repo.Create(ctx, newKey("k1", "alice")); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		revoked, err := repo.Revoke(ctx, "k1", start.Add(time.Hour))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !revoked.RevokedAt.Equal(start.Add(time.Hour)) {
+			t.Errorf("expected the key to be revoked, got %+v", revoked)
+		}
+
+		revoked, err = repo.Revoke(ctx, "k1", start.Add(2*time.Hour))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !revoked.RevokedAt.Equal(start.Add(time.Hour)) {
+			t.Errorf("expected the first revocation to be kept, got %s", revoked.RevokedAt)
+		}
+		if found, _ := repo.FindByHash(ctx, "hash-k1"); found == nil || !found.IsRevoked() {
+			t.Errorf("expected the stored key to be revoked, got %+v", found)
+		}
+
+		if _, err := repo.Revoke(ctx, "unknown", start); !errors.Is(err, apperror.ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Touch", func(t *testing.T) {
+		repo := newRepo(t)
+		if err := repo.Create(ctx, newKey("k1", "alice")); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		for _, at := range []time.Time{start.Add(time.Hour), start.Add(time.Minute)} {
+			if err := repo.Touch(ctx, "k1", at); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		}
+		found, err := repo.FindByID(ctx, "k1")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !found.LastUsedAt.Equal(start.Add(time.Hour)) {
+			t.Errorf("expected the latest use to be kept, got %s", found.LastUsedAt)
+		}
+
+		if err := repo.Touch(ctx, "unknown", start); !errors.Is(err, apperror.ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+	})
+}
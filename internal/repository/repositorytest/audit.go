@@ -0,0 +1,149 @@
+package repositorytest
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/service"
+)
+
+// AuditRepositoryFactory returns a new, empty audit repository.
+// It is called once per subtest, so each one starts from a clean state.
+type AuditRepositoryFactory func(t *testing.T) service.AuditRepository
+
+// RunAuditRepositorySuite verifies that the repositories built by newRepo
+// honor the service.AuditRepository contract.
+func RunAuditRepositorySuite(t *testing.T, newRepo AuditRepositoryFactory) {
+	ctx := context.Background()
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	t.Run("Add and List", func(t *testing.T) {
+		repo := newRepo(t)
+		after := &domain.Entity{ID: "e1", Name: "Test", Version: 1, CreatedAt: at, UpdatedAt: at}
+		created := &domain.AuditEntry{
+			ID:         "a1",
+			EntityID:   "e1",
+			Action:     domain.AuditActionCreate,
+			Principal:  "alice",
+			RequestID:  "req-1",
+			OccurredAt: at,
+			After:      after,
+			Changes:    domain.DiffEntities(nil, after),
+		}
+		mustAddAuditEntries(t, repo, created, newAuditEntry("b1", "e2"), newAuditEntry("a2", "e1"))
+
+		entries, err := repo.List(ctx, domain.AuditListOptions{EntityID: "e1", Limit: 10})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if got := auditEntryIDs(entries); !slices.Equal(got, []string{"a1", "a2"}) {
+			t.Fatalf("expected the entries of the entity in order, got %v", got)
+		}
+		found := entries[0]
+		if found.Action != created.Action || found.Principal != "alice" || found.RequestID != "req-1" ||
+			!found.OccurredAt.Equal(at) || found.Before != nil || found.After == nil || found.After.Name != "Test" ||
+			len(found.Changes) != len(created.Changes) {
+			t.Errorf("expected %+v, got %+v", created, found)
+		}
+
+		entries, err = repo.List(ctx, domain.AuditListOptions{EntityID: "unknown", Limit: 10})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(entries) != 0 {
+			t.Errorf("expected no entries for an unknown entity, got %v", auditEntryIDs(entries))
+		}
+	})
+
+	t.Run("Stored entries are copies", func(t *testing.T) {
+		repo := newRepo(t)
+		entry := newAuditEntry("a1", "e1")
+		mustAddAuditEntries(t, repo, entry)
+		entry.After.Name = "Changed"
+
+		entries, err := repo.List(ctx, domain.AuditListOptions{EntityID: "e1", Limit: 10})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(entries) != 1 || entries[0].After.Name != "Test" {
+			t.Errorf("expected the entry as it was added, got %+v", entries)
+		}
+	})
+
+	t.Run("List pages", func(t *testing.T) {
+		repo := newRepo(t)
+		mustAddAuditEntries(t, repo, newAuditEntry("a1", "e1"), newAuditEntry("a2", "e1"), newAuditEntry("a3", "e1"))
+
+		tests := []struct {
+			name string
+			opts domain.AuditListOptions
+			want []string
+		}{
+			{"limit", domain.AuditListOptions{EntityID: "e1", Limit: 2}, []string{"a1", "a2"}},
+			{"cursor", domain.AuditListOptions{EntityID: "e1", Limit: 2, Cursor: "a2"}, []string{"a3"}},
+			{"last cursor", domain.AuditListOptions{EntityID: "e1", Limit: 2, Cursor: "a3"}, []string{}},
+		}
+		for _, tt := range tests {
+			entries, err := repo.List(ctx, tt.opts)
+			if err != nil {
+				t.Fatalf("%s: expected no error, got %v", tt.name, err)
+			}
+			if got := auditEntryIDs(entries); !slices.Equal(got, tt.want) {
+				t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+			}
+		}
+	})
+}
+
+// newAuditEntry returns the audit entry of an update of entityID.
+func newAuditEntry(id, entityID string) *domain.AuditEntry {
+	before := &domain.Entity{ID: entityID, Name: "Old", Version: 1}
+	after := &domain.Entity{ID: entityID, Name: "Test", Version: 2}
+	return &domain.AuditEntry{
+		ID:         id,
+		EntityID:   entityID,
+		Action:     domain.AuditActionUpdate,
+		Principal:  "alice",
+		OccurredAt: time.Now().UTC(),
+		Before:     before,
+		After:      after,
+		Changes:    domain.DiffEntities(before, after),
+	}
+}
+
+// mustAddAuditEntries adds entries to the repository, one at a time.
+func mustAddAuditEntries(t *testing.T, repo service.AuditRepository, entries ...*domain.AuditEntry) {
+	t.Helper()
+
+	for _, e := range entries {
+		if err := repo.Add(context.Background(), []*domain.AuditEntry{e}); err != nil {
+			t.Fatalf("failed to add audit entry %s: %v", e.ID, err)
+		}
+	}
+}
+
+// assertAuditEntries checks that the audit log of entityID holds exactly the
+// entries with the given IDs, in order.
+func assertAuditEntries(t *testing.T, repo service.AuditRepository, entityID string, ids ...string) {
+	t.Helper()
+
+	entries, err := repo.List(context.Background(), domain.AuditListOptions{EntityID: entityID, Limit: 100})
+	if err != nil {
+		t.Fatalf("failed to list audit entries: %v", err)
+	}
+	if got := auditEntryIDs(entries); !slices.Equal(got, ids) {
+		t.Errorf("expected audit entries %v, got %v", ids, got)
+	}
+}
+
+// auditEntryIDs returns the IDs of the given entries, in order.
+func auditEntryIDs(entries []*domain.AuditEntry) []string {
+	ids := make([]string, len(entries))
+	for i, e := range entries {
+		ids[i] = e.ID
+	}
+	return ids
+}
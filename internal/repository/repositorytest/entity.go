@@ -0,0 +1,769 @@
+// Package repositorytest provides conformance tests shared by every
+// implementation of the service repository interfaces.
+package repositorytest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/apperror"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/service"
+)
+
+// EntityRepositoryFactory returns a new, empty repository.
+// It is called once per subtest, so each one starts from a clean state.
+type EntityRepositoryFactory func(t *testing.T) service.EntityRepository
+
+// RunEntityRepositorySuite verifies that the repositories built by newRepo
+// honor the service.EntityRepository contract.
+func RunEntityRepositorySuite(t *testing.T, newRepo EntityRepositoryFactory) {
+	ctx := context.Background()
+
+	t.Run("Create and FindByID", func(t *testing.T) {
+		repo := newRepo(t)
+
+		if err := repo.Create(ctx, &domain.Entity{ID: "1", Name: "Test"}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		found, err := repo.FindByID(ctx, "1")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if found.ID != "1" || found.Name != "Test" {
+			t.Errorf("expected entity with ID 1 and Name Test, got %+v", found)
+		}
+	})
+
+	t.Run("Create and Update return stored values", func(t *testing.T) {
+		repo := newRepo(t)
+
+		entity := &domain.Entity{ID: "1", Name: "Test"}
+		if err := repo.Create(ctx, entity); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		assertStored(t, repo, entity)
+
+		entity = &domain.Entity{ID: "1", Name: "Updated Test"}
+		if err := repo.Update(ctx, entity); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		assertStored(t, repo, entity)
+	})
+
+	t.Run("Owner", func(t *testing.T) {
+		repo := newRepo(t)
+
+		if err := repo.Create(ctx, &domain.Entity{ID: "1", Name: "Test", OwnerID: "alice"}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		// The owner never changes, whatever the update says.
+		entity := &domain.Entity{ID: "1", Name: "Updated Test", OwnerID: "bob"}
+		if err := repo.Update(ctx, entity); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if entity.OwnerID != "alice" {
+			t.Errorf("expected the update to return owner alice, got %q", entity.OwnerID)
+		}
+
+		found, err := repo.FindByID(ctx, "1")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if found.OwnerID != "alice" {
+			t.Errorf("expected owner alice, got %q", found.OwnerID)
+		}
+	})
+
+	t.Run("Tenant isolation", func(t *testing.T) {
+		repo := newRepo(t)
+		acme := service.WithTenant(ctx, "acme")
+		globex := service.WithTenant(ctx, "globex")
+
+		entity := &domain.Entity{ID: "1", Name: "Test"}
+		if err := repo.Create(acme, entity); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if entity.TenantID != "acme" {
+			t.Errorf("expected tenant acme, got %q", entity.TenantID)
+		}
+		if err := repo.Create(globex, &domain.Entity{ID: "2", Name: "Test"}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		// IDs are unique across tenants.
+		if err := repo.Create(globex, &domain.Entity{ID: "1", Name: "Test"}); !errors.Is(err, apperror.ErrConflict) {
+			t.Errorf("expected ErrConflict, got %v", err)
+		}
+
+		// The entity of acme cannot be reached from another tenant.
+		for _, other := range []context.Context{globex, ctx} {
+			if _, err := repo.FindByID(other, "1"); !errors.Is(err, apperror.ErrNotFound) {
+				t.Errorf("FindByID: expected ErrNotFound, got %v", err)
+			}
+			if err := repo.Update(other, &domain.Entity{ID: "1", Name: "Hijacked", Version: 1}); !errors.Is(err, apperror.ErrNotFound) {
+				t.Errorf("Update: expected ErrNotFound, got %v", err)
+			}
+			if err := repo.Delete(other, "1", 1); !errors.Is(err, apperror.ErrNotFound) {
+				t.Errorf("Delete: expected ErrNotFound, got %v", err)
+			}
+			ops := []domain.EntityOperation{
+				{Kind: domain.EntityOperationUpdate, Entity: &domain.Entity{ID: "1", Name: "Hijacked"}},
+				{Kind: domain.EntityOperationDelete, Entity: &domain.Entity{ID: "1"}},
+			}
+			errs, err := repo.Batch(other, ops, false)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			for i, err := range errs {
+				if !errors.Is(err, apperror.ErrNotFound) {
+					t.Errorf("Batch operation %d: expected ErrNotFound, got %v", i, err)
+				}
+			}
+		}
+		entities, err := repo.List(globex, domain.EntityListOptions{Deleted: domain.EntityDeletedIncluded})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if got := ids(entities); !slices.Equal(got, []string{"2"}) {
+			t.Errorf("expected globex to list only its entity, got %v", got)
+		}
+		found, err := repo.FindByID(acme, "1")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if found.Name != "Test" || found.Version != 1 || found.TenantID != "acme" {
+			t.Errorf("expected the entity of acme to be unchanged, got %+v", found)
+		}
+
+		// Nor can it be restored from another tenant once in the trash.
+		if err := repo.Delete(acme, "1", 0); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := repo.Restore(globex, "1", 0); !errors.Is(err, apperror.ErrNotFound) {
+			t.Errorf("Restore: expected ErrNotFound, got %v", err)
+		}
+		if _, err := repo.Restore(acme, "1", 0); err != nil {
+			t.Errorf("expected acme to restore its entity, got %v", err)
+		}
+	})
+
+	t.Run("Create duplicate", func(t *testing.T) {
+		repo := newRepo(t)
+		mustCreate(t, repo, "1", "Test")
+
+		err := repo.Create(ctx, &domain.Entity{ID: "1", Name: "Duplicate"})
+		if !errors.Is(err, apperror.ErrConflict) {
+			t.Fatalf("expected ErrConflict, got %v", err)
+		}
+
+		found, err := repo.FindByID(ctx, "1")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if found.Name != "Test" {
+			t.Errorf("expected original entity to be kept, got %+v", found)
+		}
+	})
+
+	t.Run("FindByID missing", func(t *testing.T) {
+		repo := newRepo(t)
+
+		_, err := repo.FindByID(ctx, "missing")
+		if !errors.Is(err, apperror.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Timestamps", func(t *testing.T) {
+		repo := newRepo(t)
+		mustCreate(t, repo, "1", "Test")
+
+		created, err := repo.FindByID(ctx, "1")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if created.CreatedAt.IsZero() || created.UpdatedAt.IsZero() {
+			t.Fatalf("expected timestamps to be set, got %+v", created)
+		}
+		if !created.UpdatedAt.Equal(created.CreatedAt) {
+			t.Errorf("expected UpdatedAt to equal CreatedAt on creation, got %+v", created)
+		}
+
+		// The service only sends the ID and the new values, not the timestamps.
+		if err := repo.Update(ctx, &domain.Entity{ID: "1", Name: "Updated Test"}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		updated, err := repo.FindByID(ctx, "1")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !updated.CreatedAt.Equal(created.CreatedAt) {
+			t.Errorf("expected CreatedAt to be preserved, got %v, want %v", updated.CreatedAt, created.CreatedAt)
+		}
+		if updated.UpdatedAt.Before(created.UpdatedAt) {
+			t.Errorf("expected UpdatedAt to move forward, got %v, previous %v", updated.UpdatedAt, created.UpdatedAt)
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		repo := newRepo(t)
+		mustCreate(t, repo, "1", "Test")
+
+		if err := repo.Update(ctx, &domain.Entity{ID: "1", Name: "Updated Test"}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		found, err := repo.FindByID(ctx, "1")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if found.Name != "Updated Test" {
+			t.Errorf("expected updated name, got %s", found.Name)
+		}
+	})
+
+	t.Run("Update missing", func(t *testing.T) {
+		repo := newRepo(t)
+
+		err := repo.Update(ctx, &domain.Entity{ID: "missing", Name: "Test"})
+		if !errors.Is(err, apperror.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+
+		if _, err := repo.FindByID(ctx, "missing"); !errors.Is(err, apperror.ErrNotFound) {
+			t.Fatalf("expected Update not to create the entity, got %v", err)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		repo := newRepo(t)
+		mustCreate(t, repo, "1", "Test")
+
+		if err := repo.Delete(ctx, "1", 0); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		_, err := repo.FindByID(ctx, "1")
+		if !errors.Is(err, apperror.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Delete missing", func(t *testing.T) {
+		repo := newRepo(t)
+
+		err := repo.Delete(ctx, "missing", 0)
+		if !errors.Is(err, apperror.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Soft delete", func(t *testing.T) {
+		repo := newRepo(t)
+		mustCreate(t, repo, "1", "Test")
+		mustCreate(t, repo, "2", "Other")
+
+		if err := repo.Delete(ctx, "1", 1); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if err := repo.Update(ctx, &domain.Entity{ID: "1", Name: "Updated Test"}); !errors.Is(err, apperror.ErrNotFound) {
+			t.Errorf("expected ErrNotFound when updating a deleted entity, got %v", err)
+		}
+		if err := repo.Delete(ctx, "1", 0); !errors.Is(err, apperror.ErrNotFound) {
+			t.Errorf("expected ErrNotFound when deleting a deleted entity, got %v", err)
+		}
+
+		tests := []struct {
+			filter domain.EntityDeletedFilter
+			want   []string
+		}{
+			{domain.EntityDeletedExcluded, []string{"2"}},
+			{domain.EntityDeletedIncluded, []string{"1", "2"}},
+			{domain.EntityDeletedOnly, []string{"1"}},
+		}
+		for _, tt := range tests {
+			entities, err := repo.List(ctx, domain.EntityListOptions{SortBy: domain.EntitySortByName, Deleted: tt.filter, Descending: true})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if got := ids(entities); !slices.Equal(got, tt.want) {
+				t.Errorf("deleted filter %q: expected %v, got %v", tt.filter, tt.want, got)
+			}
+		}
+
+		trash, err := repo.List(ctx, domain.EntityListOptions{Deleted: domain.EntityDeletedOnly})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(trash) != 1 || !trash[0].IsDeleted() || trash[0].Version != 2 {
+			t.Errorf("expected the deleted entity at version 2 with DeletedAt set, got %+v", trash)
+		}
+	})
+
+	t.Run("Restore", func(t *testing.T) {
+		repo := newRepo(t)
+		mustCreate(t, repo, "1", "Test")
+
+		if _, err := repo.Restore(ctx, "1", 0); !errors.Is(err, apperror.ErrNotFound) {
+			t.Errorf("expected ErrNotFound when restoring an entity that is not deleted, got %v", err)
+		}
+		if _, err := repo.Restore(ctx, "missing", 0); !errors.Is(err, apperror.ErrNotFound) {
+			t.Errorf("expected ErrNotFound when restoring a missing entity, got %v", err)
+		}
+
+		if err := repo.Delete(ctx, "1", 0); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := repo.Restore(ctx, "1", 1); !errors.Is(err, apperror.ErrPreconditionFailed) {
+			t.Errorf("expected ErrPreconditionFailed for a stale version, got %v", err)
+		}
+
+		restored, err := repo.Restore(ctx, "1", 2)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if restored.IsDeleted() || restored.Version != 3 || restored.Name != "Test" {
+			t.Errorf("expected the restored entity at version 3, got %+v", restored)
+		}
+		assertStored(t, repo, restored)
+	})
+
+	t.Run("Purge", func(t *testing.T) {
+		repo := newRepo(t)
+		mustCreate(t, repo, "old", "Test")
+		mustCreate(t, repo, "live", "Test")
+		if err := repo.Delete(ctx, "old", 0); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		time.Sleep(time.Millisecond)
+		cutoff := time.Now()
+		mustCreate(t, repo, "recent", "Test")
+		if err := repo.Delete(ctx, "recent", 0); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		n, err := repo.Purge(ctx, cutoff)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if n != 1 {
+			t.Errorf("expected 1 purged entity, got %d", n)
+		}
+
+		entities, err := repo.List(ctx, domain.EntityListOptions{Deleted: domain.EntityDeletedIncluded, SortBy: domain.EntitySortByName})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if got := ids(entities); !slices.Equal(got, []string{"live", "recent"}) {
+			t.Errorf("expected live and recent to remain, got %v", got)
+		}
+		if _, err := repo.Restore(ctx, "old", 0); !errors.Is(err, apperror.ErrNotFound) {
+			t.Errorf("expected a purged entity not to be restorable, got %v", err)
+		}
+	})
+
+	t.Run("Batch", func(t *testing.T) {
+		repo := newRepo(t)
+		mustCreate(t, repo, "1", "Test")
+		mustCreate(t, repo, "2", "Test")
+
+		ops := []domain.EntityOperation{
+			{Kind: domain.EntityOperationCreate, Entity: &domain.Entity{ID: "3", Name: "Test"}},
+			{Kind: domain.EntityOperationUpdate, Entity: &domain.Entity{ID: "1", Name: "Updated Test", Version: 1}},
+			{Kind: domain.EntityOperationDelete, Entity: &domain.Entity{ID: "2", Version: 1}},
+		}
+		errs, err := repo.Batch(ctx, ops, true)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		for i, err := range errs {
+			if err != nil {
+				t.Errorf("expected operation %d to succeed, got %v", i, err)
+			}
+		}
+		assertStored(t, repo, ops[0].Entity)
+		assertStored(t, repo, ops[1].Entity)
+		if ops[1].Entity.Version != 2 {
+			t.Errorf("expected the updated entity at version 2, got %d", ops[1].Entity.Version)
+		}
+		if _, err := repo.FindByID(ctx, "2"); !errors.Is(err, apperror.ErrNotFound) {
+			t.Errorf("expected the deleted entity not to be found, got %v", err)
+		}
+	})
+
+	t.Run("Batch atomic rollback", func(t *testing.T) {
+		repo := newRepo(t)
+		mustCreate(t, repo, "1", "Test")
+		mustCreate(t, repo, "2", "Test")
+
+		errs, err := repo.Batch(ctx, []domain.EntityOperation{
+			{Kind: domain.EntityOperationCreate, Entity: &domain.Entity{ID: "3", Name: "Test"}},
+			{Kind: domain.EntityOperationUpdate, Entity: &domain.Entity{ID: "1", Name: "Updated Test"}},
+			{Kind: domain.EntityOperationDelete, Entity: &domain.Entity{ID: "2"}},
+			{Kind: domain.EntityOperationUpdate, Entity: &domain.Entity{ID: "missing", Name: "Test"}},
+			{Kind: domain.EntityOperationCreate, Entity: &domain.Entity{ID: "4", Name: "Test"}},
+		}, true)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		for i, err := range errs {
+			want := apperror.ErrAborted
+			if i == 3 {
+				want = apperror.ErrNotFound
+			}
+			if !errors.Is(err, want) {
+				t.Errorf("expected %v for operation %d, got %v", want, i, err)
+			}
+		}
+
+		entities, err := repo.List(ctx, domain.EntityListOptions{Deleted: domain.EntityDeletedIncluded, SortBy: domain.EntitySortByName})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(entities) != 2 {
+			t.Fatalf("expected only the 2 original entities, got %+v", entities)
+		}
+		for _, e := range entities {
+			if e.Name != "Test" || e.Version != 1 || e.IsDeleted() {
+				t.Errorf("expected entity %s to be unchanged, got %+v", e.ID, e)
+			}
+		}
+	})
+
+	t.Run("Batch best effort", func(t *testing.T) {
+		repo := newRepo(t)
+		mustCreate(t, repo, "1", "Test")
+
+		errs, err := repo.Batch(ctx, []domain.EntityOperation{
+			{Kind: domain.EntityOperationCreate, Entity: &domain.Entity{ID: "1", Name: "Test"}},
+			{Kind: domain.EntityOperationCreate, Entity: &domain.Entity{ID: "2", Name: "Test"}},
+			{Kind: domain.EntityOperationDelete, Entity: &domain.Entity{ID: "1", Version: 5}},
+		}, false)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !errors.Is(errs[0], apperror.ErrConflict) || errs[1] != nil || !errors.Is(errs[2], apperror.ErrPreconditionFailed) {
+			t.Errorf("expected ErrConflict, nil and ErrPreconditionFailed, got %v", errs)
+		}
+		if _, err := repo.FindByID(ctx, "2"); err != nil {
+			t.Errorf("expected the created entity to be stored, got %v", err)
+		}
+		if _, err := repo.FindByID(ctx, "1"); err != nil {
+			t.Errorf("expected entity 1 not to be deleted, got %v", err)
+		}
+	})
+
+	t.Run("Versioning", func(t *testing.T) {
+		repo := newRepo(t)
+		mustCreate(t, repo, "1", "Test")
+
+		found, err := repo.FindByID(ctx, "1")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if found.Version != 1 {
+			t.Fatalf("expected version 1 after Create, got %d", found.Version)
+		}
+
+		entity := &domain.Entity{ID: "1", Name: "Updated Test", Version: 1}
+		if err := repo.Update(ctx, entity); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if entity.Version != 2 {
+			t.Errorf("expected Update to report version 2, got %d", entity.Version)
+		}
+
+		// Version 1 is now stale.
+		err = repo.Update(ctx, &domain.Entity{ID: "1", Name: "Stale", Version: 1})
+		if !errors.Is(err, apperror.ErrPreconditionFailed) {
+			t.Fatalf("expected ErrPreconditionFailed, got %v", err)
+		}
+		err = repo.Delete(ctx, "1", 1)
+		if !errors.Is(err, apperror.ErrPreconditionFailed) {
+			t.Fatalf("expected ErrPreconditionFailed, got %v", err)
+		}
+
+		found, err = repo.FindByID(ctx, "1")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if found.Name != "Updated Test" || found.Version != 2 {
+			t.Errorf("expected stale writes to be rejected, got %+v", found)
+		}
+
+		// A zero version skips the check.
+		entity = &domain.Entity{ID: "1", Name: "Unconditional"}
+		if err := repo.Update(ctx, entity); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if entity.Version != 3 {
+			t.Errorf("expected Update to report version 3, got %d", entity.Version)
+		}
+
+		if err := repo.Delete(ctx, "1", 3); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := repo.Delete(ctx, "1", 3); !errors.Is(err, apperror.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		repo := newRepo(t)
+
+		entities, err := repo.List(ctx, domain.EntityListOptions{})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if entities == nil || len(entities) != 0 {
+			t.Errorf("expected an empty, non-nil list, got %v", entities)
+		}
+
+		mustCreate(t, repo, "1", "First")
+		mustCreate(t, repo, "2", "Second")
+
+		entities, err = repo.List(ctx, domain.EntityListOptions{})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		names := make(map[string]string, len(entities))
+		for _, e := range entities {
+			names[e.ID] = e.Name
+		}
+		if len(entities) != 2 || names["1"] != "First" || names["2"] != "Second" {
+			t.Errorf("expected entities 1 and 2, got %v", names)
+		}
+	})
+
+	t.Run("List sorting", func(t *testing.T) {
+		repo := newRepo(t)
+		mustCreateSequence(t, repo, []string{"1", "Charlie"}, []string{"2", "Alpha"}, []string{"3", "Bravo"})
+
+		time.Sleep(time.Millisecond)
+		if err := repo.Update(ctx, &domain.Entity{ID: "2", Name: "Alpha"}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		tests := []struct {
+			sortBy     domain.EntitySortField
+			descending bool
+			want       []string
+		}{
+			{"", false, []string{"1", "2", "3"}},
+			{domain.EntitySortByCreatedAt, false, []string{"1", "2", "3"}},
+			{domain.EntitySortByCreatedAt, true, []string{"3", "2", "1"}},
+			{domain.EntitySortByUpdatedAt, false, []string{"1", "3", "2"}},
+			{domain.EntitySortByUpdatedAt, true, []string{"2", "3", "1"}},
+			{domain.EntitySortByName, false, []string{"2", "3", "1"}},
+			{domain.EntitySortByName, true, []string{"1", "3", "2"}},
+		}
+		for _, tt := range tests {
+			entities, err := repo.List(ctx, domain.EntityListOptions{SortBy: tt.sortBy, Descending: tt.descending})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if got := ids(entities); !slices.Equal(got, tt.want) {
+				t.Errorf("sort %q descending=%v: expected %v, got %v", tt.sortBy, tt.descending, tt.want, got)
+			}
+		}
+	})
+
+	t.Run("List filtering", func(t *testing.T) {
+		repo := newRepo(t)
+		mustCreateSequence(t, repo, []string{"1", "Alpha"}, []string{"2", "Alphabet"}, []string{"3", "Bravo"})
+
+		if err := repo.Create(ctx, &domain.Entity{ID: "4", Name: "Charlie", OwnerID: "alice"}); err != nil {
+			t.Fatalf("failed to create entity 4: %v", err)
+		}
+
+		first, err := repo.FindByID(ctx, "1")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		tests := []struct {
+			name string
+			opts domain.EntityListOptions
+			want []string
+		}{
+			{"name prefix", domain.EntityListOptions{NamePrefix: "Alpha"}, []string{"1", "2"}},
+			{"name prefix is case-sensitive", domain.EntityListOptions{NamePrefix: "alpha"}, []string{}},
+			{"created after", domain.EntityListOptions{CreatedAfter: first.CreatedAt}, []string{"2", "3", "4"}},
+			{"owner", domain.EntityListOptions{OwnerID: "alice"}, []string{"4"}},
+			{"combined", domain.EntityListOptions{NamePrefix: "Alpha", CreatedAfter: first.CreatedAt}, []string{"2"}},
+		}
+		for _, tt := range tests {
+			entities, err := repo.List(ctx, tt.opts)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if got := ids(entities); !slices.Equal(got, tt.want) {
+				t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+			}
+		}
+	})
+
+	t.Run("List pagination", func(t *testing.T) {
+		repo := newRepo(t)
+		for _, id := range []string{"1", "2", "3", "4", "5"} {
+			mustCreate(t, repo, id, "Test")
+		}
+
+		for _, descending := range []bool{false, true} {
+			opts := domain.EntityListOptions{Limit: 2, SortBy: domain.EntitySortByName, Descending: descending}
+			var got []string
+			for range 5 {
+				entities, err := repo.List(ctx, opts)
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				if len(entities) > opts.Limit {
+					t.Fatalf("expected at most %d entities, got %d", opts.Limit, len(entities))
+				}
+				if len(entities) == 0 {
+					break
+				}
+				got = append(got, ids(entities)...)
+				last := entities[len(entities)-1]
+				opts.After = &domain.EntityCursor{ID: last.ID, Name: last.Name, CreatedAt: last.CreatedAt, UpdatedAt: last.UpdatedAt}
+			}
+
+			want := []string{"1", "2", "3", "4", "5"}
+			if descending {
+				slices.Reverse(want)
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("descending=%v: expected %v, got %v", descending, want, got)
+			}
+		}
+	})
+
+	t.Run("Returned entities are copies", func(t *testing.T) {
+		repo := newRepo(t)
+		entity := &domain.Entity{ID: "1", Name: "Test"}
+		if err := repo.Create(ctx, entity); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		entity.Name = "Changed after Create"
+
+		found, err := repo.FindByID(ctx, "1")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		found.Name = "Changed after FindByID"
+
+		found, err = repo.FindByID(ctx, "1")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if found.Name != "Test" {
+			t.Errorf("expected stored entity to be unaffected by caller changes, got %s", found.Name)
+		}
+	})
+
+	t.Run("Concurrent access", func(t *testing.T) {
+		repo := newRepo(t)
+		const workers = 8
+
+		var wg sync.WaitGroup
+		errs := make(chan error, workers)
+		for i := range workers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- exercise(ctx, repo, fmt.Sprintf("worker-%d", i))
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			if err != nil {
+				t.Error(err)
+			}
+		}
+
+		entities, err := repo.List(ctx, domain.EntityListOptions{})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(entities) != workers {
+			t.Errorf("expected %d entities, got %d", workers, len(entities))
+		}
+	})
+}
+
+// mustCreate stores an entity, failing the test on error.
+func mustCreate(t *testing.T, repo service.EntityRepository, id, name string) {
+	t.Helper()
+
+	if err := repo.Create(context.Background(), &domain.Entity{ID: id, Name: name}); err != nil {
+		t.Fatalf("failed to create entity %s: %v", id, err)
+	}
+}
+
+// assertStored checks that entity matches the stored entity with the same ID.
+func assertStored(t *testing.T, repo service.EntityRepository, entity *domain.Entity) {
+	t.Helper()
+
+	stored, err := repo.FindByID(context.Background(), entity.ID)
+	if err != nil {
+		t.Fatalf("failed to find entity %s: %v", entity.ID, err)
+	}
+	if entity.Name != stored.Name || entity.Version != stored.Version ||
+		!entity.CreatedAt.Equal(stored.CreatedAt) || !entity.UpdatedAt.Equal(stored.UpdatedAt) {
+		t.Errorf("expected %+v to match the stored entity %+v", entity, stored)
+	}
+}
+
+// mustCreateSequence stores {id, name} pairs in order, making sure each one
+// gets a later creation time than the previous one.
+func mustCreateSequence(t *testing.T, repo service.EntityRepository, entities ...[]string) {
+	t.Helper()
+
+	for _, e := range entities {
+		mustCreate(t, repo, e[0], e[1])
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// ids returns the IDs of the given entities, in order.
+func ids(entities []*domain.Entity) []string {
+	result := make([]string, len(entities))
+	for i, e := range entities {
+		result[i] = e.ID
+	}
+	return result
+}
+
+// exercise runs every repository method against its own entity,
+// leaving a single entity with the given id behind.
+func exercise(ctx context.Context, repo service.EntityRepository, id string) error {
+	if err := repo.Create(ctx, &domain.Entity{ID: id, Name: "Test"}); err != nil {
+		return fmt.Errorf("create %s: %w", id, err)
+	}
+	if err := repo.Create(ctx, &domain.Entity{ID: id + "-tmp", Name: "Test"}); err != nil {
+		return fmt.Errorf("create %s-tmp: %w", id, err)
+	}
+	if err := repo.Update(ctx, &domain.Entity{ID: id, Name: "Updated Test"}); err != nil {
+		return fmt.Errorf("update %s: %w", id, err)
+	}
+	if _, err := repo.FindByID(ctx, id); err != nil {
+		return fmt.Errorf("find %s: %w", id, err)
+	}
+	if _, err := repo.List(ctx, domain.EntityListOptions{}); err != nil {
+		return fmt.Errorf("list: %w", err)
+	}
+	if err := repo.Delete(ctx, id+"-tmp", 0); err != nil {
+		return fmt.Errorf("delete %s-tmp: %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package repositorytest
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/service"
+)
+
+// OutboxRepositoryFactory returns a new, empty outbox.
+// It is called once per subtest, so each one starts from a clean state.
+type OutboxRepositoryFactory func(t *testing.T) service.OutboxRepository
+
+// RunOutboxRepositorySuite verifies that the outboxes built by newRepo honor
+// the service.OutboxRepository contract.
+func RunOutboxRepositorySuite(t *testing.T, newRepo OutboxRepositoryFactory) {
+	ctx := context.Background()
+
+	t.Run("Add and Pending", func(t *testing.T) {
+		repo := newRepo(t)
+		added := newMessage("m1")
+		added.TenantID = "acme"
+		added.OwnerID = "alice"
+		mustAddMessages(t, repo, "m0")
+		if err := repo.Add(ctx, []*domain.EventMessage{added}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		pending, err := repo.Pending(ctx, 10)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(pending) != 2 {
+			t.Fatalf("expected 2 pending messages, got %d", len(pending))
+		}
+		got := pending[1]
+		if got.ID != added.ID || got.Type != added.Type || got.EntityID != added.EntityID || got.TenantID != added.TenantID || got.OwnerID != added.OwnerID ||
+			!got.OccurredAt.Equal(added.OccurredAt) || string(got.Payload) != string(added.Payload) {
+			t.Errorf("expected %+v, got %+v", added, got)
+		}
+	})
+
+	t.Run("Pending order and limit", func(t *testing.T) {
+		repo := newRepo(t)
+		// IDs that do not sort in the order they are added.
+		mustAddMessages(t, repo, "c", "a", "b")
+
+		assertPending(t, repo, "c", "a", "b")
+		pending, err := repo.Pending(ctx, 2)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if got := messageIDs(pending); !slices.Equal(got, []string{"c", "a"}) {
+			t.Errorf("expected the 2 oldest messages, got %v", got)
+		}
+	})
+
+	t.Run("MarkPublished", func(t *testing.T) {
+		repo := newRepo(t)
+		mustAddMessages(t, repo, "m1", "m2", "m3")
+
+		if err := repo.MarkPublished(ctx, []string{"m1", "m3", "unknown"}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		assertPending(t, repo, "m2")
+
+		if err := repo.MarkPublished(ctx, nil); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		assertPending(t, repo, "m2")
+	})
+}
+
+// newMessage returns an entity.created message with the given ID.
+func newMessage(id string) *domain.EventMessage {
+	return &domain.EventMessage{
+		ID:         id,
+		Type:       domain.EventEntityCreated,
+		EntityID:   "entity-" + id,
+		OccurredAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Payload:    []byte(`{"id":"entity-` + id + `"}`),
+	}
+}
+
+// mustAddMessages adds messages with the given IDs to the outbox, one at a time.
+func mustAddMessages(t *testing.T, repo service.OutboxRepository, ids ...string) {
+	t.Helper()
+
+	for _, id := range ids {
+		if err := repo.Add(context.Background(), []*domain.EventMessage{newMessage(id)}); err != nil {
+			t.Fatalf("failed to add message %s: %v", id, err)
+		}
+	}
+}
+
+// assertPending checks that the outbox holds the messages with the given IDs, in order.
+func assertPending(t *testing.T, repo service.OutboxRepository, ids ...string) {
+	t.Helper()
+
+	pending, err := repo.Pending(context.Background(), 100)
+	if err != nil {
+		t.Fatalf("failed to read pending messages: %v", err)
+	}
+	if got := messageIDs(pending); !slices.Equal(got, ids) {
+		t.Errorf("expected pending messages %v, got %v", ids, got)
+	}
+}
+
+// messageIDs returns the IDs of the given messages, in order.
+func messageIDs(messages []*domain.EventMessage) []string {
+	ids := make([]string, len(messages))
+	for i, m := range messages {
+		ids[i] = m.ID
+	}
+	return ids
+}
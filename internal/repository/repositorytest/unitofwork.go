@@ -0,0 +1,288 @@
+package repositorytest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/apperror"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/service"
+)
+
+// UnitOfWorkFactory returns a new unit of work and the repositories of the
+// same, empty store, outside of any unit of work. It is called once per
+// subtest, so each one starts from a clean state.
+type UnitOfWorkFactory func(t *testing.T) (service.UnitOfWork, service.Repositories)
+
+// errRollback is returned by units of work that must be rolled back.
+var errRollback = errors.New("rollback")
+
+// RunUnitOfWorkSuite verifies that the units of work built by newUoW honor the
+// service.UnitOfWork contract.
+func RunUnitOfWorkSuite(t *testing.T, newUoW UnitOfWorkFactory) {
+	ctx := context.Background()
+
+	t.Run("Commit", func(t *testing.T) {
+		uow, stores := newUoW(t)
+		repo := stores.Entities
+		mustCreate(t, repo, "1", "Test")
+		mustAddAuditEntries(t, stores.Audit, newAuditEntry("a1", "1"))
+
+		err := uow.Do(ctx, func(repos service.Repositories) error {
+			if err := repos.Entities.Create(ctx, &domain.Entity{ID: "2", Name: "Test"}); err != nil {
+				return err
+			}
+			if err := repos.Audit.Add(ctx, []*domain.AuditEntry{newAuditEntry("a2", "1")}); err != nil {
+				return err
+			}
+			if err := repos.Entities.Update(ctx, &domain.Entity{ID: "1", Name: "Updated Test"}); err != nil {
+				return err
+			}
+
+			// Reads inside the unit of work see its own writes.
+			found, err := repos.Entities.FindByID(ctx, "1")
+			if err != nil {
+				return err
+			}
+			if found.Name != "Updated Test" {
+				t.Errorf("expected the updated name, got %q", found.Name)
+			}
+			entities, err := repos.Entities.List(ctx, domain.EntityListOptions{})
+			if err != nil {
+				return err
+			}
+			if len(entities) != 2 {
+				t.Errorf("expected 2 entities, got %d", len(entities))
+			}
+			assertAuditEntries(t, repos.Audit, "1", "a1", "a2")
+			return repos.Outbox.Add(ctx, []*domain.EventMessage{newMessage("m1")})
+		})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if _, err := repo.FindByID(ctx, "2"); err != nil {
+			t.Errorf("expected the created entity to be committed, got %v", err)
+		}
+		found, err := repo.FindByID(ctx, "1")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if found.Name != "Updated Test" || found.Version != 2 {
+			t.Errorf("expected the update to be committed, got %+v", found)
+		}
+		assertPending(t, stores.Outbox, "m1")
+		assertAuditEntries(t, stores.Audit, "1", "a1", "a2")
+	})
+
+	t.Run("Lock", func(t *testing.T) {
+		uow, stores := newUoW(t)
+		mustCreate(t, stores.Entities, "1", "Test")
+
+		// Existing and missing entities are locked up front, then reached.
+		err := uow.Do(ctx, func(repos service.Repositories) error {
+			if err := repos.Entities.Lock(ctx, "2", "1"); err != nil {
+				return err
+			}
+			if _, err := repos.Entities.FindByID(ctx, "1"); err != nil {
+				return err
+			}
+			if err := repos.Entities.Delete(ctx, "1", 0); err != nil {
+				return err
+			}
+			return repos.Entities.Create(ctx, &domain.Entity{ID: "2", Name: "Test"})
+		})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := stores.Entities.FindByID(ctx, "2"); err != nil {
+			t.Errorf("expected the created entity to be committed, got %v", err)
+		}
+		if err := stores.Entities.Lock(ctx, "1"); err != nil {
+			t.Errorf("expected no error outside a unit of work, got %v", err)
+		}
+	})
+
+	t.Run("Rollback on error", func(t *testing.T) {
+		uow, stores := newUoW(t)
+		repo := stores.Entities
+		mustAddMessages(t, stores.Outbox, "m1")
+		mustCreate(t, repo, "1", "Test")
+		mustCreate(t, repo, "2", "Test")
+		mustCreate(t, repo, "3", "Test")
+		if err := repo.Delete(ctx, "3", 0); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		before, err := repo.List(ctx, domain.EntityListOptions{Deleted: domain.EntityDeletedIncluded})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		err = uow.Do(ctx, func(repos service.Repositories) error {
+			if err := repos.Entities.Create(ctx, &domain.Entity{ID: "4", Name: "Test"}); err != nil {
+				return err
+			}
+			if err := repos.Entities.Update(ctx, &domain.Entity{ID: "1", Name: "Updated Test"}); err != nil {
+				return err
+			}
+			if err := repos.Entities.Delete(ctx, "2", 0); err != nil {
+				return err
+			}
+			if _, err := repos.Entities.Restore(ctx, "3", 0); err != nil {
+				return err
+			}
+			if err := repos.Outbox.Add(ctx, []*domain.EventMessage{newMessage("m2")}); err != nil {
+				return err
+			}
+			if err := repos.Outbox.MarkPublished(ctx, []string{"m1"}); err != nil {
+				return err
+			}
+			if err := repos.Audit.Add(ctx, []*domain.AuditEntry{newAuditEntry("a1", "1")}); err != nil {
+				return err
+			}
+			return errRollback
+		})
+		if !errors.Is(err, errRollback) {
+			t.Fatalf("expected the error of the unit of work, got %v", err)
+		}
+
+		after, err := repo.List(ctx, domain.EntityListOptions{Deleted: domain.EntityDeletedIncluded})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(after) != len(before) {
+			t.Fatalf("expected %d entities after the rollback, got %d", len(before), len(after))
+		}
+		for i := range before {
+			if *after[i] != *before[i] {
+				t.Errorf("expected %+v to be unchanged, got %+v", before[i], after[i])
+			}
+		}
+		assertPending(t, stores.Outbox, "m1")
+		assertAuditEntries(t, stores.Audit, "1")
+	})
+
+	t.Run("Rollback on panic", func(t *testing.T) {
+		uow, stores := newUoW(t)
+		repo := stores.Entities
+
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected the panic to be propagated")
+				}
+			}()
+			_ = uow.Do(ctx, func(repos service.Repositories) error {
+				if err := repos.Entities.Create(ctx, &domain.Entity{ID: "1", Name: "Test"}); err != nil {
+					return err
+				}
+				panic("unit of work failed")
+			})
+		}()
+
+		if _, err := repo.FindByID(ctx, "1"); !errors.Is(err, apperror.ErrNotFound) {
+			t.Errorf("expected the created entity to be rolled back, got %v", err)
+		}
+	})
+
+	t.Run("Atomic batch rolls back on its own", func(t *testing.T) {
+		uow, stores := newUoW(t)
+		repo := stores.Entities
+
+		err := uow.Do(ctx, func(repos service.Repositories) error {
+			if err := repos.Entities.Create(ctx, &domain.Entity{ID: "1", Name: "Test"}); err != nil {
+				return err
+			}
+			errs, err := repos.Entities.Batch(ctx, []domain.EntityOperation{
+				{Kind: domain.EntityOperationCreate, Entity: &domain.Entity{ID: "2", Name: "Test"}},
+				{Kind: domain.EntityOperationCreate, Entity: &domain.Entity{ID: "1", Name: "Test"}},
+			}, true)
+			if err != nil {
+				return err
+			}
+			if !errors.Is(errs[0], apperror.ErrAborted) || !errors.Is(errs[1], apperror.ErrConflict) {
+				t.Errorf("expected ErrAborted and ErrConflict, got %v", errs)
+			}
+
+			// The unit of work goes on after the failed batch.
+			_, err = repos.Entities.FindByID(ctx, "1")
+			return err
+		})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if _, err := repo.FindByID(ctx, "1"); err != nil {
+			t.Errorf("expected the entity created before the batch to be committed, got %v", err)
+		}
+		if _, err := repo.FindByID(ctx, "2"); !errors.Is(err, apperror.ErrNotFound) {
+			t.Errorf("expected the batch to be rolled back, got %v", err)
+		}
+	})
+
+	t.Run("Best-effort batch keeps the unit of work going", func(t *testing.T) {
+		uow, stores := newUoW(t)
+		mustCreate(t, stores.Entities, "1", "Test")
+
+		err := uow.Do(ctx, func(repos service.Repositories) error {
+			errs, err := repos.Entities.Batch(ctx, []domain.EntityOperation{
+				{Kind: domain.EntityOperationCreate, Entity: &domain.Entity{ID: "1", Name: "Test"}},
+				{Kind: domain.EntityOperationCreate, Entity: &domain.Entity{ID: "2", Name: "Test"}},
+			}, false)
+			if err != nil {
+				return err
+			}
+			if !errors.Is(errs[0], apperror.ErrConflict) || errs[1] != nil {
+				t.Errorf("expected ErrConflict and nil, got %v", errs)
+			}
+			return repos.Outbox.Add(ctx, []*domain.EventMessage{newMessage("m1")})
+		})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if _, err := stores.Entities.FindByID(ctx, "2"); err != nil {
+			t.Errorf("expected the created entity to be committed, got %v", err)
+		}
+		assertPending(t, stores.Outbox, "m1")
+	})
+	t.Run("Tenant isolation", func(t *testing.T) {
+		uow, stores := newUoW(t)
+		acme := service.WithTenant(ctx, "acme")
+		globex := service.WithTenant(ctx, "globex")
+		if err := stores.Entities.Create(acme, &domain.Entity{ID: "1", Name: "Test"}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		err := uow.Do(globex, func(repos service.Repositories) error {
+			if _, err := repos.Entities.FindByID(globex, "1"); !errors.Is(err, apperror.ErrNotFound) {
+				t.Errorf("FindByID: expected ErrNotFound, got %v", err)
+			}
+			if err := repos.Entities.Update(globex, &domain.Entity{ID: "1", Name: "Hijacked"}); !errors.Is(err, apperror.ErrNotFound) {
+				t.Errorf("Update: expected ErrNotFound, got %v", err)
+			}
+			if err := repos.Entities.Delete(globex, "1", 0); !errors.Is(err, apperror.ErrNotFound) {
+				t.Errorf("Delete: expected ErrNotFound, got %v", err)
+			}
+			entities, err := repos.Entities.List(globex, domain.EntityListOptions{})
+			if err != nil {
+				return err
+			}
+			if len(entities) != 0 {
+				t.Errorf("expected no entities, got %v", ids(entities))
+			}
+			return repos.Entities.Create(globex, &domain.Entity{ID: "2", Name: "Test"})
+		})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if _, err := stores.Entities.FindByID(globex, "2"); err != nil {
+			t.Errorf("expected the entity of globex to be committed in globex, got %v", err)
+		}
+		if _, err := stores.Entities.FindByID(acme, "2"); !errors.Is(err, apperror.ErrNotFound) {
+			t.Errorf("expected the entity of globex not to be found in acme, got %v", err)
+		}
+	})
+}
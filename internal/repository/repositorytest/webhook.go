@@ -0,0 +1,261 @@
+package repositorytest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/apperror"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/service"
+)
+
+// WebhookRepositoryFactory returns a new, empty webhook repository.
+// It is called once per subtest, so each one starts from a clean state.
+type WebhookRepositoryFactory func(t *testing.T) service.WebhookRepository
+
+// RunWebhookRepositorySuite verifies that the repositories built by newRepo
+// honor the service.WebhookRepository contract.
+func RunWebhookRepositorySuite(t *testing.T, newRepo WebhookRepositoryFactory) {
+	ctx := context.Background()
+
+	t.Run("Create and FindByID", func(t *testing.T) {
+		repo := newRepo(t)
+		webhook := &domain.Webhook{
+			ID:         "w1",
+			URL:        "https://example.com/hooks",
+			EventTypes: []domain.EventType{domain.EventEntityCreated, domain.EventEntityDeleted},
+			Secret:     "secret",
+			TenantID:   "acme",
+			OwnerID:    "alice",
+			OwnerRoles: []domain.Role{domain.RoleEditor},
+			CreatedAt:  time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		}
+		if err := repo.Create(ctx, webhook); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		found, err := repo.FindByID(ctx, "w1")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if found.URL != webhook.URL || found.Secret != webhook.Secret || !found.CreatedAt.Equal(webhook.CreatedAt) ||
+			!slices.Equal(found.EventTypes, webhook.EventTypes) || found.TenantID != webhook.TenantID ||
+			found.OwnerID != webhook.OwnerID || !slices.Equal(found.OwnerRoles, webhook.OwnerRoles) {
+			t.Errorf("expected %+v, got %+v", webhook, found)
+		}
+
+		if err := repo.Create(ctx, webhook); !errors.Is(err, apperror.ErrConflict) {
+			t.Errorf("expected ErrConflict for a duplicate ID, got %v", err)
+		}
+		if _, err := repo.FindByID(ctx, "unknown"); !errors.Is(err, apperror.ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		repo := newRepo(t)
+		for _, id := range []string{"c", "a", "b"} {
+			if err := repo.Create(ctx, &domain.Webhook{ID: id, URL: "https://example.com"}); err != nil {
+				t.Fatalf("failed to create webhook %s: %v", id, err)
+			}
+		}
+
+		webhooks, err := repo.List(ctx)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		ids := make([]string, len(webhooks))
+		for i, w := range webhooks {
+			ids[i] = w.ID
+		}
+		if !slices.Equal(ids, []string{"c", "a", "b"}) {
+			t.Errorf("expected the webhooks in creation order, got %v", ids)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		repo := newRepo(t)
+		if err := repo.Create(ctx, &domain.Webhook{ID: "w1", URL: "https://example.com"}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if err := repo.Delete(ctx, "w1"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := repo.FindByID(ctx, "w1"); !errors.Is(err, apperror.ErrNotFound) {
+			t.Errorf("expected ErrNotFound after delete, got %v", err)
+		}
+		if err := repo.Delete(ctx, "w1"); !errors.Is(err, apperror.ErrNotFound) {
+			t.Errorf("expected ErrNotFound for a deleted webhook, got %v", err)
+		}
+	})
+}
+
+// DeliveryRepositoryFactory returns a new, empty delivery repository.
+// It is called once per subtest, so each one starts from a clean state.
+type DeliveryRepositoryFactory func(t *testing.T) service.DeliveryRepository
+
+// RunDeliveryRepositorySuite verifies that the repositories built by newRepo
+// honor the service.DeliveryRepository contract.
+func RunDeliveryRepositorySuite(t *testing.T, newRepo DeliveryRepositoryFactory) {
+	ctx := context.Background()
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	t.Run("Add and FindByID", func(t *testing.T) {
+		repo := newRepo(t)
+		delivery := newDelivery("d1", "w1", start)
+		mustAddDeliveries(t, repo, delivery)
+
+		found, err := repo.FindByID(ctx, "d1")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if found.WebhookID != "w1" || found.Status != domain.DeliveryPending || found.Event.ID != delivery.Event.ID ||
+			string(found.Event.Payload) != string(delivery.Event.Payload) || !found.NextAttemptAt.Equal(start) {
+			t.Errorf("expected %+v, got %+v", delivery, found)
+		}
+
+		// Adding a stored delivery again keeps the stored one.
+		again := newDelivery("d1", "w2", start)
+		mustAddDeliveries(t, repo, again)
+		found, err = repo.FindByID(ctx, "d1")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if found.WebhookID != "w1" {
+			t.Errorf("expected the stored delivery to be kept, got %+v", found)
+		}
+
+		if _, err := repo.FindByID(ctx, "unknown"); !errors.Is(err, apperror.ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		repo := newRepo(t)
+		delivery := newDelivery("d1", "w1", start)
+		mustAddDeliveries(t, repo, delivery)
+
+		delivery.Status = domain.DeliverySucceeded
+		delivery.Attempts = []domain.DeliveryAttempt{
+			{At: start, Duration: time.Second, StatusCode: 500, Error: "status 500"},
+			{At: start.Add(time.Minute), Duration: time.Second, StatusCode: 204},
+		}
+		if err := repo.Update(ctx, delivery); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		found, err := repo.FindByID(ctx, "d1")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if found.Status != domain.DeliverySucceeded || len(found.Attempts) != 2 || found.Attempts[0].Error != "status 500" ||
+			found.Attempts[1].StatusCode != 204 {
+			t.Errorf("expected the updated delivery, got %+v", found)
+		}
+
+		if err := repo.Update(ctx, newDelivery("unknown", "w1", start)); !errors.Is(err, apperror.ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Due", func(t *testing.T) {
+		repo := newRepo(t)
+		later := newDelivery("later", "w1", start.Add(time.Hour))
+		dead := newDelivery("dead", "w1", start)
+		dead.Status = domain.DeliveryDead
+		mustAddDeliveries(t, repo,
+			newDelivery("second", "w1", start.Add(time.Minute)),
+			newDelivery("first", "w1", start),
+			later, dead)
+
+		due, err := repo.Due(ctx, start.Add(time.Minute), 10)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if got := deliveryIDs(due); !slices.Equal(got, []string{"first", "second"}) {
+			t.Errorf("expected the due pending deliveries, earliest first, got %v", got)
+		}
+
+		due, err = repo.Due(ctx, start.Add(time.Hour), 1)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if got := deliveryIDs(due); !slices.Equal(got, []string{"first"}) {
+			t.Errorf("expected the limit to apply, got %v", got)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		repo := newRepo(t)
+		old := newDelivery("old", "w1", start)
+		dead := newDelivery("dead", "w1", start)
+		dead.Status = domain.DeliveryDead
+		dead.CreatedAt = start.Add(time.Minute)
+		other := newDelivery("other", "w2", start)
+		other.Status = domain.DeliveryDead
+		other.CreatedAt = start.Add(2 * time.Minute)
+		tenant := newDelivery("tenant", "w3", start)
+		tenant.Event.TenantID = "acme"
+		mustAddDeliveries(t, repo, old, dead, other, tenant)
+
+		tests := []struct {
+			name string
+			opts domain.DeliveryListOptions
+			want []string
+		}{
+			{"all", domain.DeliveryListOptions{Limit: 10}, []string{"other", "dead", "old"}},
+			{"by webhook", domain.DeliveryListOptions{WebhookID: "w1", Limit: 10}, []string{"dead", "old"}},
+			{"by status", domain.DeliveryListOptions{Status: domain.DeliveryDead, Limit: 10}, []string{"other", "dead"}},
+			{"by webhook and status", domain.DeliveryListOptions{WebhookID: "w1", Status: domain.DeliveryDead, Limit: 10}, []string{"dead"}},
+			{"limit", domain.DeliveryListOptions{Limit: 1}, []string{"other"}},
+			{"by tenant", domain.DeliveryListOptions{TenantID: "acme", Limit: 10}, []string{"tenant"}},
+		}
+		for _, tt := range tests {
+			deliveries, err := repo.List(ctx, tt.opts)
+			if err != nil {
+				t.Fatalf("%s: expected no error, got %v", tt.name, err)
+			}
+			if got := deliveryIDs(deliveries); !slices.Equal(got, tt.want) {
+				t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+			}
+		}
+	})
+}
+
+// newDelivery returns a pending delivery of an entity.created event to
+// webhookID, created and due at the given time.
+func newDelivery(id, webhookID string, at time.Time) *domain.WebhookDelivery {
+	return &domain.WebhookDelivery{
+		ID:            id,
+		WebhookID:     webhookID,
+		Event:         *newMessage("m-" + id),
+		Status:        domain.DeliveryPending,
+		NextAttemptAt: at,
+		CreatedAt:     at,
+		UpdatedAt:     at,
+	}
+}
+
+// mustAddDeliveries adds deliveries to the repository, one at a time.
+func mustAddDeliveries(t *testing.T, repo service.DeliveryRepository, deliveries ...*domain.WebhookDelivery) {
+	t.Helper()
+
+	for _, d := range deliveries {
+		if err := repo.Add(context.Background(), []*domain.WebhookDelivery{d}); err != nil {
+			t.Fatalf("failed to add delivery %s: %v", d.ID, err)
+		}
+	}
+}
+
+// deliveryIDs returns the IDs of the given deliveries, in order.
+func deliveryIDs(deliveries []*domain.WebhookDelivery) []string {
+	ids := make([]string, len(deliveries))
+	for i, d := range deliveries {
+		ids[i] = d.ID
+	}
+	return ids
+}
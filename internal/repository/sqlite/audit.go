@@ -0,0 +1,121 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/service"
+)
+
+// AuditRepository is a SQLite implementation of the service.AuditRepository interface.
+// Entries are read back in the order of the seq column.
+type AuditRepository struct {
+	db querier // The database, or the transaction of a unit of work.
+}
+
+// NewAuditRepository creates a new AuditRepository backed by the given database handle.
+// The schema is expected to be in place; see Migrate.
+func NewAuditRepository(db *sql.DB) service.AuditRepository {
+	return &AuditRepository{
+		db: db,
+	}
+}
+
+// Add inserts entries into the audit log. The entities before and after the
+// change are stored as JSON; the changes are not stored, since they are
+// computed from them.
+func (r *AuditRepository) Add(ctx context.Context, entries []*domain.AuditEntry) error {
+	for _, e := range entries {
+		before, err := marshalAuditEntity(e.Before)
+		if err != nil {
+			return err
+		}
+		after, err := marshalAuditEntity(e.After)
+		if err != nil {
+			return err
+		}
+		_, err = r.db.ExecContext(ctx,
+			`INSERT INTO audit_log (id, entity_id, action, principal, request_id, occurred_at, before_state, after_state)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			e.ID, e.EntityID, string(e.Action), e.Principal, e.RequestID, toUnixNano(e.OccurredAt), before, after,
+		)
+		if err != nil {
+			return translateError(err)
+		}
+	}
+	return nil
+}
+
+// List returns the entries of an entity, after the cursor. An unknown cursor
+// matches no entry, so nothing is listed after it.
+func (r *AuditRepository) List(ctx context.Context, opts domain.AuditListOptions) ([]*domain.AuditEntry, error) {
+	query := `SELECT id, entity_id, action, principal, request_id, occurred_at, before_state, after_state
+		FROM audit_log WHERE entity_id = $1`
+	args := []any{opts.EntityID}
+	if opts.Cursor != "" {
+		query += ` AND seq > (SELECT seq FROM audit_log WHERE id = $2)`
+		args = append(args, opts.Cursor)
+	}
+	query += fmt.Sprintf(` ORDER BY seq LIMIT $%d`, len(args)+1)
+	args = append(args, opts.Limit)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+
+	entries := make([]*domain.AuditEntry, 0)
+	for rows.Next() {
+		var (
+			e             domain.AuditEntry
+			action        string
+			occurredAt    int64
+			before, after sql.NullString
+		)
+		if err := rows.Scan(&e.ID, &e.EntityID, &action, &e.Principal, &e.RequestID, &occurredAt, &before, &after); err != nil {
+			return nil, translateError(err)
+		}
+		e.Action = domain.AuditAction(action)
+		e.OccurredAt = fromUnixNano(occurredAt)
+		if e.Before, err = unmarshalAuditEntity(before); err != nil {
+			return nil, err
+		}
+		if e.After, err = unmarshalAuditEntity(after); err != nil {
+			return nil, err
+		}
+		e.Changes = domain.DiffEntities(e.Before, e.After)
+		entries = append(entries, &e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, translateError(err)
+	}
+	return entries, nil
+}
+
+// marshalAuditEntity returns entity as JSON, or NULL if it is nil.
+func marshalAuditEntity(entity *domain.Entity) (sql.NullString, error) {
+	if entity == nil {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(entity)
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("sqlite: failed to encode audited entity %s: %w", entity.ID, err)
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+// unmarshalAuditEntity decodes an entity stored by marshalAuditEntity.
+func unmarshalAuditEntity(data sql.NullString) (*domain.Entity, error) {
+	if !data.Valid {
+		return nil, nil
+	}
+	var entity domain.Entity
+	if err := json.Unmarshal([]byte(data.String), &entity); err != nil {
+		return nil, fmt.Errorf("sqlite: failed to decode audited entity: %w", err)
+	}
+	return &entity, nil
+}
@@ -0,0 +1,101 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/repository/repositorytest"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/service"
+
+	_ "modernc.org/sqlite"
+)
+
+// openTestDB opens a migrated database in a fresh temporary file.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_txlock=immediate")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := Migrate(context.Background(), db); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	return db
+}
+
+func TestEntityRepository(t *testing.T) {
+	repositorytest.RunEntityRepositorySuite(t, func(t *testing.T) service.EntityRepository {
+		return NewEntityRepository(openTestDB(t))
+	})
+}
+
+func TestOutboxRepository(t *testing.T) {
+	repositorytest.RunOutboxRepositorySuite(t, func(t *testing.T) service.OutboxRepository {
+		return NewOutboxRepository(openTestDB(t))
+	})
+}
+
+func TestAuditRepository(t *testing.T) {
+	repositorytest.RunAuditRepositorySuite(t, func(t *testing.T) service.AuditRepository {
+		return NewAuditRepository(openTestDB(t))
+	})
+}
+
+func TestWebhookRepository(t *testing.T) {
+	repositorytest.RunWebhookRepositorySuite(t, func(t *testing.T) service.WebhookRepository {
+		return NewWebhookRepository(openTestDB(t))
+	})
+}
+
+func TestDeliveryRepository(t *testing.T) {
+	repositorytest.RunDeliveryRepositorySuite(t, func(t *testing.T) service.DeliveryRepository {
+		return NewDeliveryRepository(openTestDB(t))
+	})
+}
+
+func TestAPIKeyRepository(t *testing.T) {
+	repositorytest.RunAPIKeyRepositorySuite(t, func(t *testing.T) service.APIKeyRepository {
+		return NewAPIKeyRepository(openTestDB(t))
+	})
+}
+
+func TestUnitOfWork(t *testing.T) {
+	repositorytest.RunUnitOfWorkSuite(t, func(t *testing.T) (service.UnitOfWork, service.Repositories) {
+		db := openTestDB(t)
+		return NewUnitOfWork(db), service.Repositories{
+			Entities: NewEntityRepository(db),
+			Outbox:   NewOutboxRepository(db),
+			Audit:    NewAuditRepository(db),
+		}
+	})
+}
+
+func TestEntityRepositoryCanceledContext(t *testing.T) {
+	repo := NewEntityRepository(openTestDB(t))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := repo.List(ctx, domain.EntityListOptions{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if err := repo.Create(ctx, &domain.Entity{ID: "1", Name: "Test"}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	db := openTestDB(t)
+
+	// Running the migrations again on an up-to-date schema must be a no-op.
+	if err := Migrate(context.Background(), db); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
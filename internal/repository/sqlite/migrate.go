@@ -0,0 +1,151 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// migrations lists the schema changes, in order. Each entry is applied exactly
+// once and recorded in the schema_migrations table. Never edit an entry that
+// has been released; append a new one instead.
+var migrations = []string{
+	`CREATE TABLE entities (
+		id         TEXT PRIMARY KEY,
+		name       TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	)`,
+	// Keyset pagination reads these in (sort column, id) order.
+	`CREATE INDEX entities_name_id_idx ON entities (name, id)`,
+	`CREATE INDEX entities_created_at_id_idx ON entities (created_at, id)`,
+	`CREATE INDEX entities_updated_at_id_idx ON entities (updated_at, id)`,
+	`ALTER TABLE entities ADD COLUMN version INTEGER NOT NULL DEFAULT 1`,
+	// Entities in the trash have a deleted_at; Purge finds the old ones by it.
+	`ALTER TABLE entities ADD COLUMN deleted_at INTEGER`,
+	`CREATE INDEX entities_deleted_at_idx ON entities (deleted_at)`,
+	// The outbox holds domain events until they are published, in seq order.
+	`CREATE TABLE outbox (
+		seq         INTEGER PRIMARY KEY AUTOINCREMENT,
+		id          TEXT NOT NULL UNIQUE,
+		type        TEXT NOT NULL,
+		entity_id   TEXT NOT NULL,
+		occurred_at INTEGER NOT NULL,
+		payload     TEXT NOT NULL
+	)`,
+	// Entities are owned by the principal who created them; List filters by owner.
+	`ALTER TABLE entities ADD COLUMN owner_id TEXT NOT NULL DEFAULT ''`,
+	`CREATE INDEX entities_owner_id_idx ON entities (owner_id)`,
+	// Entities belong to a tenant, '' being the default one, and every query
+	// but Purge filters by it: keyset pagination now reads within a tenant.
+	`ALTER TABLE entities ADD COLUMN tenant_id TEXT NOT NULL DEFAULT ''`,
+	`CREATE INDEX entities_tenant_name_id_idx ON entities (tenant_id, name, id)`,
+	`CREATE INDEX entities_tenant_created_at_id_idx ON entities (tenant_id, created_at, id)`,
+	`CREATE INDEX entities_tenant_updated_at_id_idx ON entities (tenant_id, updated_at, id)`,
+	`DROP INDEX entities_name_id_idx`,
+	`DROP INDEX entities_created_at_id_idx`,
+	`DROP INDEX entities_updated_at_id_idx`,
+	// Events are only shown to the consumers of the tenant of their entity.
+	`ALTER TABLE outbox ADD COLUMN tenant_id TEXT NOT NULL DEFAULT ''`,
+	// The audit log of entities, read in seq order by entity. Entries are
+	// written in the transaction of the change they record.
+	`CREATE TABLE audit_log (
+		seq          INTEGER PRIMARY KEY AUTOINCREMENT,
+		id           TEXT NOT NULL UNIQUE,
+		entity_id    TEXT NOT NULL,
+		action       TEXT NOT NULL,
+		principal    TEXT NOT NULL,
+		request_id   TEXT NOT NULL,
+		occurred_at  INTEGER NOT NULL,
+		before_state TEXT,
+		after_state  TEXT
+	)`,
+	`CREATE INDEX audit_log_entity_id_seq_idx ON audit_log (entity_id, seq)`,
+	// Webhook subscriptions, read in seq order, and the deliveries of events to
+	// them with their attempt logs. The payload of a delivery is kept as text,
+	// so that it is sent byte for byte as it was published.
+	`CREATE TABLE webhooks (
+		seq         INTEGER PRIMARY KEY AUTOINCREMENT,
+		id          TEXT NOT NULL UNIQUE,
+		url         TEXT NOT NULL,
+		event_types TEXT NOT NULL,
+		secret      TEXT NOT NULL,
+		tenant_id   TEXT NOT NULL,
+		created_at  INTEGER NOT NULL
+	)`,
+	`CREATE TABLE webhook_deliveries (
+		id                TEXT PRIMARY KEY,
+		webhook_id        TEXT NOT NULL,
+		event_id          TEXT NOT NULL,
+		event_type        TEXT NOT NULL,
+		event_entity_id   TEXT NOT NULL,
+		event_tenant_id   TEXT NOT NULL,
+		event_occurred_at INTEGER NOT NULL,
+		event_payload     TEXT NOT NULL,
+		status            TEXT NOT NULL,
+		attempts          TEXT NOT NULL,
+		failures          INTEGER NOT NULL,
+		next_attempt_at   INTEGER NOT NULL,
+		last_error        TEXT NOT NULL,
+		created_at        INTEGER NOT NULL,
+		updated_at        INTEGER NOT NULL
+	)`,
+	`CREATE INDEX webhook_deliveries_due_idx ON webhook_deliveries (status, next_attempt_at, id)`,
+	`CREATE INDEX webhook_deliveries_tenant_created_at_idx ON webhook_deliveries (event_tenant_id, created_at, id)`,
+	// API keys are found by the hash of the key, and listed by owner in seq order.
+	`CREATE TABLE api_keys (
+		seq          INTEGER PRIMARY KEY AUTOINCREMENT,
+		id           TEXT NOT NULL UNIQUE,
+		name         TEXT NOT NULL,
+		prefix       TEXT NOT NULL,
+		hash         TEXT NOT NULL UNIQUE,
+		scopes       TEXT NOT NULL,
+		owner_id     TEXT NOT NULL,
+		tenant_id    TEXT NOT NULL,
+		created_at   INTEGER NOT NULL,
+		last_used_at INTEGER,
+		revoked_at   INTEGER
+	)`,
+	`CREATE INDEX api_keys_owner_id_seq_idx ON api_keys (owner_id, seq)`,
+	// Events are only shown to the principals that may read their entity.
+	`ALTER TABLE outbox ADD COLUMN owner_id TEXT NOT NULL DEFAULT ''`,
+	// Webhooks only receive the events that the principal that registered them may read.
+	`ALTER TABLE webhooks ADD COLUMN owner_id TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE webhooks ADD COLUMN owner_roles TEXT NOT NULL DEFAULT '[]'`,
+}
+
+// Migrate creates the schema, or brings an existing database file up to date.
+// It is meant to be called on every startup.
+func Migrate(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at INTEGER NOT NULL DEFAULT (unixepoch())
+	)`); err != nil {
+		return fmt.Errorf("sqlite: failed to create schema_migrations: %w", err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("sqlite: failed to begin migration: %w", err)
+	}
+	defer tx.Rollback() // Rollback after Commit is a no-op.
+
+	var current int
+	if err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("sqlite: failed to read schema version: %w", err)
+	}
+
+	for version := current + 1; version <= len(migrations); version++ {
+		if _, err := tx.ExecContext(ctx, migrations[version-1]); err != nil {
+			return fmt.Errorf("sqlite: migration %d failed: %w", version, err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, version); err != nil {
+			return fmt.Errorf("sqlite: failed to record migration %d: %w", version, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("sqlite: failed to commit migrations: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/service"
+)
+
+// OutboxRepository is a SQLite implementation of the service.OutboxRepository interface.
+// Messages are read back in the order of the seq column.
+type OutboxRepository struct {
+	db querier // The database, or the transaction of a unit of work.
+}
+
+// NewOutboxRepository creates a new OutboxRepository backed by the given database handle.
+// The schema is expected to be in place; see Migrate.
+func NewOutboxRepository(db *sql.DB) service.OutboxRepository {
+	return &OutboxRepository{
+		db: db,
+	}
+}
+
+// Add inserts messages into the outbox.
+func (r *OutboxRepository) Add(ctx context.Context, messages []*domain.EventMessage) error {
+	for _, m := range messages {
+		_, err := r.db.ExecContext(ctx,
+			`INSERT INTO outbox (id, type, entity_id, tenant_id, owner_id, occurred_at, payload) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			m.ID, string(m.Type), m.EntityID, m.TenantID, m.OwnerID, toUnixNano(m.OccurredAt), string(m.Payload),
+		)
+		if err != nil {
+			return translateError(err)
+		}
+	}
+	return nil
+}
+
+// Pending returns the oldest messages of the outbox.
+func (r *OutboxRepository) Pending(ctx context.Context, limit int) ([]*domain.EventMessage, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, type, entity_id, tenant_id, owner_id, occurred_at, payload FROM outbox ORDER BY seq LIMIT $1`,
+		limit,
+	)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+
+	messages := make([]*domain.EventMessage, 0)
+	for rows.Next() {
+		var (
+			m          domain.EventMessage
+			eventType  string
+			occurredAt int64
+			payload    string
+		)
+		if err := rows.Scan(&m.ID, &eventType, &m.EntityID, &m.TenantID, &m.OwnerID, &occurredAt, &payload); err != nil {
+			return nil, translateError(err)
+		}
+		m.Type = domain.EventType(eventType)
+		m.OccurredAt = fromUnixNano(occurredAt)
+		m.Payload = []byte(payload)
+		messages = append(messages, &m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, translateError(err)
+	}
+	return messages, nil
+}
+
+// MarkPublished deletes messages from the outbox.
+func (r *OutboxRepository) MarkPublished(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	placeholders := make([]string, len(ids))
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = id
+	}
+	_, err := r.db.ExecContext(ctx,
+		`DELETE FROM outbox WHERE id IN (`+strings.Join(placeholders, ", ")+`)`,
+		args...,
+	)
+	if err != nil {
+		return translateError(err)
+	}
+	return nil
+}
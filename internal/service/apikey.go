@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/apperror"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// apiKeyPrefix marks API keys, so that they are easy to recognize.
+	apiKeyPrefix = "ak_"
+
+	// apiKeyVisibleLength is the length of the start of a key that is kept in
+	// clear, apiKeyPrefix included.
+	apiKeyVisibleLength = len(apiKeyPrefix) + 8
+
+	// apiKeyUsePrecision is the precision of the last use of a key, so that
+	// it is not written on every request.
+	apiKeyUsePrecision = time.Minute
+)
+
+// apiKeyService is a concrete implementation of the APIKeyService interface.
+type apiKeyService struct {
+	keys APIKeyRepository
+}
+
+// NewAPIKeyService creates a new apiKeyService instance.
+func NewAPIKeyService(keys APIKeyRepository) APIKeyService {
+	return &apiKeyService{
+		keys: keys,
+	}
+}
+
+// Create mints a new API key.
+func (s *apiKeyService) Create(ctx context.Context, key *domain.APIKey) (string, error) {
+	key.Normalize()
+	if err := key.Validate(); err != nil {
+		return "", invalidObject(err, "api_key")
+	}
+
+	principal, ok := PrincipalFrom(ctx)
+	if !ok {
+		return "", apperror.New(apperror.ErrUnauthenticated, "missing_credentials", "API keys can only be created by an authenticated principal")
+	}
+	if principal.APIKeyID != "" {
+		return "", apiKeysForbidden()
+	}
+	if !principal.HasRole(domain.RoleAdmin) {
+		for _, scope := range key.Scopes {
+			if !principal.HasRole(scope) {
+				return "", apperror.New(apperror.ErrForbidden, "forbidden", fmt.Sprintf("you cannot grant the %s scope, which you do not have", scope)).
+					WithMeta("scope", string(scope))
+			}
+		}
+	}
+
+	secret, err := newAPIKey()
+	if err != nil {
+		return "", err
+	}
+	key.ID = uuid.New().String()
+	key.Prefix = secret[:apiKeyVisibleLength]
+	key.Hash = hashAPIKey(secret)
+	key.OwnerID = principal.ID
+	key.TenantID = TenantFrom(ctx)
+	key.CreatedAt = time.Now().UTC()
+	key.LastUsedAt = time.Time{}
+	key.RevokedAt = time.Time{}
+
+	if err := s.keys.Create(ctx, key); err != nil {
+		return "", fmt.Errorf("service: failed to create API key: %w", err)
+	}
+	return secret, nil
+}
+
+// newAPIKey returns a random API key.
+func newAPIKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("service: failed to generate API key: %w", err)
+	}
+	return apiKeyPrefix + hex.EncodeToString(key), nil
+}
+
+// hashAPIKey returns the hash that key is stored under. Keys are random and
+// long, so a fast hash is enough to keep them from being recovered.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetByID retrieves an API key by its ID.
+func (s *apiKeyService) GetByID(ctx context.Context, id string) (*domain.APIKey, error) {
+	key, err := s.keys.FindByID(ctx, id)
+	if err == nil && key.TenantID != TenantFrom(ctx) {
+		err = apperror.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to find API key with id %s: %w", id, err)
+	}
+	if err := authorizeAPIKey(ctx, key); err != nil {
+		return nil, fmt.Errorf("service: failed to get API key with id %s: %w", id, err)
+	}
+	return key, nil
+}
+
+// List returns the API keys that the principal manages, in the tenant of ctx.
+func (s *apiKeyService) List(ctx context.Context) ([]*domain.APIKey, error) {
+	ownerID := ""
+	if principal, ok := PrincipalFrom(ctx); ok {
+		if principal.APIKeyID != "" {
+			return nil, fmt.Errorf("service: failed to list API keys: %w", apiKeysForbidden())
+		}
+		if !principal.HasRole(domain.RoleAdmin) {
+			ownerID = principal.ID
+		}
+	}
+
+	keys, err := s.keys.List(ctx, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to list API keys: %w", err)
+	}
+	tenantID := TenantFrom(ctx)
+	return slices.DeleteFunc(keys, func(key *domain.APIKey) bool {
+		return key.TenantID != tenantID
+	}), nil
+}
+
+// Revoke revokes an API key.
+func (s *apiKeyService) Revoke(ctx context.Context, id string) (*domain.APIKey, error) {
+	if _, err := s.GetByID(ctx, id); err != nil {
+		return nil, err
+	}
+
+	key, err := s.keys.Revoke(ctx, id, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to revoke API key with id %s: %w", id, err)
+	}
+	return key, nil
+}
+
+// Verify authenticates a request with an API key.
+func (s *apiKeyService) Verify(ctx context.Context, secret string) (domain.Principal, error) {
+	if !strings.HasPrefix(secret, apiKeyPrefix) {
+		return domain.Principal{}, apperror.New(apperror.ErrUnauthenticated, "invalid_api_key", "the API key is invalid")
+	}
+
+	key, err := s.keys.FindByHash(ctx, hashAPIKey(secret))
+	switch {
+	case errors.Is(err, apperror.ErrNotFound):
+		return domain.Principal{}, apperror.New(apperror.ErrUnauthenticated, "invalid_api_key", "the API key is invalid")
+	case err != nil:
+		return domain.Principal{}, fmt.Errorf("service: failed to find API key: %w: %w", apperror.ErrInternal, err)
+	case key.IsRevoked():
+		return domain.Principal{}, apperror.New(apperror.ErrUnauthenticated, "revoked_api_key", "the API key was revoked")
+	}
+
+	if now := time.Now().UTC().Truncate(apiKeyUsePrecision); key.LastUsedAt.Before(now) {
+		if err := s.keys.Touch(ctx, key.ID, now); err != nil {
+			return domain.Principal{}, fmt.Errorf("service: failed to record the use of API key with id %s: %w: %w", key.ID, apperror.ErrInternal, err)
+		}
+	}
+
+	return domain.Principal{
+		ID:       key.OwnerID,
+		Roles:    slices.Clone(key.Scopes),
+		TenantID: key.TenantID,
+		APIKeyID: key.ID,
+	}, nil
+}
+
+// authorizeAPIKey checks that the principal of ctx, if any, may manage key:
+// it must have created it or be an admin.
+func authorizeAPIKey(ctx context.Context, key *domain.APIKey) error {
+	principal, ok := PrincipalFrom(ctx)
+	switch {
+	case !ok:
+		return nil
+	case principal.APIKeyID != "":
+		return apiKeysForbidden()
+	case principal.HasRole(domain.RoleAdmin), key.OwnerID == principal.ID:
+		return nil
+	default:
+		return apperror.New(apperror.ErrForbidden, "forbidden", "you do not have permission to manage this API key")
+	}
+}
+
+// apiKeysForbidden returns the error for requests authenticated with an API
+// key that try to manage API keys.
+func apiKeysForbidden() error {
+	return apperror.New(apperror.ErrForbidden, "forbidden", "API keys cannot be managed with an API key")
+}
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/apperror"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+)
+
+// mockAPIKeyRepository is a mock implementation of the APIKeyRepository interface.
+type mockAPIKeyRepository struct {
+	CreateFunc     func(ctx context.Context, key *domain.APIKey) error
+	FindByIDFunc   func(ctx context.Context, id string) (*domain.APIKey, error)
+	FindByHashFunc func(ctx context.Context, hash string) (*domain.APIKey, error)
+	ListFunc       func(ctx context.Context, ownerID string) ([]*domain.APIKey, error)
+	RevokeFunc     func(ctx context.Context, id string, at time.Time) (*domain.APIKey, error)
+	TouchFunc      func(ctx context.Context, id string, at time.Time) error
+}
+
+func (m *mockAPIKeyRepository) Create(ctx context.Context, key *domain.APIKey) error {
+	return m.CreateFunc(ctx, key)
+}
+
+func (m *mockAPIKeyRepository) FindByID(ctx context.Context, id string) (*domain.APIKey, error) {
+	return m.FindByIDFunc(ctx, id)
+}
+
+func (m *mockAPIKeyRepository) FindByHash(ctx context.Context, hash string) (*domain.APIKey, error) {
+	return m.FindByHashFunc(ctx, hash)
+}
+
+func (m *mockAPIKeyRepository) List(ctx context.Context, ownerID string) ([]*domain.APIKey, error) {
+	return m.ListFunc(ctx, ownerID)
+}
+
+func (m *mockAPIKeyRepository) Revoke(ctx context.Context, id string, at time.Time) (*domain.APIKey, error) {
+	return m.RevokeFunc(ctx, id, at)
+}
+
+func (m *mockAPIKeyRepository) Touch(ctx context.Context, id string, at time.Time) error {
+	return m.TouchFunc(ctx, id, at)
+}
+
+func TestAPIKeyService(t *testing.T) {
+	mockKeys := &mockAPIKeyRepository{}
+	svc := NewAPIKeyService(mockKeys)
+	ctx := context.Background()
+	alice := WithPrincipal(ctx, domain.Principal{ID: "alice", Roles: []domain.Role{domain.RoleReader, domain.RoleEditor}})
+	bob := WithPrincipal(ctx, domain.Principal{ID: "bob", Roles: []domain.Role{domain.RoleEditor}})
+	admin := WithPrincipal(ctx, domain.Principal{ID: "root", Roles: []domain.Role{domain.RoleAdmin}})
+
+	stored := &domain.APIKey{ID: "k1", Name: "sync", Scopes: []domain.Role{domain.RoleReader}, OwnerID: "alice"}
+	mockKeys.FindByIDFunc = func(ctx context.Context, id string) (*domain.APIKey, error) {
+		if id != "k1" {
+			return nil, apperror.ErrNotFound
+		}
+		return stored, nil
+	}
+
+	t.Run("Create", func(t *testing.T) {
+		var created *domain.APIKey
+		mockKeys.CreateFunc = func(ctx context.Context, key *domain.APIKey) error {
+			created = key
+			return nil
+		}
+
+		key := &domain.APIKey{Name: " sync ", Scopes: []domain.Role{domain.RoleReader}}
+		secret, err := svc.Create(alice, key)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if created != key || key.ID == "" || key.Name != "sync" || key.OwnerID != "alice" || key.CreatedAt.IsZero() {
+			t.Errorf("expected the normalized key to be stored for alice, got %+v", created)
+		}
+		if key.TenantID != "" {
+			t.Errorf("expected the key in the default tenant, got %q", key.TenantID)
+		}
+		if !strings.HasPrefix(secret, apiKeyPrefix) || len(secret) != len(apiKeyPrefix)+64 {
+			t.Errorf("expected a generated key, got %q", secret)
+		}
+		if key.Hash != hashAPIKey(secret) || strings.Contains(key.Hash, secret) || !strings.HasPrefix(secret, key.Prefix) {
+			t.Errorf("expected the key to be stored as its hash and prefix only, got %+v", key)
+		}
+	})
+
+	t.Run("Create rejected", func(t *testing.T) {
+		mockKeys.CreateFunc = func(ctx context.Context, key *domain.APIKey) error {
+			t.Error("expected the key not to be stored")
+			return nil
+		}
+
+		keyCtx := WithPrincipal(ctx, domain.Principal{ID: "alice", Roles: []domain.Role{domain.RoleAdmin}, APIKeyID: "k1"})
+		tests := []struct {
+			name   string
+			ctx    context.Context
+			scopes []domain.Role
+			want   error
+		}{
+			{"invalid", alice, nil, apperror.ErrInvalidInput},
+			{"without principal", ctx, []domain.Role{domain.RoleReader}, apperror.ErrUnauthenticated},
+			{"scope the principal lacks", bob, []domain.Role{domain.RoleReader}, apperror.ErrForbidden},
+			{"with an API key", keyCtx, []domain.Role{domain.RoleReader}, apperror.ErrForbidden},
+		}
+		for _, tt := range tests {
+			if _, err := svc.Create(tt.ctx, &domain.APIKey{Name: "sync", Scopes: tt.scopes}); !errors.Is(err, tt.want) {
+				t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+			}
+		}
+	})
+
+	t.Run("Create by admin", func(t *testing.T) {
+		mockKeys.CreateFunc = func(ctx context.Context, key *domain.APIKey) error {
+			return nil
+		}
+
+		if _, err := svc.Create(admin, &domain.APIKey{Name: "sync", Scopes: []domain.Role{domain.RoleEditor}}); err != nil {
+			t.Errorf("expected admins to grant any scope, got %v", err)
+		}
+	})
+
+	t.Run("Manage", func(t *testing.T) {
+		mockKeys.RevokeFunc = func(ctx context.Context, id string, at time.Time) (*domain.APIKey, error) {
+			revoked := *stored
+			revoked.RevokedAt = at
+			return &revoked, nil
+		}
+
+		if _, err := svc.GetByID(alice, "k1"); err != nil {
+			t.Errorf("expected the owner to get the key, got %v", err)
+		}
+		if _, err := svc.GetByID(admin, "k1"); err != nil {
+			t.Errorf("expected an admin to get the key, got %v", err)
+		}
+		if _, err := svc.GetByID(bob, "k1"); !errors.Is(err, apperror.ErrForbidden) {
+			t.Errorf("expected ErrForbidden, got %v", err)
+		}
+		if _, err := svc.Revoke(bob, "k1"); !errors.Is(err, apperror.ErrForbidden) {
+			t.Errorf("expected ErrForbidden, got %v", err)
+		}
+		if _, err := svc.Revoke(alice, "unknown"); !errors.Is(err, apperror.ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+		if _, err := svc.GetByID(WithTenant(admin, "acme"), "k1"); !errors.Is(err, apperror.ErrNotFound) {
+			t.Errorf("expected the key of another tenant not to be found, got %v", err)
+		}
+
+		revoked, err := svc.Revoke(alice, "k1")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !revoked.IsRevoked() {
+			t.Errorf("expected the key to be revoked, got %+v", revoked)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		var gotOwner string
+		mockKeys.ListFunc = func(ctx context.Context, ownerID string) ([]*domain.APIKey, error) {
+			gotOwner = ownerID
+			return nil, nil
+		}
+
+		for _, tt := range []struct {
+			name  string
+			ctx   context.Context
+			owner string
+		}{{"editor", bob, "bob"}, {"admin", admin, ""}, {"anonymous", ctx, ""}} {
+			gotOwner = "unset"
+			if _, err := svc.List(tt.ctx); err != nil {
+				t.Errorf("%s: expected no error, got %v", tt.name, err)
+			}
+			if gotOwner != tt.owner {
+				t.Errorf("%s: expected to list the keys of %q, got %q", tt.name, tt.owner, gotOwner)
+			}
+		}
+
+		mockKeys.ListFunc = func(ctx context.Context, ownerID string) ([]*domain.APIKey, error) {
+			return []*domain.APIKey{{ID: "k1"}, {ID: "k2", TenantID: "acme"}}, nil
+		}
+		keys, err := svc.List(WithTenant(admin, "acme"))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(keys) != 1 || keys[0].ID != "k2" {
+			t.Errorf("expected only the key of the tenant, got %v", keys)
+		}
+	})
+
+	t.Run("Verify", func(t *testing.T) {
+		const secret = apiKeyPrefix + "0123456789abcdef"
+		key := &domain.APIKey{ID: "k1", Hash: hashAPIKey(secret), Scopes: []domain.Role{domain.RoleReader}, OwnerID: "alice", TenantID: "acme"}
+		mockKeys.FindByHashFunc = func(ctx context.Context, hash string) (*domain.APIKey, error) {
+			if hash != key.Hash {
+				return nil, apperror.ErrNotFound
+			}
+			return key, nil
+		}
+		var touched []time.Time
+		mockKeys.TouchFunc = func(ctx context.Context, id string, at time.Time) error {
+			touched = append(touched, at)
+			key.LastUsedAt = at
+			return nil
+		}
+
+		for range 2 {
+			principal, err := svc.Verify(ctx, secret)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if principal.ID != "alice" || principal.APIKeyID != "k1" || principal.TenantID != "acme" || !slices.Equal(principal.Roles, key.Scopes) {
+				t.Errorf("expected alice of acme with the scopes of the key, got %+v", principal)
+			}
+		}
+		if len(touched) != 1 || !touched[0].Equal(touched[0].Truncate(apiKeyUsePrecision)) {
+			t.Errorf("expected the use to be recorded once, to the minute, got %v", touched)
+		}
+
+		if _, err := svc.Verify(ctx, apiKeyPrefix+"unknown"); !errors.Is(err, apperror.ErrUnauthenticated) {
+			t.Errorf("expected ErrUnauthenticated for an unknown key, got %v", err)
+		}
+		if _, err := svc.Verify(ctx, "secret"); !errors.Is(err, apperror.ErrUnauthenticated) {
+			t.Errorf("expected ErrUnauthenticated for a malformed key, got %v", err)
+		}
+		key.RevokedAt = time.Now()
+		if _, err := svc.Verify(ctx, secret); !errors.Is(err, apperror.ErrUnauthenticated) {
+			t.Errorf("expected ErrUnauthenticated for a revoked key, got %v", err)
+		}
+
+		mockKeys.FindByHashFunc = func(ctx context.Context, hash string) (*domain.APIKey, error) {
+			return nil, errors.New("connection refused")
+		}
+		if _, err := svc.Verify(ctx, secret); !errors.Is(err, apperror.ErrInternal) {
+			t.Errorf("expected ErrInternal for a failing repository, got %v", err)
+		}
+	})
+}
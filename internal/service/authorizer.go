@@ -0,0 +1,77 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/apperror"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+)
+
+// Action names an operation on entities, as checked by an Authorizer.
+type Action string
+
+// Actions on entities.
+const (
+	ActionRead    Action = "read" // Get, list, or read the history of an entity.
+	ActionCreate  Action = "create"
+	ActionUpdate  Action = "update"
+	ActionDelete  Action = "delete"
+	ActionRestore Action = "restore"
+	ActionPurge   Action = "purge" // Permanently remove the deleted entities.
+
+	// ActionManageWebhooks covers registering, reading and deleting webhooks,
+	// and reading and retrying their deliveries.
+	ActionManageWebhooks Action = "manage webhooks"
+)
+
+// roleAuthorizer is a concrete implementation of the Authorizer interface,
+// which grants permissions by role and ownership:
+//   - admins may do anything to every entity, and manage webhooks;
+//   - readers may read every entity;
+//   - editors may create entities, and read, update, delete and restore the
+//     entities they own.
+//
+// Principals may have several roles; a principal without any may do nothing.
+type roleAuthorizer struct{}
+
+// NewRoleAuthorizer creates a new roleAuthorizer instance.
+func NewRoleAuthorizer() Authorizer {
+	return roleAuthorizer{}
+}
+
+// Authorize checks action against the roles of principal and the owner of entity.
+func (roleAuthorizer) Authorize(principal domain.Principal, action Action, entity *domain.Entity) error {
+	owns := entity != nil && entity.OwnerID != "" && entity.OwnerID == principal.ID
+
+	allowed := principal.HasRole(domain.RoleAdmin)
+	switch action {
+	case ActionRead:
+		allowed = allowed || principal.HasRole(domain.RoleReader) || (principal.HasRole(domain.RoleEditor) && owns)
+	case ActionCreate:
+		allowed = allowed || principal.HasRole(domain.RoleEditor)
+	case ActionUpdate, ActionDelete, ActionRestore:
+		allowed = allowed || (principal.HasRole(domain.RoleEditor) && owns)
+	}
+	if !allowed {
+		return forbidden(action)
+	}
+	return nil
+}
+
+// ListScope lets readers and admins list every entity, and editors their own.
+func (roleAuthorizer) ListScope(principal domain.Principal) (string, error) {
+	switch {
+	case principal.HasRole(domain.RoleAdmin), principal.HasRole(domain.RoleReader):
+		return "", nil
+	case principal.HasRole(domain.RoleEditor):
+		return principal.ID, nil
+	default:
+		return "", forbidden(ActionRead)
+	}
+}
+
+// forbidden returns the apperror.ErrForbidden error for action.
+func forbidden(action Action) error {
+	return apperror.New(apperror.ErrForbidden, "forbidden", fmt.Sprintf("you do not have permission to %s", action)).
+		WithMeta("action", string(action))
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/apperror"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+)
+
+func TestRoleAuthorizer(t *testing.T) {
+	authz := NewRoleAuthorizer()
+	owned := &domain.Entity{ID: "1", OwnerID: "alice"}
+	other := &domain.Entity{ID: "2", OwnerID: "bob"}
+	unowned := &domain.Entity{ID: "3"}
+
+	principal := func(roles ...domain.Role) domain.Principal {
+		return domain.Principal{ID: "alice", Roles: roles}
+	}
+
+	tests := []struct {
+		name      string
+		principal domain.Principal
+		action    Action
+		entity    *domain.Entity
+		allowed   bool
+	}{
+		{"reader reads any entity", principal(domain.RoleReader), ActionRead, other, true},
+		{"reader cannot create", principal(domain.RoleReader), ActionCreate, owned, false},
+		{"reader cannot update its own entity", principal(domain.RoleReader), ActionUpdate, owned, false},
+		{"editor creates", principal(domain.RoleEditor), ActionCreate, owned, true},
+		{"editor reads its own entity", principal(domain.RoleEditor), ActionRead, owned, true},
+		{"editor cannot read another entity", principal(domain.RoleEditor), ActionRead, other, false},
+		{"editor updates its own entity", principal(domain.RoleEditor), ActionUpdate, owned, true},
+		{"editor cannot update another entity", principal(domain.RoleEditor), ActionUpdate, other, false},
+		{"editor cannot update an entity without owner", principal(domain.RoleEditor), ActionUpdate, unowned, false},
+		{"editor deletes its own entity", principal(domain.RoleEditor), ActionDelete, owned, true},
+		{"editor restores its own entity", principal(domain.RoleEditor), ActionRestore, owned, true},
+		{"editor cannot purge", principal(domain.RoleEditor), ActionPurge, nil, false},
+		{"reader and editor reads another entity", principal(domain.RoleReader, domain.RoleEditor), ActionRead, other, true},
+		{"admin updates any entity", principal(domain.RoleAdmin), ActionUpdate, other, true},
+		{"admin purges", principal(domain.RoleAdmin), ActionPurge, nil, true},
+		{"admin manages webhooks", principal(domain.RoleAdmin), ActionManageWebhooks, nil, true},
+		{"reader cannot manage webhooks", principal(domain.RoleReader), ActionManageWebhooks, nil, false},
+		{"editor cannot manage webhooks", principal(domain.RoleEditor), ActionManageWebhooks, nil, false},
+		{"no role", principal(), ActionRead, owned, false},
+		{"unknown role", principal("owner"), ActionRead, owned, false},
+	}
+	for _, tt := range tests {
+		err := authz.Authorize(tt.principal, tt.action, tt.entity)
+		switch {
+		case tt.allowed && err != nil:
+			t.Errorf("%s: expected no error, got %v", tt.name, err)
+		case !tt.allowed && !errors.Is(err, apperror.ErrForbidden):
+			t.Errorf("%s: expected ErrForbidden, got %v", tt.name, err)
+		}
+	}
+}
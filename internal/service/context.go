@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+)
+
+// contextKey is the type of the context keys of this package.
+type contextKey int
+
+const (
+	principalKey contextKey = iota
+	requestIDKey
+	tenantKey
+)
+
+// anonymousPrincipal is recorded as the principal of the changes made without one.
+const anonymousPrincipal = "anonymous"
+
+// WithPrincipal returns a copy of ctx that carries the authenticated principal.
+func WithPrincipal(ctx context.Context, principal domain.Principal) context.Context {
+	return context.WithValue(ctx, principalKey, principal)
+}
+
+// PrincipalFrom returns the principal carried by ctx, if any.
+func PrincipalFrom(ctx context.Context) (domain.Principal, bool) {
+	principal, ok := ctx.Value(principalKey).(domain.Principal)
+	return principal, ok
+}
+
+// WithRequestID returns a copy of ctx that carries the ID of the request being served.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestIDFrom returns the request ID carried by ctx, or an empty string.
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithTenant returns a copy of ctx that carries the ID of the tenant whose
+// data the operations of ctx can reach.
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantKey, tenantID)
+}
+
+// TenantFrom returns the tenant ID carried by ctx, or an empty string for the
+// default tenant.
+func TenantFrom(ctx context.Context) string {
+	id, _ := ctx.Value(tenantKey).(string)
+	return id
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/apperror"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+)
+
+// cursor is the payload of an opaque list cursor. It records the sort order
+// and a digest of the filters it was issued for, so it cannot be replayed
+// against a different list.
+type cursor struct {
+	SortBy     domain.EntitySortField `json:"s"`
+	Descending bool                   `json:"d,omitempty"`
+	Filters    string                 `json:"f"`
+	ID         string                 `json:"id"`
+	Name       string                 `json:"n,omitempty"`
+	Time       time.Time              `json:"t,omitzero"`
+}
+
+// encodeCursor returns the cursor pointing right after the given entity in
+// the list described by opts.
+func encodeCursor(last *domain.Entity, opts domain.EntityListOptions) string {
+	c := cursor{SortBy: opts.SortBy, Descending: opts.Descending, Filters: filtersDigest(opts), ID: last.ID}
+	switch opts.SortBy {
+	case domain.EntitySortByName:
+		c.Name = last.Name
+	case domain.EntitySortByUpdatedAt:
+		c.Time = last.UpdatedAt
+	default:
+		c.Time = last.CreatedAt
+	}
+
+	// Marshaling a struct of strings, bools and times cannot fail.
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// errInvalidCursor is returned for cursors that were not issued for the requested list.
+var errInvalidCursor = apperror.New(apperror.ErrInvalidInput, "invalid_cursor", "invalid cursor").
+	WithFields(apperror.FieldError{Field: "cursor", Code: "invalid", Message: "must be a cursor returned for the same sort order and filters"})
+
+// decodeCursor parses a cursor issued by encodeCursor for the same sort order
+// and filters.
+func decodeCursor(token string, opts domain.EntityListOptions) (*domain.EntityCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, errInvalidCursor
+	}
+	if c.SortBy != opts.SortBy || c.Descending != opts.Descending || c.Filters != filtersDigest(opts) || c.ID == "" {
+		return nil, errInvalidCursor
+	}
+
+	return &domain.EntityCursor{
+		ID:        c.ID,
+		Name:      c.Name,
+		CreatedAt: c.Time,
+		UpdatedAt: c.Time,
+	}, nil
+}
+
+// filtersDigest returns a short digest of the filters of opts, including the
+// owner that the service scopes the list to.
+func filtersDigest(opts domain.EntityListOptions) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%q %q %q %q", opts.NamePrefix, opts.CreatedAfter.UTC().Format(time.RFC3339Nano), opts.Deleted, opts.OwnerID)
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:12])
+}
@@ -2,7 +2,9 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/domenicoop/go-clean-architecture-blueprint/internal/apperror"
 	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
@@ -10,30 +12,70 @@ import (
 	"github.com/google/uuid"
 )
 
+// patchAttempts bounds how often an unconditional Patch is retried when the
+// entity changes between reading and updating it.
+const patchAttempts = 3
+
+// Page sizes for List.
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 100
+)
+
+// MaxBatchSize is the largest number of operations in a batch.
+const MaxBatchSize = 1000
+
 // entityService is a concrete implementation of the EntityService interface.
 type entityService struct {
-	repo EntityRepository
+	repo  EntityRepository
+	uow   UnitOfWork
+	audit AuditRepository
+	authz Authorizer
 }
 
 // NewEntityService creates a new entityService instance.
-func NewEntityService(repo EntityRepository) EntityService {
+// Changes run in units of work of uow, which must share the store of repo, and
+// add a domain event to the outbox and an entry to the audit log, on behalf of
+// the principal of the context, in the same unit of work. The history of
+// entities is read from audit, which must share the store of uow too.
+//
+// Every operation on behalf of a principal is checked with authz. Calls
+// without a principal are not restricted: they come from the application
+// itself, like the purge job, or from a server without authentication.
+func NewEntityService(repo EntityRepository, uow UnitOfWork, audit AuditRepository, authz Authorizer) EntityService {
 	return &entityService{
-		repo: repo,
+		repo:  repo,
+		uow:   uow,
+		audit: audit,
+		authz: authz,
 	}
 }
 
 // Create creates a new entity.
 func (s *entityService) Create(ctx context.Context, entity *domain.Entity) error {
-	if entity.Name == "" {
-		return apperror.ErrInvalidInput
+	entity.Normalize()
+	if err := entity.Validate(); err != nil {
+		return invalidEntity(err)
 	}
 
 	entity.ID = uuid.New().String()
-
-	if err := s.repo.Create(ctx, entity); err != nil {
+	entity.OwnerID = ""
+	if principal, ok := PrincipalFrom(ctx); ok {
+		entity.OwnerID = principal.ID
+	}
+	if err := s.authorize(ctx, ActionCreate, entity); err != nil {
 		return fmt.Errorf("service: failed to create entity: %w", err)
 	}
-	return nil
+
+	return s.uow.Do(ctx, func(repos Repositories) error {
+		if err := repos.Entities.Create(ctx, entity); err != nil {
+			return fmt.Errorf("service: failed to create entity: %w", err)
+		}
+		if err := emit(ctx, repos, domain.EntityCreated{Entity: *entity}); err != nil {
+			return err
+		}
+		return record(ctx, repos, newAuditEntry(ctx, domain.AuditActionCreate, entity.ID, nil, entity))
+	})
 }
 
 // GetByID retrieves an entity by its ID.
@@ -42,34 +84,545 @@ func (s *entityService) GetByID(ctx context.Context, id string) (*domain.Entity,
 	if err != nil {
 		return nil, fmt.Errorf("service: failed to find entity with id %s: %w", id, err)
 	}
+	if err := s.authorize(ctx, ActionRead, entity); err != nil {
+		return nil, fmt.Errorf("service: failed to get entity with id %s: %w", id, err)
+	}
 	return entity, nil
 }
 
-// Update updates an existing entity.
+// Update updates an existing entity. A non-zero entity.Version must match the stored one.
 func (s *entityService) Update(ctx context.Context, entity *domain.Entity) error {
-	if entity.Name == "" {
-		return apperror.ErrInvalidInput
+	entity.Normalize()
+	if err := entity.Validate(); err != nil {
+		return invalidEntity(err)
 	}
 
-	if err := s.repo.Update(ctx, entity); err != nil {
-		return fmt.Errorf("service: failed to update entity with id %s: %w", entity.ID, err)
+	return s.uow.Do(ctx, func(repos Repositories) error {
+		before, err := repos.Entities.FindByID(ctx, entity.ID)
+		if err != nil {
+			return fmt.Errorf("service: failed to update entity with id %s: %w", entity.ID, err)
+		}
+		if err := s.authorize(ctx, ActionUpdate, before); err != nil {
+			return fmt.Errorf("service: failed to update entity with id %s: %w", entity.ID, err)
+		}
+		if err := repos.Entities.Update(ctx, entity); err != nil {
+			return fmt.Errorf("service: failed to update entity with id %s: %w", entity.ID, err)
+		}
+		if err := emit(ctx, repos, domain.EntityUpdated{Entity: *entity}); err != nil {
+			return err
+		}
+		return record(ctx, repos, newAuditEntry(ctx, domain.AuditActionUpdate, entity.ID, before, entity))
+	})
+}
+
+// Patch applies patch to the stored entity and updates it with the result.
+// A non-zero version must match the stored one. Without a version, the patch is
+// reapplied to the latest state if the entity changes concurrently.
+func (s *entityService) Patch(ctx context.Context, id string, version int64, patch EntityPatch) (*domain.Entity, error) {
+	if version < 0 {
+		return nil, invalidField("invalid_entity", "version", "out_of_range", "must not be negative")
+	}
+
+	for attempt := 1; ; attempt++ {
+		var entity *domain.Entity
+		err := s.uow.Do(ctx, func(repos Repositories) error {
+			before, after, err := s.patch(ctx, repos.Entities, id, version, patch)
+			if err != nil {
+				return err
+			}
+			if err := emit(ctx, repos, domain.EntityUpdated{Entity: *after}); err != nil {
+				return err
+			}
+			entity = after
+			return record(ctx, repos, newAuditEntry(ctx, domain.AuditActionUpdate, id, before, after))
+		})
+		if version == 0 && attempt < patchAttempts && errors.Is(err, apperror.ErrPreconditionFailed) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return entity, nil
+	}
+}
+
+// patch reads the entity, applies patch to it and updates it, through repo.
+// It returns the entity as it was read and as it was updated.
+func (s *entityService) patch(ctx context.Context, repo EntityRepository, id string, version int64, patch EntityPatch) (before, after *domain.Entity, err error) {
+	entity, err := repo.FindByID(ctx, id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("service: failed to find entity with id %s: %w", id, err)
+	}
+	if err := s.authorize(ctx, ActionUpdate, entity); err != nil {
+		return nil, nil, fmt.Errorf("service: failed to patch entity with id %s: %w", id, err)
+	}
+	if version != 0 && entity.Version != version {
+		return nil, nil, fmt.Errorf("service: failed to patch entity with id %s: %w", id, apperror.ErrPreconditionFailed)
+	}
+
+	read := *entity
+	stored := entity.Version
+	if err := patch(entity); err != nil {
+		return nil, nil, fmt.Errorf("service: failed to patch entity with id %s: %w", id, err)
+	}
+	// The patch may only change the entity's content, never its identity.
+	entity.ID = id
+	entity.Version = stored
+
+	entity.Normalize()
+	if err := entity.Validate(); err != nil {
+		return nil, nil, invalidEntity(err)
+	}
+
+	if err := repo.Update(ctx, entity); err != nil {
+		return nil, nil, fmt.Errorf("service: failed to update entity with id %s: %w", id, err)
+	}
+	return &read, entity, nil
+}
+
+// Delete deletes an entity by its ID. A non-zero version must match the stored one.
+func (s *entityService) Delete(ctx context.Context, id string, version int64) error {
+	if version < 0 {
+		return invalidField("invalid_entity", "version", "out_of_range", "must not be negative")
+	}
+
+	return s.uow.Do(ctx, func(repos Repositories) error {
+		before, err := repos.Entities.FindByID(ctx, id)
+		if err != nil {
+			return fmt.Errorf("service: failed to delete entity with id %s: %w", id, err)
+		}
+		if err := s.authorize(ctx, ActionDelete, before); err != nil {
+			return fmt.Errorf("service: failed to delete entity with id %s: %w", id, err)
+		}
+		if err := repos.Entities.Delete(ctx, id, version); err != nil {
+			return fmt.Errorf("service: failed to delete entity with id %s: %w", id, err)
+		}
+		if err := emit(ctx, repos, domain.EntityDeleted{ID: id, OwnerID: before.OwnerID}); err != nil {
+			return err
+		}
+		return record(ctx, repos, newAuditEntry(ctx, domain.AuditActionDelete, id, before, nil))
+	})
+}
+
+// Batch validates and applies ops in order. If atomic is set, either every
+// operation is applied or none is.
+func (s *entityService) Batch(ctx context.Context, ops []domain.EntityOperation, atomic bool) ([]error, error) {
+	if len(ops) == 0 || len(ops) > MaxBatchSize {
+		return nil, invalidField("invalid_batch", "operations", "out_of_range", fmt.Sprintf("must contain between 1 and %d operations", MaxBatchSize))
+	}
+
+	// Only the valid operations reach the repository; indexes maps them back.
+	errs := make([]error, len(ops))
+	valid := make([]domain.EntityOperation, 0, len(ops))
+	indexes := make([]int, 0, len(ops))
+	for i, op := range ops {
+		if err := prepareOperation(op); err != nil {
+			errs[i] = err
+			continue
+		}
+		valid = append(valid, op)
+		indexes = append(indexes, i)
+	}
+
+	if atomic && len(valid) < len(ops) {
+		abortRest(errs)
+		return errs, nil
+	}
+	if len(valid) == 0 {
+		return errs, nil
+	}
+
+	err := s.uow.Do(ctx, func(repos Repositories) error {
+		ids := make([]string, len(valid))
+		for j, op := range valid {
+			ids[j] = op.Entity.ID
+		}
+		if err := repos.Entities.Lock(ctx, ids...); err != nil {
+			return fmt.Errorf("service: failed to lock batch: %w", err)
+		}
+
+		// Read the entities before they change, and check that the principal
+		// may change them. A missing entity is left nil, and its operation
+		// fails in the batch.
+		allowed := make([]domain.EntityOperation, 0, len(valid))
+		allowedIndexes := make([]int, 0, len(valid))
+		befores := make([]*domain.Entity, 0, len(valid))
+		for j, op := range valid {
+			var before *domain.Entity
+			target := op.Entity
+			if op.Kind == domain.EntityOperationCreate {
+				target.OwnerID = ""
+				if principal, ok := PrincipalFrom(ctx); ok {
+					target.OwnerID = principal.ID
+				}
+			} else {
+				before, _ = repos.Entities.FindByID(ctx, op.Entity.ID)
+				target = before
+			}
+			if target != nil {
+				if err := s.authorize(ctx, operationAction(op.Kind), target); err != nil {
+					errs[indexes[j]] = fmt.Errorf("service: failed to %s entity with id %s: %w", op.Kind, op.Entity.ID, err)
+					continue
+				}
+			}
+			allowed = append(allowed, op)
+			allowedIndexes = append(allowedIndexes, indexes[j])
+			befores = append(befores, before)
+		}
+		if atomic && len(allowed) < len(valid) {
+			abortRest(errs)
+			return nil
+		}
+		if len(allowed) == 0 {
+			return nil
+		}
+
+		repoErrs, err := repos.Entities.Batch(ctx, allowed, atomic)
+		if err != nil {
+			return fmt.Errorf("service: failed to apply batch: %w", err)
+		}
+
+		var (
+			events  []domain.Event
+			entries []*domain.AuditEntry
+		)
+		for j, err := range repoErrs {
+			op := allowed[j]
+			if err != nil {
+				errs[allowedIndexes[j]] = fmt.Errorf("service: failed to %s entity with id %s: %w", op.Kind, op.Entity.ID, err)
+				continue
+			}
+			events = append(events, operationEvent(op, befores[j]))
+			entries = append(entries, operationAuditEntry(ctx, op, befores[j]))
+		}
+		if err := emit(ctx, repos, events...); err != nil {
+			return err
+		}
+		return record(ctx, repos, entries...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return errs, nil
+}
+
+// abortRest marks every operation of a failed atomic batch that did not fail
+// itself as aborted.
+func abortRest(errs []error) {
+	for i := range errs {
+		if errs[i] == nil {
+			errs[i] = apperror.ErrAborted
+		}
+	}
+}
+
+// operationAction returns the action that a batch operation performs.
+func operationAction(kind domain.EntityOperationKind) Action {
+	switch kind {
+	case domain.EntityOperationCreate:
+		return ActionCreate
+	case domain.EntityOperationUpdate:
+		return ActionUpdate
+	default:
+		return ActionDelete
+	}
+}
+
+// operationEvent returns the event for a batch operation that succeeded,
+// given the entity before it.
+func operationEvent(op domain.EntityOperation, before *domain.Entity) domain.Event {
+	switch op.Kind {
+	case domain.EntityOperationCreate:
+		return domain.EntityCreated{Entity: *op.Entity}
+	case domain.EntityOperationUpdate:
+		return domain.EntityUpdated{Entity: *op.Entity}
+	default:
+		return domain.EntityDeleted{ID: op.Entity.ID, OwnerID: before.OwnerID}
+	}
+}
+
+// operationAuditEntry returns the audit entry for a batch operation that
+// succeeded, given the entity before it.
+func operationAuditEntry(ctx context.Context, op domain.EntityOperation, before *domain.Entity) *domain.AuditEntry {
+	switch op.Kind {
+	case domain.EntityOperationCreate:
+		return newAuditEntry(ctx, domain.AuditActionCreate, op.Entity.ID, nil, op.Entity)
+	case domain.EntityOperationUpdate:
+		return newAuditEntry(ctx, domain.AuditActionUpdate, op.Entity.ID, before, op.Entity)
+	default:
+		return newAuditEntry(ctx, domain.AuditActionDelete, op.Entity.ID, before, nil)
 	}
-	return nil
 }
 
-// Delete deletes an entity by its ID.
-func (s *entityService) Delete(ctx context.Context, id string) error {
-	if err := s.repo.Delete(ctx, id); err != nil {
-		return fmt.Errorf("service: failed to delete entity with id %s: %w", id, err)
+// prepareOperation validates a batch operation, with the same rules as the
+// matching single-entity method, and assigns the ID of created entities.
+func prepareOperation(op domain.EntityOperation) error {
+	if op.Entity == nil {
+		return invalidField("invalid_operation", "entity", "required", "must be set")
+	}
+
+	switch op.Kind {
+	case domain.EntityOperationCreate, domain.EntityOperationUpdate:
+		op.Entity.Normalize()
+		if err := op.Entity.Validate(); err != nil {
+			return invalidEntity(err)
+		}
+		if op.Kind == domain.EntityOperationCreate {
+			op.Entity.ID = uuid.New().String()
+		}
+	case domain.EntityOperationDelete:
+		if op.Entity.Version < 0 {
+			return invalidField("invalid_entity", "version", "out_of_range", "must not be negative")
+		}
+	default:
+		return invalidField("invalid_operation", "op", "unsupported", fmt.Sprintf("unknown operation %q", op.Kind))
 	}
 	return nil
 }
 
-// List retrieves a list of all entities.
-func (s *entityService) List(ctx context.Context) ([]*domain.Entity, error) {
-	entities, err := s.repo.List(ctx)
+// Restore takes a deleted entity out of the trash. A non-zero version must match the stored one.
+func (s *entityService) Restore(ctx context.Context, id string, version int64) (*domain.Entity, error) {
+	if version < 0 {
+		return nil, invalidField("invalid_entity", "version", "out_of_range", "must not be negative")
+	}
+
+	var entity *domain.Entity
+	err := s.uow.Do(ctx, func(repos Repositories) error {
+		var err error
+		entity, err = repos.Entities.Restore(ctx, id, version)
+		if errors.Is(err, apperror.ErrNotFound) {
+			// Tell a missing entity apart from one that is not in the trash.
+			if _, findErr := repos.Entities.FindByID(ctx, id); findErr == nil {
+				err = apperror.New(apperror.ErrConflict, "entity_not_deleted", "the entity is not deleted")
+			}
+		}
+		if err != nil {
+			return err
+		}
+		// Deleted entities cannot be read before they are restored, so check
+		// the restored one, and roll the restore back if it is not allowed.
+		if err := s.authorize(ctx, ActionRestore, entity); err != nil {
+			return err
+		}
+		if err := emit(ctx, repos, domain.EntityRestored{Entity: *entity}); err != nil {
+			return err
+		}
+		return record(ctx, repos, newAuditEntry(ctx, domain.AuditActionRestore, id, nil, entity))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to restore entity with id %s: %w", id, err)
+	}
+	return entity, nil
+}
+
+// PurgeDeleted permanently removes the entities deleted more than retention ago.
+func (s *entityService) PurgeDeleted(ctx context.Context, retention time.Duration) (int64, error) {
+	if retention < 0 {
+		return 0, fmt.Errorf("service: retention must not be negative, got %s", retention)
+	}
+	if err := s.authorize(ctx, ActionPurge, nil); err != nil {
+		return 0, fmt.Errorf("service: failed to purge deleted entities: %w", err)
+	}
+
+	n, err := s.repo.Purge(ctx, time.Now().Add(-retention))
+	if err != nil {
+		return 0, fmt.Errorf("service: failed to purge deleted entities: %w", err)
+	}
+	return n, nil
+}
+
+// List retrieves a page of entities.
+func (s *entityService) List(ctx context.Context, opts domain.EntityListOptions) (*domain.EntityPage, error) {
+	switch {
+	case opts.Limit == 0:
+		opts.Limit = DefaultListLimit
+	case opts.Limit < 0 || opts.Limit > MaxListLimit:
+		return nil, invalidField("invalid_list_options", "limit", "out_of_range", fmt.Sprintf("must be between 1 and %d", MaxListLimit))
+	}
+
+	switch opts.SortBy {
+	case "":
+		opts.SortBy = domain.EntitySortByCreatedAt
+	case domain.EntitySortByCreatedAt, domain.EntitySortByUpdatedAt, domain.EntitySortByName:
+	default:
+		return nil, invalidField("invalid_list_options", "sort", "unsupported", fmt.Sprintf("cannot sort by %q", opts.SortBy))
+	}
+
+	switch opts.Deleted {
+	case domain.EntityDeletedExcluded, domain.EntityDeletedIncluded, domain.EntityDeletedOnly:
+	default:
+		return nil, invalidField("invalid_list_options", "deleted", "unsupported", fmt.Sprintf("unknown deleted filter %q", opts.Deleted))
+	}
+
+	if principal, ok := PrincipalFrom(ctx); ok {
+		ownerID, err := s.authz.ListScope(principal)
+		if err != nil {
+			return nil, fmt.Errorf("service: failed to list entities: %w", err)
+		}
+		if ownerID != "" {
+			opts.OwnerID = ownerID
+		}
+	}
+
+	opts.After = nil
+	if opts.Cursor != "" {
+		after, err := decodeCursor(opts.Cursor, opts)
+		if err != nil {
+			return nil, err
+		}
+		opts.After = after
+	}
+
+	// Fetch one extra entity to find out whether there is a next page.
+	limit := opts.Limit
+	opts.Limit++
+	entities, err := s.repo.List(ctx, opts)
 	if err != nil {
 		return nil, fmt.Errorf("service: failed to list entities: %w", err)
 	}
-	return entities, nil
+
+	page := &domain.EntityPage{Entities: entities}
+	if len(entities) > limit {
+		page.Entities = entities[:limit]
+		page.NextCursor = encodeCursor(entities[limit-1], opts)
+	}
+	return page, nil
+}
+
+// History retrieves a page of the audit log of an entity.
+func (s *entityService) History(ctx context.Context, opts domain.AuditListOptions) (*domain.AuditPage, error) {
+	switch {
+	case opts.Limit == 0:
+		opts.Limit = DefaultListLimit
+	case opts.Limit < 0 || opts.Limit > MaxListLimit:
+		return nil, invalidField("invalid_list_options", "limit", "out_of_range", fmt.Sprintf("must be between 1 and %d", MaxListLimit))
+	}
+
+	// Fetch one extra entry to find out whether there is a next page.
+	limit := opts.Limit
+	opts.Limit++
+	entries, err := s.audit.List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to list audit entries of entity with id %s: %w", opts.EntityID, err)
+	}
+
+	subject, err := s.historySubject(ctx, opts.EntityID, entries)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorize(ctx, ActionRead, subject); err != nil {
+		return nil, fmt.Errorf("service: failed to read the history of entity with id %s: %w", opts.EntityID, err)
+	}
+
+	page := &domain.AuditPage{Entries: entries}
+	if len(entries) > limit {
+		page.Entries = entries[:limit]
+		page.NextCursor = entries[limit-1].ID
+	}
+	return page, nil
+}
+
+// historySubject returns the entity whose history is read, as stored or, once
+// deleted, as last recorded in entries. Its owner, which never changes, decides
+// who may read the history.
+func (s *entityService) historySubject(ctx context.Context, id string, entries []*domain.AuditEntry) (*domain.Entity, error) {
+	entity, err := s.repo.FindByID(ctx, id)
+	if err == nil {
+		// An entity changed before the log existed has no history yet.
+		return entity, nil
+	}
+	if !errors.Is(err, apperror.ErrNotFound) {
+		return nil, fmt.Errorf("service: failed to find entity with id %s: %w", id, err)
+	}
+
+	if len(entries) == 0 {
+		// A page after the first one may be empty: go back to the first.
+		if entries, err = s.audit.List(ctx, domain.AuditListOptions{EntityID: id, Limit: 1}); err != nil {
+			return nil, fmt.Errorf("service: failed to list audit entries of entity with id %s: %w", id, err)
+		}
+	}
+	for _, entry := range entries {
+		subject := entry.After
+		if subject == nil {
+			subject = entry.Before
+		}
+		// The history of the entities of other tenants is not found either.
+		if subject != nil && subject.TenantID == TenantFrom(ctx) {
+			return subject, nil
+		}
+	}
+	return nil, fmt.Errorf("service: failed to find entity with id %s: %w", id, apperror.ErrNotFound)
+}
+
+// authorize checks that the principal of ctx, if any, may perform action on entity.
+func (s *entityService) authorize(ctx context.Context, action Action, entity *domain.Entity) error {
+	principal, ok := PrincipalFrom(ctx)
+	if !ok {
+		return nil
+	}
+	return s.authz.Authorize(principal, action, entity)
+}
+
+// newAuditEntry returns the audit entry of a change of the entity with the
+// given ID from before to after, made on behalf of the principal of ctx.
+func newAuditEntry(ctx context.Context, action domain.AuditAction, id string, before, after *domain.Entity) *domain.AuditEntry {
+	entry := &domain.AuditEntry{
+		ID:         uuid.New().String(),
+		EntityID:   id,
+		Action:     action,
+		Principal:  anonymousPrincipal,
+		RequestID:  RequestIDFrom(ctx),
+		OccurredAt: time.Now().UTC(),
+		Changes:    domain.DiffEntities(before, after),
+	}
+	if principal, ok := PrincipalFrom(ctx); ok {
+		entry.Principal = principal.ID
+	}
+	// Copy the entities, which the caller keeps.
+	if before != nil {
+		b := *before
+		entry.Before = &b
+	}
+	if after != nil {
+		a := *after
+		entry.After = &a
+	}
+	return entry
+}
+
+// record adds entries to the audit log of a unit of work.
+func record(ctx context.Context, repos Repositories, entries ...*domain.AuditEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	if err := repos.Audit.Add(ctx, entries); err != nil {
+		return fmt.Errorf("service: failed to record audit entries: %w", err)
+	}
+	return nil
+}
+
+// invalidEntity converts a domain validation error to an apperror.ErrInvalidInput
+// error that lists every violation.
+func invalidEntity(err error) error {
+	return invalidObject(err, "entity")
+}
+
+// invalidObject is invalidEntity for any kind of domain object, named by object.
+func invalidObject(err error, object string) error {
+	var verr *domain.ValidationError
+	if !errors.As(err, &verr) {
+		return fmt.Errorf("service: failed to validate %s: %w", object, err)
+	}
+
+	appErr := apperror.New(apperror.ErrInvalidInput, "invalid_"+object, "the "+object+" is invalid")
+	for _, v := range verr.Violations {
+		appErr.WithFields(apperror.FieldError{Field: v.Field, Code: v.Rule, Message: v.Message})
+	}
+	return appErr
+}
+
+// invalidField returns an apperror.ErrInvalidInput error for a single rejected field.
+func invalidField(code, field, rule, message string) error {
+	return apperror.New(apperror.ErrInvalidInput, code, "the request contains invalid fields").
+		WithFields(apperror.FieldError{Field: field, Code: rule, Message: message})
 }
@@ -2,8 +2,13 @@ package service
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"slices"
 	"testing"
+	"time"
 
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/apperror"
 	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
 	"github.com/google/uuid"
 )
@@ -13,8 +18,12 @@ type mockEntityRepository struct {
 	CreateFunc   func(ctx context.Context, entity *domain.Entity) error
 	FindByIDFunc func(ctx context.Context, id string) (*domain.Entity, error)
 	UpdateFunc   func(ctx context.Context, entity *domain.Entity) error
-	DeleteFunc   func(ctx context.Context, id string) error
-	ListFunc     func(ctx context.Context) ([]*domain.Entity, error)
+	DeleteFunc   func(ctx context.Context, id string, version int64) error
+	BatchFunc    func(ctx context.Context, ops []domain.EntityOperation, atomic bool) ([]error, error)
+	RestoreFunc  func(ctx context.Context, id string, version int64) (*domain.Entity, error)
+	PurgeFunc    func(ctx context.Context, deletedBefore time.Time) (int64, error)
+	ListFunc     func(ctx context.Context, opts domain.EntityListOptions) ([]*domain.Entity, error)
+	LockFunc     func(ctx context.Context, ids ...string) error
 }
 
 func (m *mockEntityRepository) Create(ctx context.Context, entity *domain.Entity) error {
@@ -29,19 +38,111 @@ func (m *mockEntityRepository) Update(ctx context.Context, entity *domain.Entity
 	return m.UpdateFunc(ctx, entity)
 }
 
-func (m *mockEntityRepository) Delete(ctx context.Context, id string) error {
-	return m.DeleteFunc(ctx, id)
+func (m *mockEntityRepository) Delete(ctx context.Context, id string, version int64) error {
+	return m.DeleteFunc(ctx, id, version)
 }
 
-func (m *mockEntityRepository) List(ctx context.Context) ([]*domain.Entity, error) {
-	return m.ListFunc(ctx)
+func (m *mockEntityRepository) Batch(ctx context.Context, ops []domain.EntityOperation, atomic bool) ([]error, error) {
+	return m.BatchFunc(ctx, ops, atomic)
+}
+
+func (m *mockEntityRepository) Restore(ctx context.Context, id string, version int64) (*domain.Entity, error) {
+	return m.RestoreFunc(ctx, id, version)
+}
+
+func (m *mockEntityRepository) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	return m.PurgeFunc(ctx, deletedBefore)
+}
+
+func (m *mockEntityRepository) List(ctx context.Context, opts domain.EntityListOptions) ([]*domain.Entity, error) {
+	return m.ListFunc(ctx, opts)
+}
+
+func (m *mockEntityRepository) Lock(ctx context.Context, ids ...string) error {
+	return m.LockFunc(ctx, ids...)
+}
+
+// mockOutboxRepository is a mock implementation of the OutboxRepository interface.
+type mockOutboxRepository struct {
+	AddFunc           func(ctx context.Context, messages []*domain.EventMessage) error
+	PendingFunc       func(ctx context.Context, limit int) ([]*domain.EventMessage, error)
+	MarkPublishedFunc func(ctx context.Context, ids []string) error
+}
+
+func (m *mockOutboxRepository) Add(ctx context.Context, messages []*domain.EventMessage) error {
+	return m.AddFunc(ctx, messages)
+}
+
+func (m *mockOutboxRepository) Pending(ctx context.Context, limit int) ([]*domain.EventMessage, error) {
+	return m.PendingFunc(ctx, limit)
+}
+
+func (m *mockOutboxRepository) MarkPublished(ctx context.Context, ids []string) error {
+	return m.MarkPublishedFunc(ctx, ids)
+}
+
+// mockAuditRepository is a mock implementation of the AuditRepository interface.
+type mockAuditRepository struct {
+	AddFunc  func(ctx context.Context, entries []*domain.AuditEntry) error
+	ListFunc func(ctx context.Context, opts domain.AuditListOptions) ([]*domain.AuditEntry, error)
+}
+
+func (m *mockAuditRepository) Add(ctx context.Context, entries []*domain.AuditEntry) error {
+	return m.AddFunc(ctx, entries)
+}
+
+func (m *mockAuditRepository) List(ctx context.Context, opts domain.AuditListOptions) ([]*domain.AuditEntry, error) {
+	return m.ListFunc(ctx, opts)
+}
+
+// mockUnitOfWork runs units of work directly against its repositories, without a transaction.
+type mockUnitOfWork struct {
+	repos Repositories
+}
+
+func (m *mockUnitOfWork) Do(ctx context.Context, fn func(repos Repositories) error) error {
+	return fn(m.repos)
+}
+
+// mockEventPublisher is a mock implementation of the EventPublisher interface.
+type mockEventPublisher struct {
+	PublishFunc func(ctx context.Context, message *domain.EventMessage) error
+}
+
+func (m *mockEventPublisher) Publish(ctx context.Context, message *domain.EventMessage) error {
+	return m.PublishFunc(ctx, message)
 }
 
 func TestEntityService(t *testing.T) {
 	mockRepo := &mockEntityRepository{}
-	service := NewEntityService(mockRepo)
+	mockOutbox := &mockOutboxRepository{}
+	mockAudit := &mockAuditRepository{}
+	service := NewEntityService(mockRepo, &mockUnitOfWork{repos: Repositories{Entities: mockRepo, Outbox: mockOutbox, Audit: mockAudit}}, mockAudit, NewRoleAuthorizer())
 	ctx := context.Background()
 
+	// events collects the types of the events added to the outbox.
+	var events []domain.EventType
+	mockOutbox.AddFunc = func(ctx context.Context, messages []*domain.EventMessage) error {
+		for _, m := range messages {
+			events = append(events, m.Type)
+		}
+		return nil
+	}
+
+	// locked collects the IDs locked up front by the units of work.
+	var locked []string
+	mockRepo.LockFunc = func(ctx context.Context, ids ...string) error {
+		locked = append(locked, ids...)
+		return nil
+	}
+
+	// audited collects the entries added to the audit log.
+	var audited []*domain.AuditEntry
+	mockAudit.AddFunc = func(ctx context.Context, entries []*domain.AuditEntry) error {
+		audited = append(audited, entries...)
+		return nil
+	}
+
 	t.Run("Create", func(t *testing.T) {
 		entity := &domain.Entity{Name: "Test"}
 		mockRepo.CreateFunc = func(ctx context.Context, e *domain.Entity) error {
@@ -55,10 +156,63 @@ func TestEntityService(t *testing.T) {
 			return nil
 		}
 
+		events = nil
 		err := service.Create(ctx, entity)
 		if err != nil {
 			t.Fatalf("expected no error, got %v", err)
 		}
+		if !slices.Equal(events, []domain.EventType{domain.EventEntityCreated}) {
+			t.Errorf("expected an entity.created event, got %v", events)
+		}
+	})
+
+	t.Run("Create outbox failure", func(t *testing.T) {
+		mockRepo.CreateFunc = func(ctx context.Context, e *domain.Entity) error {
+			return nil
+		}
+		addFunc := mockOutbox.AddFunc
+		defer func() { mockOutbox.AddFunc = addFunc }()
+		outboxErr := errors.New("outbox unavailable")
+		mockOutbox.AddFunc = func(ctx context.Context, messages []*domain.EventMessage) error {
+			return outboxErr
+		}
+
+		if err := service.Create(ctx, &domain.Entity{Name: "Test"}); !errors.Is(err, outboxErr) {
+			t.Errorf("expected the outbox error, got %v", err)
+		}
+	})
+
+	t.Run("Create audit failure", func(t *testing.T) {
+		mockRepo.CreateFunc = func(ctx context.Context, e *domain.Entity) error {
+			return nil
+		}
+		// The entries are added in the unit of work, whose failure rolls back the change.
+		auditErr := errors.New("audit log unavailable")
+		failing := &mockAuditRepository{AddFunc: func(ctx context.Context, entries []*domain.AuditEntry) error {
+			return auditErr
+		}}
+		uow := &mockUnitOfWork{repos: Repositories{Entities: mockRepo, Outbox: mockOutbox, Audit: failing}}
+		svc := NewEntityService(mockRepo, uow, mockAudit, NewRoleAuthorizer())
+
+		if err := svc.Create(ctx, &domain.Entity{Name: "Test"}); !errors.Is(err, auditErr) {
+			t.Errorf("expected the audit error, got %v", err)
+		}
+	})
+
+	t.Run("Create invalid", func(t *testing.T) {
+		mockRepo.CreateFunc = func(ctx context.Context, e *domain.Entity) error {
+			t.Error("expected invalid entity not to reach the repository")
+			return nil
+		}
+
+		err := service.Create(ctx, &domain.Entity{Name: "   "})
+		if !errors.Is(err, apperror.ErrInvalidInput) {
+			t.Fatalf("expected ErrInvalidInput, got %v", err)
+		}
+		var appErr *apperror.Error
+		if !errors.As(err, &appErr) || len(appErr.Fields) != 1 || appErr.Fields[0].Field != "name" || appErr.Fields[0].Code != "required" {
+			t.Errorf("expected a required name field error, got %v", err)
+		}
 	})
 
 	t.Run("GetByID", func(t *testing.T) {
@@ -75,4 +229,649 @@ func TestEntityService(t *testing.T) {
 			t.Errorf("expected entity with ID 1, got %s", entity.ID)
 		}
 	})
+	t.Run("Patch", func(t *testing.T) {
+		mockRepo.FindByIDFunc = func(ctx context.Context, id string) (*domain.Entity, error) {
+			return &domain.Entity{ID: id, Name: "Old", Version: 2}, nil
+		}
+		mockRepo.UpdateFunc = func(ctx context.Context, e *domain.Entity) error {
+			if e.Version != 2 {
+				t.Errorf("expected the update to require version 2, got %d", e.Version)
+			}
+			e.Version++
+			return nil
+		}
+
+		patch := func(e *domain.Entity) error {
+			e.Name = "  Renamed  "
+			e.ID = "other"
+			e.Version = 42
+			return nil
+		}
+		entity, err := service.Patch(ctx, "1", 2, patch)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if entity.ID != "1" || entity.Name != "Renamed" || entity.Version != 3 {
+			t.Errorf("expected entity 1 named Renamed at version 3, got %+v", entity)
+		}
+	})
+
+	t.Run("Patch stale version", func(t *testing.T) {
+		mockRepo.FindByIDFunc = func(ctx context.Context, id string) (*domain.Entity, error) {
+			return &domain.Entity{ID: id, Name: "Old", Version: 2}, nil
+		}
+
+		_, err := service.Patch(ctx, "1", 1, func(e *domain.Entity) error {
+			t.Error("expected the patch not to be applied")
+			return nil
+		})
+		if !errors.Is(err, apperror.ErrPreconditionFailed) {
+			t.Errorf("expected ErrPreconditionFailed, got %v", err)
+		}
+	})
+
+	t.Run("Patch invalid result", func(t *testing.T) {
+		mockRepo.FindByIDFunc = func(ctx context.Context, id string) (*domain.Entity, error) {
+			return &domain.Entity{ID: id, Name: "Old", Version: 2}, nil
+		}
+		mockRepo.UpdateFunc = func(ctx context.Context, e *domain.Entity) error {
+			t.Error("expected invalid entity not to reach the repository")
+			return nil
+		}
+
+		_, err := service.Patch(ctx, "1", 0, func(e *domain.Entity) error {
+			e.Name = ""
+			return nil
+		})
+		if !errors.Is(err, apperror.ErrInvalidInput) {
+			t.Errorf("expected ErrInvalidInput, got %v", err)
+		}
+	})
+
+	t.Run("Patch retries concurrent updates", func(t *testing.T) {
+		var version int64 = 1
+		mockRepo.FindByIDFunc = func(ctx context.Context, id string) (*domain.Entity, error) {
+			return &domain.Entity{ID: id, Name: "Old", Version: version}, nil
+		}
+		mockRepo.UpdateFunc = func(ctx context.Context, e *domain.Entity) error {
+			// Another writer wins the first attempt.
+			if version == 1 {
+				version = 2
+				return apperror.ErrPreconditionFailed
+			}
+			e.Version++
+			return nil
+		}
+
+		applied := 0
+		entity, err := service.Patch(ctx, "1", 0, func(e *domain.Entity) error {
+			applied++
+			e.Name = "Renamed"
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if applied != 2 || entity.Version != 3 {
+			t.Errorf("expected the patch to be applied twice and reach version 3, got %d and %d", applied, entity.Version)
+		}
+	})
+
+	t.Run("Batch", func(t *testing.T) {
+		mockRepo.BatchFunc = func(ctx context.Context, ops []domain.EntityOperation, atomic bool) ([]error, error) {
+			if len(ops) != 2 || atomic {
+				t.Errorf("expected the 2 valid operations in best-effort mode, got %d, atomic %v", len(ops), atomic)
+			}
+			if _, err := uuid.Parse(ops[0].Entity.ID); err != nil {
+				t.Errorf("expected a UUID for the created entity, got %q", ops[0].Entity.ID)
+			}
+			return []error{nil, apperror.ErrNotFound}, nil
+		}
+
+		events, locked = nil, nil
+		errs, err := service.Batch(ctx, []domain.EntityOperation{
+			{Kind: domain.EntityOperationCreate, Entity: &domain.Entity{Name: "Test"}},
+			{Kind: domain.EntityOperationUpdate, Entity: &domain.Entity{ID: "1"}},
+			{Kind: domain.EntityOperationDelete, Entity: &domain.Entity{ID: "2"}},
+		}, false)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(locked) != 2 || locked[1] != "2" {
+			t.Errorf("expected the created entity and entity 2 to be locked, got %v", locked)
+		}
+		if errs[0] != nil || !errors.Is(errs[1], apperror.ErrInvalidInput) || !errors.Is(errs[2], apperror.ErrNotFound) {
+			t.Errorf("expected nil, ErrInvalidInput and ErrNotFound, got %v", errs)
+		}
+		if !slices.Equal(events, []domain.EventType{domain.EventEntityCreated}) {
+			t.Errorf("expected an event for the successful operation only, got %v", events)
+		}
+	})
+
+	t.Run("Audit", func(t *testing.T) {
+		ctx := WithRequestID(WithPrincipal(ctx, domain.Principal{ID: "alice", Roles: []domain.Role{domain.RoleAdmin}}), "req-1")
+		mockRepo.FindByIDFunc = func(ctx context.Context, id string) (*domain.Entity, error) {
+			return &domain.Entity{ID: id, Name: "Old", Version: 2}, nil
+		}
+		mockRepo.UpdateFunc = func(ctx context.Context, e *domain.Entity) error {
+			e.Version++
+			return nil
+		}
+		mockRepo.DeleteFunc = func(ctx context.Context, id string, version int64) error {
+			return nil
+		}
+
+		audited = nil
+		if err := service.Update(ctx, &domain.Entity{ID: "1", Name: "Renamed", Version: 2}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := service.Delete(ctx, "1", 0); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(audited) != 2 {
+			t.Fatalf("expected 2 audit entries, got %d", len(audited))
+		}
+
+		update := audited[0]
+		if update.EntityID != "1" || update.Action != domain.AuditActionUpdate || update.Principal != "alice" ||
+			update.RequestID != "req-1" || update.OccurredAt.IsZero() {
+			t.Errorf("expected an update of entity 1 by alice in req-1, got %+v", update)
+		}
+		if update.Before == nil || update.Before.Name != "Old" || update.After == nil || update.After.Name != "Renamed" {
+			t.Errorf("expected the entity before and after the update, got %+v and %+v", update.Before, update.After)
+		}
+		want := []domain.FieldChange{{Field: "name", Before: "Old", After: "Renamed"}, {Field: "version", Before: int64(2), After: int64(3)}}
+		if !slices.Equal(update.Changes, want) {
+			t.Errorf("expected changes %v, got %v", want, update.Changes)
+		}
+
+		if deleted := audited[1]; deleted.Action != domain.AuditActionDelete || deleted.Before == nil || deleted.After != nil {
+			t.Errorf("expected a delete with the entity before it, got %+v", deleted)
+		}
+	})
+
+	t.Run("Audit without principal", func(t *testing.T) {
+		mockRepo.CreateFunc = func(ctx context.Context, e *domain.Entity) error {
+			return nil
+		}
+
+		audited = nil
+		if err := service.Create(ctx, &domain.Entity{Name: "Test"}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(audited) != 1 || audited[0].Principal != anonymousPrincipal || audited[0].Before != nil {
+			t.Errorf("expected an anonymous create, got %+v", audited)
+		}
+	})
+
+	t.Run("Audit skips failed changes", func(t *testing.T) {
+		mockRepo.UpdateFunc = func(ctx context.Context, e *domain.Entity) error {
+			return apperror.ErrPreconditionFailed
+		}
+
+		audited = nil
+		if err := service.Update(ctx, &domain.Entity{ID: "1", Name: "Renamed", Version: 1}); !errors.Is(err, apperror.ErrPreconditionFailed) {
+			t.Fatalf("expected ErrPreconditionFailed, got %v", err)
+		}
+		if len(audited) != 0 {
+			t.Errorf("expected no audit entry, got %+v", audited)
+		}
+	})
+
+	t.Run("History", func(t *testing.T) {
+		stored := []*domain.AuditEntry{{ID: "a1", EntityID: "1"}, {ID: "a2", EntityID: "1"}, {ID: "a3", EntityID: "1"}}
+		mockAudit.ListFunc = func(ctx context.Context, opts domain.AuditListOptions) ([]*domain.AuditEntry, error) {
+			if opts.EntityID != "1" {
+				return nil, nil
+			}
+			start := 0
+			for i, e := range stored {
+				if e.ID == opts.Cursor {
+					start = i + 1
+				}
+			}
+			return stored[start:min(start+opts.Limit, len(stored))], nil
+		}
+
+		page, err := service.History(ctx, domain.AuditListOptions{EntityID: "1", Limit: 2})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(page.Entries) != 2 || page.NextCursor != "a2" {
+			t.Fatalf("expected 2 entries and a next cursor, got %d entries and cursor %q", len(page.Entries), page.NextCursor)
+		}
+
+		page, err = service.History(ctx, domain.AuditListOptions{EntityID: "1", Limit: 2, Cursor: page.NextCursor})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(page.Entries) != 1 || page.Entries[0].ID != "a3" || page.NextCursor != "" {
+			t.Fatalf("expected last entry and no next cursor, got %+v", page)
+		}
+
+		if _, err := service.History(ctx, domain.AuditListOptions{EntityID: "1", Limit: MaxListLimit + 1}); !errors.Is(err, apperror.ErrInvalidInput) {
+			t.Errorf("expected ErrInvalidInput, got %v", err)
+		}
+	})
+
+	t.Run("History unknown entity", func(t *testing.T) {
+		mockAudit.ListFunc = func(ctx context.Context, opts domain.AuditListOptions) ([]*domain.AuditEntry, error) {
+			return nil, nil
+		}
+		mockRepo.FindByIDFunc = func(ctx context.Context, id string) (*domain.Entity, error) {
+			if id == "live" {
+				return &domain.Entity{ID: id, Name: "Test", Version: 1}, nil
+			}
+			return nil, apperror.ErrNotFound
+		}
+
+		if _, err := service.History(ctx, domain.AuditListOptions{EntityID: "missing"}); !errors.Is(err, apperror.ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+		page, err := service.History(ctx, domain.AuditListOptions{EntityID: "live"})
+		if err != nil || len(page.Entries) != 0 {
+			t.Errorf("expected an empty history for an entity changed before the log existed, got %+v and %v", page, err)
+		}
+	})
+
+	t.Run("Tenant", func(t *testing.T) {
+		acme := WithTenant(ctx, "acme")
+		addFunc := mockOutbox.AddFunc
+		defer func() { mockOutbox.AddFunc = addFunc }()
+		var messages []*domain.EventMessage
+		mockOutbox.AddFunc = func(ctx context.Context, added []*domain.EventMessage) error {
+			messages = append(messages, added...)
+			return nil
+		}
+		mockRepo.CreateFunc = func(ctx context.Context, e *domain.Entity) error {
+			return nil
+		}
+
+		if err := service.Create(acme, &domain.Entity{Name: "Test"}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(messages) != 1 || messages[0].TenantID != "acme" {
+			t.Errorf("expected an event of acme, got %+v", messages)
+		}
+
+		// The history of a deleted entity is only found in its tenant.
+		mockRepo.FindByIDFunc = func(ctx context.Context, id string) (*domain.Entity, error) {
+			return nil, apperror.ErrNotFound
+		}
+		mockAudit.ListFunc = func(ctx context.Context, opts domain.AuditListOptions) ([]*domain.AuditEntry, error) {
+			deleted := &domain.Entity{ID: "1", Name: "Test", TenantID: "acme", Version: 1}
+			return []*domain.AuditEntry{{ID: "a1", EntityID: "1", Action: domain.AuditActionDelete, Before: deleted}}, nil
+		}
+		if _, err := service.History(acme, domain.AuditListOptions{EntityID: "1"}); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+		if _, err := service.History(WithTenant(ctx, "globex"), domain.AuditListOptions{EntityID: "1"}); !errors.Is(err, apperror.ErrNotFound) {
+			t.Errorf("expected ErrNotFound from another tenant, got %v", err)
+		}
+	})
+
+	t.Run("Batch atomic with invalid operation", func(t *testing.T) {
+		mockRepo.BatchFunc = func(ctx context.Context, ops []domain.EntityOperation, atomic bool) ([]error, error) {
+			t.Error("expected the repository not to be called")
+			return nil, nil
+		}
+
+		errs, err := service.Batch(ctx, []domain.EntityOperation{
+			{Kind: domain.EntityOperationCreate, Entity: &domain.Entity{Name: "Test"}},
+			{Kind: "upsert", Entity: &domain.Entity{ID: "1", Name: "Test"}},
+		}, true)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !errors.Is(errs[0], apperror.ErrAborted) || !errors.Is(errs[1], apperror.ErrInvalidInput) {
+			t.Errorf("expected ErrAborted and ErrInvalidInput, got %v", errs)
+		}
+	})
+
+	t.Run("Batch size", func(t *testing.T) {
+		for _, n := range []int{0, MaxBatchSize + 1} {
+			ops := make([]domain.EntityOperation, n)
+			if _, err := service.Batch(ctx, ops, true); !errors.Is(err, apperror.ErrInvalidInput) {
+				t.Errorf("expected ErrInvalidInput for %d operations, got %v", n, err)
+			}
+		}
+	})
+
+	t.Run("Restore", func(t *testing.T) {
+		mockRepo.RestoreFunc = func(ctx context.Context, id string, version int64) (*domain.Entity, error) {
+			if id != "1" || version != 2 {
+				t.Errorf("expected to restore entity 1 at version 2, got %s at %d", id, version)
+			}
+			return &domain.Entity{ID: id, Name: "Test", Version: 3}, nil
+		}
+
+		entity, err := service.Restore(ctx, "1", 2)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if entity.Version != 3 {
+			t.Errorf("expected version 3, got %d", entity.Version)
+		}
+	})
+
+	t.Run("Restore entity not deleted", func(t *testing.T) {
+		mockRepo.RestoreFunc = func(ctx context.Context, id string, version int64) (*domain.Entity, error) {
+			return nil, apperror.ErrNotFound
+		}
+		mockRepo.FindByIDFunc = func(ctx context.Context, id string) (*domain.Entity, error) {
+			if id == "live" {
+				return &domain.Entity{ID: id, Name: "Test", Version: 1}, nil
+			}
+			return nil, apperror.ErrNotFound
+		}
+
+		if _, err := service.Restore(ctx, "live", 0); !errors.Is(err, apperror.ErrConflict) {
+			t.Errorf("expected ErrConflict, got %v", err)
+		}
+		if _, err := service.Restore(ctx, "missing", 0); !errors.Is(err, apperror.ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("PurgeDeleted", func(t *testing.T) {
+		var gotBefore time.Time
+		mockRepo.PurgeFunc = func(ctx context.Context, deletedBefore time.Time) (int64, error) {
+			gotBefore = deletedBefore
+			return 2, nil
+		}
+
+		n, err := service.PurgeDeleted(ctx, time.Hour)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if n != 2 {
+			t.Errorf("expected 2 purged entities, got %d", n)
+		}
+		if age := time.Since(gotBefore); age < time.Hour || age > time.Hour+time.Minute {
+			t.Errorf("expected entities deleted an hour ago to be purged, got %s", gotBefore)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		stored := []*domain.Entity{{ID: "1", Name: "A"}, {ID: "2", Name: "B"}, {ID: "3", Name: "C"}}
+		mockRepo.ListFunc = func(ctx context.Context, opts domain.EntityListOptions) ([]*domain.Entity, error) {
+			start := 0
+			if opts.After != nil {
+				for i, e := range stored {
+					if e.ID == opts.After.ID {
+						start = i + 1
+					}
+				}
+			}
+			end := min(start+opts.Limit, len(stored))
+			return stored[start:end], nil
+		}
+
+		opts := domain.EntityListOptions{Limit: 2, SortBy: domain.EntitySortByName}
+		page, err := service.List(ctx, opts)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(page.Entities) != 2 || page.NextCursor == "" {
+			t.Fatalf("expected 2 entities and a next cursor, got %d entities and cursor %q", len(page.Entities), page.NextCursor)
+		}
+
+		opts.Cursor = page.NextCursor
+		page, err = service.List(ctx, opts)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(page.Entities) != 1 || page.Entities[0].ID != "3" || page.NextCursor != "" {
+			t.Fatalf("expected last entity and no next cursor, got %+v", page)
+		}
+	})
+
+	t.Run("Authorization", func(t *testing.T) {
+		alice := WithPrincipal(ctx, domain.Principal{ID: "alice", Roles: []domain.Role{domain.RoleEditor}})
+		bob := WithPrincipal(ctx, domain.Principal{ID: "bob", Roles: []domain.Role{domain.RoleEditor}})
+		mockRepo.FindByIDFunc = func(ctx context.Context, id string) (*domain.Entity, error) {
+			return &domain.Entity{ID: id, Name: "Test", OwnerID: "alice", Version: 1}, nil
+		}
+		mockRepo.CreateFunc = func(ctx context.Context, e *domain.Entity) error {
+			return nil
+		}
+		mockRepo.UpdateFunc = func(ctx context.Context, e *domain.Entity) error {
+			t.Error("expected the repository not to be called")
+			return nil
+		}
+		mockRepo.DeleteFunc = func(ctx context.Context, id string, version int64) error {
+			t.Error("expected the repository not to be called")
+			return nil
+		}
+
+		entity := &domain.Entity{Name: "Test", OwnerID: "mallory"}
+		if err := service.Create(alice, entity); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if entity.OwnerID != "alice" {
+			t.Errorf("expected the creator to own the entity, got %q", entity.OwnerID)
+		}
+
+		if _, err := service.GetByID(alice, "1"); err != nil {
+			t.Errorf("expected the owner to read the entity, got %v", err)
+		}
+		if _, err := service.GetByID(bob, "1"); !errors.Is(err, apperror.ErrForbidden) {
+			t.Errorf("expected ErrForbidden, got %v", err)
+		}
+		if err := service.Update(bob, &domain.Entity{ID: "1", Name: "Renamed"}); !errors.Is(err, apperror.ErrForbidden) {
+			t.Errorf("expected ErrForbidden, got %v", err)
+		}
+		if err := service.Delete(bob, "1", 0); !errors.Is(err, apperror.ErrForbidden) {
+			t.Errorf("expected ErrForbidden, got %v", err)
+		}
+		if _, err := service.PurgeDeleted(alice, time.Hour); !errors.Is(err, apperror.ErrForbidden) {
+			t.Errorf("expected ErrForbidden, got %v", err)
+		}
+	})
+
+	t.Run("Batch atomic with forbidden operation", func(t *testing.T) {
+		bob := WithPrincipal(ctx, domain.Principal{ID: "bob", Roles: []domain.Role{domain.RoleEditor}})
+		mockRepo.FindByIDFunc = func(ctx context.Context, id string) (*domain.Entity, error) {
+			return &domain.Entity{ID: id, Name: "Test", OwnerID: "alice", Version: 1}, nil
+		}
+		mockRepo.BatchFunc = func(ctx context.Context, ops []domain.EntityOperation, atomic bool) ([]error, error) {
+			t.Error("expected the repository not to be called")
+			return nil, nil
+		}
+
+		errs, err := service.Batch(bob, []domain.EntityOperation{
+			{Kind: domain.EntityOperationCreate, Entity: &domain.Entity{Name: "Test"}},
+			{Kind: domain.EntityOperationDelete, Entity: &domain.Entity{ID: "1"}},
+		}, true)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !errors.Is(errs[0], apperror.ErrAborted) || !errors.Is(errs[1], apperror.ErrForbidden) {
+			t.Errorf("expected ErrAborted and ErrForbidden, got %v", errs)
+		}
+	})
+
+	t.Run("List scope", func(t *testing.T) {
+		var gotOwner string
+		mockRepo.ListFunc = func(ctx context.Context, opts domain.EntityListOptions) ([]*domain.Entity, error) {
+			gotOwner = opts.OwnerID
+			return nil, nil
+		}
+
+		tests := []struct {
+			name  string
+			roles []domain.Role
+			owner string
+		}{
+			{"reader", []domain.Role{domain.RoleReader}, ""},
+			{"editor", []domain.Role{domain.RoleEditor}, "alice"},
+			{"admin", []domain.Role{domain.RoleEditor, domain.RoleAdmin}, ""},
+		}
+		for _, tt := range tests {
+			gotOwner = "unset"
+			ctx := WithPrincipal(ctx, domain.Principal{ID: "alice", Roles: tt.roles})
+			if _, err := service.List(ctx, domain.EntityListOptions{OwnerID: "bob"}); err != nil {
+				t.Errorf("%s: expected no error, got %v", tt.name, err)
+				continue
+			}
+			want := tt.owner
+			if want == "" {
+				want = "bob"
+			}
+			if gotOwner != want {
+				t.Errorf("%s: expected to list the entities of %q, got %q", tt.name, want, gotOwner)
+			}
+		}
+
+		if _, err := service.List(WithPrincipal(ctx, domain.Principal{ID: "alice"}), domain.EntityListOptions{}); !errors.Is(err, apperror.ErrForbidden) {
+			t.Errorf("expected ErrForbidden without a role, got %v", err)
+		}
+	})
+
+	t.Run("List invalid options", func(t *testing.T) {
+		mockRepo.ListFunc = func(ctx context.Context, opts domain.EntityListOptions) ([]*domain.Entity, error) {
+			return nil, nil
+		}
+
+		cursor := encodeCursor(&domain.Entity{ID: "1"}, domain.EntityListOptions{SortBy: domain.EntitySortByCreatedAt, Deleted: domain.EntityDeletedExcluded})
+
+		tests := []struct {
+			name string
+			opts domain.EntityListOptions
+		}{
+			{"negative limit", domain.EntityListOptions{Limit: -1}},
+			{"limit too large", domain.EntityListOptions{Limit: MaxListLimit + 1}},
+			{"unknown sort field", domain.EntityListOptions{SortBy: "color"}},
+			{"unknown deleted filter", domain.EntityListOptions{Deleted: "sometimes"}},
+			{"malformed cursor", domain.EntityListOptions{Cursor: "not a cursor"}},
+			{"cursor for another order", domain.EntityListOptions{Cursor: cursor, Descending: true}},
+			{"cursor for another name prefix", domain.EntityListOptions{Cursor: cursor, NamePrefix: "Te"}},
+			{"cursor for another creation time", domain.EntityListOptions{Cursor: cursor, CreatedAfter: time.Unix(0, 0)}},
+			{"cursor for deleted entities", domain.EntityListOptions{Cursor: cursor, Deleted: domain.EntityDeletedOnly}},
+		}
+		for _, tt := range tests {
+			if _, err := service.List(ctx, tt.opts); !errors.Is(err, apperror.ErrInvalidInput) {
+				t.Errorf("%s: expected ErrInvalidInput, got %v", tt.name, err)
+			}
+		}
+	})
+
+	t.Run("Events carry the owner of their entity", func(t *testing.T) {
+		mockRepo.FindByIDFunc = func(ctx context.Context, id string) (*domain.Entity, error) {
+			return &domain.Entity{ID: id, Name: "Test", OwnerID: "alice", Version: 1}, nil
+		}
+		mockRepo.DeleteFunc = func(ctx context.Context, id string, version int64) error {
+			return nil
+		}
+		mockRepo.BatchFunc = func(ctx context.Context, ops []domain.EntityOperation, atomic bool) ([]error, error) {
+			return make([]error, len(ops)), nil
+		}
+		add := mockOutbox.AddFunc
+		defer func() { mockOutbox.AddFunc = add }()
+		var owners []string
+		mockOutbox.AddFunc = func(ctx context.Context, messages []*domain.EventMessage) error {
+			for _, m := range messages {
+				owners = append(owners, m.OwnerID)
+			}
+			return nil
+		}
+
+		if err := service.Delete(ctx, "1", 0); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := service.Batch(ctx, []domain.EntityOperation{{Kind: domain.EntityOperationDelete, Entity: &domain.Entity{ID: "2"}}}, true); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !slices.Equal(owners, []string{"alice", "alice"}) {
+			t.Errorf("expected the deletions to carry the owner alice, got %v", owners)
+		}
+	})
+}
+
+func TestEventRelay(t *testing.T) {
+	mockOutbox := &mockOutboxRepository{}
+	mockPublisher := &mockEventPublisher{}
+	relay := NewEventRelay(mockOutbox, mockPublisher)
+	ctx := context.Background()
+
+	entity := domain.Entity{ID: "1", Name: "Test", Version: 1}
+	created, err := newEventMessage(domain.EntityCreated{Entity: entity})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	deleted, err := newEventMessage(domain.EntityDeleted{ID: "1"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	t.Run("Encoding", func(t *testing.T) {
+		if created.Type != domain.EventEntityCreated || created.EntityID != "1" || created.ID == "" {
+			t.Errorf("unexpected message %+v", created)
+		}
+		var payload struct {
+			Entity struct {
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"entity"`
+		}
+		if err := json.Unmarshal(created.Payload, &payload); err != nil {
+			t.Fatalf("could not decode payload: %v", err)
+		}
+		if payload.Entity.ID != "1" || payload.Entity.Name != "Test" {
+			t.Errorf("expected the entity in the payload, got %s", created.Payload)
+		}
+		if string(deleted.Payload) != `{"id":"1"}` {
+			t.Errorf("expected the ID in the payload, got %s", deleted.Payload)
+		}
+	})
+
+	t.Run("Relay", func(t *testing.T) {
+		mockOutbox.PendingFunc = func(ctx context.Context, limit int) ([]*domain.EventMessage, error) {
+			if limit != 10 {
+				t.Errorf("expected limit 10, got %d", limit)
+			}
+			return []*domain.EventMessage{created, deleted}, nil
+		}
+		var published []string
+		mockPublisher.PublishFunc = func(ctx context.Context, message *domain.EventMessage) error {
+			published = append(published, message.ID)
+			return nil
+		}
+		var marked []string
+		mockOutbox.MarkPublishedFunc = func(ctx context.Context, ids []string) error {
+			marked = ids
+			return nil
+		}
+
+		n, err := relay.Relay(ctx, 10)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		want := []string{created.ID, deleted.ID}
+		if n != 2 || !slices.Equal(published, want) || !slices.Equal(marked, want) {
+			t.Errorf("expected both events published and marked in order, got %d, %v and %v", n, published, marked)
+		}
+	})
+
+	t.Run("Relay stops at the first failure", func(t *testing.T) {
+		mockOutbox.PendingFunc = func(ctx context.Context, limit int) ([]*domain.EventMessage, error) {
+			return []*domain.EventMessage{created, deleted}, nil
+		}
+		publishErr := errors.New("receiver unavailable")
+		mockPublisher.PublishFunc = func(ctx context.Context, message *domain.EventMessage) error {
+			if message.ID == deleted.ID {
+				t.Error("expected the events after the failure not to be published")
+			}
+			return publishErr
+		}
+		mockOutbox.MarkPublishedFunc = func(ctx context.Context, ids []string) error {
+			t.Errorf("expected no event to be marked, got %v", ids)
+			return nil
+		}
+
+		n, err := relay.Relay(ctx, 10)
+		if !errors.Is(err, publishErr) || n != 0 {
+			t.Errorf("expected the publish error and no published event, got %v and %d", err, n)
+		}
+	})
 }
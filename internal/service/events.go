@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+
+	"github.com/google/uuid"
+)
+
+// entityPayload is the JSON encoding of an entity in event payloads.
+type entityPayload struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	TenantID  string     `json:"tenantId,omitempty"`
+	OwnerID   string     `json:"ownerId,omitempty"`
+	Version   int64      `json:"version"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+}
+
+// newEntityPayload converts a domain.Entity to an entityPayload.
+func newEntityPayload(entity domain.Entity) *entityPayload {
+	payload := &entityPayload{
+		ID:        entity.ID,
+		Name:      entity.Name,
+		TenantID:  entity.TenantID,
+		OwnerID:   entity.OwnerID,
+		Version:   entity.Version,
+		CreatedAt: entity.CreatedAt,
+		UpdatedAt: entity.UpdatedAt,
+	}
+	if entity.IsDeleted() {
+		payload.DeletedAt = &entity.DeletedAt
+	}
+	return payload
+}
+
+// newEventMessage encodes an event for the outbox.
+//
+// Events about a stored entity are encoded as {"entity": {...}}, and
+// EntityDeleted as {"id": "..."}.
+func newEventMessage(event domain.Event) (*domain.EventMessage, error) {
+	var (
+		payload any
+		ownerID string
+	)
+	switch e := event.(type) {
+	case domain.EntityCreated:
+		payload, ownerID = map[string]any{"entity": newEntityPayload(e.Entity)}, e.Entity.OwnerID
+	case domain.EntityUpdated:
+		payload, ownerID = map[string]any{"entity": newEntityPayload(e.Entity)}, e.Entity.OwnerID
+	case domain.EntityRestored:
+		payload, ownerID = map[string]any{"entity": newEntityPayload(e.Entity)}, e.Entity.OwnerID
+	case domain.EntityDeleted:
+		payload, ownerID = map[string]any{"id": e.ID}, e.OwnerID
+	default:
+		return nil, fmt.Errorf("service: unknown event type %T", event)
+	}
+
+	js, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to encode %s event: %w", event.EventType(), err)
+	}
+	return &domain.EventMessage{
+		ID:         uuid.New().String(),
+		Type:       event.EventType(),
+		EntityID:   event.EntityID(),
+		OccurredAt: time.Now().UTC(),
+		OwnerID:    ownerID,
+		Payload:    js,
+	}, nil
+}
+
+// emit adds events to the outbox of a unit of work, in the tenant of ctx.
+func emit(ctx context.Context, repos Repositories, events ...domain.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	messages := make([]*domain.EventMessage, len(events))
+	for i, event := range events {
+		message, err := newEventMessage(event)
+		if err != nil {
+			return err
+		}
+		message.TenantID = TenantFrom(ctx)
+		messages[i] = message
+	}
+
+	if err := repos.Outbox.Add(ctx, messages); err != nil {
+		return fmt.Errorf("service: failed to add events to the outbox: %w", err)
+	}
+	return nil
+}
+
+// eventRelay is a concrete implementation of the EventRelay interface.
+type eventRelay struct {
+	outbox    OutboxRepository
+	publisher EventPublisher
+}
+
+// NewEventRelay creates a new eventRelay instance, which publishes the events
+// of outbox with publisher.
+func NewEventRelay(outbox OutboxRepository, publisher EventPublisher) EventRelay {
+	return &eventRelay{
+		outbox:    outbox,
+		publisher: publisher,
+	}
+}
+
+// Relay publishes at most limit pending events, in order.
+// An event is removed from the outbox only after it is published, so a crash
+// in between publishes it again.
+func (r *eventRelay) Relay(ctx context.Context, limit int) (int, error) {
+	messages, err := r.outbox.Pending(ctx, limit)
+	if err != nil {
+		return 0, fmt.Errorf("service: failed to read the outbox: %w", err)
+	}
+
+	published := make([]string, 0, len(messages))
+	var publishErr error
+	for _, message := range messages {
+		if err := r.publisher.Publish(ctx, message); err != nil {
+			publishErr = fmt.Errorf("service: failed to publish event %s: %w", message.ID, err)
+			break
+		}
+		published = append(published, message.ID)
+	}
+
+	if len(published) > 0 {
+		if err := r.outbox.MarkPublished(ctx, published); err != nil {
+			return 0, fmt.Errorf("service: failed to mark events as published: %w", err)
+		}
+	}
+	return len(published), publishErr
+}
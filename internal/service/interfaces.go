@@ -2,24 +2,301 @@ package service
 
 import (
 	"context"
+	"time"
 
 	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
 )
 
 // EntityRepository defines the contract for data persistence operations for Entities.
+//
+// Entities belong to the tenant of the context they are created in; see
+// WithTenant. Every method but Purge only reaches the entities of the tenant
+// of its context, and reports those of other tenants as not found.
 type EntityRepository interface {
+	// Create stores a new entity in the tenant of ctx. IDs are unique across
+	// tenants. On success, entity holds the stored values, including the
+	// tenant, version and timestamps set by the repository.
 	Create(ctx context.Context, entity *domain.Entity) error
+
+	// FindByID returns the entity with the given ID. Deleted entities are not found.
 	FindByID(ctx context.Context, id string) (*domain.Entity, error)
+
+	// Update replaces the entity if entity.Version is zero or matches the stored
+	// version, and returns apperror.ErrPreconditionFailed otherwise.
+	// On success, entity holds the stored values, including the new version.
+	// Deleted entities are not found.
 	Update(ctx context.Context, entity *domain.Entity) error
+
+	// Delete moves the entity to the trash if version is zero or matches the
+	// stored version, and returns apperror.ErrPreconditionFailed otherwise.
+	// It sets DeletedAt and increments the version. Deleted entities are not found.
+	Delete(ctx context.Context, id string, version int64) error
+
+	// Batch applies ops in order, each with the semantics of Create, Update or
+	// Delete, and returns one error per operation, nil for those that succeeded.
+	// If atomic is set, either every operation is applied or none is: on the
+	// first failure, everything is rolled back, the failed operation reports its
+	// error and every other operation reports apperror.ErrAborted.
+	// The returned error is for failures of the batch as a whole.
+	Batch(ctx context.Context, ops []domain.EntityOperation, atomic bool) ([]error, error)
+
+	// Restore takes a deleted entity out of the trash, with the same version
+	// check as Delete, and returns the stored entity. It clears DeletedAt and
+	// increments the version. Only deleted entities are found.
+	Restore(ctx context.Context, id string, version int64) (*domain.Entity, error)
+
+	// Purge permanently removes the entities deleted before deletedBefore, in
+	// every tenant, and returns how many it removed.
+	Purge(ctx context.Context, deletedBefore time.Time) (int64, error)
+
+	// List returns at most opts.Limit entities matching the filters in opts,
+	// including opts.Deleted, sorted by opts.SortBy then ID, starting after opts.After.
+	// opts.Cursor is ignored; the service decodes it into opts.After.
+	List(ctx context.Context, opts domain.EntityListOptions) ([]*domain.Entity, error)
+
+	// Lock locks the entities with the given IDs, whether they exist or not,
+	// until the unit of work ends; outside a unit of work, it does nothing.
+	// A unit of work that reaches several entities locks them all at once,
+	// before it reads them, so that it cannot deadlock with another unit of
+	// work that reaches them in another order.
+	Lock(ctx context.Context, ids ...string) error
+}
+
+// OutboxRepository stores the domain events waiting to be published. Events
+// are added in the unit of work of the change they describe, so that they are
+// stored if and only if the change is.
+type OutboxRepository interface {
+	// Add stores messages to be published.
+	Add(ctx context.Context, messages []*domain.EventMessage) error
+
+	// Pending returns at most limit messages that are not published yet,
+	// in the order they were added.
+	Pending(ctx context.Context, limit int) ([]*domain.EventMessage, error)
+
+	// MarkPublished removes the messages with the given IDs from the outbox.
+	// Unknown IDs are ignored.
+	MarkPublished(ctx context.Context, ids []string) error
+}
+
+// AuditRepository stores the audit log of entities. Entries are never
+// changed or removed once added.
+type AuditRepository interface {
+	// Add appends entries to the log.
+	Add(ctx context.Context, entries []*domain.AuditEntry) error
+
+	// List returns at most opts.Limit entries of the entity opts.EntityID,
+	// in the order they were added, starting after the entry whose ID is
+	// opts.Cursor, or from the first one if it is empty.
+	List(ctx context.Context, opts domain.AuditListOptions) ([]*domain.AuditEntry, error)
+}
+
+// Authorizer decides what principals may do to entities.
+type Authorizer interface {
+	// Authorize returns an apperror.ErrForbidden error if principal may not
+	// perform action on entity. For ActionCreate, entity is the entity to
+	// create; for ActionPurge and ActionManageWebhooks, it is nil.
+	Authorize(principal domain.Principal, action Action, entity *domain.Entity) error
+
+	// ListScope returns the owner whose entities principal may list, or an
+	// empty string if principal may list every entity. It returns an
+	// apperror.ErrForbidden error if principal may not list entities at all.
+	ListScope(principal domain.Principal) (ownerID string, err error)
+}
+
+// WebhookRepository defines the contract for data persistence operations for webhooks.
+type WebhookRepository interface {
+	// Create stores a new webhook.
+	Create(ctx context.Context, webhook *domain.Webhook) error
+
+	// FindByID returns the webhook with the given ID.
+	FindByID(ctx context.Context, id string) (*domain.Webhook, error)
+
+	// List returns every webhook, in the order they were created.
+	List(ctx context.Context) ([]*domain.Webhook, error)
+
+	// Delete removes the webhook with the given ID.
 	Delete(ctx context.Context, id string) error
-	List(ctx context.Context) ([]*domain.Entity, error)
 }
 
+// DeliveryRepository defines the contract for data persistence operations for
+// webhook deliveries, including their attempt logs.
+type DeliveryRepository interface {
+	// Add stores new deliveries. Deliveries whose ID is already stored are
+	// skipped, so that an event published twice is only delivered once.
+	Add(ctx context.Context, deliveries []*domain.WebhookDelivery) error
+
+	// FindByID returns the delivery with the given ID.
+	FindByID(ctx context.Context, id string) (*domain.WebhookDelivery, error)
+
+	// Update replaces the stored delivery.
+	Update(ctx context.Context, delivery *domain.WebhookDelivery) error
+
+	// Due returns at most limit pending deliveries whose next attempt is not
+	// after now, the earliest first.
+	Due(ctx context.Context, now time.Time, limit int) ([]*domain.WebhookDelivery, error)
+
+	// List returns at most opts.Limit deliveries matching the filters in opts,
+	// the most recently created first.
+	List(ctx context.Context, opts domain.DeliveryListOptions) ([]*domain.WebhookDelivery, error)
+}
+
+// APIKeyRepository defines the contract for data persistence operations for
+// API keys, which are found by the hash of the key.
+type APIKeyRepository interface {
+	// Create stores a new API key. It returns apperror.ErrConflict if a key
+	// with the same ID or hash is already stored.
+	Create(ctx context.Context, key *domain.APIKey) error
+
+	// FindByID returns the API key with the given ID.
+	FindByID(ctx context.Context, id string) (*domain.APIKey, error)
+
+	// FindByHash returns the API key with the given hash.
+	FindByHash(ctx context.Context, hash string) (*domain.APIKey, error)
+
+	// List returns the API keys of ownerID, or every key if it is empty, in
+	// the order they were created. Revoked keys are included.
+	List(ctx context.Context, ownerID string) ([]*domain.APIKey, error)
+
+	// Revoke sets RevokedAt of the API key to at, unless it is already
+	// revoked, and returns the stored key.
+	Revoke(ctx context.Context, id string, at time.Time) (*domain.APIKey, error)
+
+	// Touch sets LastUsedAt of the API key to at, unless it is already later.
+	Touch(ctx context.Context, id string, at time.Time) error
+}
+
+// Repositories are the repositories that take part in a unit of work.
+type Repositories struct {
+	Entities EntityRepository
+	Outbox   OutboxRepository
+	Audit    AuditRepository
+}
+
+// UnitOfWork runs business operations that span several repository calls atomically.
+type UnitOfWork interface {
+	// Do runs fn with repositories whose calls all belong to one transaction.
+	// The transaction is committed if fn returns nil, and rolled back if it
+	// returns an error or panics; Do returns the error of fn as is.
+	// The repositories must not be used after fn returns. Inside fn, other
+	// repositories of the same store may block until Do returns.
+	Do(ctx context.Context, fn func(repos Repositories) error) error
+}
+
+// EventPublisher delivers domain events to other systems.
+// Implementations must be safe for concurrent use.
+type EventPublisher interface {
+	// Publish delivers message. Delivery is at least once: Publish may be
+	// called again with a message that it already delivered.
+	Publish(ctx context.Context, message *domain.EventMessage) error
+}
+
+// WebhookSender sends event deliveries to webhook endpoints.
+// Implementations must be safe for concurrent use.
+type WebhookSender interface {
+	// Send POSTs the event of delivery to the URL of webhook, signed with its
+	// secret. It returns the status code of the response, or zero if there was
+	// none, and an error unless the status is 2xx.
+	Send(ctx context.Context, webhook *domain.Webhook, delivery *domain.WebhookDelivery) (int, error)
+}
+
+// EntityPatch applies a partial update to the current state of an entity.
+// It may be called more than once, each time with a fresh copy of the stored
+// entity, and must only change the fields it patches.
+type EntityPatch func(entity *domain.Entity) error
+
 // EntityService defines the contract for business logic operations for Entities.
 type EntityService interface {
 	Create(ctx context.Context, entity *domain.Entity) error
 	GetByID(ctx context.Context, id string) (*domain.Entity, error)
 	Update(ctx context.Context, entity *domain.Entity) error
+
+	// Patch applies patch to the stored entity and updates it with the result.
+	// A non-zero version must match the stored one.
+	Patch(ctx context.Context, id string, version int64, patch EntityPatch) (*domain.Entity, error)
+
+	Delete(ctx context.Context, id string, version int64) error
+
+	// Batch validates and applies ops in order, and returns one error per
+	// operation, nil for those that succeeded. If atomic is set, either every
+	// operation is applied or none is, and the operations that did not fail
+	// report apperror.ErrAborted.
+	Batch(ctx context.Context, ops []domain.EntityOperation, atomic bool) ([]error, error)
+
+	// Restore takes a deleted entity out of the trash.
+	// A non-zero version must match the stored one.
+	Restore(ctx context.Context, id string, version int64) (*domain.Entity, error)
+
+	// PurgeDeleted permanently removes the entities deleted more than retention
+	// ago, and returns how many it removed.
+	PurgeDeleted(ctx context.Context, retention time.Duration) (int64, error)
+
+	List(ctx context.Context, opts domain.EntityListOptions) (*domain.EntityPage, error)
+
+	// History returns a page of the audit log of an entity, oldest first.
+	// The log outlives the entity, so deleted and purged entities have one too.
+	History(ctx context.Context, opts domain.AuditListOptions) (*domain.AuditPage, error)
+}
+
+// EventRelay publishes the events of the outbox.
+type EventRelay interface {
+	// Relay publishes at most limit pending events, in order, and returns how
+	// many it published. It stops at the first event that fails to publish, so
+	// that it is retried before the events after it.
+	Relay(ctx context.Context, limit int) (int, error)
+}
+
+// WebhookService defines the contract for business logic operations for
+// webhooks and their deliveries.
+//
+// It is an EventPublisher: publishing an event schedules its delivery to every
+// webhook that subscribes to it.
+type WebhookService interface {
+	EventPublisher
+
+	// Create registers a webhook. It sets the ID and generates the secret.
+	Create(ctx context.Context, webhook *domain.Webhook) error
+	GetByID(ctx context.Context, id string) (*domain.Webhook, error)
+	List(ctx context.Context) ([]*domain.Webhook, error)
+
+	// Delete removes a webhook. Its pending deliveries are dead-lettered when
+	// they come due.
 	Delete(ctx context.Context, id string) error
-	List(ctx context.Context) ([]*domain.Entity, error)
+
+	// ListDeliveries returns the deliveries matching opts, with their attempts.
+	// Deliveries with the domain.DeliveryDead status make up the dead-letter list.
+	ListDeliveries(ctx context.Context, opts domain.DeliveryListOptions) ([]*domain.WebhookDelivery, error)
+
+	// RetryDelivery takes a dead-lettered delivery out of the dead-letter list
+	// and schedules it immediately, with a new series of attempts.
+	RetryDelivery(ctx context.Context, id string) (*domain.WebhookDelivery, error)
+
+	// Deliver attempts at most limit deliveries that are due, and returns how
+	// many it attempted. Failed deliveries are retried with exponential
+	// backoff, and dead-lettered once they run out of attempts.
+	Deliver(ctx context.Context, limit int) (int, error)
+}
+
+// APIKeyService defines the contract for business logic operations for API keys.
+//
+// Keys are managed by the principals who create them, and by admins. Requests
+// authenticated with a key cannot manage keys.
+type APIKeyService interface {
+	// Create mints an API key for the principal of ctx, with the name and the
+	// scopes of key, which must be roles of the principal. It sets the other
+	// fields of key and returns the key itself, which is not stored and
+	// cannot be retrieved again.
+	Create(ctx context.Context, key *domain.APIKey) (string, error)
+	GetByID(ctx context.Context, id string) (*domain.APIKey, error)
+
+	// List returns the API keys of the principal of ctx, or every key for
+	// admins, revoked ones included.
+	List(ctx context.Context) ([]*domain.APIKey, error)
+
+	// Revoke revokes an API key for good. Revoking a revoked key changes nothing.
+	Revoke(ctx context.Context, id string) (*domain.APIKey, error)
+
+	// Verify returns the principal authenticated by key, with the scopes of
+	// the key as roles, and records that the key was used. It returns an
+	// apperror.ErrUnauthenticated error if the key is unknown or revoked.
+	Verify(ctx context.Context, key string) (domain.Principal, error)
 }
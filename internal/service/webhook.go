@@ -0,0 +1,327 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/apperror"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+
+	"github.com/google/uuid"
+)
+
+// webhookSecretPrefix marks webhook secrets, so that they are easy to recognize.
+const webhookSecretPrefix = "whsec_"
+
+// WebhookRetryPolicy sets how failed webhook deliveries are retried.
+type WebhookRetryPolicy struct {
+	// MaxAttempts is the number of attempts after which a failing delivery is
+	// dead-lettered.
+	MaxAttempts int
+
+	// BaseDelay is the delay after the first failed attempt. It doubles after
+	// every other one, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// DefaultWebhookRetryPolicy gives up on a delivery after about three hours.
+var DefaultWebhookRetryPolicy = WebhookRetryPolicy{
+	MaxAttempts: 10,
+	BaseDelay:   30 * time.Second,
+	MaxDelay:    time.Hour,
+}
+
+// delay returns how long to wait after the given number of failed attempts in a row.
+func (p WebhookRetryPolicy) delay(failures int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// webhookService is a concrete implementation of the WebhookService interface.
+type webhookService struct {
+	webhooks   WebhookRepository
+	deliveries DeliveryRepository
+	sender     WebhookSender
+	retry      WebhookRetryPolicy
+	authz      Authorizer
+}
+
+// NewWebhookService creates a new webhookService instance, which sends the
+// deliveries with sender and retries the failed ones according to retry.
+// Principals manage webhooks if authz grants them ActionManageWebhooks, and
+// webhooks receive the events of the entities that the principal that
+// registered them may read.
+func NewWebhookService(webhooks WebhookRepository, deliveries DeliveryRepository, sender WebhookSender, retry WebhookRetryPolicy, authz Authorizer) WebhookService {
+	return &webhookService{
+		webhooks:   webhooks,
+		deliveries: deliveries,
+		sender:     sender,
+		retry:      retry,
+		authz:      authz,
+	}
+}
+
+// authorize checks that the principal of ctx, if any, may manage webhooks.
+func (s *webhookService) authorize(ctx context.Context) error {
+	principal, ok := PrincipalFrom(ctx)
+	if !ok {
+		return nil
+	}
+	return s.authz.Authorize(principal, ActionManageWebhooks, nil)
+}
+
+// Create registers a new webhook in the tenant of ctx, on behalf of its principal.
+func (s *webhookService) Create(ctx context.Context, webhook *domain.Webhook) error {
+	if err := s.authorize(ctx); err != nil {
+		return fmt.Errorf("service: failed to create webhook: %w", err)
+	}
+	webhook.Normalize()
+	if err := webhook.Validate(); err != nil {
+		return invalidObject(err, "webhook")
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return err
+	}
+	webhook.ID = uuid.New().String()
+	webhook.Secret = secret
+	webhook.TenantID = TenantFrom(ctx)
+	webhook.OwnerID, webhook.OwnerRoles = "", nil
+	if principal, ok := PrincipalFrom(ctx); ok {
+		webhook.OwnerID, webhook.OwnerRoles = principal.ID, slices.Clone(principal.Roles)
+	}
+	webhook.CreatedAt = time.Now().UTC()
+
+	if err := s.webhooks.Create(ctx, webhook); err != nil {
+		return fmt.Errorf("service: failed to create webhook: %w", err)
+	}
+	return nil
+}
+
+// newWebhookSecret returns a random webhook secret.
+func newWebhookSecret() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("service: failed to generate webhook secret: %w", err)
+	}
+	return webhookSecretPrefix + hex.EncodeToString(key), nil
+}
+
+// GetByID retrieves a webhook of the tenant of ctx by its ID.
+func (s *webhookService) GetByID(ctx context.Context, id string) (*domain.Webhook, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, fmt.Errorf("service: failed to find webhook with id %s: %w", id, err)
+	}
+	webhook, err := s.webhooks.FindByID(ctx, id)
+	if err == nil && webhook.TenantID != TenantFrom(ctx) {
+		err = apperror.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to find webhook with id %s: %w", id, err)
+	}
+	return webhook, nil
+}
+
+// List returns every webhook of the tenant of ctx.
+func (s *webhookService) List(ctx context.Context) ([]*domain.Webhook, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, fmt.Errorf("service: failed to list webhooks: %w", err)
+	}
+	webhooks, err := s.webhooks.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to list webhooks: %w", err)
+	}
+	tenantID := TenantFrom(ctx)
+	return slices.DeleteFunc(webhooks, func(webhook *domain.Webhook) bool {
+		return webhook.TenantID != tenantID
+	}), nil
+}
+
+// Delete removes a webhook of the tenant of ctx.
+func (s *webhookService) Delete(ctx context.Context, id string) error {
+	if _, err := s.GetByID(ctx, id); err != nil {
+		return err
+	}
+	if err := s.webhooks.Delete(ctx, id); err != nil {
+		return fmt.Errorf("service: failed to delete webhook with id %s: %w", id, err)
+	}
+	return nil
+}
+
+// ListDeliveries returns the deliveries matching opts, of the events of the
+// tenant of ctx.
+func (s *webhookService) ListDeliveries(ctx context.Context, opts domain.DeliveryListOptions) ([]*domain.WebhookDelivery, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, fmt.Errorf("service: failed to list deliveries: %w", err)
+	}
+	switch {
+	case opts.Limit == 0:
+		opts.Limit = DefaultListLimit
+	case opts.Limit < 0 || opts.Limit > MaxListLimit:
+		return nil, invalidField("invalid_list_options", "limit", "out_of_range", fmt.Sprintf("must be between 1 and %d", MaxListLimit))
+	}
+	switch opts.Status {
+	case "", domain.DeliveryPending, domain.DeliverySucceeded, domain.DeliveryDead:
+	default:
+		return nil, invalidField("invalid_list_options", "status", "invalid", "must be pending, succeeded or dead")
+	}
+
+	opts.TenantID = TenantFrom(ctx)
+	deliveries, err := s.deliveries.List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to list deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// RetryDelivery schedules a dead-lettered delivery of the tenant of ctx again.
+func (s *webhookService) RetryDelivery(ctx context.Context, id string) (*domain.WebhookDelivery, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, fmt.Errorf("service: failed to retry delivery with id %s: %w", id, err)
+	}
+	delivery, err := s.deliveries.FindByID(ctx, id)
+	if err == nil && delivery.Event.TenantID != TenantFrom(ctx) {
+		err = apperror.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to find delivery with id %s: %w", id, err)
+	}
+	if delivery.Status != domain.DeliveryDead {
+		return nil, apperror.New(apperror.ErrConflict, "delivery_not_dead", "only dead-lettered deliveries can be retried").
+			WithMeta("status", string(delivery.Status))
+	}
+
+	now := time.Now().UTC()
+	delivery.Status = domain.DeliveryPending
+	delivery.Failures = 0
+	delivery.NextAttemptAt = now
+	delivery.UpdatedAt = now
+	if err := s.deliveries.Update(ctx, delivery); err != nil {
+		return nil, fmt.Errorf("service: failed to update delivery with id %s: %w", id, err)
+	}
+	return delivery, nil
+}
+
+// Publish schedules the delivery of message to every webhook of its tenant
+// that subscribes to it, and whose owner may read the entity of the message.
+// A delivery is identified by its webhook and event, so publishing the same
+// message again schedules nothing new.
+func (s *webhookService) Publish(ctx context.Context, message *domain.EventMessage) error {
+	webhooks, err := s.webhooks.List(ctx)
+	if err != nil {
+		return fmt.Errorf("service: failed to list webhooks: %w", err)
+	}
+
+	now := time.Now().UTC()
+	var deliveries []*domain.WebhookDelivery
+	for _, webhook := range webhooks {
+		if webhook.TenantID != message.TenantID || !webhook.Subscribes(message.Type) || !s.shows(webhook, message) {
+			continue
+		}
+		deliveries = append(deliveries, &domain.WebhookDelivery{
+			ID:            uuid.NewSHA1(uuid.NameSpaceURL, []byte(webhook.ID+"/"+message.ID)).String(),
+			WebhookID:     webhook.ID,
+			Event:         *message,
+			Status:        domain.DeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	if err := s.deliveries.Add(ctx, deliveries); err != nil {
+		return fmt.Errorf("service: failed to schedule deliveries of event %s: %w", message.ID, err)
+	}
+	return nil
+}
+
+// shows reports whether the owner of webhook may read the entity of message.
+// Webhooks registered without authentication receive every event of their tenant.
+func (s *webhookService) shows(webhook *domain.Webhook, message *domain.EventMessage) bool {
+	if webhook.OwnerID == "" {
+		return true
+	}
+	owner := domain.Principal{ID: webhook.OwnerID, Roles: webhook.OwnerRoles, TenantID: webhook.TenantID}
+	entity := &domain.Entity{ID: message.EntityID, TenantID: message.TenantID, OwnerID: message.OwnerID}
+	return s.authz.Authorize(owner, ActionRead, entity) == nil
+}
+
+// Deliver attempts the deliveries that are due, one at a time.
+func (s *webhookService) Deliver(ctx context.Context, limit int) (int, error) {
+	deliveries, err := s.deliveries.Due(ctx, time.Now().UTC(), limit)
+	if err != nil {
+		return 0, fmt.Errorf("service: failed to read due deliveries: %w", err)
+	}
+
+	for i, delivery := range deliveries {
+		if err := s.deliver(ctx, delivery); err != nil {
+			return i, err
+		}
+	}
+	return len(deliveries), nil
+}
+
+// deliver makes an attempt at delivery and records its outcome.
+func (s *webhookService) deliver(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	webhook, err := s.webhooks.FindByID(ctx, delivery.WebhookID)
+	switch {
+	case errors.Is(err, apperror.ErrNotFound):
+		delivery.Status = domain.DeliveryDead
+		delivery.LastError = "the webhook was deleted"
+	case err != nil:
+		return fmt.Errorf("service: failed to find webhook with id %s: %w", delivery.WebhookID, err)
+	default:
+		start := time.Now()
+		status, sendErr := s.sender.Send(ctx, webhook, delivery)
+		if ctx.Err() != nil {
+			// Shutting down: the attempt was cut short, not failed.
+			return ctx.Err()
+		}
+		s.record(delivery, domain.DeliveryAttempt{
+			At:         start.UTC(),
+			Duration:   time.Since(start),
+			StatusCode: status,
+		}, sendErr)
+	}
+
+	delivery.UpdatedAt = time.Now().UTC()
+	if err := s.deliveries.Update(ctx, delivery); err != nil {
+		return fmt.Errorf("service: failed to update delivery with id %s: %w", delivery.ID, err)
+	}
+	return nil
+}
+
+// record adds attempt to the log of delivery, and moves the delivery to its
+// next state: succeeded, scheduled for a retry, or dead.
+func (s *webhookService) record(delivery *domain.WebhookDelivery, attempt domain.DeliveryAttempt, err error) {
+	if err == nil {
+		delivery.Attempts = append(delivery.Attempts, attempt)
+		delivery.Status = domain.DeliverySucceeded
+		delivery.Failures = 0
+		delivery.LastError = ""
+		return
+	}
+
+	attempt.Error = err.Error()
+	delivery.Attempts = append(delivery.Attempts, attempt)
+	delivery.Failures++
+	delivery.LastError = attempt.Error
+	if delivery.Failures >= s.retry.MaxAttempts {
+		delivery.Status = domain.DeliveryDead
+		return
+	}
+	delivery.NextAttemptAt = attempt.At.Add(attempt.Duration + s.retry.delay(delivery.Failures))
+}
@@ -0,0 +1,463 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/apperror"
+	"github.com/domenicoop/go-clean-architecture-blueprint/internal/domain"
+)
+
+// mockWebhookRepository is a mock implementation of the WebhookRepository interface.
+type mockWebhookRepository struct {
+	CreateFunc   func(ctx context.Context, webhook *domain.Webhook) error
+	FindByIDFunc func(ctx context.Context, id string) (*domain.Webhook, error)
+	ListFunc     func(ctx context.Context) ([]*domain.Webhook, error)
+	DeleteFunc   func(ctx context.Context, id string) error
+}
+
+func (m *mockWebhookRepository) Create(ctx context.Context, webhook *domain.Webhook) error {
+	return m.CreateFunc(ctx, webhook)
+}
+
+func (m *mockWebhookRepository) FindByID(ctx context.Context, id string) (*domain.Webhook, error) {
+	return m.FindByIDFunc(ctx, id)
+}
+
+func (m *mockWebhookRepository) List(ctx context.Context) ([]*domain.Webhook, error) {
+	return m.ListFunc(ctx)
+}
+
+func (m *mockWebhookRepository) Delete(ctx context.Context, id string) error {
+	return m.DeleteFunc(ctx, id)
+}
+
+// mockDeliveryRepository is a mock implementation of the DeliveryRepository interface.
+type mockDeliveryRepository struct {
+	AddFunc      func(ctx context.Context, deliveries []*domain.WebhookDelivery) error
+	FindByIDFunc func(ctx context.Context, id string) (*domain.WebhookDelivery, error)
+	UpdateFunc   func(ctx context.Context, delivery *domain.WebhookDelivery) error
+	DueFunc      func(ctx context.Context, now time.Time, limit int) ([]*domain.WebhookDelivery, error)
+	ListFunc     func(ctx context.Context, opts domain.DeliveryListOptions) ([]*domain.WebhookDelivery, error)
+}
+
+func (m *mockDeliveryRepository) Add(ctx context.Context, deliveries []*domain.WebhookDelivery) error {
+	return m.AddFunc(ctx, deliveries)
+}
+
+func (m *mockDeliveryRepository) FindByID(ctx context.Context, id string) (*domain.WebhookDelivery, error) {
+	return m.FindByIDFunc(ctx, id)
+}
+
+func (m *mockDeliveryRepository) Update(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	return m.UpdateFunc(ctx, delivery)
+}
+
+func (m *mockDeliveryRepository) Due(ctx context.Context, now time.Time, limit int) ([]*domain.WebhookDelivery, error) {
+	return m.DueFunc(ctx, now, limit)
+}
+
+func (m *mockDeliveryRepository) List(ctx context.Context, opts domain.DeliveryListOptions) ([]*domain.WebhookDelivery, error) {
+	return m.ListFunc(ctx, opts)
+}
+
+// mockWebhookSender is a mock implementation of the WebhookSender interface.
+type mockWebhookSender struct {
+	SendFunc func(ctx context.Context, webhook *domain.Webhook, delivery *domain.WebhookDelivery) (int, error)
+}
+
+func (m *mockWebhookSender) Send(ctx context.Context, webhook *domain.Webhook, delivery *domain.WebhookDelivery) (int, error) {
+	return m.SendFunc(ctx, webhook, delivery)
+}
+
+func TestWebhookService(t *testing.T) {
+	mockWebhooks := &mockWebhookRepository{}
+	mockDeliveries := &mockDeliveryRepository{}
+	mockSender := &mockWebhookSender{}
+	retry := WebhookRetryPolicy{MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Hour}
+	svc := NewWebhookService(mockWebhooks, mockDeliveries, mockSender, retry, NewRoleAuthorizer())
+	ctx := context.Background()
+
+	webhook := &domain.Webhook{ID: "w1", URL: "https://example.com/hooks", Secret: "whsec_test"}
+	mockWebhooks.FindByIDFunc = func(ctx context.Context, id string) (*domain.Webhook, error) {
+		if id != "w1" {
+			return nil, apperror.ErrNotFound
+		}
+		return webhook, nil
+	}
+
+	// deliver runs Deliver on delivery, and returns it as updated.
+	deliver := func(t *testing.T, delivery *domain.WebhookDelivery) *domain.WebhookDelivery {
+		t.Helper()
+
+		mockDeliveries.DueFunc = func(ctx context.Context, now time.Time, limit int) ([]*domain.WebhookDelivery, error) {
+			return []*domain.WebhookDelivery{delivery}, nil
+		}
+		var updated *domain.WebhookDelivery
+		mockDeliveries.UpdateFunc = func(ctx context.Context, delivery *domain.WebhookDelivery) error {
+			updated = delivery
+			return nil
+		}
+
+		n, err := svc.Deliver(ctx, 10)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if n != 1 || updated == nil {
+			t.Fatalf("expected the delivery to be attempted and updated, got %d attempted", n)
+		}
+		return updated
+	}
+
+	t.Run("Create", func(t *testing.T) {
+		var stored *domain.Webhook
+		mockWebhooks.CreateFunc = func(ctx context.Context, webhook *domain.Webhook) error {
+			stored = webhook
+			return nil
+		}
+
+		created := &domain.Webhook{URL: " https://example.com/hooks ", EventTypes: []domain.EventType{domain.EventEntityCreated}}
+		if err := svc.Create(ctx, created); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if stored != created || created.ID == "" || created.URL != "https://example.com/hooks" || created.CreatedAt.IsZero() {
+			t.Errorf("expected the normalized webhook to be stored with an ID, got %+v", stored)
+		}
+		if !strings.HasPrefix(created.Secret, webhookSecretPrefix) || len(created.Secret) != len(webhookSecretPrefix)+64 {
+			t.Errorf("expected a generated secret, got %q", created.Secret)
+		}
+	})
+
+	t.Run("Create invalid", func(t *testing.T) {
+		mockWebhooks.CreateFunc = func(ctx context.Context, webhook *domain.Webhook) error {
+			t.Error("expected an invalid webhook not to be stored")
+			return nil
+		}
+
+		err := svc.Create(ctx, &domain.Webhook{URL: "ftp://example.com"})
+		var appErr *apperror.Error
+		if !errors.As(err, &appErr) || !errors.Is(err, apperror.ErrInvalidInput) || appErr.Code != "invalid_webhook" {
+			t.Errorf("expected an invalid_webhook error, got %v", err)
+		}
+	})
+
+	t.Run("Authorization", func(t *testing.T) {
+		mockWebhooks.CreateFunc = func(ctx context.Context, webhook *domain.Webhook) error {
+			return nil
+		}
+		mockWebhooks.ListFunc = func(ctx context.Context) ([]*domain.Webhook, error) {
+			return nil, nil
+		}
+		mockWebhooks.DeleteFunc = func(ctx context.Context, id string) error {
+			return nil
+		}
+		mockDeliveries.ListFunc = func(ctx context.Context, opts domain.DeliveryListOptions) ([]*domain.WebhookDelivery, error) {
+			return nil, nil
+		}
+		mockDeliveries.FindByIDFunc = func(ctx context.Context, id string) (*domain.WebhookDelivery, error) {
+			return &domain.WebhookDelivery{ID: id, Status: domain.DeliveryDead}, nil
+		}
+		mockDeliveries.UpdateFunc = func(ctx context.Context, delivery *domain.WebhookDelivery) error {
+			return nil
+		}
+
+		// manage runs every operation that manages webhooks, and returns their errors.
+		manage := func(ctx context.Context) []error {
+			_, getErr := svc.GetByID(ctx, "w1")
+			_, listErr := svc.List(ctx)
+			_, listDeliveriesErr := svc.ListDeliveries(ctx, domain.DeliveryListOptions{})
+			_, retryErr := svc.RetryDelivery(ctx, "d1")
+			return []error{
+				svc.Create(ctx, &domain.Webhook{URL: "https://example.com/hooks"}),
+				getErr,
+				listErr,
+				svc.Delete(ctx, "w1"),
+				listDeliveriesErr,
+				retryErr,
+			}
+		}
+
+		tests := []struct {
+			name  string
+			roles []domain.Role
+		}{
+			{"reader", []domain.Role{domain.RoleReader}},
+			{"editor", []domain.Role{domain.RoleEditor}},
+			{"no role", nil},
+		}
+		for _, tt := range tests {
+			ctx := WithPrincipal(ctx, domain.Principal{ID: "alice", Roles: tt.roles})
+			for i, err := range manage(ctx) {
+				if !errors.Is(err, apperror.ErrForbidden) {
+					t.Errorf("%s: expected ErrForbidden for operation %d, got %v", tt.name, i, err)
+				}
+			}
+		}
+
+		admin := WithPrincipal(ctx, domain.Principal{ID: "root", Roles: []domain.Role{domain.RoleAdmin}})
+		for i, err := range manage(admin) {
+			if err != nil {
+				t.Errorf("admin: expected no error for operation %d, got %v", i, err)
+			}
+		}
+
+		created := &domain.Webhook{URL: "https://example.com/hooks"}
+		if err := svc.Create(admin, created); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if created.OwnerID != "root" || !slices.Equal(created.OwnerRoles, []domain.Role{domain.RoleAdmin}) {
+			t.Errorf("expected the webhook to be owned by root as an admin, got %q with %v", created.OwnerID, created.OwnerRoles)
+		}
+	})
+
+	t.Run("Publish by owner", func(t *testing.T) {
+		mockWebhooks.ListFunc = func(ctx context.Context) ([]*domain.Webhook, error) {
+			return []*domain.Webhook{
+				{ID: "w1", OwnerID: "alice", OwnerRoles: []domain.Role{domain.RoleEditor}},
+				{ID: "w2", OwnerID: "bob", OwnerRoles: []domain.Role{domain.RoleReader}},
+				{ID: "w3"},
+				{ID: "w4", OwnerID: "carol"},
+			}, nil
+		}
+		var added []string
+		mockDeliveries.AddFunc = func(ctx context.Context, deliveries []*domain.WebhookDelivery) error {
+			for _, d := range deliveries {
+				added = append(added, d.WebhookID)
+			}
+			return nil
+		}
+
+		tests := []struct {
+			owner string
+			want  []string
+		}{
+			{"alice", []string{"w1", "w2", "w3"}},
+			{"bob", []string{"w2", "w3"}},
+		}
+		for _, tt := range tests {
+			added = nil
+			message := &domain.EventMessage{ID: "e1", Type: domain.EventEntityCreated, EntityID: "1", OwnerID: tt.owner}
+			if err := svc.Publish(ctx, message); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if !slices.Equal(added, tt.want) {
+				t.Errorf("expected the event of %s to be delivered to %v, got %v", tt.owner, tt.want, added)
+			}
+		}
+	})
+
+	t.Run("Publish", func(t *testing.T) {
+		mockWebhooks.ListFunc = func(ctx context.Context) ([]*domain.Webhook, error) {
+			return []*domain.Webhook{
+				{ID: "w1"},
+				{ID: "w2", EventTypes: []domain.EventType{domain.EventEntityDeleted}},
+				{ID: "w3", EventTypes: []domain.EventType{domain.EventEntityCreated}},
+			}, nil
+		}
+		var added []*domain.WebhookDelivery
+		mockDeliveries.AddFunc = func(ctx context.Context, deliveries []*domain.WebhookDelivery) error {
+			added = append(added, deliveries...)
+			return nil
+		}
+
+		message := &domain.EventMessage{ID: "e1", Type: domain.EventEntityCreated, EntityID: "1"}
+		for range 2 {
+			if err := svc.Publish(ctx, message); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		}
+
+		if len(added) != 4 {
+			t.Fatalf("expected a delivery per subscribed webhook and publish, got %d", len(added))
+		}
+		if added[0].WebhookID != "w1" || added[1].WebhookID != "w3" || added[0].Event.ID != "e1" ||
+			added[0].Status != domain.DeliveryPending || added[0].NextAttemptAt.IsZero() {
+			t.Errorf("expected pending deliveries to w1 and w3, got %+v and %+v", added[0], added[1])
+		}
+		if added[0].ID == added[1].ID || added[0].ID != added[2].ID || added[1].ID != added[3].ID {
+			t.Errorf("expected the delivery IDs to depend on the webhook and event only, got %v", deliveryIDs(added))
+		}
+	})
+
+	t.Run("Deliver", func(t *testing.T) {
+		mockSender.SendFunc = func(ctx context.Context, w *domain.Webhook, delivery *domain.WebhookDelivery) (int, error) {
+			if w != webhook || delivery.ID != "d1" {
+				t.Errorf("expected d1 to be sent to w1, got %s to %s", delivery.ID, w.ID)
+			}
+			return 204, nil
+		}
+
+		updated := deliver(t, &domain.WebhookDelivery{ID: "d1", WebhookID: "w1", Status: domain.DeliveryPending, Failures: 1, LastError: "timeout"})
+		if updated.Status != domain.DeliverySucceeded || updated.Failures != 0 || updated.LastError != "" {
+			t.Errorf("expected the delivery to succeed, got %+v", updated)
+		}
+		if len(updated.Attempts) != 1 || updated.Attempts[0].StatusCode != 204 || updated.Attempts[0].Error != "" {
+			t.Errorf("expected the attempt to be logged, got %+v", updated.Attempts)
+		}
+	})
+
+	t.Run("Deliver failure", func(t *testing.T) {
+		mockSender.SendFunc = func(ctx context.Context, w *domain.Webhook, delivery *domain.WebhookDelivery) (int, error) {
+			return 503, errors.New("status 503")
+		}
+
+		updated := deliver(t, &domain.WebhookDelivery{ID: "d1", WebhookID: "w1", Status: domain.DeliveryPending, Failures: 1})
+		if updated.Status != domain.DeliveryPending || updated.Failures != 2 || updated.LastError != "status 503" {
+			t.Errorf("expected the delivery to be retried, got %+v", updated)
+		}
+		attempt := updated.Attempts[0]
+		if attempt.StatusCode != 503 || attempt.Error != "status 503" {
+			t.Errorf("expected the failed attempt to be logged, got %+v", attempt)
+		}
+		if want := attempt.At.Add(attempt.Duration + 2*time.Minute); !updated.NextAttemptAt.Equal(want) {
+			t.Errorf("expected the next attempt at %s, got %s", want, updated.NextAttemptAt)
+		}
+	})
+
+	t.Run("Deliver out of attempts", func(t *testing.T) {
+		mockSender.SendFunc = func(ctx context.Context, w *domain.Webhook, delivery *domain.WebhookDelivery) (int, error) {
+			return 0, errors.New("connection refused")
+		}
+
+		updated := deliver(t, &domain.WebhookDelivery{ID: "d1", WebhookID: "w1", Status: domain.DeliveryPending, Failures: 2})
+		if updated.Status != domain.DeliveryDead || updated.Failures != 3 || updated.LastError != "connection refused" {
+			t.Errorf("expected the delivery to be dead-lettered, got %+v", updated)
+		}
+	})
+
+	t.Run("Deliver to deleted webhook", func(t *testing.T) {
+		mockSender.SendFunc = func(ctx context.Context, w *domain.Webhook, delivery *domain.WebhookDelivery) (int, error) {
+			t.Error("expected nothing to be sent")
+			return 0, nil
+		}
+
+		updated := deliver(t, &domain.WebhookDelivery{ID: "d1", WebhookID: "deleted", Status: domain.DeliveryPending})
+		if updated.Status != domain.DeliveryDead || len(updated.Attempts) != 0 || updated.LastError == "" {
+			t.Errorf("expected the delivery to be dead-lettered without an attempt, got %+v", updated)
+		}
+	})
+
+	t.Run("RetryDelivery", func(t *testing.T) {
+		stored := &domain.WebhookDelivery{ID: "d1", Status: domain.DeliveryDead, Failures: 3, Attempts: make([]domain.DeliveryAttempt, 3)}
+		mockDeliveries.FindByIDFunc = func(ctx context.Context, id string) (*domain.WebhookDelivery, error) {
+			return stored, nil
+		}
+		mockDeliveries.UpdateFunc = func(ctx context.Context, delivery *domain.WebhookDelivery) error {
+			return nil
+		}
+
+		delivery, err := svc.RetryDelivery(ctx, "d1")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if delivery.Status != domain.DeliveryPending || delivery.Failures != 0 || len(delivery.Attempts) != 3 ||
+			delivery.NextAttemptAt.After(time.Now()) {
+			t.Errorf("expected the delivery to be due again with its attempt log, got %+v", delivery)
+		}
+
+		if _, err := svc.RetryDelivery(ctx, "d1"); !errors.Is(err, apperror.ErrConflict) {
+			t.Errorf("expected ErrConflict for a pending delivery, got %v", err)
+		}
+	})
+
+	t.Run("Tenant isolation", func(t *testing.T) {
+		acme := WithTenant(ctx, "acme")
+		webhooks := []*domain.Webhook{{ID: "w1"}, {ID: "w2", TenantID: "acme"}}
+		mockWebhooks.ListFunc = func(ctx context.Context) ([]*domain.Webhook, error) {
+			return slices.Clone(webhooks), nil
+		}
+		mockWebhooks.FindByIDFunc = func(ctx context.Context, id string) (*domain.Webhook, error) {
+			return webhooks[0], nil
+		}
+		mockWebhooks.DeleteFunc = func(ctx context.Context, id string) error {
+			t.Error("expected the webhook of another tenant not to be deleted")
+			return nil
+		}
+		var added []*domain.WebhookDelivery
+		mockDeliveries.AddFunc = func(ctx context.Context, deliveries []*domain.WebhookDelivery) error {
+			added = append(added, deliveries...)
+			return nil
+		}
+		mockDeliveries.FindByIDFunc = func(ctx context.Context, id string) (*domain.WebhookDelivery, error) {
+			return &domain.WebhookDelivery{ID: id, Status: domain.DeliveryDead}, nil
+		}
+		var listed domain.DeliveryListOptions
+		mockDeliveries.ListFunc = func(ctx context.Context, opts domain.DeliveryListOptions) ([]*domain.WebhookDelivery, error) {
+			listed = opts
+			return nil, nil
+		}
+
+		found, err := svc.List(acme)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(found) != 1 || found[0].ID != "w2" {
+			t.Errorf("expected only the webhook of acme, got %v", found)
+		}
+		if _, err := svc.GetByID(acme, "w1"); !errors.Is(err, apperror.ErrNotFound) {
+			t.Errorf("expected ErrNotFound for the webhook of another tenant, got %v", err)
+		}
+		if err := svc.Delete(acme, "w1"); !errors.Is(err, apperror.ErrNotFound) {
+			t.Errorf("expected ErrNotFound for the webhook of another tenant, got %v", err)
+		}
+		if _, err := svc.RetryDelivery(acme, "d1"); !errors.Is(err, apperror.ErrNotFound) {
+			t.Errorf("expected ErrNotFound for the delivery of another tenant, got %v", err)
+		}
+		if _, err := svc.ListDeliveries(acme, domain.DeliveryListOptions{}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if listed.TenantID != "acme" {
+			t.Errorf("expected the deliveries of acme to be listed, got %+v", listed)
+		}
+
+		if err := svc.Publish(ctx, &domain.EventMessage{ID: "e1", Type: domain.EventEntityCreated, TenantID: "acme"}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(added) != 1 || added[0].WebhookID != "w2" {
+			t.Errorf("expected the event of acme to be delivered to its webhook only, got %v", deliveryIDs(added))
+		}
+	})
+
+	t.Run("ListDeliveries", func(t *testing.T) {
+		mockDeliveries.ListFunc = func(ctx context.Context, opts domain.DeliveryListOptions) ([]*domain.WebhookDelivery, error) {
+			if opts.Limit != DefaultListLimit || opts.Status != domain.DeliveryDead {
+				t.Errorf("expected the default limit and the dead status, got %+v", opts)
+			}
+			return nil, nil
+		}
+
+		if _, err := svc.ListDeliveries(ctx, domain.DeliveryListOptions{Status: domain.DeliveryDead}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := svc.ListDeliveries(ctx, domain.DeliveryListOptions{Limit: MaxListLimit + 1}); !errors.Is(err, apperror.ErrInvalidInput) {
+			t.Errorf("expected ErrInvalidInput for a large limit, got %v", err)
+		}
+		if _, err := svc.ListDeliveries(ctx, domain.DeliveryListOptions{Status: "lost"}); !errors.Is(err, apperror.ErrInvalidInput) {
+			t.Errorf("expected ErrInvalidInput for an unknown status, got %v", err)
+		}
+	})
+}
+
+func TestWebhookRetryPolicy(t *testing.T) {
+	policy := WebhookRetryPolicy{MaxAttempts: 10, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i, delay := range want {
+		if got := policy.delay(i + 1); got != delay {
+			t.Errorf("expected a delay of %s after %d failures, got %s", delay, i+1, got)
+		}
+	}
+}
+
+// deliveryIDs returns the IDs of the given deliveries, in order.
+func deliveryIDs(deliveries []*domain.WebhookDelivery) []string {
+	ids := make([]string, len(deliveries))
+	for i, d := range deliveries {
+		ids[i] = d.ID
+	}
+	return ids
+}